@@ -0,0 +1,122 @@
+package delivery
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwa0x2/SmartSRT-Backend/domain"
+	"github.com/kwa0x2/SmartSRT-Backend/utils"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+type APIKeyDelivery struct {
+	APIKeyUseCase domain.APIKeyUseCase
+}
+
+func (ad *APIKeyDelivery) Create(ctx *gin.Context) {
+	userData, org, ok := ad.requireKeyManager(ctx)
+	if !ok {
+		return
+	}
+
+	var body domain.CreateAPIKeyBody
+	if err := ctx.ShouldBindJSON(&body); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("Invalid request body. Please check your input."))
+		return
+	}
+
+	for _, scope := range body.Scopes {
+		if !scope.IsValid() {
+			ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("Invalid scope: "+string(scope)))
+			return
+		}
+	}
+
+	apiKey, rawKey, err := ad.APIKeyUseCase.Create(userData, org, body.Name, body.Scopes, body.Sandbox)
+	if err != nil {
+		slog.Error("Failed to create API key",
+			slog.String("action", "api_key_create"),
+			slog.String("user_id", userData.ID.Hex()),
+			slog.String("error", err.Error()))
+		ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	// the plaintext key is only ever returned here
+	ctx.JSON(http.StatusCreated, gin.H{
+		"api_key": apiKey,
+		"key":     rawKey,
+	})
+}
+
+func (ad *APIKeyDelivery) FindAll(ctx *gin.Context) {
+	userData, org, ok := ad.requireKeyManager(ctx)
+	if !ok {
+		return
+	}
+
+	apiKeys, err := ad.APIKeyUseCase.FindAll(userData, org)
+	if err != nil {
+		if !utils.IsNormalBusinessError(err) {
+			slog.Error("Failed to lookup API keys",
+				slog.String("action", "api_key_list"),
+				slog.String("user_id", userData.ID.Hex()),
+				slog.String("error", err.Error()))
+		}
+		ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred while retrieving API keys. Please try again later or contact support."))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, apiKeys)
+}
+
+func (ad *APIKeyDelivery) Revoke(ctx *gin.Context) {
+	userData, org, ok := ad.requireKeyManager(ctx)
+	if !ok {
+		return
+	}
+
+	keyID, err := bson.ObjectIDFromHex(ctx.Param("keyID"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("Invalid API key ID."))
+		return
+	}
+
+	if err = ad.APIKeyUseCase.Revoke(userData, org, keyID); err != nil {
+		if errors.Is(err, utils.ErrAPIKeyInvalid) {
+			ctx.JSON(http.StatusNotFound, utils.NewMessageResponse("API key not found."))
+			return
+		}
+		slog.Error("Failed to revoke API key",
+			slog.String("action", "api_key_revoke"),
+			slog.String("user_id", userData.ID.Hex()),
+			slog.String("api_key_id", keyID.Hex()),
+			slog.String("error", err.Error()))
+		ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.NewMessageResponse("API key revoked."))
+}
+
+// requireKeyManager returns the session user and active organization. Keys of an
+// organization can only be managed by its owners and admins.
+func (ad *APIKeyDelivery) requireKeyManager(ctx *gin.Context) (*domain.User, *domain.Organization, bool) {
+	user, exists := ctx.Get("user")
+	if !exists {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return nil, nil, false
+	}
+
+	org := utils.GetActiveOrganization(ctx)
+	if org != nil {
+		if membership := utils.GetMembership(ctx); membership == nil || !membership.Role.CanManageMembers() {
+			ctx.JSON(http.StatusForbidden, utils.NewMessageResponse("Only organization owners and admins can manage API keys."))
+			return nil, nil, false
+		}
+	}
+
+	return user.(*domain.User), org, true
+}
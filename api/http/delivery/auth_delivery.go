@@ -7,13 +7,15 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
-	"sync"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
 	"github.com/go-resty/resty/v2"
-	"github.com/google/uuid"
+	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/kwa0x2/SmartSRT-Backend/bootstrap"
 	"github.com/kwa0x2/SmartSRT-Backend/config"
 	"github.com/kwa0x2/SmartSRT-Backend/domain"
@@ -21,44 +23,66 @@ import (
 	"github.com/kwa0x2/SmartSRT-Backend/utils"
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
+	"golang.org/x/oauth2"
 )
 
 type AuthDelivery struct {
-	Env            *config.Env
-	UserUseCase    domain.UserUseCase
-	SessionUseCase domain.SessionUseCase
-	SinchUseCase   domain.SinchUseCase
-	ResendUseCase  domain.ResendUseCase
-	PaddleUseCase  domain.PaddleUseCase
+	Env                 *config.Env
+	UserUseCase         domain.UserUseCase
+	SessionUseCase      domain.SessionUseCase
+	SinchUseCase        domain.SinchUseCase
+	ResendUseCase       domain.ResendUseCase
+	PaddleUseCase       domain.PaddleUseCase
+	OrganizationUseCase domain.OrganizationUseCase
+	AvatarUseCase       domain.AvatarUseCase
+	IdentityUseCase     domain.IdentityUseCase
+	OAuthStateUseCase   domain.OAuthStateUseCase
+	TwoFactorUseCase    domain.TwoFactorUseCase
+	PasskeyUseCase      domain.PasskeyUseCase
 }
 
-var (
-	stateStore = sync.Map{}
-)
-
+// GoogleLogin starts signing in with Google. An optional redirect query parameter names the
+// frontend path to continue at, see utils.SafeRedirectPath.
 func (ad *AuthDelivery) GoogleLogin(ctx *gin.Context) {
-	googleConfig := bootstrap.GoogleConfig(ad.Env)
-	state := uuid.New().String()
-	stateStore.Store(state, state)
-	url := googleConfig.AuthCodeURL(state)
-	ctx.Redirect(http.StatusTemporaryRedirect, url)
+	flow := &domain.OAuthState{
+		Provider:     types.Google,
+		RedirectPath: utils.SafeRedirectPath(ctx.Query("redirect")),
+	}
+	ad.startOAuth(ctx, bootstrap.GoogleConfig(ad.Env), flow, ad.loginRedirect(ctx.GetString("locale")))
+}
+
+func (ad *AuthDelivery) GoogleLink(ctx *gin.Context) {
+	user, exists := ctx.Get("user")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, utils.NewMessageResponse("Unauthorized. Please log in and try again."))
+		return
+	}
+
+	userID := user.(*domain.User).ID
+	flow := &domain.OAuthState{
+		Provider:   types.Google,
+		LinkUserID: &userID,
+	}
+	ad.startOAuth(ctx, bootstrap.GoogleConfig(ad.Env), flow, ad.settingsRedirect(ctx.GetString("locale")))
 }
 
 func (ad *AuthDelivery) GoogleCallback(ctx *gin.Context) {
 	code := ctx.Query("code")
-	state := ctx.Query("state")
 	locale := ctx.GetString("locale")
-	loginRedirect := fmt.Sprintf("%s/%s/auth/login", ad.Env.FrontEndURL, locale)
+	loginRedirect := ad.loginRedirect(locale)
 
-	if _, exists := stateStore.Load(state); !exists {
-		utils.SetErrorCookie(ctx, "invalid_state", ad.Env)
-		ctx.Redirect(http.StatusTemporaryRedirect, loginRedirect)
+	flow, ok := ad.consumeOAuth(ctx, types.Google, loginRedirect)
+	if !ok {
 		return
 	}
+	if flow.LinkUserID != nil {
+		// a failed link goes back to the settings it was started from
+		loginRedirect = ad.settingsRedirect(locale)
+	}
 
 	googleConfig := bootstrap.GoogleConfig(ad.Env)
 
-	token, err := googleConfig.Exchange(context.Background(), code)
+	token, err := googleConfig.Exchange(context.Background(), code, oauth2.VerifierOption(flow.CodeVerifier))
 	if err != nil {
 		utils.SetErrorCookie(ctx, "server_error", ad.Env)
 		ctx.Redirect(http.StatusTemporaryRedirect, loginRedirect)
@@ -107,97 +131,67 @@ func (ad *AuthDelivery) GoogleCallback(ctx *gin.Context) {
 		return
 	}
 
-	user, err := ad.UserUseCase.FindOneByEmail(userData["email"].(string))
-	if err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			jwtClaims := jwt.MapClaims{
-				"name":       userData["name"].(string),
-				"email":      userData["email"].(string),
-				"avatar_url": userData["picture"].(string),
-				"auth_type":  types.Google,
-			}
-
-			exp1HourUnix := time.Now().Add(1 * time.Hour).Unix() // 1 hour
-
-			tokenString, tokenErr := utils.GenerateJWT(jwtClaims, ad.Env, exp1HourUnix)
-			if tokenErr != nil {
-				if !utils.IsNormalBusinessError(tokenErr) {
-					slog.Error("Failed to generate JWT for Google auth",
-						slog.String("action", "jwt_generation_google_auth"),
-						slog.String("error", tokenErr.Error()))
-				}
-				utils.SetErrorCookie(ctx, "server_error", ad.Env)
-				ctx.Redirect(http.StatusTemporaryRedirect, loginRedirect)
-				return
-			}
-
-			otpPath := fmt.Sprintf("/%s/auth/otp", ctx.GetString("locale"))
-			utils.SetAuthTokenCookie(ctx, tokenString, otpPath, 3600, ad.Env) // 1 hour
-
-			redirectURL := fmt.Sprintf("%s/%s/auth/otp", ad.Env.FrontEndURL, locale)
-			ctx.Redirect(http.StatusTemporaryRedirect, redirectURL)
-			return
-		} else {
-			if !utils.IsNormalBusinessError(err) {
-				slog.Error("Failed to lookup user during Google auth",
-					slog.String("action", "user_lookup_google_auth"),
-					slog.String("error", err.Error()))
-			}
-			utils.SetErrorCookie(ctx, "server_error", ad.Env)
-			ctx.Redirect(http.StatusTemporaryRedirect, loginRedirect)
-			return
-		}
-	}
-
-	if user.AuthType != types.Google {
-		errorType := fmt.Sprintf("exists_%s", user.AuthType)
-		utils.SetErrorCookie(ctx, errorType, ad.Env)
-		ctx.Redirect(http.StatusTemporaryRedirect, loginRedirect)
-		return
-	}
-
-	sessionID, sessionErr := ad.SessionUseCase.CreateSessionAndUpdateLastLogin(user.ID, user.Plan, user.Email)
-	if sessionErr != nil {
-		if !utils.IsNormalBusinessError(sessionErr) {
-			slog.Error("Failed to create session during Google auth",
-				slog.String("action", "session_creation_google_auth"),
-				slog.String("user_id", user.ID.Hex()),
-				slog.String("error", sessionErr.Error()))
-		}
+	subject, _ := userData["id"].(string)
+	if subject == "" {
+		slog.Error("Google user info has no account ID",
+			slog.String("action", "google_userinfo_missing_id"))
 		utils.SetErrorCookie(ctx, "server_error", ad.Env)
 		ctx.Redirect(http.StatusTemporaryRedirect, loginRedirect)
 		return
 	}
 
-	utils.SetSIDCookie(ctx, sessionID, ad.Env)
+	profile := &domain.OAuthProfile{
+		Provider:  types.Google,
+		Subject:   subject,
+		Email:     userData["email"].(string),
+		Name:      userData["name"].(string),
+		AvatarURL: userData["picture"].(string),
+	}
 
-	redirectURL := fmt.Sprintf("%s/%s/auth/verify", ad.Env.FrontEndURL, locale)
-	ctx.Redirect(http.StatusTemporaryRedirect, redirectURL)
+	ad.completeOAuth(ctx, profile, flow, loginRedirect)
 }
 
+// GitHubLogin starts signing in with GitHub, like GoogleLogin.
 func (ad *AuthDelivery) GitHubLogin(ctx *gin.Context) {
-	githubConfig := bootstrap.GitHubConfig(ad.Env)
-	state := uuid.New().String()
-	stateStore.Store(state, state)
-	url := githubConfig.AuthCodeURL(state)
-	ctx.Redirect(http.StatusTemporaryRedirect, url)
+	flow := &domain.OAuthState{
+		Provider:     types.Github,
+		RedirectPath: utils.SafeRedirectPath(ctx.Query("redirect")),
+	}
+	ad.startOAuth(ctx, bootstrap.GitHubConfig(ad.Env), flow, ad.loginRedirect(ctx.GetString("locale")))
+}
+
+func (ad *AuthDelivery) GitHubLink(ctx *gin.Context) {
+	user, exists := ctx.Get("user")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, utils.NewMessageResponse("Unauthorized. Please log in and try again."))
+		return
+	}
+
+	userID := user.(*domain.User).ID
+	flow := &domain.OAuthState{
+		Provider:   types.Github,
+		LinkUserID: &userID,
+	}
+	ad.startOAuth(ctx, bootstrap.GitHubConfig(ad.Env), flow, ad.settingsRedirect(ctx.GetString("locale")))
 }
 
 func (ad *AuthDelivery) GitHubCallback(ctx *gin.Context) {
 	code := ctx.Query("code")
-	state := ctx.Query("state")
 	locale := ctx.GetString("locale")
-	loginRedirect := fmt.Sprintf("%s/%s/auth/login", ad.Env.FrontEndURL, locale)
+	loginRedirect := ad.loginRedirect(locale)
 
-	if _, exists := stateStore.Load(state); !exists {
-		utils.SetErrorCookie(ctx, "invalid_state", ad.Env)
-		ctx.Redirect(http.StatusTemporaryRedirect, loginRedirect)
+	flow, ok := ad.consumeOAuth(ctx, types.Github, loginRedirect)
+	if !ok {
 		return
 	}
+	if flow.LinkUserID != nil {
+		// a failed link goes back to the settings it was started from
+		loginRedirect = ad.settingsRedirect(locale)
+	}
 
 	githubConfig := bootstrap.GitHubConfig(ad.Env)
 
-	token, err := githubConfig.Exchange(context.Background(), code)
+	token, err := githubConfig.Exchange(context.Background(), code, oauth2.VerifierOption(flow.CodeVerifier))
 	if err != nil {
 		utils.SetErrorCookie(ctx, "server_error", ad.Env)
 		ctx.Redirect(http.StatusTemporaryRedirect, loginRedirect)
@@ -285,79 +279,24 @@ func (ad *AuthDelivery) GitHubCallback(ctx *gin.Context) {
 		return
 	}
 
-	var email string
-	if len(emails) > 0 {
-		email = emails[0]["email"].(string)
-	} else {
-		email = "Email not available"
-	}
-
-	user, err := ad.UserUseCase.FindOneByEmail(email)
-	if err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			jwtClaims := jwt.MapClaims{
-				"name":       userData["name"].(string),
-				"email":      email,
-				"avatar_url": userData["avatar_url"].(string),
-				"auth_type":  types.Github,
-			}
-
-			exp1HourUnix := time.Now().Add(1 * time.Hour).Unix() // 1 hour
-
-			tokenString, tokenErr := utils.GenerateJWT(jwtClaims, ad.Env, exp1HourUnix)
-			if tokenErr != nil {
-				if !utils.IsNormalBusinessError(tokenErr) {
-					slog.Error("Failed to generate JWT for GitHub auth",
-						slog.String("action", "jwt_generation_github_auth"),
-						slog.String("error", tokenErr.Error()))
-				}
-				utils.SetErrorCookie(ctx, "server_error", ad.Env)
-				ctx.Redirect(http.StatusTemporaryRedirect, loginRedirect)
-				return
-			}
-
-			otpPath := fmt.Sprintf("/%s/auth/otp", ctx.GetString("locale"))
-			utils.SetAuthTokenCookie(ctx, tokenString, otpPath, 3600, ad.Env) // 1 hour
-
-			redirectURL := fmt.Sprintf("%s/%s/auth/otp", ad.Env.FrontEndURL, locale)
-			ctx.Redirect(http.StatusTemporaryRedirect, redirectURL)
-			return
-		} else {
-			if !utils.IsNormalBusinessError(err) {
-				slog.Error("Failed to lookup user during GitHub auth",
-					slog.String("action", "user_lookup_github_auth"),
-					slog.String("error", err.Error()))
-			}
-			utils.SetErrorCookie(ctx, "server_error", ad.Env)
-			ctx.Redirect(http.StatusTemporaryRedirect, loginRedirect)
-			return
-		}
-	}
-
-	if user.AuthType != types.Github {
-		errorType := fmt.Sprintf("exists_%s", user.AuthType)
-		utils.SetErrorCookie(ctx, errorType, ad.Env)
-		ctx.Redirect(http.StatusTemporaryRedirect, loginRedirect)
-		return
-	}
-
-	sessionID, sessionErr := ad.SessionUseCase.CreateSessionAndUpdateLastLogin(user.ID, user.Plan, user.Email)
-	if sessionErr != nil {
-		if !utils.IsNormalBusinessError(sessionErr) {
-			slog.Error("Failed to create session during GitHub auth",
-				slog.String("action", "session_creation_github_auth"),
-				slog.String("user_id", user.ID.Hex()),
-				slog.String("error", sessionErr.Error()))
-		}
+	githubID, _ := userData["id"].(float64)
+	if githubID == 0 {
+		slog.Error("GitHub user info has no account ID",
+			slog.String("action", "github_userinfo_missing_id"))
 		utils.SetErrorCookie(ctx, "server_error", ad.Env)
 		ctx.Redirect(http.StatusTemporaryRedirect, loginRedirect)
 		return
 	}
 
-	utils.SetSIDCookie(ctx, sessionID, ad.Env)
+	profile := &domain.OAuthProfile{
+		Provider:  types.Github,
+		Subject:   strconv.FormatInt(int64(githubID), 10),
+		Email:     githubEmail(emails),
+		Name:      userData["name"].(string),
+		AvatarURL: userData["avatar_url"].(string),
+	}
 
-	redirectURL := fmt.Sprintf("%s/%s/auth/verify", ad.Env.FrontEndURL, locale)
-	ctx.Redirect(http.StatusTemporaryRedirect, redirectURL)
+	ad.completeOAuth(ctx, profile, flow, loginRedirect)
 }
 
 func (ad *AuthDelivery) CredentialsLogin(ctx *gin.Context) {
@@ -373,7 +312,7 @@ func (ad *AuthDelivery) CredentialsLogin(ctx *gin.Context) {
 		return
 	}
 
-	user, err := ad.UserUseCase.FindOneByEmail(body.Email)
+	user, restorable, err := ad.findLoginUser(body.Email)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			ctx.JSON(http.StatusNotFound, utils.NewMessageResponse("User not found. Please register to create an account."))
@@ -390,7 +329,7 @@ func (ad *AuthDelivery) CredentialsLogin(ctx *gin.Context) {
 		}
 	}
 
-	if user.AuthType != types.Credentials {
+	if user.Password == "" {
 		ctx.JSON(http.StatusConflict, utils.NewMessageResponse(
 			fmt.Sprintf("An account with this email already exists. Please log in using %s.", utils.ToCamelCase(string(user.AuthType))),
 		))
@@ -402,7 +341,30 @@ func (ad *AuthDelivery) CredentialsLogin(ctx *gin.Context) {
 		return
 	}
 
-	sessionID, sessionErr := ad.SessionUseCase.CreateSessionAndUpdateLastLogin(user.ID, user.Plan, user.Email)
+	if user.TOTPEnabled {
+		challengeToken, err := ad.twoFactorChallenge(user)
+		if err != nil {
+			slog.Error("Failed to generate two-factor challenge during credentials login",
+				slog.String("action", "two_factor_challenge_credentials_login"),
+				slog.String("user_id", user.ID.Hex()),
+				slog.String("error", err.Error()))
+			ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, gin.H{
+			"two_factor_required": true,
+			"challenge_token":     challengeToken,
+		})
+		return
+	}
+
+	if restorable && !ad.restoreAccount(user) {
+		ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	sessionID, sessionErr := ad.SessionUseCase.CreateSessionAndUpdateLastLogin(user.ID, user.Plan, user.Email, sessionClient(ctx))
 	if sessionErr != nil {
 		if !utils.IsNormalBusinessError(sessionErr) {
 			slog.Error("Failed to create session during credentials login",
@@ -484,10 +446,11 @@ func (ad *AuthDelivery) SendSetupNewPasswordEmail(ctx *gin.Context) {
 		return
 	}
 
-	user, err := ad.UserUseCase.FindOneByEmailAndAuthType(body.Email, types.Credentials)
+	// OAuth users can set a password too, it becomes another way to sign in
+	user, err := ad.UserUseCase.FindOneByEmail(body.Email)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
-			ctx.JSON(http.StatusNotFound, utils.NewMessageResponse("The email address is not associated with any credentials account. Please check and try again."))
+			ctx.JSON(http.StatusNotFound, utils.NewMessageResponse("The email address is not associated with any account. Please check and try again."))
 			return
 		} else {
 			if !utils.IsNormalBusinessError(err) {
@@ -626,6 +589,17 @@ func (ad *AuthDelivery) UpdatePassword(ctx *gin.Context) {
 	path := fmt.Sprintf("/%s/auth/reset-password", ctx.GetString("locale"))
 	utils.DeleteCookie(ctx, "token", &path, ad.Env)
 
+	// whoever knew the old password is signed out, the browser that changed it stays signed in
+	currentSessionID, _ := ctx.Cookie("sid")
+	if _, err = ad.SessionUseCase.RevokeOtherSessions(userID, currentSessionID); err != nil {
+		slog.Error("Failed to revoke sessions after password update",
+			slog.String("action", "session_revoke_password_update"),
+			slog.String("user_id", userID.Hex()),
+			slog.String("error", err.Error()))
+		ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("Password updated, but your other sessions could not be signed out. Please sign them out from your account settings."))
+		return
+	}
+
 	ctx.JSON(http.StatusOK, utils.NewMessageResponse("Password updated successfully."))
 }
 
@@ -642,6 +616,20 @@ func (ad *AuthDelivery) VerifyOTPAndCreate(ctx *gin.Context) {
 		return
 	}
 
+	// the email stays reserved for a deleted account until its restore window has passed,
+	// signing in restores it instead
+	if _, err := ad.UserUseCase.FindRestorableByEmail(body.Email); err == nil {
+		ctx.JSON(http.StatusConflict, utils.NewMessageResponse("This email belongs to a deleted account that can still be restored. Sign in to restore it."))
+		return
+	} else if !errors.Is(err, mongo.ErrNoDocuments) {
+		slog.Error("Failed to lookup restorable account during user registration",
+			slog.String("action", "restorable_lookup_user_registration"),
+			slog.String("email", body.Email),
+			slog.String("error", err.Error()))
+		ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
 	valid, err := ad.SinchUseCase.VerifyOTP(body.PhoneNumber, body.OTP)
 	if err != nil {
 		if !utils.IsNormalBusinessError(err) {
@@ -692,9 +680,25 @@ func (ad *AuthDelivery) VerifyOTPAndCreate(ctx *gin.Context) {
 		}
 	}
 
+	ad.cacheProviderAvatar(newUser)
+
 	path := fmt.Sprintf("/%s/auth/otp", ctx.GetString("locale"))
 	utils.DeleteCookie(ctx, "token", &path, ad.Env)
 
+	// the account exists either way, a bad invitation only means the user is not joined
+	if body.InvitationToken != "" {
+		if _, err = ad.OrganizationUseCase.AcceptInvitation(newUser, body.InvitationToken); err != nil {
+			if !utils.IsNormalBusinessError(err) {
+				slog.Error("Failed to accept invitation during registration",
+					slog.String("action", "invitation_accept_registration"),
+					slog.String("user_id", newUser.ID.Hex()),
+					slog.String("error", err.Error()))
+			}
+			ctx.JSON(http.StatusCreated, utils.NewMessageResponse("User created successfully, but the invitation could not be accepted. Please ask for a new invitation."))
+			return
+		}
+	}
+
 	ctx.JSON(http.StatusCreated, utils.NewMessageResponse("User created successfully"))
 }
 
@@ -707,6 +711,10 @@ func (ad *AuthDelivery) SendDeleteAccountMail(ctx *gin.Context) {
 
 	userData := user.(*domain.User)
 
+	if !ad.ensureNoSharedOwnership(ctx, userData.ID) {
+		return
+	}
+
 	jwtClaims := jwt.MapClaims{
 		"process": types.DeleteAccount,
 		"id":      userData.ID,
@@ -784,7 +792,13 @@ func (ad *AuthDelivery) DeleteAccount(ctx *gin.Context) {
 		return
 	}
 
-	if err = ad.PaddleUseCase.CancelSubscriptionImmediately(userID); err != nil {
+	// ownership may have been taken on since the email was sent
+	if !ad.ensureNoSharedOwnership(ctx, userID) {
+		return
+	}
+
+	cancelledSubscription, err := ad.PaddleUseCase.CancelSubscriptionImmediately(userID)
+	if err != nil {
 		if !utils.IsNormalBusinessError(err) {
 			slog.Error("Failed to cancel subscription during account deletion",
 				slog.String("action", "subscription_cancellation_delete_account"),
@@ -811,7 +825,8 @@ func (ad *AuthDelivery) DeleteAccount(ctx *gin.Context) {
 		utils.DeleteCookie(ctx, "sid", nil, ad.Env)
 	}
 
-	if err = ad.UserUseCase.DeleteUser(userID); err != nil {
+	erasure, err := ad.UserUseCase.DeleteUser(userID, cancelledSubscription)
+	if err != nil {
 		if !utils.IsNormalBusinessError(err) {
 			slog.Error("Failed to delete user from database",
 				slog.String("action", "user_deletion"),
@@ -824,5 +839,1430 @@ func (ad *AuthDelivery) DeleteAccount(ctx *gin.Context) {
 
 	utils.DeleteCookie(ctx, "token", nil, ad.Env)
 
+	if email, ok := jwtClaims["email"].(string); ok {
+		ad.sendAccountDeletedEmail(ctx, email, erasure)
+	}
+
 	ctx.JSON(http.StatusNoContent, utils.NewMessageResponse("Account deleted successfully!"))
+}
+
+// ensureNoSharedOwnership writes the response and returns false when the account owns an
+// organization other members are still in; the organization would be left without an owner.
+func (ad *AuthDelivery) ensureNoSharedOwnership(ctx *gin.Context, userID bson.ObjectID) bool {
+	err := ad.OrganizationUseCase.EnsureNoSharedOwnership(userID)
+	if err == nil {
+		return true
+	}
+
+	if errors.Is(err, utils.ErrOrgOwnerHasMembers) {
+		ctx.JSON(http.StatusConflict, utils.NewMessageResponse("You own an organization that still has other members. Remove them before deleting your account."))
+		return false
+	}
+
+	slog.Error("Failed to check organization ownership for account deletion",
+		slog.String("action", "org_ownership_check_delete_account"),
+		slog.String("user_id", userID.Hex()),
+		slog.String("error", err.Error()))
+	ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+	return false
+}
+
+// RestoreAccount undoes an account deletion through the link of the deletion email. It does
+// not sign the user in, the link stays valid for the whole grace period.
+func (ad *AuthDelivery) RestoreAccount(ctx *gin.Context) {
+	claims, exists := ctx.Get("claims")
+	if !exists {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	jwtClaims, ok := claims.(jwt.MapClaims)
+	if !ok {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	if processStr, ok := jwtClaims["process"].(string); !ok || processStr != string(types.RestoreAccount) {
+		ctx.JSON(http.StatusUnauthorized, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	userIDStr, idOk := jwtClaims["id"].(string)
+	erasureIDStr, erasureOk := jwtClaims["erasure_id"].(string)
+	if !idOk || !erasureOk {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	userID, err := bson.ObjectIDFromHex(userIDStr)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	erasureID, err := bson.ObjectIDFromHex(erasureIDStr)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	erasure, err := ad.UserUseCase.RestoreUser(userID, &erasureID)
+	if err != nil {
+		if errors.Is(err, utils.ErrAccountNotRestorable) {
+			ctx.JSON(http.StatusGone, utils.NewMessageResponse("This account can no longer be restored."))
+			return
+		}
+		slog.Error("Failed to restore user",
+			slog.String("action", "user_restore"),
+			slog.String("user_id", userID.Hex()),
+			slog.String("error", err.Error()))
+		ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	if email, ok := jwtClaims["email"].(string); ok {
+		ad.sendAccountRestoredEmail(email, erasure)
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message":                "Account restored successfully. Please log in.",
+		"cancelled_subscription": erasure.CancelledSubscription,
+	})
+}
+
+func (ad *AuthDelivery) SendEmailChangeMail(ctx *gin.Context) {
+	user, exists := ctx.Get("user")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, utils.NewMessageResponse("Unauthorized. Please log in and try again."))
+		return
+	}
+
+	userData := user.(*domain.User)
+
+	var body domain.EmailChangeBody
+	if err := ctx.ShouldBindJSON(&body); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("Invalid request body. Please provide a valid email address."))
+		return
+	}
+	newEmail := strings.TrimSpace(body.Email)
+
+	// legacy OAuth logins find the user by the address the provider reports, changing it would lock them out
+	identities, err := ad.IdentityUseCase.FindByUserID(userData.ID)
+	if err != nil {
+		slog.Error("Failed to lookup identities for email change",
+			slog.String("action", "email_change_identity_lookup"),
+			slog.String("user_id", userData.ID.Hex()),
+			slog.String("error", err.Error()))
+		ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+	if domain.IsLegacyOAuthLogin(userData, identities) {
+		ctx.JSON(http.StatusConflict, utils.NewMessageResponse(fmt.Sprintf("Your email address is managed by your %s account.", utils.ToCamelCase(string(userData.AuthType)))))
+		return
+	}
+
+	if strings.EqualFold(newEmail, userData.Email) {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("This is already your email address."))
+		return
+	}
+
+	taken, err := ad.UserUseCase.IsEmailExists(newEmail)
+	if err == nil && !taken {
+		if _, restoreErr := ad.UserUseCase.FindRestorableByEmail(newEmail); restoreErr == nil {
+			taken = true
+		} else if !errors.Is(restoreErr, mongo.ErrNoDocuments) {
+			err = restoreErr
+		}
+	}
+	if err != nil {
+		slog.Error("Failed to check email availability",
+			slog.String("action", "email_change_lookup"),
+			slog.String("user_id", userData.ID.Hex()),
+			slog.String("error", err.Error()))
+		ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+	if taken {
+		ctx.JSON(http.StatusConflict, utils.NewMessageResponse("This email address is already used by another account."))
+		return
+	}
+
+	jwtClaims := jwt.MapClaims{
+		"process":   types.ChangeEmail,
+		"id":        userData.ID,
+		"email":     userData.Email,
+		"new_email": newEmail,
+	}
+
+	exp1HourUnix := time.Now().Add(1 * time.Hour).Unix() // 1 hour
+
+	tokenString, err := utils.GenerateJWT(jwtClaims, ad.Env, exp1HourUnix)
+	if err != nil {
+		slog.Error("Failed to generate JWT for email change",
+			slog.String("action", "jwt_generation_email_change"),
+			slog.String("user_id", userData.ID.Hex()),
+			slog.String("error", err.Error()))
+		ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	confirmLink := fmt.Sprintf("%s/%s/auth/account/email/confirm?token=%s", ad.Env.FrontEndURL, ctx.GetString("locale"), url.QueryEscape(tokenString))
+	if _, err = ad.ResendUseCase.SendEmailChangeConfirmEmail(newEmail, confirmLink); err != nil {
+		if !utils.IsNormalBusinessError(err) {
+			slog.Error("Failed to send email change confirmation",
+				slog.String("action", "email_change_confirm_sending"),
+				slog.String("user_id", userData.ID.Hex()),
+				slog.String("error", err.Error()))
+		}
+		ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("Failed to send the confirmation email. Please try again later or contact support."))
+		return
+	}
+
+	if _, err = ad.ResendUseCase.SendEmailChangeNoticeEmail(userData.Email, newEmail); err != nil {
+		slog.Warn("Email change notice could not be sent",
+			slog.String("user_id", userData.ID.Hex()),
+			slog.String("error", err.Error()))
+	}
+
+	ctx.JSON(http.StatusOK, utils.NewMessageResponse("Confirmation email sent. Please check the inbox of your new email address."))
+}
+
+func (ad *AuthDelivery) ConfirmEmailChange(ctx *gin.Context) {
+	claims, exists := ctx.Get("claims")
+	if !exists {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	jwtClaims, ok := claims.(jwt.MapClaims)
+	if !ok {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	if processStr, ok := jwtClaims["process"].(string); !ok || processStr != string(types.ChangeEmail) {
+		ctx.JSON(http.StatusUnauthorized, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	userIDStr, idOk := jwtClaims["id"].(string)
+	oldEmail, oldOk := jwtClaims["email"].(string)
+	newEmail, newOk := jwtClaims["new_email"].(string)
+	if !idOk || !oldOk || !newOk {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	userID, err := bson.ObjectIDFromHex(userIDStr)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	if _, err = ad.UserUseCase.ChangeEmail(userID, oldEmail, newEmail); err != nil {
+		switch {
+		case errors.Is(err, utils.ErrEmailTaken):
+			ctx.JSON(http.StatusConflict, utils.NewMessageResponse("This email address is already used by another account."))
+		case errors.Is(err, utils.ErrEmailChangeInvalid):
+			ctx.JSON(http.StatusGone, utils.NewMessageResponse("This link is no longer valid. Please request the change again."))
+		default:
+			slog.Error("Failed to change email",
+				slog.String("action", "email_change"),
+				slog.String("user_id", userID.Hex()),
+				slog.String("error", err.Error()))
+			ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "Email address changed successfully.",
+		"email":   newEmail,
+	})
+}
+
+// ListIdentities returns the linked provider accounts and whether a password is set. A legacy
+// OAuth login is listed like a linked identity.
+func (ad *AuthDelivery) ListIdentities(ctx *gin.Context) {
+	user, exists := ctx.Get("user")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, utils.NewMessageResponse("Unauthorized. Please log in and try again."))
+		return
+	}
+
+	userData := user.(*domain.User)
+
+	identities, err := ad.IdentityUseCase.FindByUserID(userData.ID)
+	if err != nil {
+		slog.Error("Failed to list identities",
+			slog.String("action", "identity_list"),
+			slog.String("user_id", userData.ID.Hex()),
+			slog.String("error", err.Error()))
+		ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	if domain.IsLegacyOAuthLogin(userData, identities) {
+		identities = append(identities, &domain.Identity{
+			Provider:  userData.AuthType,
+			Email:     userData.Email,
+			CreatedAt: userData.CreatedAt,
+		})
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"identities":   identities,
+		"has_password": userData.Password != "",
+	})
+}
+
+func (ad *AuthDelivery) UnlinkIdentity(ctx *gin.Context) {
+	user, exists := ctx.Get("user")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, utils.NewMessageResponse("Unauthorized. Please log in and try again."))
+		return
+	}
+
+	userData := user.(*domain.User)
+
+	provider := types.AuthType(ctx.Param("provider"))
+	if provider != types.Google && provider != types.Github {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("Unknown provider."))
+		return
+	}
+
+	if err := ad.IdentityUseCase.Unlink(userData.ID, provider); err != nil {
+		switch {
+		case errors.Is(err, mongo.ErrNoDocuments):
+			ctx.JSON(http.StatusNotFound, utils.NewMessageResponse(fmt.Sprintf("No %s account is linked.", utils.ToCamelCase(string(provider)))))
+		case errors.Is(err, utils.ErrLastLoginMethod):
+			ctx.JSON(http.StatusConflict, utils.NewMessageResponse("This is your only way to sign in. Link another account or set a password first."))
+		default:
+			slog.Error("Failed to unlink identity",
+				slog.String("action", "identity_unlink"),
+				slog.String("user_id", userData.ID.Hex()),
+				slog.String("provider", string(provider)),
+				slog.String("error", err.Error()))
+			ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.NewMessageResponse(fmt.Sprintf("%s account unlinked successfully.", utils.ToCamelCase(string(provider)))))
+}
+
+func (ad *AuthDelivery) ListSessions(ctx *gin.Context) {
+	user, exists := ctx.Get("user")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, utils.NewMessageResponse("Unauthorized. Please log in and try again."))
+		return
+	}
+
+	userData := user.(*domain.User)
+	currentSessionID, _ := ctx.Cookie("sid")
+
+	sessions, err := ad.SessionUseCase.ListSessions(userData.ID, currentSessionID)
+	if err != nil {
+		slog.Error("Failed to list sessions",
+			slog.String("action", "session_list"),
+			slog.String("user_id", userData.ID.Hex()),
+			slog.String("error", err.Error()))
+		ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+// RevokeSession signs one of the user's sessions out. Revoking the current session is the same
+// as logging out.
+func (ad *AuthDelivery) RevokeSession(ctx *gin.Context) {
+	user, exists := ctx.Get("user")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, utils.NewMessageResponse("Unauthorized. Please log in and try again."))
+		return
+	}
+
+	userData := user.(*domain.User)
+
+	session, err := ad.SessionUseCase.RevokeSession(userData.ID, ctx.Param("id"))
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			ctx.JSON(http.StatusNotFound, utils.NewMessageResponse("Session not found."))
+			return
+		}
+		slog.Error("Failed to revoke session",
+			slog.String("action", "session_revoke"),
+			slog.String("user_id", userData.ID.Hex()),
+			slog.String("error", err.Error()))
+		ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	if currentSessionID, _ := ctx.Cookie("sid"); session.SessionID == currentSessionID {
+		utils.DeleteCookie(ctx, "sid", nil, ad.Env)
+	}
+
+	ctx.JSON(http.StatusOK, utils.NewMessageResponse("Session signed out successfully."))
+}
+
+// RevokeOtherSessions signs the user out everywhere but in the current session.
+func (ad *AuthDelivery) RevokeOtherSessions(ctx *gin.Context) {
+	user, exists := ctx.Get("user")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, utils.NewMessageResponse("Unauthorized. Please log in and try again."))
+		return
+	}
+
+	userData := user.(*domain.User)
+	currentSessionID, _ := ctx.Cookie("sid")
+
+	revoked, err := ad.SessionUseCase.RevokeOtherSessions(userData.ID, currentSessionID)
+	if err != nil {
+		slog.Error("Failed to revoke other sessions",
+			slog.String("action", "session_revoke_others"),
+			slog.String("user_id", userData.ID.Hex()),
+			slog.Int("revoked", revoked),
+			slog.String("error", err.Error()))
+		ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "Signed out of all other sessions.",
+		"revoked": revoked,
+	})
+}
+
+// VerifyTwoFactor completes a sign-in that CredentialsLogin or an OAuth callback left at the
+// second step. The challenge token proves the first step, the code the second.
+func (ad *AuthDelivery) VerifyTwoFactor(ctx *gin.Context) {
+	claims, exists := ctx.Get("claims")
+	if !exists {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	jwtClaims, ok := claims.(jwt.MapClaims)
+	if !ok {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	if processStr, ok := jwtClaims["process"].(string); !ok || processStr != string(types.TwoFactorLogin) {
+		ctx.JSON(http.StatusUnauthorized, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	userIDStr, ok := jwtClaims["id"].(string)
+	if !ok {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	userID, err := bson.ObjectIDFromHex(userIDStr)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	challenge, ok := jwtClaims["challenge"].(string)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, utils.NewMessageResponse("Your sign-in has expired. Please log in again."))
+		return
+	}
+
+	var body domain.TwoFactorCodeBody
+	if err = ctx.ShouldBindJSON(&body); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("Invalid request body. Please provide your authentication code."))
+		return
+	}
+
+	user, restorable, err := ad.findUserByID(userID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			ctx.JSON(http.StatusNotFound, utils.NewMessageResponse("User not found. Please register to create an account."))
+			return
+		}
+		slog.Error("Failed to lookup user for two-factor verification",
+			slog.String("action", "user_lookup_two_factor"),
+			slog.String("user_id", userIDStr),
+			slog.String("error", err.Error()))
+		ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	if err = ad.TwoFactorUseCase.VerifyChallenge(user, challenge, body.Code); err != nil {
+		switch {
+		case errors.Is(err, utils.ErrTwoFactorCodeInvalid):
+			ctx.JSON(http.StatusUnauthorized, utils.NewMessageResponse("Incorrect or already used code. Please try again."))
+		case errors.Is(err, utils.ErrTwoFactorChallengeInvalid):
+			ctx.JSON(http.StatusUnauthorized, utils.NewMessageResponse("Too many incorrect codes or this sign-in was already completed. Please log in again."))
+		case errors.Is(err, utils.ErrTwoFactorLocked):
+			ctx.JSON(http.StatusTooManyRequests, utils.NewMessageResponse("Too many incorrect codes. Please try again in 15 minutes."))
+		case errors.Is(err, utils.ErrTwoFactorNotSetUp):
+			ctx.JSON(http.StatusConflict, utils.NewMessageResponse("Two-factor authentication is no longer enabled. Please log in again."))
+		default:
+			slog.Error("Failed to verify two-factor code",
+				slog.String("action", "two_factor_verification"),
+				slog.String("user_id", userIDStr),
+				slog.String("error", err.Error()))
+			ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		}
+		return
+	}
+
+	if restorable && !ad.restoreAccount(user) {
+		ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	ad.cacheProviderAvatar(user)
+
+	sessionID, sessionErr := ad.SessionUseCase.CreateSessionAndUpdateLastLogin(user.ID, user.Plan, user.Email, sessionClient(ctx))
+	if sessionErr != nil {
+		if !utils.IsNormalBusinessError(sessionErr) {
+			slog.Error("Failed to create session after two-factor verification",
+				slog.String("action", "session_creation_two_factor"),
+				slog.String("user_id", user.ID.Hex()),
+				slog.String("error", sessionErr.Error()))
+		}
+		ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("Failed to create a user session. Please try again later or contact support."))
+		return
+	}
+
+	utils.SetSIDCookie(ctx, sessionID, ad.Env)
+
+	path := fmt.Sprintf("/%s/auth/2fa", ctx.GetString("locale"))
+	utils.DeleteCookie(ctx, "token", &path, ad.Env)
+
+	user.Password = ""
+
+	ctx.JSON(http.StatusOK, user)
+}
+
+func (ad *AuthDelivery) BeginTOTPEnrollment(ctx *gin.Context) {
+	user, exists := ctx.Get("user")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, utils.NewMessageResponse("Unauthorized. Please log in and try again."))
+		return
+	}
+
+	userData := user.(*domain.User)
+
+	secret, uri, err := ad.TwoFactorUseCase.BeginEnrollment(userData)
+	if err != nil {
+		if errors.Is(err, utils.ErrTwoFactorEnabled) {
+			ctx.JSON(http.StatusConflict, utils.NewMessageResponse("Two-factor authentication is already enabled."))
+			return
+		}
+		slog.Error("Failed to begin TOTP enrollment",
+			slog.String("action", "totp_enrollment_begin"),
+			slog.String("user_id", userData.ID.Hex()),
+			slog.String("error", err.Error()))
+		ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"secret":      secret,
+		"otpauth_uri": uri,
+	})
+}
+
+func (ad *AuthDelivery) ConfirmTOTPEnrollment(ctx *gin.Context) {
+	user, exists := ctx.Get("user")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, utils.NewMessageResponse("Unauthorized. Please log in and try again."))
+		return
+	}
+
+	userData := user.(*domain.User)
+
+	var body domain.TwoFactorCodeBody
+	if err := ctx.ShouldBindJSON(&body); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("Invalid request body. Please provide your authentication code."))
+		return
+	}
+
+	codes, err := ad.TwoFactorUseCase.ConfirmEnrollment(userData.ID, body.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, utils.ErrTwoFactorCodeInvalid):
+			ctx.JSON(http.StatusUnauthorized, utils.NewMessageResponse("Incorrect code. Please check your authenticator app and try again."))
+		case errors.Is(err, utils.ErrTwoFactorEnabled):
+			ctx.JSON(http.StatusConflict, utils.NewMessageResponse("Two-factor authentication is already enabled."))
+		case errors.Is(err, utils.ErrTwoFactorNotSetUp):
+			ctx.JSON(http.StatusConflict, utils.NewMessageResponse("Please start the two-factor setup again."))
+		default:
+			slog.Error("Failed to confirm TOTP enrollment",
+				slog.String("action", "totp_enrollment_confirm"),
+				slog.String("user_id", userData.ID.Hex()),
+				slog.String("error", err.Error()))
+			ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled. Store your recovery codes in a safe place, they are shown only once.",
+		"recovery_codes": codes,
+	})
+}
+
+func (ad *AuthDelivery) DisableTOTP(ctx *gin.Context) {
+	user, exists := ctx.Get("user")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, utils.NewMessageResponse("Unauthorized. Please log in and try again."))
+		return
+	}
+
+	userData := user.(*domain.User)
+
+	var body domain.TwoFactorCodeBody
+	if err := ctx.ShouldBindJSON(&body); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("Invalid request body. Please provide your authentication code."))
+		return
+	}
+
+	if err := ad.TwoFactorUseCase.Disable(userData, body.Code); err != nil {
+		ad.handleTwoFactorCodeError(ctx, userData, err, "totp_disable")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.NewMessageResponse("Two-factor authentication disabled."))
+}
+
+func (ad *AuthDelivery) RegenerateRecoveryCodes(ctx *gin.Context) {
+	user, exists := ctx.Get("user")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, utils.NewMessageResponse("Unauthorized. Please log in and try again."))
+		return
+	}
+
+	userData := user.(*domain.User)
+
+	var body domain.TwoFactorCodeBody
+	if err := ctx.ShouldBindJSON(&body); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("Invalid request body. Please provide your authentication code."))
+		return
+	}
+
+	codes, err := ad.TwoFactorUseCase.RegenerateRecoveryCodes(userData, body.Code)
+	if err != nil {
+		ad.handleTwoFactorCodeError(ctx, userData, err, "recovery_codes_regenerate")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message":        "New recovery codes created, the previous ones no longer work.",
+		"recovery_codes": codes,
+	})
+}
+
+func (ad *AuthDelivery) handleTwoFactorCodeError(ctx *gin.Context, user *domain.User, err error, action string) {
+	switch {
+	case errors.Is(err, utils.ErrTwoFactorCodeInvalid):
+		ctx.JSON(http.StatusUnauthorized, utils.NewMessageResponse("Incorrect or already used code. Please try again."))
+	case errors.Is(err, utils.ErrTwoFactorNotSetUp):
+		ctx.JSON(http.StatusConflict, utils.NewMessageResponse("Two-factor authentication is not enabled."))
+	default:
+		slog.Error("Failed to process two-factor request",
+			slog.String("action", action),
+			slog.String("user_id", user.ID.Hex()),
+			slog.String("error", err.Error()))
+		ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+	}
+}
+
+// twoFactorChallenge signs the state between the two steps of a sign-in. It is only good for
+// VerifyTwoFactor and expires after TwoFactorChallengeTTL. The challenge it carries is stored
+// with the user, which limits the codes tried with it to TwoFactorMaxAttempts.
+func (ad *AuthDelivery) twoFactorChallenge(user *domain.User) (string, error) {
+	challenge, err := ad.TwoFactorUseCase.CreateChallenge(user.ID)
+	if err != nil {
+		return "", err
+	}
+
+	jwtClaims := jwt.MapClaims{
+		"process":   types.TwoFactorLogin,
+		"id":        user.ID,
+		"challenge": challenge,
+	}
+
+	return utils.GenerateJWT(jwtClaims, ad.Env, time.Now().Add(domain.TwoFactorChallengeTTL).Unix())
+}
+
+func (ad *AuthDelivery) BeginPasskeyRegistration(ctx *gin.Context) {
+	user, exists := ctx.Get("user")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, utils.NewMessageResponse("Unauthorized. Please log in and try again."))
+		return
+	}
+
+	userData := user.(*domain.User)
+
+	var body domain.PasskeyReauthBody
+	if err := ctx.ShouldBindJSON(&body); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("Invalid request body. Please check your input."))
+		return
+	}
+
+	// a passkey skips two-factor authentication on every later sign-in, a session alone is not enough
+	if !ad.reauthenticate(ctx, userData, body, "passkey_registration_reauth") {
+		return
+	}
+
+	options, session, err := ad.PasskeyUseCase.BeginRegistration(userData)
+	if err == nil {
+		var sessionToken string
+		if sessionToken, err = ad.passkeyCeremony(types.PasskeyRegistration, &userData.ID, session); err == nil {
+			ctx.JSON(http.StatusOK, gin.H{
+				"options":       options,
+				"session_token": sessionToken,
+			})
+			return
+		}
+	}
+
+	slog.Error("Failed to begin passkey registration",
+		slog.String("action", "passkey_registration_begin"),
+		slog.String("user_id", userData.ID.Hex()),
+		slog.String("error", err.Error()))
+	ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+}
+
+func (ad *AuthDelivery) FinishPasskeyRegistration(ctx *gin.Context) {
+	user, exists := ctx.Get("user")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, utils.NewMessageResponse("Unauthorized. Please log in and try again."))
+		return
+	}
+
+	userData := user.(*domain.User)
+
+	var body domain.PasskeyRegistrationBody
+	if err := ctx.ShouldBindJSON(&body); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("Invalid request body. Please check your input."))
+		return
+	}
+
+	// the ceremony has to be finished by the user who started it
+	session, userID, ok := ad.parsePasskeyCeremony(body.SessionToken, types.PasskeyRegistration)
+	if !ok || userID != userData.ID {
+		ctx.JSON(http.StatusUnauthorized, utils.NewMessageResponse("The passkey setup has expired. Please try again."))
+		return
+	}
+
+	passkey, err := ad.PasskeyUseCase.FinishRegistration(userData, *session, strings.TrimSpace(body.Name), body.Credential)
+	if err != nil {
+		if errors.Is(err, utils.ErrPasskeyInvalid) {
+			ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("The passkey could not be verified. Please try again."))
+			return
+		}
+		slog.Error("Failed to finish passkey registration",
+			slog.String("action", "passkey_registration_finish"),
+			slog.String("user_id", userData.ID.Hex()),
+			slog.String("error", err.Error()))
+		ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	if _, err = ad.ResendUseCase.SendPasskeyAddedEmail(userData.Email, passkey.Name); err != nil {
+		slog.Warn("Passkey added email could not be sent",
+			slog.String("user_id", userData.ID.Hex()),
+			slog.String("error", err.Error()))
+	}
+
+	ctx.JSON(http.StatusCreated, passkey)
+}
+
+// reauthenticate writes the response and returns false unless the user confirmed the request:
+// with a current two-factor code when two-factor authentication is enabled, otherwise with the
+// password when one is set. Accounts with neither must have signed in within PasskeyReauthWindow.
+func (ad *AuthDelivery) reauthenticate(ctx *gin.Context, user *domain.User, body domain.PasskeyReauthBody, action string) bool {
+	switch {
+	case user.TOTPEnabled:
+		if err := ad.TwoFactorUseCase.Verify(user, body.Code); err != nil {
+			ad.handleTwoFactorCodeError(ctx, user, err, action)
+			return false
+		}
+	case user.Password != "":
+		if !utils.CheckPasswordHash(body.Password, user.Password) {
+			ctx.JSON(http.StatusUnauthorized, utils.NewMessageResponse("Incorrect password. Please try again."))
+			return false
+		}
+	default:
+		session, exists := ctx.Get("session")
+		sessionData, ok := session.(*domain.Session)
+		if !exists || !ok || time.Since(time.Unix(sessionData.CreatedAt, 0)) > domain.PasskeyReauthWindow {
+			ctx.JSON(http.StatusForbidden, utils.NewMessageResponse("Please log in again to continue."))
+			return false
+		}
+	}
+
+	return true
+}
+
+func (ad *AuthDelivery) ListPasskeys(ctx *gin.Context) {
+	user, exists := ctx.Get("user")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, utils.NewMessageResponse("Unauthorized. Please log in and try again."))
+		return
+	}
+
+	userData := user.(*domain.User)
+
+	passkeys, err := ad.PasskeyUseCase.FindByUserID(userData.ID)
+	if err != nil {
+		slog.Error("Failed to list passkeys",
+			slog.String("action", "passkey_list"),
+			slog.String("user_id", userData.ID.Hex()),
+			slog.String("error", err.Error()))
+		ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"passkeys": passkeys})
+}
+
+func (ad *AuthDelivery) RevokePasskey(ctx *gin.Context) {
+	user, exists := ctx.Get("user")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, utils.NewMessageResponse("Unauthorized. Please log in and try again."))
+		return
+	}
+
+	userData := user.(*domain.User)
+
+	passkeyID, err := bson.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("Invalid passkey ID."))
+		return
+	}
+
+	if err = ad.PasskeyUseCase.Revoke(userData.ID, passkeyID); err != nil {
+		switch {
+		case errors.Is(err, mongo.ErrNoDocuments):
+			ctx.JSON(http.StatusNotFound, utils.NewMessageResponse("Passkey not found."))
+		case errors.Is(err, utils.ErrLastLoginMethod):
+			ctx.JSON(http.StatusConflict, utils.NewMessageResponse("This is your only way to sign in. Add another passkey, link an account or set a password first."))
+		default:
+			slog.Error("Failed to revoke passkey",
+				slog.String("action", "passkey_revoke"),
+				slog.String("user_id", userData.ID.Hex()),
+				slog.String("passkey_id", passkeyID.Hex()),
+				slog.String("error", err.Error()))
+			ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.NewMessageResponse("Passkey removed successfully."))
+}
+
+func (ad *AuthDelivery) BeginPasskeyLogin(ctx *gin.Context) {
+	options, session, err := ad.PasskeyUseCase.BeginLogin()
+	if err == nil {
+		var sessionToken string
+		if sessionToken, err = ad.passkeyCeremony(types.PasskeyLogin, nil, session); err == nil {
+			ctx.JSON(http.StatusOK, gin.H{
+				"options":       options,
+				"session_token": sessionToken,
+			})
+			return
+		}
+	}
+
+	slog.Error("Failed to begin passkey login",
+		slog.String("action", "passkey_login_begin"),
+		slog.String("error", err.Error()))
+	ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+}
+
+// FinishPasskeyLogin signs in without a second step. The passkey was verified by the
+// authenticator, so it already is something the user has and something they know or are.
+func (ad *AuthDelivery) FinishPasskeyLogin(ctx *gin.Context) {
+	var body domain.PasskeyAssertionBody
+	if err := ctx.ShouldBindJSON(&body); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("Invalid request body. Please check your input."))
+		return
+	}
+
+	session, _, ok := ad.parsePasskeyCeremony(body.SessionToken, types.PasskeyLogin)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, utils.NewMessageResponse("The sign-in has expired. Please try again."))
+		return
+	}
+
+	user, err := ad.PasskeyUseCase.FinishLogin(*session, body.Credential)
+	if err != nil {
+		if errors.Is(err, utils.ErrPasskeyInvalid) {
+			ctx.JSON(http.StatusUnauthorized, utils.NewMessageResponse("The passkey could not be verified. Please try again."))
+			return
+		}
+		slog.Error("Failed to finish passkey login",
+			slog.String("action", "passkey_login_finish"),
+			slog.String("error", err.Error()))
+		ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	restorable := false
+	if user.DeletedAt != nil {
+		if user, err = ad.UserUseCase.FindRestorableByID(user.ID); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				ctx.JSON(http.StatusNotFound, utils.NewMessageResponse("User not found. Please register to create an account."))
+				return
+			}
+			slog.Error("Failed to lookup deleted user during passkey login",
+				slog.String("action", "user_lookup_passkey_login"),
+				slog.String("error", err.Error()))
+			ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+			return
+		}
+		restorable = true
+	}
+
+	ad.startSession(ctx, user, restorable, "session_creation_passkey_login")
+}
+
+// BeginPasskeySecondFactor answers the second step of a sign-in with a passkey instead of a code.
+// It takes the same challenge token as VerifyTwoFactor.
+func (ad *AuthDelivery) BeginPasskeySecondFactor(ctx *gin.Context) {
+	claims, exists := ctx.Get("claims")
+	if !exists {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	jwtClaims, ok := claims.(jwt.MapClaims)
+	if !ok {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	if processStr, ok := jwtClaims["process"].(string); !ok || processStr != string(types.TwoFactorLogin) {
+		ctx.JSON(http.StatusUnauthorized, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	userIDStr, ok := jwtClaims["id"].(string)
+	if !ok {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	userID, err := bson.ObjectIDFromHex(userIDStr)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	user, _, err := ad.findUserByID(userID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			ctx.JSON(http.StatusNotFound, utils.NewMessageResponse("User not found. Please register to create an account."))
+			return
+		}
+		slog.Error("Failed to lookup user for passkey second factor",
+			slog.String("action", "user_lookup_passkey_second_factor"),
+			slog.String("user_id", userIDStr),
+			slog.String("error", err.Error()))
+		ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	options, session, err := ad.PasskeyUseCase.BeginSecondFactor(user)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			ctx.JSON(http.StatusConflict, utils.NewMessageResponse("No passkey is registered for this account. Please use your authentication code."))
+			return
+		}
+		slog.Error("Failed to begin passkey second factor",
+			slog.String("action", "passkey_second_factor_begin"),
+			slog.String("user_id", userIDStr),
+			slog.String("error", err.Error()))
+		ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	sessionToken, err := ad.passkeyCeremony(types.PasskeySecondFactor, &user.ID, session)
+	if err != nil {
+		slog.Error("Failed to generate passkey ceremony token",
+			slog.String("action", "jwt_generation_passkey_second_factor"),
+			slog.String("user_id", userIDStr),
+			slog.String("error", err.Error()))
+		ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"options":       options,
+		"session_token": sessionToken,
+	})
+}
+
+func (ad *AuthDelivery) FinishPasskeySecondFactor(ctx *gin.Context) {
+	var body domain.PasskeyAssertionBody
+	if err := ctx.ShouldBindJSON(&body); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("Invalid request body. Please check your input."))
+		return
+	}
+
+	session, userID, ok := ad.parsePasskeyCeremony(body.SessionToken, types.PasskeySecondFactor)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, utils.NewMessageResponse("The sign-in has expired. Please log in again."))
+		return
+	}
+
+	user, restorable, err := ad.findUserByID(userID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			ctx.JSON(http.StatusNotFound, utils.NewMessageResponse("User not found. Please register to create an account."))
+			return
+		}
+		slog.Error("Failed to lookup user for passkey second factor",
+			slog.String("action", "user_lookup_passkey_second_factor"),
+			slog.String("user_id", userID.Hex()),
+			slog.String("error", err.Error()))
+		ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	if err = ad.PasskeyUseCase.FinishSecondFactor(user, *session, body.Credential); err != nil {
+		if errors.Is(err, utils.ErrPasskeyInvalid) {
+			ctx.JSON(http.StatusUnauthorized, utils.NewMessageResponse("The passkey could not be verified. Please try again."))
+			return
+		}
+		slog.Error("Failed to finish passkey second factor",
+			slog.String("action", "passkey_second_factor_finish"),
+			slog.String("user_id", userID.Hex()),
+			slog.String("error", err.Error()))
+		ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	path := fmt.Sprintf("/%s/auth/2fa", ctx.GetString("locale"))
+	utils.DeleteCookie(ctx, "token", &path, ad.Env)
+
+	ad.startSession(ctx, user, restorable, "session_creation_passkey_second_factor")
+}
+
+// passkeyCeremony keeps the WebAuthn session data of a started ceremony on our side and returns
+// the session token the browser sends back with its response. It expires after PasskeyCeremonyTTL.
+func (ad *AuthDelivery) passkeyCeremony(process types.ProcessType, userID *bson.ObjectID, session *webauthn.SessionData) (string, error) {
+	return ad.PasskeyUseCase.StartCeremony(process, userID, session)
+}
+
+// parsePasskeyCeremony finishes the ceremony of the token and returns what passkeyCeremony kept,
+// false when the token is unknown, expired, of another ceremony or was already used. The user ID
+// is zero when the ceremony had none.
+func (ad *AuthDelivery) parsePasskeyCeremony(token string, process types.ProcessType) (*webauthn.SessionData, bson.ObjectID, bool) {
+	session, userID, err := ad.PasskeyUseCase.FinishCeremony(process, token)
+	if err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			slog.Error("Failed to finish passkey ceremony",
+				slog.String("action", "passkey_ceremony_finish"),
+				slog.String("process", string(process)),
+				slog.String("error", err.Error()))
+		}
+		return nil, bson.ObjectID{}, false
+	}
+
+	if userID == nil {
+		return session, bson.ObjectID{}, true
+	}
+
+	return session, *userID, true
+}
+
+// startSession signs the user in once every step of the sign-in passed, restoring a deleted
+// account first, and responds with the user.
+func (ad *AuthDelivery) startSession(ctx *gin.Context, user *domain.User, restorable bool, action string) {
+	if restorable && !ad.restoreAccount(user) {
+		ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	ad.cacheProviderAvatar(user)
+
+	sessionID, err := ad.SessionUseCase.CreateSessionAndUpdateLastLogin(user.ID, user.Plan, user.Email, sessionClient(ctx))
+	if err != nil {
+		if !utils.IsNormalBusinessError(err) {
+			slog.Error("Failed to create session",
+				slog.String("action", action),
+				slog.String("user_id", user.ID.Hex()),
+				slog.String("error", err.Error()))
+		}
+		ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("Failed to create a user session. Please try again later or contact support."))
+		return
+	}
+
+	utils.SetSIDCookie(ctx, sessionID, ad.Env)
+
+	user.Password = ""
+
+	ctx.JSON(http.StatusOK, user)
+}
+
+// completeOAuth signs in with the provider account, or starts the registration when no user has
+// it. Users are found by their linked identity first. A user registered with the provider before
+// identities existed is found by email, and the identity is linked on that sign-in.
+func (ad *AuthDelivery) completeOAuth(ctx *gin.Context, profile *domain.OAuthProfile, flow *domain.OAuthState, loginRedirect string) {
+	if flow.LinkUserID != nil {
+		ad.linkIdentity(ctx, *flow.LinkUserID, profile)
+		return
+	}
+
+	locale := ctx.GetString("locale")
+
+	user, restorable, err := ad.findIdentityUser(profile)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		user, restorable, err = ad.findLoginUser(profile.Email)
+		if err == nil && user.AuthType != profile.Provider {
+			errorType := fmt.Sprintf("exists_%s", user.AuthType)
+			utils.SetErrorCookie(ctx, errorType, ad.Env)
+			ctx.Redirect(http.StatusTemporaryRedirect, loginRedirect)
+			return
+		}
+	}
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			jwtClaims := jwt.MapClaims{
+				"name":       profile.Name,
+				"email":      profile.Email,
+				"avatar_url": profile.AvatarURL,
+				"auth_type":  profile.Provider,
+			}
+
+			exp1HourUnix := time.Now().Add(1 * time.Hour).Unix() // 1 hour
+
+			tokenString, tokenErr := utils.GenerateJWT(jwtClaims, ad.Env, exp1HourUnix)
+			if tokenErr != nil {
+				if !utils.IsNormalBusinessError(tokenErr) {
+					slog.Error("Failed to generate JWT for OAuth registration",
+						slog.String("action", fmt.Sprintf("jwt_generation_%s_auth", profile.Provider)),
+						slog.String("error", tokenErr.Error()))
+				}
+				utils.SetErrorCookie(ctx, "server_error", ad.Env)
+				ctx.Redirect(http.StatusTemporaryRedirect, loginRedirect)
+				return
+			}
+
+			otpPath := fmt.Sprintf("/%s/auth/otp", locale)
+			utils.SetAuthTokenCookie(ctx, tokenString, otpPath, 3600, ad.Env) // 1 hour
+
+			redirectURL := fmt.Sprintf("%s/%s/auth/otp", ad.Env.FrontEndURL, locale)
+			ctx.Redirect(http.StatusTemporaryRedirect, redirectURL)
+			return
+		} else {
+			if !utils.IsNormalBusinessError(err) {
+				slog.Error("Failed to lookup user during OAuth login",
+					slog.String("action", fmt.Sprintf("user_lookup_%s_auth", profile.Provider)),
+					slog.String("error", err.Error()))
+			}
+			utils.SetErrorCookie(ctx, "server_error", ad.Env)
+			ctx.Redirect(http.StatusTemporaryRedirect, loginRedirect)
+			return
+		}
+	}
+
+	// links the identity of a legacy user and keeps the email of a linked one current
+	if _, err = ad.IdentityUseCase.Link(user.ID, profile); err != nil {
+		if errors.Is(err, utils.ErrIdentityLinked) || errors.Is(err, utils.ErrProviderLinked) {
+			utils.SetErrorCookie(ctx, "identity_linked", ad.Env)
+		} else {
+			slog.Error("Failed to link identity during OAuth login",
+				slog.String("action", fmt.Sprintf("identity_link_%s_auth", profile.Provider)),
+				slog.String("user_id", user.ID.Hex()),
+				slog.String("error", err.Error()))
+			utils.SetErrorCookie(ctx, "server_error", ad.Env)
+		}
+		ctx.Redirect(http.StatusTemporaryRedirect, loginRedirect)
+		return
+	}
+
+	if user.TOTPEnabled {
+		challengeToken, err := ad.twoFactorChallenge(user)
+		if err != nil {
+			slog.Error("Failed to generate two-factor challenge during OAuth login",
+				slog.String("action", fmt.Sprintf("two_factor_challenge_%s_auth", profile.Provider)),
+				slog.String("user_id", user.ID.Hex()),
+				slog.String("error", err.Error()))
+			utils.SetErrorCookie(ctx, "server_error", ad.Env)
+			ctx.Redirect(http.StatusTemporaryRedirect, loginRedirect)
+			return
+		}
+
+		twoFactorPath := fmt.Sprintf("/%s/auth/2fa", locale)
+		utils.SetAuthTokenCookie(ctx, challengeToken, twoFactorPath, int(domain.TwoFactorChallengeTTL.Seconds()), ad.Env)
+
+		redirectURL := fmt.Sprintf("%s/%s/auth/2fa", ad.Env.FrontEndURL, locale)
+		ctx.Redirect(http.StatusTemporaryRedirect, withPostLoginRedirect(redirectURL, flow.RedirectPath))
+		return
+	}
+
+	if restorable && !ad.restoreAccount(user) {
+		utils.SetErrorCookie(ctx, "server_error", ad.Env)
+		ctx.Redirect(http.StatusTemporaryRedirect, loginRedirect)
+		return
+	}
+
+	ad.cacheProviderAvatar(user)
+
+	sessionID, sessionErr := ad.SessionUseCase.CreateSessionAndUpdateLastLogin(user.ID, user.Plan, user.Email, sessionClient(ctx))
+	if sessionErr != nil {
+		if !utils.IsNormalBusinessError(sessionErr) {
+			slog.Error("Failed to create session during OAuth login",
+				slog.String("action", fmt.Sprintf("session_creation_%s_auth", profile.Provider)),
+				slog.String("user_id", user.ID.Hex()),
+				slog.String("error", sessionErr.Error()))
+		}
+		utils.SetErrorCookie(ctx, "server_error", ad.Env)
+		ctx.Redirect(http.StatusTemporaryRedirect, loginRedirect)
+		return
+	}
+
+	utils.SetSIDCookie(ctx, sessionID, ad.Env)
+
+	redirectURL := fmt.Sprintf("%s/%s/auth/verify", ad.Env.FrontEndURL, locale)
+	ctx.Redirect(http.StatusTemporaryRedirect, withPostLoginRedirect(redirectURL, flow.RedirectPath))
+}
+
+// linkIdentity finishes a link flow started from the settings, where the user is sent back.
+func (ad *AuthDelivery) linkIdentity(ctx *gin.Context, userID bson.ObjectID, profile *domain.OAuthProfile) {
+	settingsRedirect := ad.settingsRedirect(ctx.GetString("locale"))
+
+	if _, err := ad.IdentityUseCase.Link(userID, profile); err != nil {
+		switch {
+		case errors.Is(err, utils.ErrIdentityLinked):
+			utils.SetErrorCookie(ctx, "identity_linked", ad.Env)
+		case errors.Is(err, utils.ErrProviderLinked):
+			utils.SetErrorCookie(ctx, "provider_linked", ad.Env)
+		default:
+			slog.Error("Failed to link identity",
+				slog.String("action", "identity_link"),
+				slog.String("user_id", userID.Hex()),
+				slog.String("provider", string(profile.Provider)),
+				slog.String("error", err.Error()))
+			utils.SetErrorCookie(ctx, "server_error", ad.Env)
+		}
+		ctx.Redirect(http.StatusTemporaryRedirect, settingsRedirect)
+		return
+	}
+
+	ctx.Redirect(http.StatusTemporaryRedirect, fmt.Sprintf("%s?linked=%s", settingsRedirect, profile.Provider))
+}
+
+func (ad *AuthDelivery) settingsRedirect(locale string) string {
+	return fmt.Sprintf("%s/%s/dashboard/settings", ad.Env.FrontEndURL, locale)
+}
+
+func (ad *AuthDelivery) loginRedirect(locale string) string {
+	return fmt.Sprintf("%s/%s/auth/login", ad.Env.FrontEndURL, locale)
+}
+
+// withPostLoginRedirect passes the path a sign-in was started for on to the frontend page that
+// finishes it. The path was checked with utils.SafeRedirectPath when the flow started.
+func withPostLoginRedirect(pageURL, redirectPath string) string {
+	if redirectPath == "" {
+		return pageURL
+	}
+	return pageURL + "?redirect=" + url.QueryEscape(redirectPath)
+}
+
+// startOAuth stores the flow and sends the browser to the provider with a PKCE challenge. The
+// flow is bound to the browser by the oauth_binding cookie, which is kept when it is already
+// set, so that flows started in several tabs all finish.
+func (ad *AuthDelivery) startOAuth(ctx *gin.Context, config oauth2.Config, flow *domain.OAuthState, failureRedirect string) {
+	binding, err := ctx.Cookie("oauth_binding")
+	if err != nil || binding == "" {
+		binding, err = utils.GenerateSessionID()
+	}
+
+	var state string
+	if err == nil {
+		flow.CodeVerifier = oauth2.GenerateVerifier()
+		state, err = ad.OAuthStateUseCase.Create(flow, binding)
+	}
+	if err != nil {
+		slog.Error("Failed to start OAuth flow",
+			slog.String("action", fmt.Sprintf("oauth_state_%s", flow.Provider)),
+			slog.String("error", err.Error()))
+		utils.SetErrorCookie(ctx, "server_error", ad.Env)
+		ctx.Redirect(http.StatusTemporaryRedirect, failureRedirect)
+		return
+	}
+
+	utils.SetOAuthBindingCookie(ctx, binding, int(domain.OAuthStateTTL.Seconds()), ad.Env)
+
+	ctx.Redirect(http.StatusTemporaryRedirect, config.AuthCodeURL(state, oauth2.S256ChallengeOption(flow.CodeVerifier)))
+}
+
+// consumeOAuth returns the flow the callback finishes. When there is none for the state and
+// the browser, it redirects to loginRedirect with an error and returns false.
+func (ad *AuthDelivery) consumeOAuth(ctx *gin.Context, provider types.AuthType, loginRedirect string) (*domain.OAuthState, bool) {
+	state := ctx.Query("state")
+	binding, _ := ctx.Cookie("oauth_binding")
+	if state == "" || binding == "" {
+		utils.SetErrorCookie(ctx, "invalid_state", ad.Env)
+		ctx.Redirect(http.StatusTemporaryRedirect, loginRedirect)
+		return nil, false
+	}
+
+	flow, err := ad.OAuthStateUseCase.Consume(provider, state, binding)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			utils.SetErrorCookie(ctx, "invalid_state", ad.Env)
+		} else {
+			slog.Error("Failed to load OAuth flow",
+				slog.String("action", fmt.Sprintf("oauth_state_%s_callback", provider)),
+				slog.String("error", err.Error()))
+			utils.SetErrorCookie(ctx, "server_error", ad.Env)
+		}
+		ctx.Redirect(http.StatusTemporaryRedirect, loginRedirect)
+		return nil, false
+	}
+
+	return flow, true
+}
+
+// findIdentityUser looks up the user the provider account is linked to, like findLoginUser.
+func (ad *AuthDelivery) findIdentityUser(profile *domain.OAuthProfile) (*domain.User, bool, error) {
+	identity, err := ad.IdentityUseCase.FindByProviderSubject(profile.Provider, profile.Subject)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return ad.findUserByID(identity.UserID)
+}
+
+// sessionClient describes the browser signing in, for the session list.
+func sessionClient(ctx *gin.Context) domain.SessionClient {
+	return domain.SessionClient{
+		UserAgent: ctx.Request.UserAgent(),
+		IPAddress: ctx.ClientIP(),
+	}
+}
+
+// findUserByID looks up the user a verified token or credential names, like findLoginUser.
+func (ad *AuthDelivery) findUserByID(userID bson.ObjectID) (*domain.User, bool, error) {
+	user, err := ad.UserUseCase.FindOneByID(userID)
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return user, false, err
+	}
+
+	deleted, err := ad.UserUseCase.FindRestorableByID(userID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return deleted, true, nil
+}
+
+// githubEmail picks the primary address, or else the first one, that GitHub has verified.
+// Unverified addresses are skipped, they could find the account of someone else.
+func githubEmail(emails []map[string]interface{}) string {
+	email := "Email not available"
+	for _, entry := range emails {
+		address, ok := entry["email"].(string)
+		if verified, _ := entry["verified"].(bool); !ok || !verified {
+			continue
+		}
+		if primary, _ := entry["primary"].(bool); primary {
+			return address
+		}
+		if email == "Email not available" {
+			email = address
+		}
+	}
+	return email
+}
+
+// findLoginUser looks up the user signing in. A deleted account that can still be restored
+// is returned with restorable set, the caller restores it once the sign-in is verified.
+func (ad *AuthDelivery) findLoginUser(email string) (*domain.User, bool, error) {
+	user, err := ad.UserUseCase.FindOneByEmail(email)
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return user, false, err
+	}
+
+	deleted, restoreErr := ad.UserUseCase.FindRestorableByEmail(email)
+	if restoreErr != nil {
+		if !errors.Is(restoreErr, mongo.ErrNoDocuments) {
+			return nil, false, restoreErr
+		}
+		return nil, false, err
+	}
+
+	return deleted, true, nil
+}
+
+func (ad *AuthDelivery) restoreAccount(user *domain.User) bool {
+	erasure, err := ad.UserUseCase.RestoreUser(user.ID, nil)
+	if err != nil {
+		if !utils.IsNormalBusinessError(err) {
+			slog.Error("Failed to restore user on login",
+				slog.String("action", "user_restore_login"),
+				slog.String("user_id", user.ID.Hex()),
+				slog.String("error", err.Error()))
+		}
+		return false
+	}
+	user.DeletedAt = nil
+
+	ad.sendAccountRestoredEmail(user.Email, erasure)
+	return true
+}
+
+// cacheProviderAvatar stores the OAuth provider avatar on our side in the background, so a slow
+// avatar host cannot hold up the sign-in. The provider link keeps working meanwhile, so a failure
+// only means another attempt on the next login. It works on a copy, the request keeps using user.
+func (ad *AuthDelivery) cacheProviderAvatar(user *domain.User) {
+	userCopy := *user
+	go func() {
+		if err := ad.AvatarUseCase.CacheProviderAvatar(&userCopy); err != nil {
+			slog.Warn("Provider avatar could not be cached",
+				slog.String("user_id", userCopy.ID.Hex()),
+				slog.String("error", err.Error()))
+		}
+	}()
+}
+
+// sendAccountDeletedEmail links to restoring this erasure only, so the link of an earlier
+// deletion cannot undo a later one.
+func (ad *AuthDelivery) sendAccountDeletedEmail(ctx *gin.Context, email string, erasure *domain.Erasure) {
+	jwtClaims := jwt.MapClaims{
+		"process":    types.RestoreAccount,
+		"id":         erasure.UserID,
+		"erasure_id": erasure.ID,
+		"email":      email,
+	}
+
+	tokenString, err := utils.GenerateJWT(jwtClaims, ad.Env, erasure.ScheduledAt.Unix())
+	if err == nil {
+		restoreLink := fmt.Sprintf("%s/%s/auth/account/restore?token=%s", ad.Env.FrontEndURL, ctx.GetString("locale"), url.QueryEscape(tokenString))
+		_, err = ad.ResendUseCase.SendAccountDeletedEmail(email, erasure.ScheduledAt, restoreLink)
+	}
+	if err != nil {
+		slog.Warn("Account deleted email could not be sent",
+			slog.String("user_id", erasure.UserID.Hex()),
+			slog.String("error", err.Error()))
+	}
+}
+
+func (ad *AuthDelivery) sendAccountRestoredEmail(email string, erasure *domain.Erasure) {
+	if erasure.CancelledSubscription != nil {
+		slog.Info("Restored account had its subscription cancelled",
+			slog.String("user_id", erasure.UserID.Hex()),
+			slog.String("subscription_id", erasure.CancelledSubscription.SubscriptionID))
+	}
+
+	dashboardLink := fmt.Sprintf("%s/en/dashboard", ad.Env.FrontEndURL)
+	if _, err := ad.ResendUseCase.SendAccountRestoredEmail(email, erasure.CancelledSubscription, dashboardLink); err != nil {
+		slog.Warn("Account restored email could not be sent",
+			slog.String("user_id", erasure.UserID.Hex()),
+			slog.String("error", err.Error()))
+	}
 }
\ No newline at end of file
@@ -0,0 +1,374 @@
+package delivery
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwa0x2/SmartSRT-Backend/domain"
+	"github.com/kwa0x2/SmartSRT-Backend/domain/types"
+	"github.com/kwa0x2/SmartSRT-Backend/utils"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+type OrganizationDelivery struct {
+	OrganizationUseCase domain.OrganizationUseCase
+}
+
+func (od *OrganizationDelivery) Create(ctx *gin.Context) {
+	user, exists := ctx.Get("user")
+	if !exists {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	userData := user.(*domain.User)
+
+	var body domain.CreateOrganizationBody
+	if err := ctx.ShouldBindJSON(&body); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("Invalid request body. Please check your input."))
+		return
+	}
+
+	org, err := od.OrganizationUseCase.Create(userData, body.Name)
+	if err != nil {
+		if errors.Is(err, utils.ErrOrgPlanRequired) {
+			ctx.JSON(http.StatusForbidden, utils.NewMessageResponse("Creating an organization requires a paid plan."))
+			return
+		}
+		if errors.Is(err, utils.ErrOrgLimitReached) {
+			ctx.JSON(http.StatusConflict, utils.NewMessageResponse("You already own the maximum number of organizations."))
+			return
+		}
+		slog.Error("Failed to create organization",
+			slog.String("action", "organization_create"),
+			slog.String("user_id", userData.ID.Hex()),
+			slog.String("error", err.Error()))
+		ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, org)
+}
+
+func (od *OrganizationDelivery) FindAll(ctx *gin.Context) {
+	user, exists := ctx.Get("user")
+	if !exists {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	userData := user.(*domain.User)
+
+	memberships, err := od.OrganizationUseCase.FindMembershipsByUserID(userData)
+	if err != nil {
+		if !utils.IsNormalBusinessError(err) {
+			slog.Error("Failed to lookup organizations",
+				slog.String("action", "organization_list"),
+				slog.String("user_id", userData.ID.Hex()),
+				slog.String("error", err.Error()))
+		}
+		ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred while retrieving organizations. Please try again later or contact support."))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, memberships)
+}
+
+func (od *OrganizationDelivery) FindMembers(ctx *gin.Context) {
+	member, ok := od.requireMember(ctx)
+	if !ok {
+		return
+	}
+
+	members, err := od.OrganizationUseCase.FindMembers(member.OrgID)
+	if err != nil {
+		if !utils.IsNormalBusinessError(err) {
+			slog.Error("Failed to lookup organization members",
+				slog.String("action", "organization_member_list"),
+				slog.String("org_id", member.OrgID.Hex()),
+				slog.String("error", err.Error()))
+		}
+		ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred while retrieving members. Please try again later or contact support."))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, members)
+}
+
+func (od *OrganizationDelivery) UpdateMemberRole(ctx *gin.Context) {
+	actor, ok := od.requireMember(ctx)
+	if !ok {
+		return
+	}
+
+	userID, err := bson.ObjectIDFromHex(ctx.Param("userID"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("Invalid user ID."))
+		return
+	}
+
+	var body domain.UpdateMemberRoleBody
+	if err = ctx.ShouldBindJSON(&body); err != nil || !body.Role.IsValid() {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("Invalid request body. Role must be admin or member."))
+		return
+	}
+
+	if err = od.OrganizationUseCase.UpdateMemberRole(actor, userID, body.Role); err != nil {
+		od.respondMemberError(ctx, "organization_member_role_update", actor, userID, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.NewMessageResponse("Member role updated."))
+}
+
+func (od *OrganizationDelivery) RemoveMember(ctx *gin.Context) {
+	actor, ok := od.requireMember(ctx)
+	if !ok {
+		return
+	}
+
+	userID, err := bson.ObjectIDFromHex(ctx.Param("userID"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("Invalid user ID."))
+		return
+	}
+
+	if err = od.OrganizationUseCase.RemoveMember(actor, userID); err != nil {
+		od.respondMemberError(ctx, "organization_member_remove", actor, userID, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.NewMessageResponse("Member removed from the organization."))
+}
+
+func (od *OrganizationDelivery) Activate(ctx *gin.Context) {
+	member, ok := od.requireMember(ctx)
+	if !ok {
+		return
+	}
+
+	if err := od.OrganizationUseCase.SetActive(member.UserID, &member.OrgID); err != nil {
+		od.respondMemberError(ctx, "organization_activate", member, member.UserID, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.NewMessageResponse("Switched to the organization."))
+}
+
+func (od *OrganizationDelivery) Deactivate(ctx *gin.Context) {
+	user, exists := ctx.Get("user")
+	if !exists {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	userData := user.(*domain.User)
+
+	if err := od.OrganizationUseCase.SetActive(userData.ID, nil); err != nil {
+		slog.Error("Failed to switch to personal account",
+			slog.String("action", "organization_deactivate"),
+			slog.String("user_id", userData.ID.Hex()),
+			slog.String("error", err.Error()))
+		ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.NewMessageResponse("Switched to your personal account."))
+}
+
+func (od *OrganizationDelivery) InviteMember(ctx *gin.Context) {
+	actor, ok := od.requireMember(ctx)
+	if !ok {
+		return
+	}
+
+	user, _ := ctx.Get("user")
+	userData := user.(*domain.User)
+
+	var body domain.InviteMemberBody
+	if err := ctx.ShouldBindJSON(&body); err != nil || !body.Role.IsValid() {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("Invalid request body. Please provide an email and a role of admin or member."))
+		return
+	}
+
+	invitation, err := od.OrganizationUseCase.InviteMember(actor, userData, body.Email, body.Role, ctx.GetString("locale"))
+	if err != nil {
+		od.respondMemberError(ctx, "organization_invitation_create", actor, userData.ID, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, invitation)
+}
+
+func (od *OrganizationDelivery) FindPendingInvitations(ctx *gin.Context) {
+	member, ok := od.requireMember(ctx)
+	if !ok {
+		return
+	}
+
+	if !member.Role.CanManageMembers() {
+		ctx.JSON(http.StatusForbidden, utils.NewMessageResponse("Only owners and admins can view invitations."))
+		return
+	}
+
+	invitations, err := od.OrganizationUseCase.FindPendingInvitations(member.OrgID)
+	if err != nil {
+		if !utils.IsNormalBusinessError(err) {
+			slog.Error("Failed to lookup organization invitations",
+				slog.String("action", "organization_invitation_list"),
+				slog.String("org_id", member.OrgID.Hex()),
+				slog.String("error", err.Error()))
+		}
+		ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred while retrieving invitations. Please try again later or contact support."))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, invitations)
+}
+
+func (od *OrganizationDelivery) ResendInvitation(ctx *gin.Context) {
+	actor, ok := od.requireMember(ctx)
+	if !ok {
+		return
+	}
+
+	user, _ := ctx.Get("user")
+	userData := user.(*domain.User)
+
+	invitationID, err := bson.ObjectIDFromHex(ctx.Param("invitationID"))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, utils.NewMessageResponse("Invitation not found."))
+		return
+	}
+
+	if err = od.OrganizationUseCase.ResendInvitation(actor, userData, invitationID, ctx.GetString("locale")); err != nil {
+		od.respondMemberError(ctx, "organization_invitation_resend", actor, userData.ID, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.NewMessageResponse("Invitation sent again."))
+}
+
+func (od *OrganizationDelivery) RevokeInvitation(ctx *gin.Context) {
+	actor, ok := od.requireMember(ctx)
+	if !ok {
+		return
+	}
+
+	invitationID, err := bson.ObjectIDFromHex(ctx.Param("invitationID"))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, utils.NewMessageResponse("Invitation not found."))
+		return
+	}
+
+	if err = od.OrganizationUseCase.RevokeInvitation(actor, invitationID); err != nil {
+		od.respondMemberError(ctx, "organization_invitation_revoke", actor, actor.UserID, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.NewMessageResponse("Invitation revoked."))
+}
+
+func (od *OrganizationDelivery) AcceptInvitation(ctx *gin.Context) {
+	user, exists := ctx.Get("user")
+	if !exists {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	userData := user.(*domain.User)
+
+	var body domain.AcceptInvitationBody
+	if err := ctx.ShouldBindJSON(&body); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("Invalid request body. Please check your input."))
+		return
+	}
+
+	org, err := od.OrganizationUseCase.AcceptInvitation(userData, body.Token)
+	if err != nil {
+		switch {
+		case errors.Is(err, utils.ErrInvitationInvalid):
+			ctx.JSON(http.StatusGone, utils.NewMessageResponse("This invitation is no longer valid. Please ask for a new one."))
+		case errors.Is(err, utils.ErrInvitationEmailMismatch):
+			ctx.JSON(http.StatusForbidden, utils.NewMessageResponse("This invitation was sent to a different email address."))
+		case errors.Is(err, utils.ErrAlreadyOrgMember):
+			ctx.JSON(http.StatusConflict, utils.NewMessageResponse("You are already a member of this organization."))
+		default:
+			slog.Error("Failed to accept organization invitation",
+				slog.String("action", "organization_invitation_accept"),
+				slog.String("user_id", userData.ID.Hex()),
+				slog.String("error", err.Error()))
+			ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, org)
+}
+
+// requireMember resolves the :orgID path parameter to the caller's membership. Non-members get
+// the same 404 as unknown organizations.
+func (od *OrganizationDelivery) requireMember(ctx *gin.Context) (*domain.OrganizationMember, bool) {
+	user, exists := ctx.Get("user")
+	if !exists {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return nil, false
+	}
+
+	userData := user.(*domain.User)
+
+	orgID, err := bson.ObjectIDFromHex(ctx.Param("orgID"))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, utils.NewMessageResponse("Organization not found."))
+		return nil, false
+	}
+
+	member, err := od.OrganizationUseCase.FindMember(orgID, userData.ID)
+	if err != nil {
+		if !utils.IsNormalBusinessError(err) {
+			slog.Error("Failed to lookup organization membership",
+				slog.String("action", "organization_membership_lookup"),
+				slog.String("org_id", orgID.Hex()),
+				slog.String("user_id", userData.ID.Hex()),
+				slog.String("error", err.Error()))
+			ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+			return nil, false
+		}
+		ctx.JSON(http.StatusNotFound, utils.NewMessageResponse("Organization not found."))
+		return nil, false
+	}
+
+	return member, true
+}
+
+func (od *OrganizationDelivery) respondMemberError(ctx *gin.Context, action string, actor *domain.OrganizationMember, userID bson.ObjectID, err error) {
+	switch {
+	case errors.Is(err, utils.ErrNotOrgMember):
+		ctx.JSON(http.StatusNotFound, utils.NewMessageResponse("Member not found."))
+	case errors.Is(err, utils.ErrInvitationInvalid):
+		ctx.JSON(http.StatusNotFound, utils.NewMessageResponse("Invitation not found."))
+	case errors.Is(err, utils.ErrInvitationExists):
+		ctx.JSON(http.StatusConflict, utils.NewMessageResponse("An invitation is already pending for this email. Resend it instead."))
+	case errors.Is(err, utils.ErrAlreadyOrgMember):
+		ctx.JSON(http.StatusConflict, utils.NewMessageResponse("This user is already a member of the organization."))
+	case errors.Is(err, utils.ErrOrgOwnerImmutable):
+		ctx.JSON(http.StatusConflict, utils.NewMessageResponse("The organization owner cannot be changed or removed."))
+	case errors.Is(err, utils.ErrOrgRoleForbidden):
+		message := "Only owners and admins can manage members."
+		if actor.Role == types.OrgAdmin {
+			message = "Admins can only manage members, not other admins."
+		}
+		ctx.JSON(http.StatusForbidden, utils.NewMessageResponse(message))
+	default:
+		if !utils.IsNormalBusinessError(err) {
+			slog.Error("Failed to update organization member",
+				slog.String("action", action),
+				slog.String("org_id", actor.OrgID.Hex()),
+				slog.String("user_id", userID.Hex()),
+				slog.String("error", err.Error()))
+		}
+		ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+	}
+}
@@ -0,0 +1,27 @@
+package delivery
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwa0x2/SmartSRT-Backend/domain"
+	"github.com/kwa0x2/SmartSRT-Backend/utils"
+)
+
+type PlanDelivery struct {
+	PlanUseCase domain.PlanUseCase
+}
+
+func (pd *PlanDelivery) FindAll(ctx *gin.Context) {
+	plans, err := pd.PlanUseCase.FindAll()
+	if err != nil {
+		slog.Error("Failed to lookup plan catalogue",
+			slog.String("action", "plan_catalogue_lookup"),
+			slog.String("error", err.Error()))
+		ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred while retrieving plans. Please try again later or contact support."))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, plans)
+}
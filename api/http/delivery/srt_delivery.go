@@ -1,11 +1,14 @@
 package delivery
 
 import (
+	"errors"
+	"fmt"
 	"io"
 	"log/slog"
 	"mime/multipart"
 	"net/http"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/kwa0x2/SmartSRT-Backend/domain/types"
@@ -16,11 +19,16 @@ import (
 	"github.com/kwa0x2/SmartSRT-Backend/rabbitmq"
 	"github.com/kwa0x2/SmartSRT-Backend/utils"
 	"github.com/kwa0x2/SmartSRT-Backend/utils/validator"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
 )
 
 type SRTDelivery struct {
-	SRTUseCase domain.SRTUseCase
-	RabbitMQ   *domain.RabbitMQ
+	SRTUseCase   domain.SRTUseCase
+	UsageUseCase domain.UsageUseCase
+	PlanUseCase  domain.PlanUseCase
+	RabbitMQ     *domain.RabbitMQ
+	JobEventHub  *domain.JobEventHub
 }
 
 func (sd *SRTDelivery) ConvertFileToSRT(ctx *gin.Context) {
@@ -33,6 +41,20 @@ func (sd *SRTDelivery) ConvertFileToSRT(ctx *gin.Context) {
 	}
 
 	userData := user.(*domain.User)
+	org := utils.GetActiveOrganization(ctx)
+	accountID := domain.AccountID(userData, org)
+	accountPlan := domain.AccountPlan(userData, org)
+
+	plan, err := sd.PlanUseCase.FindByName(accountPlan)
+	if err != nil {
+		slog.Error("Failed to lookup plan for conversion",
+			slog.String("action", "plan_lookup"),
+			slog.String("user_id", userData.ID.Hex()),
+			slog.String("plan", string(accountPlan)),
+			slog.String("error", err.Error()))
+		ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
 
 	file, header, err := ctx.Request.FormFile("file")
 	if err != nil {
@@ -48,13 +70,22 @@ func (sd *SRTDelivery) ConvertFileToSRT(ctx *gin.Context) {
 
 	fileType := filepath.Ext(header.Filename)
 
-	if userData.Plan != types.Pro && fileType == ".wav" {
-		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("You need to upgrade to the Pro plan to upload WAV files."))
+	if !utils.IsValidMediaFile(fileType) {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("Invalid file format. Only mp4, mp3 and wav files are accepted."))
 		return
 	}
 
-	if !utils.IsValidMediaFile(fileType) {
-		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("Invalid file format. Only mp4, mp3 and wav files are accepted."))
+	if !plan.AllowsFormat(fileType) {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse(
+			fmt.Sprintf("Your %s plan does not support %s files. Please upgrade your plan.", plan.DisplayName, strings.TrimPrefix(fileType, ".")),
+		))
+		return
+	}
+
+	if header.Size > plan.MaxFileSize {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse(
+			fmt.Sprintf("File size exceeds the limit. Maximum size is %d MB for your plan.", plan.MaxFileSize>>20),
+		))
 		return
 	}
 
@@ -70,10 +101,7 @@ func (sd *SRTDelivery) ConvertFileToSRT(ctx *gin.Context) {
 		return
 	}
 
-	maxDuration := 30 * time.Second
-	if userData.Plan == types.Pro {
-		maxDuration = 5 * time.Minute
-	}
+	maxDuration := time.Duration(plan.MaxFileDuration * float64(time.Second))
 
 	fileDuration := time.Duration(duration * float64(time.Second))
 	if fileDuration > maxDuration {
@@ -105,6 +133,7 @@ func (sd *SRTDelivery) ConvertFileToSRT(ctx *gin.Context) {
 
 	msg := domain.ConversionMessage{
 		UserID:              userData.ID,
+		OrgID:               orgIDOf(org),
 		WordsPerLine:        params.WordsPerLine,
 		Punctuation:         params.Punctuation,
 		ConsiderPunctuation: params.ConsiderPunctuation,
@@ -114,39 +143,167 @@ func (sd *SRTDelivery) ConvertFileToSRT(ctx *gin.Context) {
 		FileSize:            header.Size,
 		FileDuration:        duration,
 		Email:               userData.Email,
+		Sandbox:             utils.IsSandbox(ctx),
 	}
 
-	response, err := rabbitmq.PublishConversionMessage(sd.RabbitMQ, ctx, msg)
-	if err != nil {
-		if err.Error() == "Response timeout" {
-			if !utils.IsNormalBusinessError(err) {
-				slog.Error("RabbitMQ conversion request timeout",
-					slog.String("action", "rabbitmq_conversion_timeout"),
-					slog.String("file_id", fileID),
-					slog.String("user_id", userData.ID.Hex()),
-					slog.String("error", err.Error()))
+	// sandbox conversions never touch the usage balance
+	if !msg.Sandbox {
+		if err = sd.UsageUseCase.ReserveUsage(accountID, fileID, duration); err != nil {
+			if errors.Is(err, utils.ErrLimitReached) {
+				ctx.JSON(http.StatusForbidden, utils.NewMessageResponse("You have reached your monthly usage limit. Please upgrade your plan or wait for your usage to renew."))
+				return
 			}
-			ctx.JSON(http.StatusAccepted, gin.H{
-				"message": "Your file is being processed. You will receive an email when it's ready.",
-				"file_id": fileID,
-			})
+			slog.Error("Failed to reserve usage for conversion",
+				slog.String("action", "usage_reservation"),
+				slog.String("file_id", fileID),
+				slog.String("user_id", userData.ID.Hex()),
+				slog.String("error", err.Error()))
+			ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("Failed to queue conversion. Please try again."))
 			return
-		} else {
-			if !utils.IsNormalBusinessError(err) {
-				slog.Error("Failed to publish conversion message to RabbitMQ",
-					slog.String("action", "rabbitmq_conversion_publish"),
+		}
+	}
+
+	position, err := rabbitmq.PublishConversionMessage(sd.RabbitMQ, ctx, msg)
+	if err != nil {
+		if !msg.Sandbox {
+			if releaseErr := sd.UsageUseCase.ReleaseReservation(fileID, types.ReleaseFailed); releaseErr != nil {
+				slog.Error("Failed to release usage reservation after publish error",
+					slog.String("action", "usage_reservation_release"),
 					slog.String("file_id", fileID),
 					slog.String("user_id", userData.ID.Hex()),
-					slog.String("error", err.Error()))
+					slog.String("error", releaseErr.Error()))
 			}
-			ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("Failed to queue conversion. Please try again."))
+		}
+		if !utils.IsNormalBusinessError(err) {
+			slog.Error("Failed to publish conversion message to RabbitMQ",
+				slog.String("action", "rabbitmq_conversion_publish"),
+				slog.String("file_id", fileID),
+				slog.String("user_id", userData.ID.Hex()),
+				slog.String("error", err.Error()))
+		}
+		ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("Failed to queue conversion. Please try again."))
+		return
+	}
+
+	middleware.RecordSRTMetrics("queued_success", time.Since(startTime))
+	ctx.JSON(http.StatusAccepted, gin.H{
+		"message":        "Your file is being processed. You will receive an email when it's ready.",
+		"file_id":        fileID,
+		"queue_position": position,
+		"events_url":     fmt.Sprintf("/api/v1/srt/jobs/%s/events", fileID),
+		"sandbox":        msg.Sandbox,
+	})
+}
+
+func (sd *SRTDelivery) CancelJob(ctx *gin.Context) {
+	user, exists := ctx.Get("user")
+	if !exists {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	userData := user.(*domain.User)
+	fileID := ctx.Param("fileID")
+
+	// any member can cancel a queued job billed to their organization
+	reservation, err := sd.UsageUseCase.FindActiveReservation(fileID)
+	if err != nil || reservation.UserID != domain.AccountID(userData, utils.GetActiveOrganization(ctx)) {
+		if err != nil && !utils.IsNormalBusinessError(err) {
+			slog.Error("Failed to lookup usage reservation for cancellation",
+				slog.String("action", "job_cancellation_lookup"),
+				slog.String("file_id", fileID),
+				slog.String("user_id", userData.ID.Hex()),
+				slog.String("error", err.Error()))
+		}
+		ctx.JSON(http.StatusNotFound, utils.NewMessageResponse("Job not found or it has already finished."))
+		return
+	}
+
+	if last, known := sd.JobEventHub.Last(fileID); known && last.Status != types.JobQueued {
+		ctx.JSON(http.StatusConflict, utils.NewMessageResponse("The job is already being processed and can no longer be cancelled."))
+		return
+	}
+
+	if err = sd.UsageUseCase.ReleaseReservation(fileID, types.ReleaseCancelled); err != nil {
+		if errors.Is(err, utils.ErrReservationNotActive) {
+			ctx.JSON(http.StatusNotFound, utils.NewMessageResponse("Job not found or it has already finished."))
 			return
 		}
+		slog.Error("Failed to release usage reservation on cancellation",
+			slog.String("action", "job_cancellation_release"),
+			slog.String("file_id", fileID),
+			slog.String("user_id", userData.ID.Hex()),
+			slog.String("error", err.Error()))
+		ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
 
+	event := domain.JobEvent{
+		FileID:    fileID,
+		UserID:    userData.ID,
+		Status:    types.JobCancelled,
+		Message:   "The job was cancelled.",
+		Timestamp: time.Now().UTC(),
+	}
+	if err = rabbitmq.PublishJobEvent(sd.RabbitMQ, event); err != nil {
+		slog.Warn("Failed to publish job cancellation event",
+			slog.String("file_id", fileID),
+			slog.String("error", err.Error()))
 	}
 
-	middleware.RecordSRTMetrics("queued_success", time.Since(startTime))
-	ctx.JSON(response.StatusCode, response)
+	ctx.JSON(http.StatusOK, utils.NewMessageResponse("Job cancelled successfully."))
+}
+
+func (sd *SRTDelivery) StreamJobEvents(ctx *gin.Context) {
+	user, exists := ctx.Get("user")
+	if !exists {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	userData := user.(*domain.User)
+	fileID := ctx.Param("fileID")
+
+	last, known := sd.JobEventHub.Last(fileID)
+	if known && last.UserID != userData.ID {
+		ctx.JSON(http.StatusNotFound, utils.NewMessageResponse("Job not found."))
+		return
+	}
+
+	events, unsubscribe := sd.JobEventHub.Subscribe(fileID)
+	defer unsubscribe()
+
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("Connection", "keep-alive")
+	ctx.Header("X-Accel-Buffering", "no")
+
+	if known {
+		ctx.SSEvent("progress", last)
+		ctx.Writer.Flush()
+		if last.Status.IsTerminal() {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(domain.JobEventHeartbeat)
+	defer heartbeat.Stop()
+
+	ctx.Stream(func(w io.Writer) bool {
+		select {
+		case <-ctx.Request.Context().Done():
+			return false
+		case event := <-events:
+			if event.UserID != userData.ID {
+				return true
+			}
+			ctx.SSEvent("progress", event)
+			return !event.Status.IsTerminal()
+		case <-heartbeat.C:
+			ctx.SSEvent("ping", time.Now().UTC().Unix())
+			return true
+		}
+	})
 }
 
 func (sd *SRTDelivery) FindHistories(ctx *gin.Context) {
@@ -158,8 +315,18 @@ func (sd *SRTDelivery) FindHistories(ctx *gin.Context) {
 
 	userData := user.(*domain.User)
 
-	srtHistoriesData, err := sd.SRTUseCase.FindHistoriesByUserID(userData.ID)
+	query, err := validator.ValidateHistoryQuery(ctx)
 	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse(err.Error()))
+		return
+	}
+
+	srtHistoriesData, err := sd.SRTUseCase.FindHistories(userData.ID, orgIDOf(utils.GetActiveOrganization(ctx)), utils.IsSandbox(ctx), *query)
+	if err != nil {
+		if errors.Is(err, utils.ErrCursorInvalid) {
+			ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("Invalid cursor. Request the first page again."))
+			return
+		}
 		if !utils.IsNormalBusinessError(err) {
 			slog.Error("Failed to lookup SRT history",
 				slog.String("action", "srt_history_lookup"),
@@ -172,3 +339,187 @@ func (sd *SRTDelivery) FindHistories(ctx *gin.Context) {
 
 	ctx.JSON(http.StatusOK, srtHistoriesData)
 }
+
+// DownloadHistory redirects to a short-lived presigned link for the subtitles, or for the
+// source media with ?file=media.
+func (sd *SRTDelivery) DownloadHistory(ctx *gin.Context) {
+	user, exists := ctx.Get("user")
+	if !exists {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	userData := user.(*domain.User)
+
+	historyID, err := bson.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("Invalid history ID."))
+		return
+	}
+
+	file := types.DownloadFile(ctx.DefaultQuery("file", string(types.DownloadSRT)))
+	if !file.IsValid() {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("file must be srt or media."))
+		return
+	}
+
+	history, err := sd.SRTUseCase.FindHistory(userData.ID, orgIDOf(utils.GetActiveOrganization(ctx)), utils.IsSandbox(ctx), historyID)
+	if err == nil {
+		var url string
+		if url, err = sd.SRTUseCase.CreateDownloadURL(history, file, domain.SRTDownloadURLTTL); err == nil {
+			ctx.Header("Cache-Control", "no-store")
+			ctx.Redirect(http.StatusFound, url)
+			return
+		}
+	}
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		ctx.JSON(http.StatusNotFound, utils.NewMessageResponse("File not found."))
+		return
+	}
+	slog.Error("Failed to create download link",
+		slog.String("action", "srt_history_download"),
+		slog.String("user_id", userData.ID.Hex()),
+		slog.String("history_id", historyID.Hex()),
+		slog.String("error", err.Error()))
+	ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+}
+
+func (sd *SRTDelivery) DeleteHistory(ctx *gin.Context) {
+	historyID, err := bson.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("Invalid history ID."))
+		return
+	}
+
+	deleted, ok := sd.deleteHistories(ctx, []bson.ObjectID{historyID})
+	if !ok {
+		return
+	}
+	if deleted == 0 {
+		ctx.JSON(http.StatusNotFound, utils.NewMessageResponse("File not found."))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.NewMessageResponse("Conversion deleted."))
+}
+
+func (sd *SRTDelivery) DeleteHistories(ctx *gin.Context) {
+	var body domain.DeleteHistoriesBody
+	if err := ctx.ShouldBindJSON(&body); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("Invalid request body. Send between 1 and 100 ids."))
+		return
+	}
+
+	historyIDs := make([]bson.ObjectID, 0, len(body.IDs))
+	for _, id := range body.IDs {
+		historyID, err := bson.ObjectIDFromHex(id)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("Invalid history ID: "+id))
+			return
+		}
+		historyIDs = append(historyIDs, historyID)
+	}
+
+	deleted, ok := sd.deleteHistories(ctx, historyIDs)
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"deleted": deleted})
+}
+
+func (sd *SRTDelivery) PinHistory(ctx *gin.Context) {
+	sd.setPinned(ctx, true)
+}
+
+func (sd *SRTDelivery) UnpinHistory(ctx *gin.Context) {
+	sd.setPinned(ctx, false)
+}
+
+// setPinned marks a conversion as kept or not kept by the retention job. Pinning needs a plan
+// with the pin feature, unpinning is always allowed so items stay manageable after a downgrade.
+func (sd *SRTDelivery) setPinned(ctx *gin.Context, pinned bool) {
+	user, exists := ctx.Get("user")
+	if !exists {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	userData := user.(*domain.User)
+	org := utils.GetActiveOrganization(ctx)
+
+	historyID, err := bson.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("Invalid history ID."))
+		return
+	}
+
+	if pinned {
+		accountPlan := domain.AccountPlan(userData, org)
+		plan, err := sd.PlanUseCase.FindByName(accountPlan)
+		if err != nil {
+			slog.Error("Failed to lookup plan for pinning",
+				slog.String("action", "plan_lookup"),
+				slog.String("user_id", userData.ID.Hex()),
+				slog.String("plan", string(accountPlan)),
+				slog.String("error", err.Error()))
+			ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+			return
+		}
+		if !plan.HasFeature(domain.FeaturePinHistory) {
+			ctx.JSON(http.StatusForbidden, utils.NewMessageResponse("Pinning conversions is not available on your plan. Please upgrade."))
+			return
+		}
+	}
+
+	if err = sd.SRTUseCase.SetPinned(userData.ID, orgIDOf(org), utils.IsSandbox(ctx), historyID, pinned); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			ctx.JSON(http.StatusNotFound, utils.NewMessageResponse("File not found."))
+			return
+		}
+		slog.Error("Failed to update SRT history pin",
+			slog.String("action", "srt_history_pin"),
+			slog.String("user_id", userData.ID.Hex()),
+			slog.String("history_id", historyID.Hex()),
+			slog.String("error", err.Error()))
+		ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	if pinned {
+		ctx.JSON(http.StatusOK, utils.NewMessageResponse("Conversion pinned."))
+		return
+	}
+	ctx.JSON(http.StatusOK, utils.NewMessageResponse("Conversion unpinned."))
+}
+
+func (sd *SRTDelivery) deleteHistories(ctx *gin.Context, historyIDs []bson.ObjectID) (int, bool) {
+	user, exists := ctx.Get("user")
+	if !exists {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return 0, false
+	}
+
+	userData := user.(*domain.User)
+
+	deleted, err := sd.SRTUseCase.DeleteHistories(userData.ID, orgIDOf(utils.GetActiveOrganization(ctx)), utils.IsSandbox(ctx), historyIDs)
+	if err != nil {
+		slog.Error("Failed to delete SRT history",
+			slog.String("action", "srt_history_delete"),
+			slog.String("user_id", userData.ID.Hex()),
+			slog.Int("count", len(historyIDs)),
+			slog.String("error", err.Error()))
+		ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return 0, false
+	}
+
+	return deleted, true
+}
+
+func orgIDOf(org *domain.Organization) *bson.ObjectID {
+	if org == nil {
+		return nil
+	}
+	return &org.ID
+}
@@ -22,7 +22,7 @@ func (sd *SubscriptonDelivery) GetRemainingDays(ctx *gin.Context) {
 
 	userData := user.(*domain.User)
 
-	days, err := sd.SubscriptionUseCase.GetRemainingDaysByUserID(userData.ID)
+	days, err := sd.SubscriptionUseCase.GetRemainingDaysByUserID(domain.AccountID(userData, utils.GetActiveOrganization(ctx)))
 	if err != nil {
 		if !utils.IsNormalBusinessError(err) {
 			slog.Error("Failed to get remaining days",
@@ -3,6 +3,7 @@ package delivery
 import (
 	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/kwa0x2/SmartSRT-Backend/domain"
@@ -22,7 +23,7 @@ func (ud *UsageDelivery) FindOne(ctx *gin.Context) {
 
 	userData := user.(*domain.User)
 
-	usageData, err := ud.UsageUseCase.FindOneByUserID(userData.ID)
+	usageData, err := ud.UsageUseCase.FindOneByUserID(domain.AccountID(userData, utils.GetActiveOrganization(ctx)))
 	if err != nil {
 		if !utils.IsNormalBusinessError(err) {
 			slog.Error("Failed to lookup usage data",
@@ -35,6 +36,67 @@ func (ud *UsageDelivery) FindOne(ctx *gin.Context) {
 	}
 
 	ctx.JSON(http.StatusOK, gin.H{
-		"MonthlyUsage": usageData.MonthlyUsage,
+		"MonthlyUsage":  usageData.MonthlyUsage,
+		"ReservedUsage": usageData.ReservedUsage,
+		"BonusBalance":  usageData.BonusBalance,
+		"UsageLimit":    usageData.UsageLimit,
+		"PeriodStart":   usageData.StartDate,
+		"PeriodEnd":     usageData.EndDate,
 	})
 }
+
+// FindHistory serves the usage ledger. from and to are YYYY-MM-DD dates in UTC, to is inclusive;
+// without them the last 30 days are returned.
+func (ud *UsageDelivery) FindHistory(ctx *gin.Context) {
+	user, exists := ctx.Get("user")
+	if !exists {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	userData := user.(*domain.User)
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	from := today.AddDate(0, 0, -29)
+	to := today.AddDate(0, 0, 1)
+
+	if value := ctx.Query("from"); value != "" {
+		parsed, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("Invalid 'from' date. Use the YYYY-MM-DD format."))
+			return
+		}
+		from = parsed
+	}
+
+	if value := ctx.Query("to"); value != "" {
+		parsed, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("Invalid 'to' date. Use the YYYY-MM-DD format."))
+			return
+		}
+		to = parsed.AddDate(0, 0, 1)
+	}
+
+	if !from.Before(to) {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("The 'from' date must not be after the 'to' date."))
+		return
+	}
+
+	if to.Sub(from) > domain.UsageHistoryMaxRange {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("The date range cannot be longer than one year."))
+		return
+	}
+
+	history, err := ud.UsageUseCase.FindHistory(domain.AccountID(userData, utils.GetActiveOrganization(ctx)), from, to)
+	if err != nil {
+		slog.Error("Failed to lookup usage history",
+			slog.String("action", "usage_history_lookup"),
+			slog.String("user_id", userData.ID.Hex()),
+			slog.String("error", err.Error()))
+		ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred while retrieving usage history. Please try again later or contact support."))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, history)
+}
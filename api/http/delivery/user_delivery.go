@@ -1,17 +1,29 @@
 package delivery
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/kwa0x2/SmartSRT-Backend/domain"
+	"github.com/kwa0x2/SmartSRT-Backend/rabbitmq"
 	"github.com/kwa0x2/SmartSRT-Backend/utils"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
 )
 
 type UserDelivery struct {
 	UserUseCase        domain.UserUseCase
 	UserBaseRepository domain.BaseRepository[*domain.User]
+	DataExportUseCase  domain.DataExportUseCase
+	SinchUseCase       domain.SinchUseCase
+	AvatarUseCase      domain.AvatarUseCase
+	RabbitMQ           *domain.RabbitMQ
 }
 
 func (ud *UserDelivery) GetProfileFromSession(ctx *gin.Context) {
@@ -33,14 +45,245 @@ func (ud *UserDelivery) GetProfileFromSession(ctx *gin.Context) {
 	usageData := usage.(*domain.Usage)
 
 	response := gin.H{
-		"user":        userData,
-		"usage_limit": usageData.UsageLimit,
+		"user":         userData,
+		"usage_limit":  usageData.UsageLimit,
+		"organization": utils.GetActiveOrganization(ctx),
 	}
 
 	ctx.JSON(http.StatusOK, response)
 	
 }
 
+func (ud *UserDelivery) UpdateProfile(ctx *gin.Context) {
+	user, exists := ctx.Get("user")
+	if !exists {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	userData := user.(*domain.User)
+
+	var body domain.UpdateProfileBody
+	if err := ctx.ShouldBindJSON(&body); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("Invalid request body. Please check your input."))
+		return
+	}
+
+	var update domain.ProfileUpdate
+	if body.Name != nil {
+		name := strings.TrimSpace(*body.Name)
+		if name == "" {
+			ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("Name cannot be empty."))
+			return
+		}
+		update.Name = &name
+	}
+
+	if body.PhoneNumber != nil && *body.PhoneNumber != userData.PhoneNumber {
+		if body.OTP == "" {
+			ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("Please verify the new phone number with the code sent to it."))
+			return
+		}
+
+		valid, err := ud.SinchUseCase.VerifyOTP(*body.PhoneNumber, body.OTP)
+		if err != nil {
+			if !utils.IsNormalBusinessError(err) {
+				slog.Error("Failed to verify OTP for phone number change",
+					slog.String("action", "otp_verification_phone_change"),
+					slog.String("user_id", userData.ID.Hex()),
+					slog.String("error", err.Error()))
+			}
+			ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("Failed to verify OTP. Please try again later or contact support."))
+			return
+		} else if !valid {
+			ctx.JSON(http.StatusUnauthorized, utils.NewMessageResponse("Incorrect OTP. Please check and try again."))
+			return
+		}
+		update.PhoneNumber = body.PhoneNumber
+	}
+
+	if update.Name == nil && update.PhoneNumber == nil {
+		userData.Password = ""
+		ctx.JSON(http.StatusOK, gin.H{"message": "Profile is already up to date.", "user": userData})
+		return
+	}
+
+	updated, err := ud.UserUseCase.UpdateProfile(userData.ID, update)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			ctx.JSON(http.StatusConflict, utils.NewMessageResponse("This phone number is already used by another account."))
+			return
+		}
+		slog.Error("Failed to update profile",
+			slog.String("action", "profile_update"),
+			slog.String("user_id", userData.ID.Hex()),
+			slog.String("error", err.Error()))
+		ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	updated.Password = ""
+	ctx.JSON(http.StatusOK, gin.H{"message": "Profile updated successfully.", "user": updated})
+}
+
+func (ud *UserDelivery) UploadAvatar(ctx *gin.Context) {
+	user, exists := ctx.Get("user")
+	if !exists {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	userData := user.(*domain.User)
+
+	// leaves room for the multipart framing around the image
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, domain.AvatarMaxUploadSize+64<<10)
+
+	fileHeader, err := ctx.FormFile("avatar")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			ctx.JSON(http.StatusRequestEntityTooLarge, utils.NewMessageResponse("Avatar must be 5 MB or smaller."))
+			return
+		}
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("Please attach an image as 'avatar'."))
+		return
+	}
+	if fileHeader.Size > domain.AvatarMaxUploadSize {
+		ctx.JSON(http.StatusRequestEntityTooLarge, utils.NewMessageResponse("Avatar must be 5 MB or smaller."))
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("Please attach an image as 'avatar'."))
+		return
+	}
+	defer file.Close()
+
+	image, err := io.ReadAll(file)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("Please attach an image as 'avatar'."))
+		return
+	}
+
+	updated, err := ud.AvatarUseCase.Upload(userData, image)
+	if err != nil {
+		if errors.Is(err, utils.ErrAvatarInvalid) {
+			ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("Avatar must be a JPEG, PNG or GIF image."))
+			return
+		}
+		slog.Error("Failed to upload avatar",
+			slog.String("action", "avatar_upload"),
+			slog.String("user_id", userData.ID.Hex()),
+			slog.String("error", err.Error()))
+		ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Avatar updated successfully.", "avatar_url": updated.AvatarURL})
+}
+
+// GetAvatar redirects to a short-lived link of a stored avatar. It is public like the
+// provider avatar links it replaces.
+func (ud *UserDelivery) GetAvatar(ctx *gin.Context) {
+	userID, err := bson.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, utils.NewMessageResponse("Avatar not found."))
+		return
+	}
+
+	link, err := ud.AvatarUseCase.CreateViewURL(userID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			ctx.JSON(http.StatusNotFound, utils.NewMessageResponse("Avatar not found."))
+			return
+		}
+		slog.Error("Failed to create avatar link",
+			slog.String("action", "avatar_view"),
+			slog.String("user_id", userID.Hex()),
+			slog.String("error", err.Error()))
+		ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	// browsers may reuse the redirect while the presigned link is still valid
+	ctx.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int((domain.AvatarURLTTL-5*time.Minute).Seconds())))
+	ctx.Redirect(http.StatusFound, link)
+}
+
+func (ud *UserDelivery) UpdateUsageNotifications(ctx *gin.Context) {
+	user, exists := ctx.Get("user")
+	if !exists {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	userData := user.(*domain.User)
+
+	var body domain.UsageNotificationsBody
+	if err := ctx.ShouldBindJSON(&body); err != nil {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("Invalid request body. Please check your input."))
+		return
+	}
+
+	if err := ud.UserUseCase.UpdateUsageEmailsOptOutByID(userData.ID, !*body.Enabled); err != nil {
+		slog.Error("Failed to update usage notification preference",
+			slog.String("action", "usage_notifications_update"),
+			slog.String("user_id", userData.ID.Hex()),
+			slog.String("error", err.Error()))
+		ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, utils.NewMessageResponse("Usage notification preference updated."))
+}
+
+func (ud *UserDelivery) RequestDataExport(ctx *gin.Context) {
+	user, exists := ctx.Get("user")
+	if !exists {
+		ctx.JSON(http.StatusBadRequest, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	userData := user.(*domain.User)
+
+	export, err := ud.DataExportUseCase.Request(userData.ID)
+	if err != nil {
+		if errors.Is(err, utils.ErrDataExportInProgress) {
+			ctx.JSON(http.StatusConflict, utils.NewMessageResponse("Your data export is already being prepared. You will receive an email when it's ready."))
+			return
+		}
+		slog.Error("Failed to create data export",
+			slog.String("action", "data_export_request"),
+			slog.String("user_id", userData.ID.Hex()),
+			slog.String("error", err.Error()))
+		ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+		return
+	}
+
+	msg := domain.DataExportMessage{ExportID: export.ID, UserID: userData.ID}
+	if err = rabbitmq.PublishDataExportMessage(ud.RabbitMQ, ctx, msg); err != nil {
+		slog.Error("Failed to publish data export message to RabbitMQ",
+			slog.String("action", "rabbitmq_data_export_publish"),
+			slog.String("export_id", export.ID.Hex()),
+			slog.String("user_id", userData.ID.Hex()),
+			slog.String("error", err.Error()))
+		if failErr := ud.DataExportUseCase.Fail(export.ID, err.Error()); failErr != nil {
+			slog.Error("Failed to mark unqueued data export as failed",
+				slog.String("action", "data_export_fail"),
+				slog.String("export_id", export.ID.Hex()),
+				slog.String("error", failErr.Error()))
+		}
+		ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("Failed to queue data export. Please try again."))
+		return
+	}
+
+	ctx.JSON(http.StatusAccepted, gin.H{
+		"message": "Your data export is being prepared. You will receive an email with a download link when it's ready.",
+		"export":  export,
+	})
+}
+
 func (ud *UserDelivery) CheckEmailExists(ctx *gin.Context) {
 	email := ctx.Param("email")
 
@@ -50,6 +293,14 @@ func (ud *UserDelivery) CheckEmailExists(ctx *gin.Context) {
 	}
 
 	exists, err := ud.UserUseCase.IsEmailExists(email)
+	if err == nil && !exists {
+		// a deleted account keeps its email while it can be restored
+		if _, restoreErr := ud.UserUseCase.FindRestorableByEmail(email); restoreErr == nil {
+			exists = true
+		} else if !errors.Is(restoreErr, mongo.ErrNoDocuments) {
+			err = restoreErr
+		}
+	}
 	if err != nil {
 		if !utils.IsNormalBusinessError(err) {
 			slog.Error("Failed to check email existence",
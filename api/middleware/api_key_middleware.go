@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwa0x2/SmartSRT-Backend/domain"
+	"github.com/kwa0x2/SmartSRT-Backend/domain/types"
+	"github.com/kwa0x2/SmartSRT-Backend/utils"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// APIKeyMiddleware authenticates requests carrying an `Authorization: Bearer ssk_...` header
+// and populates the same context values as SessionMiddleware. Requests without an API key
+// are handed to fallback, so a route can accept both session cookies and API keys.
+func APIKeyMiddleware(apiKeyUseCase domain.APIKeyUseCase, userBaseRepository domain.BaseRepository[*domain.User], usageBaseRepository domain.BaseRepository[*domain.Usage], organizationUseCase domain.OrganizationUseCase, scope types.APIKeyScope, fallback gin.HandlerFunc) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		rawKey, ok := strings.CutPrefix(ctx.GetHeader("Authorization"), "Bearer ")
+		if !ok || !strings.HasPrefix(rawKey, domain.APIKeyPrefix) {
+			fallback(ctx)
+			return
+		}
+
+		apiKey, err := apiKeyUseCase.Authenticate(strings.TrimSpace(rawKey))
+		if err != nil {
+			if !utils.IsNormalBusinessError(err) {
+				slog.Error("API key authentication failed",
+					slog.String("error", err.Error()))
+				ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+			} else {
+				ctx.JSON(http.StatusUnauthorized, utils.NewMessageResponse("Invalid API key."))
+			}
+			ctx.Abort()
+			return
+		}
+
+		if !apiKey.HasScope(scope) {
+			ctx.JSON(http.StatusForbidden, utils.NewMessageResponse("This API key is missing the required scope: "+string(scope)))
+			ctx.Abort()
+			return
+		}
+
+		user, err := userBaseRepository.FindOne(nil, bson.D{{Key: "_id", Value: apiKey.UserID}})
+		if err != nil {
+			if !utils.IsNormalBusinessError(err) {
+				slog.Error("User lookup failed",
+					slog.String("user_id", apiKey.UserID.Hex()),
+					slog.String("api_key_id", apiKey.ID.Hex()),
+					slog.String("error", err.Error()))
+				ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+			} else {
+				ctx.JSON(http.StatusUnauthorized, utils.NewMessageResponse("Invalid API key."))
+			}
+			ctx.Abort()
+			return
+		}
+
+		// organization keys only work while their creator is still a member
+		var org *domain.Organization
+		var member *domain.OrganizationMember
+		if apiKey.OrgID != nil {
+			member, err = organizationUseCase.FindMember(*apiKey.OrgID, user.ID)
+			if err == nil {
+				org, err = organizationUseCase.FindByID(*apiKey.OrgID)
+			}
+			if err != nil {
+				if !utils.IsNormalBusinessError(err) {
+					slog.Error("API key organization lookup failed",
+						slog.String("user_id", user.ID.Hex()),
+						slog.String("org_id", apiKey.OrgID.Hex()),
+						slog.String("error", err.Error()))
+					ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+				} else {
+					ctx.JSON(http.StatusUnauthorized, utils.NewMessageResponse("Invalid API key."))
+				}
+				ctx.Abort()
+				return
+			}
+		}
+
+		accountID := domain.AccountID(user, org)
+		usage, err := usageBaseRepository.FindOne(nil, bson.D{{Key: "user_id", Value: accountID}})
+		if err != nil {
+			if !utils.IsNormalBusinessError(err) {
+				slog.Error("Usage lookup failed",
+					slog.String("user_id", user.ID.Hex()),
+					slog.String("account_id", accountID.Hex()),
+					slog.String("error", err.Error()))
+			}
+		}
+
+		ctx.Set("user", user)
+		ctx.Set("api_key", apiKey)
+		if org != nil {
+			ctx.Set("organization", org)
+			ctx.Set("membership", member)
+		}
+		if usage != nil {
+			ctx.Set("usage", usage)
+		}
+
+		ctx.Next()
+	}
+}
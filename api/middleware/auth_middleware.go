@@ -12,7 +12,7 @@ import (
 	"github.com/kwa0x2/SmartSRT-Backend/utils"
 )
 
-func SessionMiddleware(sessionUseCase domain.SessionUseCase, userBaseRepository domain.BaseRepository[*domain.User], usageBaseRepository domain.BaseRepository[*domain.Usage], env *config.Env) gin.HandlerFunc {
+func SessionMiddleware(sessionUseCase domain.SessionUseCase, userBaseRepository domain.BaseRepository[*domain.User], usageBaseRepository domain.BaseRepository[*domain.Usage], organizationUseCase domain.OrganizationUseCase, env *config.Env) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		sessionID, err := ctx.Cookie("sid")
 		if err != nil {
@@ -58,19 +58,38 @@ func SessionMiddleware(sessionUseCase domain.SessionUseCase, userBaseRepository
 			return
 		}
 
-		usageFilter := bson.D{{Key: "user_id", Value: userID}}
+		result.ID = userID
+
+		// a stale active organization falls back to the personal account
+		org, membership, err := organizationUseCase.FindActive(result)
+		if err != nil {
+			slog.Error("Active organization lookup failed",
+				slog.String("user_id", userID.Hex()),
+				slog.String("error", err.Error()))
+			ctx.JSON(http.StatusInternalServerError, utils.NewMessageResponse("An error occurred. Please try again later or contact support."))
+			ctx.Abort()
+			return
+		}
+
+		accountID := domain.AccountID(result, org)
+		usageFilter := bson.D{{Key: "user_id", Value: accountID}}
 		usage, err := usageBaseRepository.FindOne(nil, usageFilter)
 		if err != nil {
 			if !utils.IsNormalBusinessError(err) {
 				slog.Error("Usage lookup failed", 
 					slog.String("user_id", userID.Hex()), 
+					slog.String("account_id", accountID.Hex()),
 					slog.String("error", err.Error()))
 			}
 		}
 
 		utils.SetSIDCookie(ctx, sessionID, env)
-		result.ID = userID
+		ctx.Set("session", session)
 		ctx.Set("user", result)
+		if org != nil {
+			ctx.Set("organization", org)
+			ctx.Set("membership", membership)
+		}
 		if usage != nil {
 			ctx.Set("usage", usage)
 		}
@@ -79,7 +98,7 @@ func SessionMiddleware(sessionUseCase domain.SessionUseCase, userBaseRepository
 	}
 }
 
-func JWTMiddleware() gin.HandlerFunc {
+func JWTMiddleware(env *config.Env) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		token := ctx.GetHeader("Authorization")
 		if token == "" {
@@ -88,7 +107,7 @@ func JWTMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		claims, err := utils.GetClaims(token)
+		claims, err := utils.GetClaims(token, env.JWTSecret)
 		if err != nil {
 			if !utils.IsNormalBusinessError(err) {
 				slog.Error("JWT claims parsing failed", 
@@ -24,30 +24,88 @@ type EndpointLimit struct {
 
 var defaultEndpointLimits = map[string]EndpointLimit{
 	// Auth endpoints
-	"GET/api/v1/auth/google/login":             {limit: 10, window: time.Minute},
-	"GET/api/v1/auth/github/login":             {limit: 10, window: time.Minute},
-	"POST/api/v1/auth/credentials/login":       {limit: 10, window: time.Minute},
-	"POST/api/v1/auth/register":                {limit: 10, window: time.Minute},
-	"GET/api/v1/auth/logout":                   {limit: 15, window: time.Minute},
-	"POST/api/v1/auth/otp/send":                {limit: 2, window: time.Minute},
-	"POST/api/v1/auth/account/password/forgot": {limit: 5, window: time.Minute},
-	"PUT/api/v1/auth/account/password/reset":   {limit: 5, window: time.Minute},
-	"GET/api/v1/auth/account/delete/request":   {limit: 5, window: time.Minute},
-	"DELETE/api/v1/auth/account":               {limit: 5, window: time.Minute},
+	"GET/api/v1/auth/google/login":              {limit: 10, window: time.Minute},
+	"GET/api/v1/auth/github/login":              {limit: 10, window: time.Minute},
+	"GET/api/v1/auth/google/link":               {limit: 10, window: time.Minute},
+	"GET/api/v1/auth/github/link":               {limit: 10, window: time.Minute},
+	"GET/api/v1/auth/identities":                {limit: 60, window: time.Minute},
+	"DELETE/api/v1/auth/identities/:provider":   {limit: 10, window: time.Minute},
+	"POST/api/v1/auth/credentials/login":        {limit: 10, window: time.Minute},
+	"POST/api/v1/auth/2fa/verify":               {limit: 5, window: time.Minute},
+	"POST/api/v1/auth/2fa/totp/setup":           {limit: 5, window: time.Minute},
+	"POST/api/v1/auth/2fa/totp/confirm":         {limit: 5, window: time.Minute},
+	"DELETE/api/v1/auth/2fa/totp":               {limit: 5, window: time.Minute},
+	"POST/api/v1/auth/2fa/recovery-codes":       {limit: 5, window: time.Minute},
+	"POST/api/v1/auth/2fa/passkey/begin":        {limit: 5, window: time.Minute},
+	"POST/api/v1/auth/2fa/passkey/finish":       {limit: 5, window: time.Minute},
+	"POST/api/v1/auth/passkey/login/begin":      {limit: 10, window: time.Minute},
+	"POST/api/v1/auth/passkey/login/finish":     {limit: 10, window: time.Minute},
+	"GET/api/v1/auth/passkeys":                  {limit: 60, window: time.Minute},
+	"POST/api/v1/auth/passkeys/register/begin":  {limit: 5, window: time.Minute},
+	"POST/api/v1/auth/passkeys/register/finish": {limit: 5, window: time.Minute},
+	"DELETE/api/v1/auth/passkeys/:id":           {limit: 10, window: time.Minute},
+	"POST/api/v1/auth/register":                 {limit: 10, window: time.Minute},
+	"GET/api/v1/auth/logout":                    {limit: 15, window: time.Minute},
+	"GET/api/v1/auth/sessions":                  {limit: 60, window: time.Minute},
+	"DELETE/api/v1/auth/sessions":               {limit: 5, window: time.Minute},
+	"DELETE/api/v1/auth/sessions/:id":           {limit: 10, window: time.Minute},
+	"POST/api/v1/auth/otp/send":                 {limit: 2, window: time.Minute},
+	"POST/api/v1/auth/account/password/forgot":  {limit: 5, window: time.Minute},
+	"PUT/api/v1/auth/account/password/reset":    {limit: 5, window: time.Minute},
+	"GET/api/v1/auth/account/delete/request":    {limit: 5, window: time.Minute},
+	"DELETE/api/v1/auth/account":                {limit: 5, window: time.Minute},
+	"POST/api/v1/auth/account/restore":          {limit: 5, window: time.Minute},
+	"POST/api/v1/auth/account/email/change":     {limit: 3, window: time.Minute},
+	"POST/api/v1/auth/account/email/confirm":    {limit: 5, window: time.Minute},
 
 	// User endpoints
 	"GET/api/v1/user/me":                   {limit: 500, window: time.Minute},
+	"PATCH/api/v1/user/me":                 {limit: 20, window: time.Minute},
+	"PUT/api/v1/user/me/avatar":            {limit: 10, window: time.Minute},
+	"GET/api/v1/user/avatars/:id":          {limit: 300, window: time.Minute},
 	"HEAD/api/v1/user/exists/email/:email": {limit: 20, window: time.Minute},
 	"HEAD/api/v1/user/exists/phone/:phone": {limit: 20, window: time.Minute},
+	"PUT/api/v1/user/notifications/usage":  {limit: 20, window: time.Minute},
+	"POST/api/v1/user/export":              {limit: 3, window: time.Hour},
 	// SRT endpoints
-	"POST/api/v1/srt":          {limit: 10, window: time.Minute},
-	"GET/api/v1/srt/histories": {limit: 100, window: time.Minute},
+	"POST/api/v1/srt":                       {limit: 10, window: time.Minute},
+	"GET/api/v1/srt/histories":              {limit: 100, window: time.Minute},
+	"GET/api/v1/srt/histories/:id/download": {limit: 60, window: time.Minute},
+	"DELETE/api/v1/srt/histories/:id":       {limit: 60, window: time.Minute},
+	"POST/api/v1/srt/histories/delete":      {limit: 10, window: time.Minute},
+	"PUT/api/v1/srt/histories/:id/pin":      {limit: 60, window: time.Minute},
+	"DELETE/api/v1/srt/histories/:id/pin":   {limit: 60, window: time.Minute},
+	"GET/api/v1/srt/jobs/:fileID/events":    {limit: 30, window: time.Minute},
+	"DELETE/api/v1/srt/jobs/:fileID":        {limit: 20, window: time.Minute},
 	// Usage endpoint
-	"GET/api/v1/usage": {limit: 500, window: time.Minute},
+	"GET/api/v1/usage":         {limit: 500, window: time.Minute},
+	"GET/api/v1/usage/history": {limit: 60, window: time.Minute},
+
+	// Organization endpoints
+	"POST/api/v1/organizations":                                         {limit: 5, window: time.Minute},
+	"GET/api/v1/organizations":                                          {limit: 100, window: time.Minute},
+	"DELETE/api/v1/organizations/active":                                {limit: 20, window: time.Minute},
+	"PUT/api/v1/organizations/:orgID/activate":                          {limit: 20, window: time.Minute},
+	"GET/api/v1/organizations/:orgID/members":                           {limit: 100, window: time.Minute},
+	"PUT/api/v1/organizations/:orgID/members/:userID":                   {limit: 20, window: time.Minute},
+	"DELETE/api/v1/organizations/:orgID/members/:userID":                {limit: 20, window: time.Minute},
+	"POST/api/v1/organizations/invitations/accept":                      {limit: 10, window: time.Minute},
+	"POST/api/v1/organizations/:orgID/invitations":                      {limit: 10, window: time.Minute},
+	"GET/api/v1/organizations/:orgID/invitations":                       {limit: 100, window: time.Minute},
+	"POST/api/v1/organizations/:orgID/invitations/:invitationID/resend": {limit: 5, window: time.Minute},
+	"DELETE/api/v1/organizations/:orgID/invitations/:invitationID":      {limit: 20, window: time.Minute},
+
+	// API key endpoints
+	"POST/api/v1/api-keys":          {limit: 10, window: time.Minute},
+	"GET/api/v1/api-keys":           {limit: 100, window: time.Minute},
+	"DELETE/api/v1/api-keys/:keyID": {limit: 20, window: time.Minute},
 
 	// Contact endpoint
 	"POST/api/v1/contact": {limit: 5, window: time.Minute},
 
+	// Plan endpoint
+	"GET/api/v1/plans": {limit: 100, window: time.Minute},
+
 	// Paddle endpoints
 	"POST/api/v1/paddle/webhook":        {limit: 200, window: time.Minute},
 	"GET/api/v1/paddle/customer-portal": {limit: 50, window: time.Minute},
@@ -0,0 +1,32 @@
+package route
+
+import (
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/gin-gonic/gin"
+	"github.com/kwa0x2/SmartSRT-Backend/api/http/delivery"
+	"github.com/kwa0x2/SmartSRT-Backend/api/middleware"
+	"github.com/kwa0x2/SmartSRT-Backend/config"
+	"github.com/kwa0x2/SmartSRT-Backend/domain"
+	"github.com/kwa0x2/SmartSRT-Backend/repository"
+	"github.com/kwa0x2/SmartSRT-Backend/usecase"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+func NewAPIKeyRoute(env *config.Env, group *gin.RouterGroup, db *mongo.Database, dynamodb *dynamodb.Client) {
+	sr := repository.NewSessionRepository(dynamodb, domain.TableName)
+	seu := usecase.NewSessionUseCase(sr, repository.NewBaseRepository[*domain.User](db))
+	ou := usecase.NewOrganizationUseCase(env, repository.NewBaseRepository[*domain.Organization](db), repository.NewBaseRepository[*domain.OrganizationMember](db), repository.NewBaseRepository[*domain.OrganizationInvitation](db), repository.NewBaseRepository[*domain.User](db), nil, nil, nil, nil)
+
+	ad := &delivery.APIKeyDelivery{
+		APIKeyUseCase: usecase.NewAPIKeyUseCase(repository.NewBaseRepository[*domain.APIKey](db)),
+	}
+
+	// keys are managed with a session only, an API key cannot create further keys
+	apiKeyRoute := group.Group("/api-keys")
+	apiKeyRoute.Use(middleware.SessionMiddleware(seu, repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), ou, env))
+	{
+		apiKeyRoute.POST("", ad.Create)
+		apiKeyRoute.GET("", ad.FindAll)
+		apiKeyRoute.DELETE("/:keyID", ad.Revoke)
+	}
+}
@@ -1,11 +1,16 @@
 package route
 
 import (
+	"log/slog"
+	"os"
+
 	"github.com/PaddleHQ/paddle-go-sdk/v3"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/gin-gonic/gin"
 	"github.com/kwa0x2/SmartSRT-Backend/api/http/delivery"
 	"github.com/kwa0x2/SmartSRT-Backend/api/middleware"
+	"github.com/kwa0x2/SmartSRT-Backend/bootstrap"
 	"github.com/kwa0x2/SmartSRT-Backend/config"
 	"github.com/kwa0x2/SmartSRT-Backend/domain"
 	"github.com/kwa0x2/SmartSRT-Backend/repository"
@@ -14,20 +19,40 @@ import (
 	"go.mongodb.org/mongo-driver/v2/mongo"
 )
 
-func NewAuthRoute(env *config.Env, group *gin.RouterGroup, db *mongo.Database, dynamodb *dynamodb.Client, resendClient *resend.Client, paddleSDK *paddle.SDK) {
+func NewAuthRoute(env *config.Env, group *gin.RouterGroup, s3Client *s3.Client, db *mongo.Database, dynamodb *dynamodb.Client, resendClient *resend.Client, paddleSDK *paddle.SDK) {
+	logger := slog.Default()
+
 	ser := repository.NewSessionRepository(dynamodb, domain.TableName)
 	sr := repository.NewSinchRepository(env.SinchAppKey, env.SinchAppSecret)
 	rr := repository.NewResendRepository(resendClient)
-	pu := usecase.NewPaddleUseCase(env, paddleSDK, usecase.NewSubscriptionUseCase(env, repository.NewBaseRepository[*domain.Subscription](db), repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db)), nil)
-	uu := usecase.NewUserUseCase(env, repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), repository.NewBaseRepository[*domain.SRTHistory](db), pu)
+	ru := usecase.NewResendUseCase(rr)
+	plu := usecase.NewPlanUseCase(env, repository.NewBaseRepository[*domain.Plan](db))
+	usguc := usecase.NewUsageUseCase(env, repository.NewBaseRepository[*domain.Usage](db), repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.UsageReservation](db), repository.NewBaseRepository[*domain.UsagePeriod](db), repository.NewBaseRepository[*domain.Subscription](db), repository.NewBaseRepository[*domain.UsageLedgerEntry](db), repository.NewBaseRepository[*domain.Organization](db), nil, plu)
+	ou := usecase.NewOrganizationUseCase(env, repository.NewBaseRepository[*domain.Organization](db), repository.NewBaseRepository[*domain.OrganizationMember](db), repository.NewBaseRepository[*domain.OrganizationInvitation](db), repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), usguc, plu, ru)
+	pu := usecase.NewPaddleUseCase(env, paddleSDK, usecase.NewSubscriptionUseCase(env, repository.NewBaseRepository[*domain.Subscription](db), repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Organization](db), usguc, plu), nil, usguc, plu, ou)
+	uu := usecase.NewUserUseCase(env, repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), repository.NewBaseRepository[*domain.SRTHistory](db), repository.NewBaseRepository[*domain.Erasure](db), pu, usguc, plu)
 	seu := usecase.NewSessionUseCase(ser, repository.NewBaseRepository[*domain.User](db))
+	stu := usecase.NewStorageUseCase(repository.NewStorageRepository(s3Client, env.AWSS3BucketName), repository.NewBaseRepository[*domain.StorageDeletion](db), repository.NewBaseRepository[*domain.SRTHistory](db), repository.NewBaseRepository[*domain.Erasure](db))
+	wa, err := bootstrap.WebAuthn(env)
+	if err != nil {
+		logger.Error("WebAuthn configuration failed for auth route",
+			slog.String("error", err.Error()),
+		)
+		os.Exit(1)
+	}
 	ad := &delivery.AuthDelivery{
-		Env:            env,
-		UserUseCase:    uu,
-		SessionUseCase: seu,
-		SinchUseCase:   usecase.NewSinchUseCase(sr),
-		ResendUseCase:  usecase.NewResendUseCase(rr),
-		PaddleUseCase:  pu,
+		Env:                 env,
+		UserUseCase:         uu,
+		SessionUseCase:      seu,
+		SinchUseCase:        usecase.NewSinchUseCase(sr),
+		ResendUseCase:       ru,
+		PaddleUseCase:       pu,
+		OrganizationUseCase: ou,
+		AvatarUseCase:       usecase.NewAvatarUseCase(env, repository.NewBaseRepository[*domain.User](db), repository.NewAvatarRepository(s3Client, env.AWSS3BucketName), stu),
+		OAuthStateUseCase:   usecase.NewOAuthStateUseCase(repository.NewBaseRepository[*domain.OAuthState](db)),
+		IdentityUseCase:     usecase.NewIdentityUseCase(repository.NewBaseRepository[*domain.Identity](db), repository.NewBaseRepository[*domain.Passkey](db), repository.NewBaseRepository[*domain.User](db)),
+		TwoFactorUseCase:    usecase.NewTwoFactorUseCase(repository.NewBaseRepository[*domain.User](db)),
+		PasskeyUseCase:      usecase.NewPasskeyUseCase(wa, repository.NewBaseRepository[*domain.Passkey](db), repository.NewBaseRepository[*domain.PasskeyCeremony](db), repository.NewBaseRepository[*domain.Identity](db), repository.NewBaseRepository[*domain.User](db)),
 	}
 
 	authGroup := group.Group("/auth")
@@ -37,19 +62,43 @@ func NewAuthRoute(env *config.Env, group *gin.RouterGroup, db *mongo.Database, d
 		authGroup.GET("/google/callback", ad.GoogleCallback)
 		authGroup.GET("/github/login", ad.GitHubLogin)
 		authGroup.GET("/github/callback", ad.GitHubCallback)
+		authGroup.GET("/google/link", middleware.SessionMiddleware(seu, repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), ou, env), ad.GoogleLink)
+		authGroup.GET("/github/link", middleware.SessionMiddleware(seu, repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), ou, env), ad.GitHubLink)
+		authGroup.GET("/identities", middleware.SessionMiddleware(seu, repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), ou, env), ad.ListIdentities)
+		authGroup.DELETE("/identities/:provider", middleware.SessionMiddleware(seu, repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), ou, env), ad.UnlinkIdentity)
 
 		authGroup.POST("/credentials/login", ad.CredentialsLogin)
+		authGroup.POST("/2fa/verify", middleware.JWTMiddleware(env), ad.VerifyTwoFactor)
+		authGroup.POST("/2fa/totp/setup", middleware.SessionMiddleware(seu, repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), ou, env), ad.BeginTOTPEnrollment)
+		authGroup.POST("/2fa/totp/confirm", middleware.SessionMiddleware(seu, repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), ou, env), ad.ConfirmTOTPEnrollment)
+		authGroup.DELETE("/2fa/totp", middleware.SessionMiddleware(seu, repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), ou, env), ad.DisableTOTP)
+		authGroup.POST("/2fa/recovery-codes", middleware.SessionMiddleware(seu, repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), ou, env), ad.RegenerateRecoveryCodes)
+		authGroup.POST("/2fa/passkey/begin", middleware.JWTMiddleware(env), ad.BeginPasskeySecondFactor)
+		authGroup.POST("/2fa/passkey/finish", ad.FinishPasskeySecondFactor)
+
+		authGroup.POST("/passkey/login/begin", ad.BeginPasskeyLogin)
+		authGroup.POST("/passkey/login/finish", ad.FinishPasskeyLogin)
+		authGroup.GET("/passkeys", middleware.SessionMiddleware(seu, repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), ou, env), ad.ListPasskeys)
+		authGroup.POST("/passkeys/register/begin", middleware.SessionMiddleware(seu, repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), ou, env), ad.BeginPasskeyRegistration)
+		authGroup.POST("/passkeys/register/finish", middleware.SessionMiddleware(seu, repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), ou, env), ad.FinishPasskeyRegistration)
+		authGroup.DELETE("/passkeys/:id", middleware.SessionMiddleware(seu, repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), ou, env), ad.RevokePasskey)
 
 		authGroup.POST("/register", ad.VerifyOTPAndCreate)
 
 		authGroup.GET("/logout", ad.Logout)
+		authGroup.GET("/sessions", middleware.SessionMiddleware(seu, repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), ou, env), ad.ListSessions)
+		authGroup.DELETE("/sessions", middleware.SessionMiddleware(seu, repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), ou, env), ad.RevokeOtherSessions)
+		authGroup.DELETE("/sessions/:id", middleware.SessionMiddleware(seu, repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), ou, env), ad.RevokeSession)
 
 		authGroup.POST("/otp/send", ad.SinchSendOTP)
 
 		authGroup.POST("/account/password/forgot", ad.SendSetupNewPasswordEmail)
-		authGroup.PUT("/account/password/reset", middleware.JWTMiddleware(), ad.UpdatePassword)
-		authGroup.GET("/account/delete/request", middleware.SessionMiddleware(seu, repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), env), ad.SendDeleteAccountMail)
-		authGroup.DELETE("/account", middleware.JWTMiddleware(), ad.DeleteAccount)
+		authGroup.PUT("/account/password/reset", middleware.JWTMiddleware(env), ad.UpdatePassword)
+		authGroup.GET("/account/delete/request", middleware.SessionMiddleware(seu, repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), ou, env), ad.SendDeleteAccountMail)
+		authGroup.DELETE("/account", middleware.JWTMiddleware(env), ad.DeleteAccount)
+		authGroup.POST("/account/restore", middleware.JWTMiddleware(env), ad.RestoreAccount)
+		authGroup.POST("/account/email/change", middleware.SessionMiddleware(seu, repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), ou, env), ad.SendEmailChangeMail)
+		authGroup.POST("/account/email/confirm", middleware.JWTMiddleware(env), ad.ConfirmEmailChange)
 
 	}
 }
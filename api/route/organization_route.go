@@ -0,0 +1,44 @@
+package route
+
+import (
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/gin-gonic/gin"
+	"github.com/kwa0x2/SmartSRT-Backend/api/http/delivery"
+	"github.com/kwa0x2/SmartSRT-Backend/api/middleware"
+	"github.com/kwa0x2/SmartSRT-Backend/config"
+	"github.com/kwa0x2/SmartSRT-Backend/domain"
+	"github.com/kwa0x2/SmartSRT-Backend/repository"
+	"github.com/kwa0x2/SmartSRT-Backend/usecase"
+	"github.com/resend/resend-go/v2"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+func NewOrganizationRoute(env *config.Env, group *gin.RouterGroup, db *mongo.Database, dynamodb *dynamodb.Client, resendClient *resend.Client) {
+	sr := repository.NewSessionRepository(dynamodb, domain.TableName)
+	seu := usecase.NewSessionUseCase(sr, repository.NewBaseRepository[*domain.User](db))
+	plu := usecase.NewPlanUseCase(env, repository.NewBaseRepository[*domain.Plan](db))
+	ou := usecase.NewOrganizationUseCase(env, repository.NewBaseRepository[*domain.Organization](db), repository.NewBaseRepository[*domain.OrganizationMember](db), repository.NewBaseRepository[*domain.OrganizationInvitation](db), repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), nil, plu, usecase.NewResendUseCase(repository.NewResendRepository(resendClient)))
+
+	od := &delivery.OrganizationDelivery{
+		OrganizationUseCase: ou,
+	}
+
+	organizationRoute := group.Group("/organizations")
+	organizationRoute.Use(middleware.LocaleMiddleware())
+	organizationRoute.Use(middleware.SessionMiddleware(seu, repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), ou, env))
+	{
+		organizationRoute.POST("", od.Create)
+		organizationRoute.GET("", od.FindAll)
+		organizationRoute.DELETE("/active", od.Deactivate)
+		organizationRoute.PUT("/:orgID/activate", od.Activate)
+		organizationRoute.GET("/:orgID/members", od.FindMembers)
+		organizationRoute.PUT("/:orgID/members/:userID", od.UpdateMemberRole)
+		organizationRoute.DELETE("/:orgID/members/:userID", od.RemoveMember)
+
+		organizationRoute.POST("/invitations/accept", od.AcceptInvitation)
+		organizationRoute.POST("/:orgID/invitations", od.InviteMember)
+		organizationRoute.GET("/:orgID/invitations", od.FindPendingInvitations)
+		organizationRoute.POST("/:orgID/invitations/:invitationID/resend", od.ResendInvitation)
+		organizationRoute.DELETE("/:orgID/invitations/:invitationID", od.RevokeInvitation)
+	}
+}
@@ -14,17 +14,20 @@ import (
 )
 
 func NewPaddleRoutes(env *config.Env, group *gin.RouterGroup, paddleSDK *paddle.SDK, db *mongo.Database, dynamodb *dynamodb.Client) {
-	su := usecase.NewSubscriptionUseCase(env, repository.NewBaseRepository[*domain.Subscription](db), repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db))
+	plu := usecase.NewPlanUseCase(env, repository.NewBaseRepository[*domain.Plan](db))
+	usguc := usecase.NewUsageUseCase(env, repository.NewBaseRepository[*domain.Usage](db), repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.UsageReservation](db), repository.NewBaseRepository[*domain.UsagePeriod](db), repository.NewBaseRepository[*domain.Subscription](db), repository.NewBaseRepository[*domain.UsageLedgerEntry](db), repository.NewBaseRepository[*domain.Organization](db), nil, plu)
+	ou := usecase.NewOrganizationUseCase(env, repository.NewBaseRepository[*domain.Organization](db), repository.NewBaseRepository[*domain.OrganizationMember](db), repository.NewBaseRepository[*domain.OrganizationInvitation](db), repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), usguc, plu, nil)
+	su := usecase.NewSubscriptionUseCase(env, repository.NewBaseRepository[*domain.Subscription](db), repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Organization](db), usguc, plu)
 	sr := repository.NewSessionRepository(dynamodb, domain.TableName)
-	uu := usecase.NewUserUseCase(env, repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), repository.NewBaseRepository[*domain.SRTHistory](db), nil)
+	uu := usecase.NewUserUseCase(env, repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), repository.NewBaseRepository[*domain.SRTHistory](db), repository.NewBaseRepository[*domain.Erasure](db), nil, usguc, plu)
 	pd := &delivery.PaddleDelivery{
-		PaddleUseCase: usecase.NewPaddleUseCase(env, paddleSDK, su, uu),
+		PaddleUseCase: usecase.NewPaddleUseCase(env, paddleSDK, su, uu, usguc, plu, ou),
 	}
 
 	paddleGroup := group.Group("/paddle")
 	{
 		paddleGroup.POST("/webhook", middleware.PaddleWebhookVerifier(env.PaddleWebhookSecretKey), pd.HandleWebhook)
-		paddleGroup.GET("/customer-portal", middleware.SessionMiddleware(usecase.NewSessionUseCase(sr, repository.NewBaseRepository[*domain.User](db)), repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), env), pd.CreateCustomerPortalSessionByEmail)
+		paddleGroup.GET("/customer-portal", middleware.SessionMiddleware(usecase.NewSessionUseCase(sr, repository.NewBaseRepository[*domain.User](db)), repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), ou, env), pd.CreateCustomerPortalSessionByEmail)
 		paddleGroup.GET("/price/:priceID", pd.GetPriceByID)
 	}
 }
@@ -0,0 +1,22 @@
+package route
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/kwa0x2/SmartSRT-Backend/api/http/delivery"
+	"github.com/kwa0x2/SmartSRT-Backend/config"
+	"github.com/kwa0x2/SmartSRT-Backend/domain"
+	"github.com/kwa0x2/SmartSRT-Backend/repository"
+	"github.com/kwa0x2/SmartSRT-Backend/usecase"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+func NewPlanRoute(env *config.Env, group *gin.RouterGroup, db *mongo.Database) {
+	pd := &delivery.PlanDelivery{
+		PlanUseCase: usecase.NewPlanUseCase(env, repository.NewBaseRepository[*domain.Plan](db)),
+	}
+
+	planRoute := group.Group("/plans")
+	{
+		planRoute.GET("", pd.FindAll)
+	}
+}
@@ -30,11 +30,14 @@ func Setup(env *config.Env, db *mongo.Database, dynamodb *dynamodb.Client, route
 	groupRouter.Use(limiter.RateLimitMiddleware())
 	groupRouter.Use(middleware.PrometheusMiddleware())
 
-	NewAuthRoute(env, groupRouter, db, dynamodb, resendClient, paddleSDK)
-	NewUserRoute(env, groupRouter, db, dynamodb)
+	NewAuthRoute(env, groupRouter, s3Client, db, dynamodb, resendClient, paddleSDK)
+	NewUserRoute(env, groupRouter, s3Client, db, dynamodb)
 	NewSRTRoute(env, groupRouter, s3Client, lambdaClient, env.AWSS3BucketName, env.AWSLambdaFuncName, db, dynamodb)
 	NewUsageRoute(env, groupRouter, db, dynamodb)
 	NewContactRoute(env, groupRouter, db, resendClient)
 	NewPaddleRoutes(env, groupRouter, paddleSDK, db, dynamodb)
 	NewSubscriptionRoute(env, groupRouter, dynamodb, db)
+	NewPlanRoute(env, groupRouter, db)
+	NewOrganizationRoute(env, groupRouter, db, dynamodb, resendClient)
+	NewAPIKeyRoute(env, groupRouter, db, dynamodb)
 }
@@ -13,6 +13,8 @@ import (
 	"github.com/kwa0x2/SmartSRT-Backend/bootstrap"
 	"github.com/kwa0x2/SmartSRT-Backend/config"
 	"github.com/kwa0x2/SmartSRT-Backend/domain"
+	"github.com/kwa0x2/SmartSRT-Backend/domain/types"
+	"github.com/kwa0x2/SmartSRT-Backend/rabbitmq"
 	"github.com/kwa0x2/SmartSRT-Backend/repository"
 	"github.com/kwa0x2/SmartSRT-Backend/usecase"
 	"go.mongodb.org/mongo-driver/v2/mongo"
@@ -24,8 +26,12 @@ func NewSRTRoute(env *config.Env, group *gin.RouterGroup, s3Client *s3.Client, l
 	su := repository.NewSessionRepository(dynamodb, domain.TableName)
 	sr := repository.NewSRTRepository(s3Client, lambdaClient, db, bucketName, lambdaFuncName, domain.CollectionSRTHistory)
 	seu := usecase.NewSessionUseCase(su, repository.NewBaseRepository[*domain.User](db))
+	ou := usecase.NewOrganizationUseCase(env, repository.NewBaseRepository[*domain.Organization](db), repository.NewBaseRepository[*domain.OrganizationMember](db), repository.NewBaseRepository[*domain.OrganizationInvitation](db), repository.NewBaseRepository[*domain.User](db), nil, nil, nil, nil)
 
-	usguc := usecase.NewUsageUseCase(env, repository.NewBaseRepository[*domain.Usage](db), repository.NewBaseRepository[*domain.User](db))
+	plu := usecase.NewPlanUseCase(env, repository.NewBaseRepository[*domain.Plan](db))
+	usguc := usecase.NewUsageUseCase(env, repository.NewBaseRepository[*domain.Usage](db), repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.UsageReservation](db), repository.NewBaseRepository[*domain.UsagePeriod](db), repository.NewBaseRepository[*domain.Subscription](db), repository.NewBaseRepository[*domain.UsageLedgerEntry](db), repository.NewBaseRepository[*domain.Organization](db), nil, plu)
+
+	stu := usecase.NewStorageUseCase(repository.NewStorageRepository(s3Client, bucketName), repository.NewBaseRepository[*domain.StorageDeletion](db), repository.NewBaseRepository[*domain.SRTHistory](db), repository.NewBaseRepository[*domain.Erasure](db))
 
 	rmq, err := bootstrap.NewRabbitMQ(env)
 	if err != nil {
@@ -35,14 +41,30 @@ func NewSRTRoute(env *config.Env, group *gin.RouterGroup, s3Client *s3.Client, l
 		os.Exit(1)
 	}
 
+	jobEventHub := domain.NewJobEventHub()
+	go rabbitmq.StartJobEventRelay(rmq, jobEventHub)
+
 	sd := &delivery.SRTDelivery{
-		SRTUseCase: usecase.NewSRTUseCase(sr, usguc, repository.NewBaseRepository[*domain.SRTHistory](db)),
-		RabbitMQ:   rmq,
+		SRTUseCase:   usecase.NewSRTUseCase(sr, repository.NewSandboxSRTRepository(s3Client, bucketName), usguc, stu, repository.NewBaseRepository[*domain.SRTHistory](db)),
+		UsageUseCase: usguc,
+		PlanUseCase:  plu,
+		RabbitMQ:     rmq,
+		JobEventHub:  jobEventHub,
 	}
 
+	sm := middleware.SessionMiddleware(seu, repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), ou, env)
+	aku := usecase.NewAPIKeyUseCase(repository.NewBaseRepository[*domain.APIKey](db))
+
 	srtRoute := group.Group("/srt")
 	{
-		srtRoute.POST("", middleware.SessionMiddleware(seu, repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), env), sd.ConvertFileToSRT)
-		srtRoute.GET("/histories", middleware.SessionMiddleware(seu, repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), env), sd.FindHistories)
+		srtRoute.POST("", middleware.APIKeyMiddleware(aku, repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), ou, types.ScopeSRTWrite, sm), sd.ConvertFileToSRT)
+		srtRoute.GET("/histories", middleware.APIKeyMiddleware(aku, repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), ou, types.ScopeHistoryRead, sm), sd.FindHistories)
+		srtRoute.GET("/histories/:id/download", middleware.APIKeyMiddleware(aku, repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), ou, types.ScopeHistoryRead, sm), sd.DownloadHistory)
+		srtRoute.DELETE("/histories/:id", middleware.APIKeyMiddleware(aku, repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), ou, types.ScopeHistoryWrite, sm), sd.DeleteHistory)
+		srtRoute.PUT("/histories/:id/pin", middleware.APIKeyMiddleware(aku, repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), ou, types.ScopeHistoryWrite, sm), sd.PinHistory)
+		srtRoute.DELETE("/histories/:id/pin", middleware.APIKeyMiddleware(aku, repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), ou, types.ScopeHistoryWrite, sm), sd.UnpinHistory)
+		srtRoute.POST("/histories/delete", middleware.APIKeyMiddleware(aku, repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), ou, types.ScopeHistoryWrite, sm), sd.DeleteHistories)
+		srtRoute.DELETE("/jobs/:fileID", middleware.APIKeyMiddleware(aku, repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), ou, types.ScopeSRTWrite, sm), sd.CancelJob)
+		srtRoute.GET("/jobs/:fileID/events", middleware.APIKeyMiddleware(aku, repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), ou, types.ScopeHistoryRead, sm), sd.StreamJobEvents)
 	}
 }
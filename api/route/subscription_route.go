@@ -13,14 +13,15 @@ import (
 )
 
 func NewSubscriptionRoute(env *config.Env, group *gin.RouterGroup, dynamodb *dynamodb.Client, db *mongo.Database) {
-	su := usecase.NewSubscriptionUseCase(env, repository.NewBaseRepository[*domain.Subscription](db), nil, nil)
+	su := usecase.NewSubscriptionUseCase(env, repository.NewBaseRepository[*domain.Subscription](db), nil, nil, nil, nil)
 	sr := repository.NewSessionRepository(dynamodb, domain.TableName)
+	ou := usecase.NewOrganizationUseCase(env, repository.NewBaseRepository[*domain.Organization](db), repository.NewBaseRepository[*domain.OrganizationMember](db), repository.NewBaseRepository[*domain.OrganizationInvitation](db), repository.NewBaseRepository[*domain.User](db), nil, nil, nil, nil)
 
 	sd := &delivery.SubscriptonDelivery{
 		SubscriptionUseCase: su,
 	}
 	subscriptionRoute := group.Group("/subscription")
 	{
-		subscriptionRoute.GET("/remaining-days", middleware.SessionMiddleware(usecase.NewSessionUseCase(sr, repository.NewBaseRepository[*domain.User](db)), repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), env), sd.GetRemainingDays)
+		subscriptionRoute.GET("/remaining-days", middleware.SessionMiddleware(usecase.NewSessionUseCase(sr, repository.NewBaseRepository[*domain.User](db)), repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), ou, env), sd.GetRemainingDays)
 	}
 }
\ No newline at end of file
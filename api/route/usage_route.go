@@ -7,6 +7,7 @@ import (
 	"github.com/kwa0x2/SmartSRT-Backend/api/middleware"
 	"github.com/kwa0x2/SmartSRT-Backend/config"
 	"github.com/kwa0x2/SmartSRT-Backend/domain"
+	"github.com/kwa0x2/SmartSRT-Backend/domain/types"
 	"github.com/kwa0x2/SmartSRT-Backend/repository"
 	"github.com/kwa0x2/SmartSRT-Backend/usecase"
 	"go.mongodb.org/mongo-driver/v2/mongo"
@@ -14,13 +15,18 @@ import (
 
 func NewUsageRoute(env *config.Env, group *gin.RouterGroup, db *mongo.Database, dynamodb *dynamodb.Client) {
 	sr := repository.NewSessionRepository(dynamodb, domain.TableName)
+	ou := usecase.NewOrganizationUseCase(env, repository.NewBaseRepository[*domain.Organization](db), repository.NewBaseRepository[*domain.OrganizationMember](db), repository.NewBaseRepository[*domain.OrganizationInvitation](db), repository.NewBaseRepository[*domain.User](db), nil, nil, nil, nil)
 
 	ud := delivery.UsageDelivery{
-		UsageUseCase: usecase.NewUsageUseCase(env, repository.NewBaseRepository[*domain.Usage](db), nil),
+		UsageUseCase: usecase.NewUsageUseCase(env, repository.NewBaseRepository[*domain.Usage](db), nil, repository.NewBaseRepository[*domain.UsageReservation](db), nil, nil, repository.NewBaseRepository[*domain.UsageLedgerEntry](db), nil, nil, nil),
 	}
 
+	sm := middleware.SessionMiddleware(usecase.NewSessionUseCase(sr, repository.NewBaseRepository[*domain.User](db)), repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), ou, env)
+	aku := usecase.NewAPIKeyUseCase(repository.NewBaseRepository[*domain.APIKey](db))
+
 	usageRoute := group.Group("/usage")
 	{
-		usageRoute.GET("", middleware.SessionMiddleware(usecase.NewSessionUseCase(sr, repository.NewBaseRepository[*domain.User](db)), repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), env), ud.FindOne)
+		usageRoute.GET("", middleware.APIKeyMiddleware(aku, repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), ou, types.ScopeUsageRead, sm), ud.FindOne)
+		usageRoute.GET("/history", middleware.APIKeyMiddleware(aku, repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), ou, types.ScopeUsageRead, sm), ud.FindHistory)
 	}
 }
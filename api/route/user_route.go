@@ -1,10 +1,15 @@
 package route
 
 import (
+	"log/slog"
+	"os"
+
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/gin-gonic/gin"
 	"github.com/kwa0x2/SmartSRT-Backend/api/http/delivery"
 	"github.com/kwa0x2/SmartSRT-Backend/api/middleware"
+	"github.com/kwa0x2/SmartSRT-Backend/bootstrap"
 	"github.com/kwa0x2/SmartSRT-Backend/config"
 	"github.com/kwa0x2/SmartSRT-Backend/domain"
 	"github.com/kwa0x2/SmartSRT-Backend/repository"
@@ -12,17 +17,39 @@ import (
 	"go.mongodb.org/mongo-driver/v2/mongo"
 )
 
-func NewUserRoute(env *config.Env, group *gin.RouterGroup, db *mongo.Database, dynamodb *dynamodb.Client) {
+func NewUserRoute(env *config.Env, group *gin.RouterGroup, s3Client *s3.Client, db *mongo.Database, dynamodb *dynamodb.Client) {
+	logger := slog.Default()
+
 	sr := repository.NewSessionRepository(dynamodb, domain.TableName)
+	ou := usecase.NewOrganizationUseCase(env, repository.NewBaseRepository[*domain.Organization](db), repository.NewBaseRepository[*domain.OrganizationMember](db), repository.NewBaseRepository[*domain.OrganizationInvitation](db), repository.NewBaseRepository[*domain.User](db), nil, nil, nil, nil)
+
+	stu := usecase.NewStorageUseCase(repository.NewStorageRepository(s3Client, env.AWSS3BucketName), repository.NewBaseRepository[*domain.StorageDeletion](db), repository.NewBaseRepository[*domain.SRTHistory](db), repository.NewBaseRepository[*domain.Erasure](db))
+
+	rmq, err := bootstrap.NewRabbitMQ(env)
+	if err != nil {
+		logger.Error("RabbitMQ connection failed for user route",
+			slog.String("error", err.Error()),
+		)
+		os.Exit(1)
+	}
 
 	ud := &delivery.UserDelivery{
-		UserUseCase:        usecase.NewUserUseCase(env, repository.NewBaseRepository[*domain.User](db), nil, nil, nil),
+		UserUseCase:        usecase.NewUserUseCase(env, repository.NewBaseRepository[*domain.User](db), nil, nil, repository.NewBaseRepository[*domain.Erasure](db), nil, nil, nil),
 		UserBaseRepository: repository.NewBaseRepository[*domain.User](db),
+		DataExportUseCase:  usecase.NewDataExportUseCase(repository.NewBaseRepository[*domain.DataExport](db), nil, nil, nil, nil, nil, nil),
+		SinchUseCase:       usecase.NewSinchUseCase(repository.NewSinchRepository(env.SinchAppKey, env.SinchAppSecret)),
+		AvatarUseCase:      usecase.NewAvatarUseCase(env, repository.NewBaseRepository[*domain.User](db), repository.NewAvatarRepository(s3Client, env.AWSS3BucketName), stu),
+		RabbitMQ:           rmq,
 	}
 
 	userRoute := group.Group("/user")
 	{
-		userRoute.GET("/me", middleware.SessionMiddleware(usecase.NewSessionUseCase(sr, repository.NewBaseRepository[*domain.User](db)), repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), env), ud.GetProfileFromSession)
+		userRoute.GET("/me", middleware.SessionMiddleware(usecase.NewSessionUseCase(sr, repository.NewBaseRepository[*domain.User](db)), repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), ou, env), ud.GetProfileFromSession)
+		userRoute.PATCH("/me", middleware.SessionMiddleware(usecase.NewSessionUseCase(sr, repository.NewBaseRepository[*domain.User](db)), repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), ou, env), ud.UpdateProfile)
+		userRoute.PUT("/me/avatar", middleware.SessionMiddleware(usecase.NewSessionUseCase(sr, repository.NewBaseRepository[*domain.User](db)), repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), ou, env), ud.UploadAvatar)
+		userRoute.GET("/avatars/:id", ud.GetAvatar)
+		userRoute.PUT("/notifications/usage", middleware.SessionMiddleware(usecase.NewSessionUseCase(sr, repository.NewBaseRepository[*domain.User](db)), repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), ou, env), ud.UpdateUsageNotifications)
+		userRoute.POST("/export", middleware.SessionMiddleware(usecase.NewSessionUseCase(sr, repository.NewBaseRepository[*domain.User](db)), repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Usage](db), ou, env), ud.RequestDataExport)
 
 		userRoute.HEAD("/exists/email/:email", ud.CheckEmailExists)
 		userRoute.HEAD("/exists/phone/:phone", ud.CheckPhoneExists)
@@ -0,0 +1,23 @@
+package bootstrap
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/kwa0x2/SmartSRT-Backend/config"
+)
+
+// WebAuthn configures passkeys for the frontend origin, ceremonies run in its pages.
+func WebAuthn(env *config.Env) (*webauthn.WebAuthn, error) {
+	frontEnd, err := url.Parse(env.FrontEndURL)
+	if err != nil || frontEnd.Hostname() == "" {
+		return nil, fmt.Errorf("FRONTEND_URL is not a valid origin: %q", env.FrontEndURL)
+	}
+
+	return webauthn.New(&webauthn.Config{
+		RPID:          frontEnd.Hostname(),
+		RPDisplayName: "SmartSRT",
+		RPOrigins:     []string{frontEnd.Scheme + "://" + frontEnd.Host},
+	})
+}
@@ -2,16 +2,20 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"log/slog"
 	"mime/multipart"
 	"os"
+	"time"
 
 	"github.com/kwa0x2/SmartSRT-Backend/bootstrap"
 	"github.com/kwa0x2/SmartSRT-Backend/config"
 	"github.com/kwa0x2/SmartSRT-Backend/domain"
+	"github.com/kwa0x2/SmartSRT-Backend/domain/types"
 	"github.com/kwa0x2/SmartSRT-Backend/rabbitmq"
 	"github.com/kwa0x2/SmartSRT-Backend/repository"
 	"github.com/kwa0x2/SmartSRT-Backend/usecase"
+	"github.com/kwa0x2/SmartSRT-Backend/utils"
 )
 
 type fileReader struct {
@@ -23,25 +27,37 @@ func (f *fileReader) Close() error {
 }
 
 type Consumer struct {
-	env           *config.Env
-	logger        *slog.Logger
-	SRTUseCase    domain.SRTUseCase
-	resendUseCase domain.ResendUseCase
-	rabbitMQ      *domain.RabbitMQ
+	env              *config.Env
+	logger           *slog.Logger
+	SRTUseCase       domain.SRTUseCase
+	usageUseCase     domain.UsageUseCase
+	resendUseCase    domain.ResendUseCase
+	storageUseCase   domain.StorageUseCase
+	retentionUseCase domain.RetentionUseCase
+	erasureUseCase   domain.ErasureUseCase
+	exportUseCase    domain.DataExportUseCase
+	userUseCase      domain.UserUseCase
+	rabbitMQ         *domain.RabbitMQ
 }
 
-func NewConsumer(env *config.Env, logger *slog.Logger, SRTUseCase domain.SRTUseCase, ResendUseCase domain.ResendUseCase, rabbitMQ *domain.RabbitMQ) *Consumer {
+func NewConsumer(env *config.Env, logger *slog.Logger, SRTUseCase domain.SRTUseCase, UsageUseCase domain.UsageUseCase, ResendUseCase domain.ResendUseCase, StorageUseCase domain.StorageUseCase, RetentionUseCase domain.RetentionUseCase, ErasureUseCase domain.ErasureUseCase, DataExportUseCase domain.DataExportUseCase, UserUseCase domain.UserUseCase, rabbitMQ *domain.RabbitMQ) *Consumer {
 	return &Consumer{
-		env:           env,
-		logger:        logger,
-		SRTUseCase:    SRTUseCase,
-		resendUseCase: ResendUseCase,
-		rabbitMQ:      rabbitMQ,
+		env:              env,
+		logger:           logger,
+		SRTUseCase:       SRTUseCase,
+		usageUseCase:     UsageUseCase,
+		resendUseCase:    ResendUseCase,
+		storageUseCase:   StorageUseCase,
+		retentionUseCase: RetentionUseCase,
+		erasureUseCase:   ErasureUseCase,
+		exportUseCase:    DataExportUseCase,
+		userUseCase:      UserUseCase,
+		rabbitMQ:         rabbitMQ,
 	}
 }
 
 func (c *Consumer) Start() error {
-	err := rabbitmq.StartWorkerPool(c.rabbitMQ, 5, func(msg domain.ConversionMessage) (*domain.LambdaResponse, error) {
+	err := rabbitmq.StartWorkerPool(c.rabbitMQ, 5, func(msg domain.ConversionMessage) error {
 		c.logger.Info("File conversion process started",
 			slog.String("file_id", msg.FileID),
 			slog.String("user_id", msg.UserID.Hex()),
@@ -52,6 +68,8 @@ func (c *Consumer) Start() error {
 
 		request := domain.FileConversionRequest{
 			UserID:              msg.UserID,
+			OrgID:               msg.OrgID,
+			FileID:              msg.FileID,
 			WordsPerLine:        msg.WordsPerLine,
 			Punctuation:         msg.Punctuation,
 			ConsiderPunctuation: msg.ConsiderPunctuation,
@@ -62,33 +80,50 @@ func (c *Consumer) Start() error {
 				Size:     msg.FileSize,
 			},
 			FileDuration: msg.FileDuration,
+			Sandbox:      msg.Sandbox,
+			Progress: func(status types.JobStatus) {
+				c.publishJobEvent(domain.JobEvent{FileID: msg.FileID, UserID: msg.UserID, Status: status})
+			},
 		}
 
-		response, err := c.SRTUseCase.UploadFileAndConvertToSRT(request)
+		history, err := c.SRTUseCase.UploadFileAndConvertToSRT(request)
 		if err != nil {
-			return nil, err
+			message := "An error occurred. Please try again later or contact support."
+			if errors.Is(err, utils.ErrReservationNotActive) {
+				message = "This job was cancelled or expired before it could be processed."
+			}
+			c.publishJobEvent(domain.JobEvent{FileID: msg.FileID, UserID: msg.UserID, Status: types.JobFailed, Message: message})
+			return err
 		}
 
-		if _, err := c.resendUseCase.SendSRTCreatedEmail(msg.Email, response.Body.SRTURL); err != nil {
-			c.logger.Error("Email sending failed",
-				slog.String("email", msg.Email),
+		// the history is saved at this point, so a failed presign only leaves the link out
+		srtURL, err := c.SRTUseCase.CreateDownloadURL(history, types.DownloadSRT, domain.SRTDownloadURLTTL)
+		if err != nil {
+			c.logger.Error("SRT download link presigning failed",
 				slog.String("file_id", msg.FileID),
+				slog.String("history_id", history.ID.Hex()),
 				slog.String("error", err.Error()),
 			)
-		} else {
-			c.logger.Info("Email sent successfully",
-				slog.String("email", msg.Email),
+		}
+		c.publishJobEvent(domain.JobEvent{FileID: msg.FileID, UserID: msg.UserID, Status: types.JobDone, HistoryID: history.ID.Hex(), SRTURL: srtURL})
+
+		if msg.Sandbox {
+			c.logger.Info("Sandbox file processed successfully",
 				slog.String("file_id", msg.FileID),
-				slog.String("srt_url", response.Body.SRTURL),
+				slog.String("user_id", msg.UserID.Hex()),
+				slog.String("history_id", history.ID.Hex()),
 			)
+			return nil
 		}
 
+		c.sendSRTCreatedEmail(msg, history)
+
 		c.logger.Info("File processed successfully",
 			slog.String("file_id", msg.FileID),
 			slog.String("user_id", msg.UserID.Hex()),
-			slog.String("srt_url", response.Body.SRTURL),
+			slog.String("history_id", history.ID.Hex()),
 		)
-		return response, nil
+		return nil
 	})
 
 	if err != nil {
@@ -98,12 +133,286 @@ func (c *Consumer) Start() error {
 		return err
 	}
 
+	err = rabbitmq.StartDataExportWorkerPool(c.rabbitMQ, 1, func(msg domain.DataExportMessage) error {
+		c.logger.Info("Data export started",
+			slog.String("export_id", msg.ExportID.Hex()),
+			slog.String("user_id", msg.UserID.Hex()),
+		)
+
+		if err := c.exportUseCase.Process(msg.ExportID); err != nil {
+			c.logger.Error("Data export failed",
+				slog.String("export_id", msg.ExportID.Hex()),
+				slog.String("user_id", msg.UserID.Hex()),
+				slog.String("error", err.Error()),
+			)
+			return err
+		}
+
+		c.logger.Info("Data export processed successfully",
+			slog.String("export_id", msg.ExportID.Hex()),
+			slog.String("user_id", msg.UserID.Hex()),
+		)
+		return nil
+	})
+
+	if err != nil {
+		c.logger.Error("Data export worker pool startup failed",
+			slog.String("error", err.Error()),
+		)
+		return err
+	}
+
+	go c.runUsageMaintenance()
+	go c.runStorageMaintenance()
+	go c.runAccountErasure()
+	go c.runCustomerEmailSync()
+
 	c.logger.Info("Consumer started successfully",
 		slog.String("status", "waiting_for_messages"),
 	)
 	select {}
 }
 
+// sendSRTCreatedEmail mails a presigned link that stays valid for SRTEmailDownloadURLTTL.
+func (c *Consumer) sendSRTCreatedEmail(msg domain.ConversionMessage, history *domain.SRTHistory) {
+	link, err := c.SRTUseCase.CreateDownloadURL(history, types.DownloadSRT, domain.SRTEmailDownloadURLTTL)
+	if err != nil {
+		c.logger.Error("SRT email link presigning failed",
+			slog.String("file_id", msg.FileID),
+			slog.String("history_id", history.ID.Hex()),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+
+	if _, err = c.resendUseCase.SendSRTCreatedEmail(msg.Email, link); err != nil {
+		c.logger.Error("Email sending failed",
+			slog.String("email", msg.Email),
+			slog.String("file_id", msg.FileID),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+
+	c.logger.Info("Email sent successfully",
+		slog.String("email", msg.Email),
+		slog.String("file_id", msg.FileID),
+		slog.String("history_id", history.ID.Hex()),
+	)
+}
+
+// runUsageMaintenance periodically hands back quota held by jobs that never finished,
+// opens a fresh usage period for users whose period has ended and sends usage emails.
+func (c *Consumer) runUsageMaintenance() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		c.releaseExpiredReservations()
+		c.rolloverDuePeriods()
+		c.sendUsageNotifications()
+	}
+}
+
+func (c *Consumer) releaseExpiredReservations() {
+	released, err := c.usageUseCase.ReleaseExpiredReservations()
+	if err != nil {
+		c.logger.Error("Expired usage reservation release failed",
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+
+	if released > 0 {
+		c.logger.Info("Expired usage reservations released",
+			slog.Int("count", released),
+		)
+	}
+}
+
+func (c *Consumer) rolloverDuePeriods() {
+	rolled, err := c.usageUseCase.RolloverDuePeriods()
+	if err != nil {
+		c.logger.Error("Usage period rollover failed",
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+
+	if rolled > 0 {
+		c.logger.Info("Usage periods rolled over",
+			slog.Int("count", rolled),
+		)
+	}
+}
+
+func (c *Consumer) sendUsageNotifications() {
+	sent, err := c.usageUseCase.SendUsageNotifications()
+	if err != nil {
+		c.logger.Error("Usage notifications failed",
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+
+	if sent > 0 {
+		c.logger.Info("Usage notifications sent",
+			slog.Int("count", sent),
+		)
+	}
+}
+
+// runStorageMaintenance removes queued S3 objects every minute, applies the plan retention
+// limits and expires data exports once per RetentionInterval and looks for orphaned objects
+// once per StorageReconcileInterval.
+func (c *Consumer) runStorageMaintenance() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	var lastRetention, lastReconcile time.Time
+	for range ticker.C {
+		c.processStorageDeletions()
+
+		if time.Since(lastRetention) >= domain.RetentionInterval {
+			lastRetention = time.Now()
+			c.applyRetention()
+			c.expireDataExports()
+		}
+
+		if time.Since(lastReconcile) >= domain.StorageReconcileInterval {
+			lastReconcile = time.Now()
+			c.reconcileStorage()
+		}
+	}
+}
+
+func (c *Consumer) processStorageDeletions() {
+	deleted, err := c.storageUseCase.ProcessPendingDeletions()
+	if err != nil {
+		c.logger.Error("Storage deletion failed",
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+
+	if deleted > 0 {
+		c.logger.Info("Storage objects deleted",
+			slog.Int("count", deleted),
+		)
+	}
+}
+
+func (c *Consumer) applyRetention() {
+	run, err := c.retentionUseCase.ApplyRetention()
+	if err != nil {
+		c.logger.Error("Retention run failed",
+			slog.Int("warned", run.Warned),
+			slog.Int("media_deleted", run.MediaDeleted),
+			slog.Int("histories_deleted", run.HistoriesDeleted),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+
+	if run.Warned > 0 || run.MediaDeleted > 0 || run.HistoriesDeleted > 0 {
+		c.logger.Info("Retention applied",
+			slog.Int("warned", run.Warned),
+			slog.Int("media_deleted", run.MediaDeleted),
+			slog.Int("histories_deleted", run.HistoriesDeleted),
+		)
+	}
+}
+
+func (c *Consumer) expireDataExports() {
+	expired, err := c.exportUseCase.ExpireExports()
+	if err != nil {
+		c.logger.Error("Data export expiry failed",
+			slog.Int("expired", expired),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+
+	if expired > 0 {
+		c.logger.Info("Expired data exports queued for deletion",
+			slog.Int("count", expired),
+		)
+	}
+}
+
+func (c *Consumer) reconcileStorage() {
+	queued, err := c.storageUseCase.ReconcileOrphans()
+	if err != nil {
+		c.logger.Error("Storage reconciliation failed",
+			slog.Int("queued", queued),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+
+	if queued > 0 {
+		c.logger.Info("Orphaned storage objects queued for deletion",
+			slog.Int("count", queued),
+		)
+	}
+}
+
+// runAccountErasure permanently removes deleted accounts whose grace period is over.
+func (c *Consumer) runAccountErasure() {
+	ticker := time.NewTicker(domain.ErasureInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		erased, err := c.erasureUseCase.ProcessDueErasures()
+		if err != nil {
+			c.logger.Error("Account erasure failed",
+				slog.Int("erased", erased),
+				slog.String("error", err.Error()),
+			)
+			continue
+		}
+
+		if erased > 0 {
+			c.logger.Info("Accounts erased",
+				slog.Int("count", erased),
+			)
+		}
+	}
+}
+
+// runCustomerEmailSync retries the Paddle customer updates of changed emails every minute.
+func (c *Consumer) runCustomerEmailSync() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		synced, err := c.userUseCase.SyncPendingCustomerEmails()
+		if err != nil {
+			c.logger.Error("Paddle customer email sync failed",
+				slog.String("error", err.Error()),
+			)
+			continue
+		}
+
+		if synced > 0 {
+			c.logger.Info("Paddle customer emails synced",
+				slog.Int("count", synced),
+			)
+		}
+	}
+}
+
+func (c *Consumer) publishJobEvent(event domain.JobEvent) {
+	event.Timestamp = time.Now().UTC()
+	if err := rabbitmq.PublishJobEvent(c.rabbitMQ, event); err != nil {
+		c.logger.Warn("Job event publishing failed",
+			slog.String("file_id", event.FileID),
+			slog.String("status", string(event.Status)),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
 func main() {
 	app := bootstrap.App()
 	env := app.Env
@@ -127,11 +436,21 @@ func main() {
 	)
 
 	sr := repository.NewSRTRepository(s3Client, lambdaClient, db, env.AWSS3BucketName, env.AWSLambdaFuncName, domain.CollectionSRTHistory)
-	usguc := usecase.NewUsageUseCase(env, repository.NewBaseRepository[*domain.Usage](db), repository.NewBaseRepository[*domain.User](db))
-	srtUseCase := usecase.NewSRTUseCase(sr, usguc, repository.NewBaseRepository[*domain.SRTHistory](db))
 	resendUseCase := usecase.NewResendUseCase(repository.NewResendRepository(app.ResendClient))
+	plu := usecase.NewPlanUseCase(env, repository.NewBaseRepository[*domain.Plan](db))
+	usguc := usecase.NewUsageUseCase(env, repository.NewBaseRepository[*domain.Usage](db), repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.UsageReservation](db), repository.NewBaseRepository[*domain.UsagePeriod](db), repository.NewBaseRepository[*domain.Subscription](db), repository.NewBaseRepository[*domain.UsageLedgerEntry](db), repository.NewBaseRepository[*domain.Organization](db), resendUseCase, plu)
+	storageUseCase := usecase.NewStorageUseCase(repository.NewStorageRepository(s3Client, env.AWSS3BucketName), repository.NewBaseRepository[*domain.StorageDeletion](db), repository.NewBaseRepository[*domain.SRTHistory](db), repository.NewBaseRepository[*domain.Erasure](db))
+	srtUseCase := usecase.NewSRTUseCase(sr, repository.NewSandboxSRTRepository(s3Client, env.AWSS3BucketName), usguc, storageUseCase, repository.NewBaseRepository[*domain.SRTHistory](db))
+
+	retentionUseCase := usecase.NewRetentionUseCase(env, repository.NewBaseRepository[*domain.SRTHistory](db), repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.Organization](db), plu, storageUseCase, resendUseCase)
+	erasureUseCase := usecase.NewErasureUseCase(repository.NewBaseRepository[*domain.Erasure](db), repository.NewErasureRepository(db), repository.NewSessionRepository(app.DynamoDB, domain.TableName), storageUseCase)
+
+	dataExportUseCase := usecase.NewDataExportUseCase(repository.NewBaseRepository[*domain.DataExport](db), repository.NewDataExportRepository(s3Client, env.AWSS3BucketName), repository.NewBaseRepository[*domain.User](db), repository.NewBaseRepository[*domain.SRTHistory](db), repository.NewErasureRepository(db), storageUseCase, resendUseCase)
+
+	paddleUseCase := usecase.NewPaddleUseCase(env, app.PaddleSDK, nil, nil, nil, nil, nil)
+	userUseCase := usecase.NewUserUseCase(env, repository.NewBaseRepository[*domain.User](db), nil, nil, nil, paddleUseCase, nil, nil)
 
-	consumer := NewConsumer(env, logger, srtUseCase, resendUseCase, rabbitMQ)
+	consumer := NewConsumer(env, logger, srtUseCase, usguc, resendUseCase, storageUseCase, retentionUseCase, erasureUseCase, dataExportUseCase, userUseCase, rabbitMQ)
 	if err = consumer.Start(); err != nil {
 		logger.Error("Consumer error",
 			slog.String("error", err.Error()),
@@ -5,6 +5,7 @@ type Env struct {
 	ServerAddress          string `mapstructure:"SERVER_ADDRESS" validate:"required"`
 	JWTSecret              string `mapstructure:"JWT_SECRET" validate:"required"`
 	FrontEndURL            string `mapstructure:"FRONTEND_URL" validate:"required"`
+	APIURL                 string `mapstructure:"API_URL"` // Public base URL of this API, prefixes uploaded avatar links
 	MongoURI               string `mapstructure:"MONGO_URI" validate:"required"`
 	MongoDBName            string `mapstructure:"MONGO_DB_NAME" validate:"required"`
 	RabbitMQURI            string `mapstructure:"RABBITMQ_URI" validate:"required"`
@@ -29,4 +30,8 @@ type Env struct {
 	FreeMonthlyLimit       float64 `mapstructure:"FREE_MONTHLY_LIMIT" validate:"required"`
 	ProMonthlyLimit        float64 `mapstructure:"PRO_MONTHLY_LIMIT" validate:"required"`
 	CookieDomain           string  `mapstructure:"COOKIE_DOMAIN" validate:"required"`
+	UsageNotifyThresholds  []int   `mapstructure:"USAGE_NOTIFY_THRESHOLDS"`
+	PaddleMinutePacks      string  `mapstructure:"PADDLE_MINUTE_PACKS"` // price_id:minutes pairs, comma separated
+	PaddleProPriceIDs      []string `mapstructure:"PADDLE_PRO_PRICE_IDS" validate:"required,min=1,dive,startswith=pri_"` // Pro subscription prices, added to the Pro plan on every startup
+	AccountErasureGraceDays int     `mapstructure:"ACCOUNT_ERASURE_GRACE_DAYS"` // Days between account deletion and permanent erasure
 }
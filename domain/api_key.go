@@ -0,0 +1,71 @@
+package domain
+
+import (
+	"slices"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/kwa0x2/SmartSRT-Backend/domain/types"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const (
+	CollectionAPIKey = "api_keys"
+
+	APIKeyPrefix = "ssk_"
+
+	// APIKeySandboxPrefix marks test-mode keys, whose conversions run against a fake
+	// transcription backend and are never charged.
+	APIKeySandboxPrefix = APIKeyPrefix + "test_"
+
+	// APIKeyLastUsedResolution limits last_used_at writes to one per key and interval.
+	APIKeyLastUsedResolution = 1 * time.Minute
+)
+
+// APIKey grants programmatic access on behalf of the user who created it. Keys created while
+// an organization is active are bound to it and stop working when the user leaves it.
+// Only a hash of the key is stored; the key itself is shown once on creation.
+type APIKey struct {
+	ID         bson.ObjectID       `bson:"_id,omitempty" json:"id"`
+	UserID     bson.ObjectID       `bson:"user_id" validate:"required" json:"user_id"`
+	OrgID      *bson.ObjectID      `bson:"org_id,omitempty" json:"org_id,omitempty"`
+	Name       string              `bson:"name" validate:"required,max=100" json:"name"`
+	Prefix     string              `bson:"prefix" validate:"required" json:"prefix"` // First characters of the key, to tell keys apart
+	KeyHash    string              `bson:"key_hash" validate:"required" json:"-"`
+	Scopes     []types.APIKeyScope `bson:"scopes" validate:"required,min=1" json:"scopes"`
+	Sandbox    bool                `bson:"sandbox" json:"sandbox"`
+	LastUsedAt *time.Time          `bson:"last_used_at,omitempty" json:"last_used_at"`
+	CreatedAt  time.Time           `bson:"created_at" validate:"required" json:"created_at"`
+	UpdatedAt  time.Time           `bson:"updated_at" validate:"required" json:"-"`
+	DeletedAt  *time.Time          `bson:"deleted_at,omitempty" json:"-"`
+}
+
+func (k *APIKey) Validate() error {
+	validate := validator.New()
+	return validate.Struct(k)
+}
+
+func (k *APIKey) GetCollectionName() string {
+	return CollectionAPIKey
+}
+
+func (k *APIKey) SetID(id bson.ObjectID) {
+	k.ID = id
+}
+
+func (k *APIKey) HasScope(scope types.APIKeyScope) bool {
+	return slices.Contains(k.Scopes, scope)
+}
+
+type CreateAPIKeyBody struct {
+	Name    string              `json:"name" binding:"required,max=100"`
+	Scopes  []types.APIKeyScope `json:"scopes" binding:"required,min=1"`
+	Sandbox bool                `json:"sandbox"`
+}
+
+type APIKeyUseCase interface {
+	Create(user *User, org *Organization, name string, scopes []types.APIKeyScope, sandbox bool) (*APIKey, string, error)
+	FindAll(user *User, org *Organization) ([]*APIKey, error)
+	Revoke(user *User, org *Organization, id bson.ObjectID) error
+	Authenticate(rawKey string) (*APIKey, error)
+}
@@ -24,12 +24,18 @@ type VerifyOTPAndCreateBody struct {
 	AvatarURL   string         `json:"avatar_url"`
 	OTP         string         `json:"otp"`
 	AuthType    types.AuthType `json:"auth_type"`
+
+	InvitationToken string `json:"invitation_token"` // Optional, joins the inviting organization once the account exists
 }
 
 type EmailBody struct {
 	Email string `json:"email"`
 }
 
+type EmailChangeBody struct {
+	Email string `json:"email" binding:"required,email,max=254"`
+}
+
 type PhoneNumberBody struct {
 	PhoneNumber string `json:"phone_number"`
 }
@@ -0,0 +1,49 @@
+package domain
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kwa0x2/SmartSRT-Backend/config"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const (
+	// AvatarSize is the width and height of stored avatars in pixels.
+	AvatarSize          = 256
+	AvatarMaxUploadSize = 5 << 20
+	// AvatarMaxPixels rejects images that would take too much memory to decode.
+	AvatarMaxPixels = 25_000_000
+	AvatarURLTTL    = 1 * time.Hour
+)
+
+// AvatarProviderHosts are the domains, including their subdomains, that OAuth provider
+// avatars are fetched from. Anything else is left as it is.
+var AvatarProviderHosts = []string{"googleusercontent.com", "githubusercontent.com"}
+
+// AvatarObjectKey is where a resized avatar uploaded at the given time is stored.
+func AvatarObjectKey(userID bson.ObjectID, at time.Time) string {
+	return fmt.Sprintf("avatars/%s/%d.png", userID.Hex(), at.UnixNano())
+}
+
+// AvatarURL is the public link of a stored avatar. The version changes with every upload so
+// that browsers do not keep showing the previous one.
+func AvatarURL(env *config.Env, userID bson.ObjectID, at time.Time) string {
+	return fmt.Sprintf("%s/api/v1/user/avatars/%s?v=%d", env.APIURL, userID.Hex(), at.Unix())
+}
+
+type AvatarRepository interface {
+	Upload(objectKey string, image []byte) error
+	PresignView(objectKey string, ttl time.Duration) (string, error)
+	// FetchProviderAvatar downloads an avatar of at most AvatarMaxUploadSize bytes.
+	FetchProviderAvatar(url string) ([]byte, error)
+}
+
+type AvatarUseCase interface {
+	// Upload resizes and stores the image as the user's avatar and returns the updated user.
+	Upload(user *User, image []byte) (*User, error)
+	// CacheProviderAvatar copies an OAuth provider avatar into our bucket, once per user.
+	CacheProviderAvatar(user *User) error
+	// CreateViewURL presigns the stored avatar of the user, mongo.ErrNoDocuments when there is none.
+	CreateViewURL(userID bson.ObjectID) (string, error)
+}
@@ -18,6 +18,9 @@ type BaseRepository[T Entity] interface {
 	FindOne(ctx context.Context, filter bson.D) (T, error)
 	Find(ctx context.Context, filter bson.D, opts *options.FindOptionsBuilder) ([]T, error)
 	UpdateOne(ctx context.Context, filter bson.D, update bson.D, opts *options.UpdateOneOptionsBuilder) error
+	FindOneAndUpdate(ctx context.Context, filter bson.D, update bson.D, opts *options.FindOneAndUpdateOptionsBuilder) (T, error)
 	SoftDelete(ctx context.Context, filter bson.D) error
+	FindOneDeleted(ctx context.Context, filter bson.D) (T, error)
+	Restore(ctx context.Context, filter bson.D) error
 	GetDatabase() *mongo.Database
 }
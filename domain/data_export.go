@@ -0,0 +1,70 @@
+package domain
+
+import (
+	"io"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/kwa0x2/SmartSRT-Backend/domain/types"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const (
+	CollectionDataExport = "data_exports"
+
+	// DataExportURLTTL is how long the emailed download link and the archive behind it are kept,
+	// the longest S3 allows for presigned URLs.
+	DataExportURLTTL     = 7 * 24 * time.Hour
+	DataExportBatchSize  = 100
+	DataExportBuildLimit = 30 * time.Minute
+)
+
+// DataExport is a user's request for a copy of their personal data. The consumer builds the
+// archive, stores it under DataExportObjectKey and emails a presigned link to it.
+type DataExport struct {
+	ID          bson.ObjectID          `bson:"_id,omitempty" json:"id"`
+	UserID      bson.ObjectID          `bson:"user_id" validate:"required" json:"-"`
+	Status      types.DataExportStatus `bson:"status" validate:"required" json:"status"`
+	ObjectKey   string                 `bson:"object_key,omitempty" json:"-"` // Served through the emailed presigned link only
+	Size        int64                  `bson:"size,omitempty" json:"size,omitempty"`
+	LastError   string                 `bson:"last_error,omitempty" json:"-"`
+	ExpiresAt   *time.Time             `bson:"expires_at,omitempty" json:"expires_at,omitempty"` // Archive is removed after this
+	CompletedAt *time.Time             `bson:"completed_at,omitempty" json:"completed_at,omitempty"`
+	CreatedAt   time.Time              `bson:"created_at" validate:"required" json:"created_at"`
+	UpdatedAt   time.Time              `bson:"updated_at" validate:"required" json:"-"`
+}
+
+func (e *DataExport) Validate() error {
+	validate := validator.New()
+	return validate.Struct(e)
+}
+
+func (e *DataExport) GetCollectionName() string {
+	return CollectionDataExport
+}
+
+func (e *DataExport) SetID(id bson.ObjectID) {
+	e.ID = id
+}
+
+// DataExportObjectKey is where the archive of an export is stored.
+func DataExportObjectKey(userID, exportID bson.ObjectID) string {
+	return "exports/" + userID.Hex() + "/" + exportID.Hex() + ".zip"
+}
+
+type DataExportRepository interface {
+	GetObject(objectKey string) (io.ReadCloser, error)
+	PutObject(objectKey string, body io.ReadSeeker) error
+	PresignDownload(objectKey, fileName string, ttl time.Duration) (string, error)
+}
+
+type DataExportUseCase interface {
+	// Request records a queued export, ErrDataExportInProgress when one is already underway.
+	Request(userID bson.ObjectID) (*DataExport, error)
+	// Fail marks an export that could not be built or queued.
+	Fail(id bson.ObjectID, reason string) error
+	// Process builds the archive of a queued export and emails the download link.
+	Process(id bson.ObjectID) error
+	// ExpireExports queues the archives of expired exports for deletion.
+	ExpireExports() (int, error)
+}
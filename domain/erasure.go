@@ -0,0 +1,92 @@
+package domain
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/kwa0x2/SmartSRT-Backend/config"
+	"github.com/kwa0x2/SmartSRT-Backend/domain/types"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const (
+	CollectionErasure = "erasures"
+
+	// DefaultErasureGraceDays applies when ACCOUNT_ERASURE_GRACE_DAYS is not set.
+	DefaultErasureGraceDays = 30
+	ErasureInterval         = 1 * time.Hour
+	ErasureBatchSize        = 20
+	ErasureMaxBackoff       = 24 * time.Hour
+)
+
+// Erasure is the audit record of a permanent account deletion. It is written when the user
+// deletes the account and completed once every trace of the account has been removed. The
+// record itself never holds personal data besides the user ID and a hash of the email.
+type Erasure struct {
+	ID            bson.ObjectID       `bson:"_id,omitempty"`
+	UserID        bson.ObjectID       `bson:"user_id" validate:"required"`
+	EmailHash     string              `bson:"email_hash,omitempty"` // SHA-256 of the lowercased email, lets support confirm an erasure
+	Status        types.ErasureStatus `bson:"status" validate:"required"`
+	RequestedAt   time.Time           `bson:"requested_at" validate:"required"`
+	ScheduledAt   time.Time           `bson:"scheduled_at" validate:"required"` // End of the grace period
+	Attempts      int                 `bson:"attempts"`
+	LastError     string              `bson:"last_error,omitempty"`
+	NextAttemptAt time.Time           `bson:"next_attempt_at" validate:"required"`
+	Steps         []ErasureStep       `bson:"steps,omitempty"`
+	CompletedAt   *time.Time          `bson:"completed_at,omitempty"`
+	CancelledAt   *time.Time          `bson:"cancelled_at,omitempty"` // Set when the user restored the account
+	CreatedAt     time.Time           `bson:"created_at" validate:"required"`
+	UpdatedAt     time.Time           `bson:"updated_at" validate:"required"`
+
+	// CancelledSubscription is the Paddle subscription that was cancelled together with the
+	// account. Restoring the account does not bring it back, so it is reported to the user.
+	CancelledSubscription *CancelledSubscription `bson:"cancelled_subscription,omitempty"`
+}
+
+type CancelledSubscription struct {
+	SubscriptionID string    `bson:"subscription_id" json:"subscription_id"`
+	ProductName    string    `bson:"product_name" json:"product_name"`
+	PaidUntil      time.Time `bson:"paid_until" json:"paid_until"` // End of the billing period that was cut short
+}
+
+// ErasureStep records what a single step of the last erasure attempt removed.
+type ErasureStep struct {
+	Name  string         `bson:"name"`
+	OrgID *bson.ObjectID `bson:"org_id,omitempty"` // Set for data of an organization the user owned
+	Count int64          `bson:"count"`
+	At    time.Time      `bson:"at"`
+}
+
+func (e *Erasure) Validate() error {
+	validate := validator.New()
+	return validate.Struct(e)
+}
+
+func (e *Erasure) GetCollectionName() string {
+	return CollectionErasure
+}
+
+func (e *Erasure) SetID(id bson.ObjectID) {
+	e.ID = id
+}
+
+// ErasureGracePeriod is how long a deleted account is kept before it is erased for good.
+func ErasureGracePeriod(env *config.Env) time.Duration {
+	days := env.AccountErasureGraceDays
+	if days <= 0 {
+		days = DefaultErasureGraceDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// ErasureRepository works on raw collections. Unlike BaseRepository it also sees and
+// removes soft-deleted documents, which is the point of an erasure.
+type ErasureRepository interface {
+	Find(ctx context.Context, collection string, filter bson.D, results any) error
+	DeleteMany(ctx context.Context, collection string, filter bson.D) (int64, error)
+}
+
+type ErasureUseCase interface {
+	ProcessDueErasures() (int, error)
+}
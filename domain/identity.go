@@ -0,0 +1,78 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/kwa0x2/SmartSRT-Backend/domain/types"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const (
+	CollectionIdentity = "identities"
+)
+
+// Identity links an OAuth provider account to a user, so that users are found by the
+// provider's subject ID rather than by the email address it reports. A user has at most one
+// identity per provider.
+type Identity struct {
+	ID        bson.ObjectID  `bson:"_id,omitempty" json:"-"`
+	UserID    bson.ObjectID  `bson:"user_id" validate:"required" json:"-"`
+	Provider  types.AuthType `bson:"provider" validate:"required,oneof=google github" json:"provider"`
+	Subject   string         `bson:"subject" validate:"required" json:"-"` // ID of the account at the provider
+	Email     string         `bson:"email" json:"email"`                   // Address the provider reported when it was last used
+	CreatedAt time.Time      `bson:"created_at" validate:"required" json:"created_at"`
+	UpdatedAt time.Time      `bson:"updated_at" validate:"required" json:"-"`
+	DeletedAt *time.Time     `bson:"deleted_at,omitempty" json:"-"`
+}
+
+func (i *Identity) Validate() error {
+	validate := validator.New()
+	return validate.Struct(i)
+}
+
+func (i *Identity) GetCollectionName() string {
+	return CollectionIdentity
+}
+
+func (i *Identity) SetID(id bson.ObjectID) {
+	i.ID = id
+}
+
+// OAuthProfile is what an OAuth provider reported about the account that signed in.
+type OAuthProfile struct {
+	Provider  types.AuthType
+	Subject   string
+	Email     string
+	Name      string
+	AvatarURL string
+}
+
+type IdentityUseCase interface {
+	// FindByProviderSubject returns the identity of the provider account, mongo.ErrNoDocuments
+	// when it is not linked to any user.
+	FindByProviderSubject(provider types.AuthType, subject string) (*Identity, error)
+	FindByUserID(userID bson.ObjectID) ([]*Identity, error)
+	// Link adds the provider account to the user, ErrIdentityLinked when it belongs to another
+	// user, linked or as their legacy OAuth login, and ErrProviderLinked when the user has a different account of the provider linked.
+	// Linking the same account again only refreshes its email.
+	Link(userID bson.ObjectID, profile *OAuthProfile) (*Identity, error)
+	// Unlink removes the user's identity of the provider, ErrLastLoginMethod when the user would
+	// be left without a way to sign in.
+	Unlink(userID bson.ObjectID, provider types.AuthType) error
+}
+
+// IsLegacyOAuthLogin tells whether the user registered with an OAuth provider before
+// identities existed and has not signed in with it since. Such users are still found by email,
+// their first sign-in links the identity.
+func IsLegacyOAuthLogin(user *User, identities []*Identity) bool {
+	if user.AuthType != types.Google && user.AuthType != types.Github {
+		return false
+	}
+	for _, identity := range identities {
+		if identity.Provider == user.AuthType {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,121 @@
+package domain
+
+import (
+	"sync"
+	"time"
+
+	"github.com/kwa0x2/SmartSRT-Backend/domain/types"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const (
+	JobEventRetention     = 15 * time.Minute
+	JobEventHeartbeat     = 15 * time.Second
+	jobEventSubscriberBuf = 16
+)
+
+type JobEvent struct {
+	FileID        string          `json:"file_id"`
+	UserID        bson.ObjectID   `json:"user_id"`
+	Status        types.JobStatus `json:"status"`
+	QueuePosition int             `json:"queue_position,omitempty"`
+	HistoryID     string          `json:"history_id,omitempty"`
+	SRTURL        string          `json:"srt_url,omitempty"` // Presigned, valid for SRTDownloadURLTTL
+	Message       string          `json:"message,omitempty"`
+	Timestamp     time.Time       `json:"timestamp"`
+}
+
+// JobEventHub keeps the latest event of every known job and fans new events
+// out to the SSE streams subscribed on this API node.
+type JobEventHub struct {
+	mu          sync.RWMutex
+	subscribers map[string]map[chan JobEvent]struct{}
+	last        map[string]JobEvent
+	lastSweep   time.Time
+}
+
+func NewJobEventHub() *JobEventHub {
+	return &JobEventHub{
+		subscribers: make(map[string]map[chan JobEvent]struct{}),
+		last:        make(map[string]JobEvent),
+		lastSweep:   time.Now(),
+	}
+}
+
+func (h *JobEventHub) Subscribe(fileID string) (<-chan JobEvent, func()) {
+	ch := make(chan JobEvent, jobEventSubscriberBuf)
+
+	h.mu.Lock()
+	if h.subscribers[fileID] == nil {
+		h.subscribers[fileID] = make(map[chan JobEvent]struct{})
+	}
+	h.subscribers[fileID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if subs, ok := h.subscribers[fileID]; ok {
+			delete(subs, ch)
+			if len(subs) == 0 {
+				delete(h.subscribers, fileID)
+			}
+		}
+	}
+}
+
+func (h *JobEventHub) Last(fileID string) (JobEvent, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	event, ok := h.last[fileID]
+	return event, ok
+}
+
+// Publish records the event and delivers it to local subscribers. A job
+// leaving the queue moves every job still waiting behind it one slot forward.
+func (h *JobEventHub) Publish(event JobEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	previous, known := h.last[event.FileID]
+	if known && previous.Status.IsTerminal() {
+		return
+	}
+	h.last[event.FileID] = event
+	h.deliver(event)
+
+	if event.Status == types.JobUploading && (!known || previous.Status == types.JobQueued) {
+		for fileID, queued := range h.last {
+			if fileID == event.FileID || queued.Status != types.JobQueued || queued.QueuePosition <= 1 {
+				continue
+			}
+			queued.QueuePosition--
+			queued.Timestamp = event.Timestamp
+			h.last[fileID] = queued
+			h.deliver(queued)
+		}
+	}
+
+	if time.Since(h.lastSweep) > time.Minute {
+		h.sweep()
+	}
+}
+
+func (h *JobEventHub) deliver(event JobEvent) {
+	for ch := range h.subscribers[event.FileID] {
+		select {
+		case ch <- event:
+		default:
+			// slow subscriber, it will still get the latest state on reconnect
+		}
+	}
+}
+
+func (h *JobEventHub) sweep() {
+	h.lastSweep = time.Now()
+	for fileID, event := range h.last {
+		if time.Since(event.Timestamp) > JobEventRetention && len(h.subscribers[fileID]) == 0 {
+			delete(h.last, fileID)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/kwa0x2/SmartSRT-Backend/domain/types"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const (
+	CollectionOAuthState = "oauth_states"
+
+	// OAuthStateTTL is how long a started OAuth flow can come back to its callback.
+	OAuthStateTTL = 10 * time.Minute
+)
+
+// OAuthState is kept for every started OAuth flow, shared by all replicas and removed by a TTL
+// index once it expires. Only hashes of the state parameter and of the browser's binding cookie
+// are stored, the flow is found by both so that it can only finish in the browser it started in.
+type OAuthState struct {
+	ID           bson.ObjectID  `bson:"_id,omitempty"`
+	StateHash    string         `bson:"state_hash" validate:"required"`
+	BindingHash  string         `bson:"binding_hash" validate:"required"`
+	Provider     types.AuthType `bson:"provider" validate:"required,oneof=google github"`
+	CodeVerifier string         `bson:"code_verifier" validate:"required"` // PKCE verifier of the authorization request
+	LinkUserID   *bson.ObjectID `bson:"link_user_id,omitempty"`            // Set when a signed-in user links the provider account
+	RedirectPath string         `bson:"redirect_path,omitempty"`           // Frontend path to continue at after signing in
+	ExpiresAt    time.Time      `bson:"expires_at" validate:"required"`
+	CreatedAt    time.Time      `bson:"created_at" validate:"required"`
+	UpdatedAt    time.Time      `bson:"updated_at" validate:"required"`
+}
+
+func (o *OAuthState) Validate() error {
+	validate := validator.New()
+	return validate.Struct(o)
+}
+
+func (o *OAuthState) GetCollectionName() string {
+	return CollectionOAuthState
+}
+
+func (o *OAuthState) SetID(id bson.ObjectID) {
+	o.ID = id
+}
+
+type OAuthStateUseCase interface {
+	// Create stores the flow for the browser of the binding cookie and returns its state parameter.
+	Create(flow *OAuthState, binding string) (string, error)
+	// Consume removes the flow and returns it, mongo.ErrNoDocuments when it is unknown, expired,
+	// of another provider or was started in another browser. A flow can be consumed once.
+	Consume(provider types.AuthType, state, binding string) (*OAuthState, error)
+}
@@ -0,0 +1,172 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/kwa0x2/SmartSRT-Backend/domain/types"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const (
+	CollectionOrganization       = "organizations"
+	CollectionOrganizationMember = "organization_members"
+
+	CollectionOrganizationInvitation = "organization_invitations"
+
+	InvitationTTL = 7 * 24 * time.Hour
+
+	// MaxOwnedOrganizations caps how many organizations one user can own, since each of them
+	// comes with its own usage pool.
+	MaxOwnedOrganizations = 3
+)
+
+// Organization is an account shared by its members. Its ID is used as the account ID of
+// the usage pool and the subscription, the same way a user's ID is for personal accounts.
+type Organization struct {
+	ID        bson.ObjectID  `bson:"_id,omitempty" json:"id"`
+	Name      string         `bson:"name" validate:"required,max=100" json:"name"`
+	OwnerID   bson.ObjectID  `bson:"owner_id" validate:"required" json:"owner_id"`
+	Plan      types.PlanType `bson:"plan" validate:"required" json:"plan"`
+	CreatedAt time.Time      `bson:"created_at" validate:"required" json:"created_at"`
+	UpdatedAt time.Time      `bson:"updated_at" validate:"required" json:"updated_at"`
+	DeletedAt *time.Time     `bson:"deleted_at,omitempty" json:"-"`
+}
+
+func (o *Organization) Validate() error {
+	validate := validator.New()
+	return validate.Struct(o)
+}
+
+func (o *Organization) GetCollectionName() string {
+	return CollectionOrganization
+}
+
+func (o *Organization) SetID(id bson.ObjectID) {
+	o.ID = id
+}
+
+type OrganizationMember struct {
+	ID        bson.ObjectID `bson:"_id,omitempty" json:"-"`
+	OrgID     bson.ObjectID `bson:"org_id" validate:"required" json:"org_id"`
+	UserID    bson.ObjectID `bson:"user_id" validate:"required" json:"user_id"`
+	Role      types.OrgRole `bson:"role" validate:"required" json:"role"`
+	CreatedAt time.Time     `bson:"created_at" validate:"required" json:"joined_at"`
+	UpdatedAt time.Time     `bson:"updated_at" validate:"required" json:"-"`
+	DeletedAt *time.Time    `bson:"deleted_at,omitempty" json:"-"`
+}
+
+func (m *OrganizationMember) Validate() error {
+	validate := validator.New()
+	return validate.Struct(m)
+}
+
+func (m *OrganizationMember) GetCollectionName() string {
+	return CollectionOrganizationMember
+}
+
+func (m *OrganizationMember) SetID(id bson.ObjectID) {
+	m.ID = id
+}
+
+// OrganizationInvitation is pending until it is accepted; revoking soft deletes it. Only the
+// hash of the latest emailed token is kept, so resending invalidates earlier links.
+type OrganizationInvitation struct {
+	ID         bson.ObjectID  `bson:"_id,omitempty" json:"id"`
+	OrgID      bson.ObjectID  `bson:"org_id" validate:"required" json:"org_id"`
+	Email      string         `bson:"email" validate:"required,email" json:"email"`
+	Role       types.OrgRole  `bson:"role" validate:"required" json:"role"`
+	InvitedBy  bson.ObjectID  `bson:"invited_by" validate:"required" json:"invited_by"`
+	TokenHash  string         `bson:"token_hash" validate:"required" json:"-"`
+	ExpiresAt  time.Time      `bson:"expires_at" validate:"required" json:"expires_at"`
+	AcceptedAt *time.Time     `bson:"accepted_at,omitempty" json:"-"`
+	AcceptedBy *bson.ObjectID `bson:"accepted_by,omitempty" json:"-"`
+	CreatedAt  time.Time      `bson:"created_at" validate:"required" json:"created_at"`
+	UpdatedAt  time.Time      `bson:"updated_at" validate:"required" json:"-"`
+	DeletedAt  *time.Time     `bson:"deleted_at,omitempty" json:"-"`
+}
+
+func (i *OrganizationInvitation) Validate() error {
+	validate := validator.New()
+	return validate.Struct(i)
+}
+
+func (i *OrganizationInvitation) GetCollectionName() string {
+	return CollectionOrganizationInvitation
+}
+
+func (i *OrganizationInvitation) SetID(id bson.ObjectID) {
+	i.ID = id
+}
+
+// OrganizationMembership is an organization as seen by one of its members.
+type OrganizationMembership struct {
+	Organization *Organization `json:"organization"`
+	Role         types.OrgRole `json:"role"`
+	Active       bool          `json:"active"`
+}
+
+// OrganizationMemberDetail is a member with the profile fields shown in the member list.
+type OrganizationMemberDetail struct {
+	UserID    bson.ObjectID `json:"user_id"`
+	Name      string        `json:"name"`
+	Email     string        `json:"email"`
+	AvatarURL string        `json:"avatar_url"`
+	Role      types.OrgRole `json:"role"`
+	JoinedAt  time.Time     `json:"joined_at"`
+}
+
+type CreateOrganizationBody struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
+
+type UpdateMemberRoleBody struct {
+	Role types.OrgRole `json:"role" binding:"required"`
+}
+
+type InviteMemberBody struct {
+	Email string        `json:"email" binding:"required,email"`
+	Role  types.OrgRole `json:"role" binding:"required"`
+}
+
+type AcceptInvitationBody struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// AccountID returns the ID that usage, reservations and subscriptions are kept under:
+// the active organization when there is one, the user otherwise.
+func AccountID(user *User, org *Organization) bson.ObjectID {
+	if org != nil {
+		return org.ID
+	}
+	return user.ID
+}
+
+// AccountPlan returns the plan that limits apply to for the same account as AccountID.
+func AccountPlan(user *User, org *Organization) types.PlanType {
+	if org != nil {
+		return org.Plan
+	}
+	return user.Plan
+}
+
+type OrganizationUseCase interface {
+	Create(owner *User, name string) (*Organization, error)
+	FindByID(id bson.ObjectID) (*Organization, error)
+	FindMember(orgID, userID bson.ObjectID) (*OrganizationMember, error)
+	FindMembershipsByUserID(user *User) ([]*OrganizationMembership, error)
+	FindMembers(orgID bson.ObjectID) ([]*OrganizationMemberDetail, error)
+	FindActive(user *User) (*Organization, *OrganizationMember, error)
+	UpdateMemberRole(actor *OrganizationMember, userID bson.ObjectID, role types.OrgRole) error
+	RemoveMember(actor *OrganizationMember, userID bson.ObjectID) error
+	// EnsureNoSharedOwnership returns ErrOrgOwnerHasMembers when userID owns an organization
+	// with other members. The owner cannot be changed, so such an account cannot be deleted.
+	EnsureNoSharedOwnership(userID bson.ObjectID) error
+	UpdatePlanAndUsageLimitByID(id bson.ObjectID, plan types.PlanType) error
+	SetActive(userID bson.ObjectID, orgID *bson.ObjectID) error
+	InviteMember(actor *OrganizationMember, inviter *User, email string, role types.OrgRole, locale string) (*OrganizationInvitation, error)
+	FindPendingInvitations(orgID bson.ObjectID) ([]*OrganizationInvitation, error)
+	ResendInvitation(actor *OrganizationMember, inviter *User, invitationID bson.ObjectID, locale string) error
+	RevokeInvitation(actor *OrganizationMember, invitationID bson.ObjectID) error
+	AcceptInvitation(user *User, token string) (*Organization, error)
+}
@@ -13,7 +13,9 @@ type PaddleWebhookEvent struct {
 type PaddleUseCase interface {
 	HandleWebhook(event *PaddleWebhookEvent) error
 	CreateCustomerPortalSessionByEmail(email string) (*paddle.CustomerPortalSession, error)
-	CancelSubscriptionImmediately(userID bson.ObjectID) error
+	// CancelSubscriptionImmediately returns the subscription it cancelled, nil when there was no active one.
+	CancelSubscriptionImmediately(accountID bson.ObjectID) (*Subscription, error)
 	GetCustomerIDByEmail(email string) (string, error)
+	UpdateCustomerEmail(customerID, email string) error
 	GetPriceByID(priceID string) (*paddle.Price, error)
 }
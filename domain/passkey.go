@@ -0,0 +1,127 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/kwa0x2/SmartSRT-Backend/domain/types"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const (
+	CollectionPasskey         = "passkeys"
+	CollectionPasskeyCeremony = "passkey_ceremonies"
+
+	// PasskeyCeremonyTTL is how long a started registration or sign-in can be finished.
+	PasskeyCeremonyTTL = 5 * time.Minute
+	// PasskeyReauthWindow is how recent the sign-in of an account without password and
+	// two-factor authentication has to be to register a passkey.
+	PasskeyReauthWindow = 10 * time.Minute
+)
+
+// Passkey is a WebAuthn credential a user registered. Passkeys sign in on their own, since
+// signing in with one requires user verification, and answer the second step of a sign-in.
+type Passkey struct {
+	ID              bson.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID          bson.ObjectID `bson:"user_id" validate:"required" json:"-"`
+	Name            string        `bson:"name" validate:"required,max=100" json:"name"`
+	CredentialID    []byte        `bson:"credential_id" validate:"required" json:"-"`
+	PublicKey       []byte        `bson:"public_key" validate:"required" json:"-"`
+	AttestationType string        `bson:"attestation_type" json:"-"`
+	AAGUID          []byte        `bson:"aaguid,omitempty" json:"-"`
+	SignCount       uint32        `bson:"sign_count" json:"-"`
+	Transports      []string      `bson:"transports" json:"transports"`
+	BackupEligible  bool          `bson:"backup_eligible" json:"backup_eligible"`
+	BackupState     bool          `bson:"backup_state" json:"backup_state"` // Synced to other devices by the platform
+	LastUsedAt      *time.Time    `bson:"last_used_at,omitempty" json:"last_used_at"`
+	CreatedAt       time.Time     `bson:"created_at" validate:"required" json:"created_at"`
+	UpdatedAt       time.Time     `bson:"updated_at" validate:"required" json:"-"`
+	DeletedAt       *time.Time    `bson:"deleted_at,omitempty" json:"-"`
+}
+
+func (p *Passkey) Validate() error {
+	validate := validator.New()
+	return validate.Struct(p)
+}
+
+func (p *Passkey) GetCollectionName() string {
+	return CollectionPasskey
+}
+
+func (p *Passkey) SetID(id bson.ObjectID) {
+	p.ID = id
+}
+
+// PasskeyCeremony keeps the WebAuthn session data of a started registration or sign-in until
+// the browser's response comes back, shared by all replicas and removed by a TTL index once it
+// expires. Only a hash of the session token is stored, and finishing deletes the ceremony, so
+// its challenge can be answered once.
+type PasskeyCeremony struct {
+	ID        bson.ObjectID     `bson:"_id,omitempty"`
+	TokenHash string            `bson:"token_hash" validate:"required"`
+	Process   types.ProcessType `bson:"process" validate:"required"`
+	UserID    *bson.ObjectID    `bson:"user_id,omitempty"`           // Unset for a sign-in that starts without a user
+	Session   string            `bson:"session" validate:"required"` // webauthn.SessionData as JSON
+	ExpiresAt time.Time         `bson:"expires_at" validate:"required"`
+	CreatedAt time.Time         `bson:"created_at" validate:"required"`
+	UpdatedAt time.Time         `bson:"updated_at" validate:"required"`
+}
+
+func (c *PasskeyCeremony) Validate() error {
+	validate := validator.New()
+	return validate.Struct(c)
+}
+
+func (c *PasskeyCeremony) GetCollectionName() string {
+	return CollectionPasskeyCeremony
+}
+
+func (c *PasskeyCeremony) SetID(id bson.ObjectID) {
+	c.ID = id
+}
+
+// PasskeyReauthBody confirms the user before a registration starts: a current two-factor code
+// when two-factor authentication is enabled, otherwise the password when one is set.
+type PasskeyReauthBody struct {
+	Password string `json:"password" binding:"max=128"`
+	Code     string `json:"code" binding:"max=32"`
+}
+
+// PasskeyRegistrationBody finishes a registration. SessionToken is the one its begin returned,
+// Credential the PublicKeyCredential the browser created.
+type PasskeyRegistrationBody struct {
+	SessionToken string          `json:"session_token" binding:"required"`
+	Name         string          `json:"name" binding:"required,max=100"`
+	Credential   json.RawMessage `json:"credential" binding:"required"`
+}
+
+// PasskeyAssertionBody finishes a sign-in, like PasskeyRegistrationBody.
+type PasskeyAssertionBody struct {
+	SessionToken string          `json:"session_token" binding:"required"`
+	Credential   json.RawMessage `json:"credential" binding:"required"`
+}
+
+type PasskeyUseCase interface {
+	BeginRegistration(user *User) (*protocol.CredentialCreation, *webauthn.SessionData, error)
+	FinishRegistration(user *User, session webauthn.SessionData, name string, response []byte) (*Passkey, error)
+	// BeginLogin starts a sign-in with whichever passkey the browser offers.
+	BeginLogin() (*protocol.CredentialAssertion, *webauthn.SessionData, error)
+	// FinishLogin returns the owner of the passkey, ErrPasskeyInvalid when the assertion does
+	// not verify. The owner may be a deleted account, see FindRestorableByID.
+	FinishLogin(session webauthn.SessionData, response []byte) (*User, error)
+	// BeginSecondFactor starts a sign-in step with one of the user's passkeys, mongo.ErrNoDocuments
+	// when the user has none.
+	BeginSecondFactor(user *User) (*protocol.CredentialAssertion, *webauthn.SessionData, error)
+	FinishSecondFactor(user *User, session webauthn.SessionData, response []byte) error
+	// StartCeremony stores the session data of a started ceremony and returns its session token.
+	StartCeremony(process types.ProcessType, userID *bson.ObjectID, session *webauthn.SessionData) (string, error)
+	// FinishCeremony removes the ceremony of the token and returns its session data and user,
+	// mongo.ErrNoDocuments when it is unknown, expired, of another process or already finished.
+	FinishCeremony(process types.ProcessType, token string) (*webauthn.SessionData, *bson.ObjectID, error)
+	FindByUserID(userID bson.ObjectID) ([]*Passkey, error)
+	// Revoke removes the passkey, ErrLastLoginMethod when the user would be left without a way to sign in.
+	Revoke(userID, id bson.ObjectID) error
+}
@@ -0,0 +1,114 @@
+package domain
+
+import (
+	"slices"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/kwa0x2/SmartSRT-Backend/config"
+	"github.com/kwa0x2/SmartSRT-Backend/domain/types"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const (
+	CollectionPlan = "plans"
+
+	PlanCacheTTL = 1 * time.Minute
+
+	// FeaturePinHistory lets an account pin conversions so retention never deletes them.
+	FeaturePinHistory = "pin_history"
+)
+
+// Plan describes everything a tier is allowed to do. Adding a document to the plans
+// collection is enough to offer a new tier; no check compares plan names directly.
+type Plan struct {
+	ID              bson.ObjectID   `bson:"_id,omitempty" json:"-"`
+	Name            types.PlanType  `bson:"name" validate:"required" json:"name"`
+	DisplayName     string          `bson:"display_name" validate:"required" json:"display_name"`
+	MonthlySeconds  float64         `bson:"monthly_seconds" validate:"required" json:"monthly_seconds"`
+	MaxFileDuration float64         `bson:"max_file_duration" validate:"required" json:"max_file_duration"` // Seconds
+	MaxFileSize     int64           `bson:"max_file_size" validate:"required" json:"max_file_size"`         // Bytes
+	AllowedFormats  []string        `bson:"allowed_formats" validate:"required" json:"allowed_formats"`     // File extensions including the dot
+	Features        map[string]bool `bson:"features" json:"features"`
+	Retention       PlanRetention   `bson:"retention" json:"retention"`
+	PaddlePriceIDs  []string        `bson:"paddle_price_ids" json:"paddle_price_ids"`
+	IsDefault       bool            `bson:"is_default" json:"is_default"` // Assigned on registration and after a subscription ends
+	CreatedAt       time.Time       `bson:"created_at" validate:"required" json:"-"`
+	UpdatedAt       time.Time       `bson:"updated_at" validate:"required" json:"-"`
+	DeletedAt       *time.Time      `bson:"deleted_at,omitempty" json:"-"`
+}
+
+// PlanRetention sets how many days conversions are kept. Zero keeps them forever. The seeder
+// fills it in on plans created before retention existed.
+type PlanRetention struct {
+	MediaDays int `bson:"media_days" json:"media_days"` // Uploaded source media
+	SRTDays   int `bson:"srt_days" json:"srt_days"`     // Subtitles together with their history entry
+}
+
+func (p *Plan) Validate() error {
+	validate := validator.New()
+	return validate.Struct(p)
+}
+
+func (p *Plan) GetCollectionName() string {
+	return CollectionPlan
+}
+
+func (p *Plan) SetID(id bson.ObjectID) {
+	p.ID = id
+}
+
+func (p *Plan) AllowsFormat(fileType string) bool {
+	return slices.Contains(p.AllowedFormats, fileType)
+}
+
+func (p *Plan) HasFeature(feature string) bool {
+	return p.Features[feature]
+}
+
+func (p *Plan) HasPriceID(priceID string) bool {
+	return slices.Contains(p.PaddlePriceIDs, priceID)
+}
+
+// DefaultPlans is the catalogue seeded into an empty plans collection, matching the
+// rules that applied before plans became configurable.
+func DefaultPlans(env *config.Env) []*Plan {
+	now := time.Now().UTC()
+
+	return []*Plan{
+		{
+			Name:            types.Free,
+			DisplayName:     "Free",
+			MonthlySeconds:  env.FreeMonthlyLimit,
+			MaxFileDuration: 30,
+			MaxFileSize:     100 << 20,
+			AllowedFormats:  []string{".mp4", ".mp3"},
+			Features:        map[string]bool{},
+			Retention:       PlanRetention{MediaDays: 7, SRTDays: 30},
+			PaddlePriceIDs:  []string{},
+			IsDefault:       true,
+			CreatedAt:       now,
+			UpdatedAt:       now,
+		},
+		{
+			Name:            types.Pro,
+			DisplayName:     "Pro",
+			MonthlySeconds:  env.ProMonthlyLimit,
+			MaxFileDuration: 5 * 60,
+			MaxFileSize:     1 << 30,
+			AllowedFormats:  []string{".mp4", ".mp3", ".wav"},
+			Features:        map[string]bool{FeaturePinHistory: true},
+			Retention:       PlanRetention{MediaDays: 30, SRTDays: 365},
+			PaddlePriceIDs:  append([]string{}, env.PaddleProPriceIDs...),
+			CreatedAt:       now,
+			UpdatedAt:       now,
+		},
+	}
+}
+
+type PlanUseCase interface {
+	FindAll() ([]*Plan, error)
+	FindByName(name types.PlanType) (*Plan, error)
+	FindByPriceID(priceID string) (*Plan, error)
+	FindDefault() (*Plan, error)
+}
@@ -10,12 +10,13 @@ import (
 )
 
 const (
-	QueueConversions = "srt_conversions"
+	QueueConversions  = "srt_conversions"
+	QueueDataExports  = "data_exports"
+	ExchangeJobEvents = "srt_job_events"
 
 	ReconnectDelay  = 5 * time.Second
 	ReInitDelay     = 2 * time.Second
 	ResendDelay     = 5 * time.Second
-	MessageTimeout  = 10 * time.Second
 	ChannelPoolSize = 10
 )
 
@@ -52,16 +53,24 @@ func (p *ChannelPool) Close() {
 }
 
 type ConversionMessage struct {
-	UserID              bson.ObjectID `json:"user_id"`
-	WordsPerLine        int           `json:"words_per_line"`
-	Punctuation         bool          `json:"punctuation"`
-	ConsiderPunctuation bool          `json:"consider_punctuation"`
-	FileName            string        `json:"file_name"`
-	FileID              string        `json:"file_id"`
-	FileContent         []byte        `json:"file_content"`
-	FileSize            int64         `json:"file_size"`
-	FileDuration        float64       `json:"file_duration"`
-	Email               string        `json:"email"`
+	UserID              bson.ObjectID  `json:"user_id"`
+	OrgID               *bson.ObjectID `json:"org_id,omitempty"`
+	WordsPerLine        int            `json:"words_per_line"`
+	Punctuation         bool           `json:"punctuation"`
+	ConsiderPunctuation bool           `json:"consider_punctuation"`
+	FileName            string         `json:"file_name"`
+	FileID              string         `json:"file_id"`
+	FileContent         []byte         `json:"file_content"`
+	FileSize            int64          `json:"file_size"`
+	FileDuration        float64        `json:"file_duration"`
+	Email               string         `json:"email"`
+	Sandbox             bool           `json:"sandbox,omitempty"`
+}
+
+// DataExportMessage asks the consumer to build the archive of a queued DataExport.
+type DataExportMessage struct {
+	ExportID bson.ObjectID `json:"export_id"`
+	UserID   bson.ObjectID `json:"user_id"`
 }
 
 type RabbitMQ struct {
@@ -81,7 +90,7 @@ type Worker struct {
 	ID       int
 	Channel  *amqp.Channel
 	Queue    string
-	Handler  func(ConversionMessage) (*LambdaResponse, error)
+	Handler  func(body []byte) error
 	Done     chan bool
 	RabbitMQ *RabbitMQ
 }
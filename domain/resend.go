@@ -1,6 +1,10 @@
 package domain
 
-import "github.com/kwa0x2/SmartSRT-Backend/config"
+import (
+	"time"
+
+	"github.com/kwa0x2/SmartSRT-Backend/config"
+)
 
 type ResendRepository interface {
 	SendEmail(to, subject, htmlContent string) (string, error)
@@ -11,4 +15,14 @@ type ResendUseCase interface {
 	SendContactNotifyMail(env *config.Env, contact *Contact) (string, error)
 	SendDeleteAccountEmail(email, deleteAccountLink string) (string, error)
 	SendSRTCreatedEmail(email, SRTLink string) (string, error)
+	SendUsageThresholdEmail(email string, percent int, usedSeconds, limitSeconds float64, periodEnd time.Time, usageLink string) (string, error)
+	SendUsagePeriodStartedEmail(email string, limitSeconds float64, periodEnd time.Time, usageLink string) (string, error)
+	SendOrganizationInvitationEmail(email, orgName, inviterName, role string, expiresAt time.Time, inviteLink string) (string, error)
+	SendRetentionWarningEmail(email string, count int, deleteAt time.Time, historyLink string) (string, error)
+	SendAccountDeletedEmail(email string, restoreUntil time.Time, restoreLink string) (string, error)
+	SendAccountRestoredEmail(email string, cancelled *CancelledSubscription, dashboardLink string) (string, error)
+	SendDataExportEmail(email string, expiresAt time.Time, downloadLink string) (string, error)
+	SendEmailChangeConfirmEmail(email, confirmLink string) (string, error)
+	SendEmailChangeNoticeEmail(email, newEmail string) (string, error)
+	SendPasskeyAddedEmail(email, passkeyName string) (string, error)
 }
@@ -8,24 +8,57 @@ import (
 
 const (
 	TableName = "sessions"
+	// SessionUserIndex is the global secondary index of the sessions table keyed by user_id.
+	// It has to project all attributes, sessions are listed from it.
+	SessionUserIndex = "user_id-index"
 )
 
 type SessionRepository interface {
 	CreateSession(ctx context.Context, session Session) error
 	GetSession(ctx context.Context, sessionID string) (*Session, error)
-	UpdateSessionTTL(ctx context.Context, sessionID string, newTTL int) error
+	// UpdateSessionActivity extends the session and records when it was last seen.
+	UpdateSessionActivity(ctx context.Context, sessionID string, newTTL int, lastSeenAt int64) error
 	DeleteSession(ctx context.Context, sessionID string) error
+	// FindSessionsByUserID queries SessionUserIndex, which is eventually consistent. It may
+	// still return sessions that expired but were not yet removed by DynamoDB.
+	FindSessionsByUserID(ctx context.Context, userID string) ([]*Session, error)
+	DeleteSessionsByUserID(ctx context.Context, userID string) (int, error)
 }
 
 type SessionUseCase interface {
-	CreateSessionAndUpdateLastLogin(userID bson.ObjectID, plan types.PlanType, email string) (string, error)
+	CreateSessionAndUpdateLastLogin(userID bson.ObjectID, plan types.PlanType, email string, client SessionClient) (string, error)
 	ValidateSession(sessionID string) (*Session, error)
 	DeleteSession(sessionID string) error
+	// ListSessions returns the user's active sessions, most recently seen first, with the one
+	// of currentSessionID marked as current.
+	ListSessions(userID bson.ObjectID, currentSessionID string) ([]*Session, error)
+	// RevokeSession deletes the user's session with the public ID, mongo.ErrNoDocuments when
+	// the user has no such session. It returns the revoked session.
+	RevokeSession(userID bson.ObjectID, id string) (*Session, error)
+	// RevokeOtherSessions deletes every session of the user but currentSessionID, which may be
+	// empty, and returns how many were deleted.
+	RevokeOtherSessions(userID bson.ObjectID, currentSessionID string) (int, error)
 }
 
+// SessionClient describes the browser or app a session is created for.
+type SessionClient struct {
+	UserAgent string
+	IPAddress string
+}
+
+// Session is keyed by its session ID, which is the sid cookie value and never leaves the table.
+// Sessions are shown and revoked by ID, a hash of the session ID.
 type Session struct {
-	SessionID string         `dynamodbav:"session_id"`
-	UserID    string         `dynamodbav:"user_id"`
-	Plan      types.PlanType `dynamodbav:"plan"`
-	TTL       int            `dynamodbav:"ttl"`
+	SessionID  string         `dynamodbav:"session_id" json:"-"`
+	UserID     string         `dynamodbav:"user_id" json:"-"`
+	Plan       types.PlanType `dynamodbav:"plan" json:"-"`
+	TTL        int            `dynamodbav:"ttl" json:"expires_at"`
+	Device     string         `dynamodbav:"device" json:"device"` // e.g. "Chrome on macOS", derived from UserAgent
+	UserAgent  string         `dynamodbav:"user_agent" json:"user_agent"`
+	IPAddress  string         `dynamodbav:"ip_address" json:"ip_address"` // Address the session was created from
+	CreatedAt  int64          `dynamodbav:"created_at" json:"created_at"`
+	LastSeenAt int64          `dynamodbav:"last_seen_at" json:"last_seen_at"`
+
+	ID      string `dynamodbav:"-" json:"id"`
+	Current bool   `dynamodbav:"-" json:"current"`
 }
@@ -1,10 +1,12 @@
 package domain
 
 import (
+	"fmt"
 	"mime/multipart"
 	"time"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/kwa0x2/SmartSRT-Backend/domain/types"
 	"go.mongodb.org/mongo-driver/v2/bson"
 )
 
@@ -19,32 +21,56 @@ type LambdaResponse struct {
 }
 
 type FileConversionRequest struct {
-	UserID              bson.ObjectID `json:"user_id"`
-	WordsPerLine        int           `json:"words_per_line"`
-	Punctuation         bool          `json:"punctuation"`
-	ConsiderPunctuation bool          `json:"consider_punctuation"`
-	FileName            string        `json:"file_name"`
+	UserID              bson.ObjectID  `json:"user_id"`
+	OrgID               *bson.ObjectID `json:"org_id,omitempty"` // Organization the conversion is billed to and shared with
+	FileID              string         `json:"file_id"`
+	WordsPerLine        int            `json:"words_per_line"`
+	Punctuation         bool           `json:"punctuation"`
+	ConsiderPunctuation bool           `json:"consider_punctuation"`
+	FileName            string         `json:"file_name"`
 	File                multipart.File
 	FileHeader          multipart.FileHeader
 	FileDuration        float64
+	Sandbox             bool                         `json:"-"` // Converted by the fake backend, never charged
+	Progress            func(status types.JobStatus) `json:"-"`
+}
+
+func (r FileConversionRequest) ReportProgress(status types.JobStatus) {
+	if r.Progress != nil {
+		r.Progress(status)
+	}
 }
 
 const (
 	CollectionSRTHistory = "srt_history"
+
+	// SRTDownloadURLTTL bounds the presigned links handed out by the download endpoint.
+	SRTDownloadURLTTL = 5 * time.Minute
+	// SRTEmailDownloadURLTTL is the lifetime of the link in the "subtitles ready" email,
+	// the longest S3 allows for presigned URLs.
+	SRTEmailDownloadURLTTL = 7 * 24 * time.Hour
 )
 
 type SRTHistory struct {
-	ID                  bson.ObjectID `bson:"_id,omitempty"`
-	UserID              bson.ObjectID `bson:"user_id" validate:"required"`
-	FileName            string        `bson:"file_name" validate:"required"`
-	S3URL               string        `bson:"s3_url" validate:"required"`
-	Duration            float64       `bson:"duration"`
-	WordsPerLine        int           `bson:"words_per_line"`
-	Punctuation         bool          `bson:"punctuation"`
-	ConsiderPunctuation bool          `bson:"consider_punctuation"`
-	CreatedAt           time.Time     `bson:"created_at"  validate:"required"`
-	UpdatedAt           time.Time     `bson:"updated_at"  validate:"required"`
-	DeletedAt           *time.Time    `bson:"deleted_at,omitempty"`
+	ID                  bson.ObjectID  `bson:"_id,omitempty"`
+	UserID              bson.ObjectID  `bson:"user_id" validate:"required"`
+	OrgID               *bson.ObjectID `bson:"org_id,omitempty"` // Set for conversions made inside an organization, visible to all its members
+	FileName            string         `bson:"file_name" validate:"required"`
+	ObjectKey           string         `bson:"object_key" validate:"required" json:"-"` // Served through presigned links only
+	MediaObjectKey      string         `bson:"media_object_key,omitempty" json:"-"`     // Uploaded source file, empty for sandbox conversions
+	MediaFileName       string         `bson:"media_file_name,omitempty"`
+	Duration            float64        `bson:"duration"`
+	WordsPerLine        int            `bson:"words_per_line"`
+	Punctuation         bool           `bson:"punctuation"`
+	ConsiderPunctuation bool           `bson:"consider_punctuation"`
+	Sandbox             bool           `bson:"sandbox,omitempty"` // Created with a test-mode API key, hidden from live history
+	Pinned              bool           `bson:"pinned"`            // Kept by the retention job while the plan allows pinning
+	MediaDeletedAt      *time.Time     `bson:"media_deleted_at,omitempty"`
+	RetentionWarnedAt   *time.Time     `bson:"retention_warned_at,omitempty"` // Owner was told about the next retention deletion
+	RetentionDueAt      *time.Time     `bson:"retention_due_at,omitempty"`    // Due date the warning announced, a new due date needs a new warning
+	CreatedAt           time.Time      `bson:"created_at"  validate:"required"`
+	UpdatedAt           time.Time      `bson:"updated_at"  validate:"required"`
+	DeletedAt           *time.Time     `bson:"deleted_at,omitempty"`
 }
 
 func (s *SRTHistory) Validate() error {
@@ -60,12 +86,51 @@ func (s *SRTHistory) SetID(id bson.ObjectID) {
 	s.ID = id
 }
 
+const (
+	SRTHistoryDefaultPageSize = 20
+	SRTHistoryMaxPageSize     = 100
+)
+
+// SRTHistoryQuery filters and pages a history listing. Nil filters are not applied.
+type SRTHistoryQuery struct {
+	From                *time.Time
+	To                  *time.Time // Exclusive
+	MinDuration         *float64
+	MaxDuration         *float64
+	WordsPerLine        *int
+	Punctuation         *bool
+	ConsiderPunctuation *bool
+	FileName            string // Case-insensitive substring
+	Sort                types.HistorySort
+	Cursor              string
+	Limit               int
+}
+
+type DeleteHistoriesBody struct {
+	IDs []string `json:"ids" binding:"required,min=1,max=100"`
+}
+
+type SRTHistoryPage struct {
+	Items      []*SRTHistory `json:"items"`
+	NextCursor string        `json:"next_cursor,omitempty"` // Empty on the last page
+}
+
+// MediaObjectKey is where UploadFileToS3 stores a user's source media.
+func MediaObjectKey(userID bson.ObjectID, fileName string) string {
+	return fmt.Sprintf("files/%s/%s", userID.Hex(), fileName)
+}
+
 type SRTUseCase interface {
-	UploadFileAndConvertToSRT(request FileConversionRequest) (*LambdaResponse, error)
-	FindHistoriesByUserID(userID bson.ObjectID) ([]*SRTHistory, error)
+	UploadFileAndConvertToSRT(request FileConversionRequest) (*SRTHistory, error)
+	FindHistory(userID bson.ObjectID, orgID *bson.ObjectID, sandbox bool, id bson.ObjectID) (*SRTHistory, error)
+	CreateDownloadURL(history *SRTHistory, file types.DownloadFile, ttl time.Duration) (string, error)
+	DeleteHistories(userID bson.ObjectID, orgID *bson.ObjectID, sandbox bool, ids []bson.ObjectID) (int, error)
+	SetPinned(userID bson.ObjectID, orgID *bson.ObjectID, sandbox bool, id bson.ObjectID, pinned bool) error
+	FindHistories(userID bson.ObjectID, orgID *bson.ObjectID, sandbox bool, query SRTHistoryQuery) (*SRTHistoryPage, error)
 }
 
 type SRTRepository interface {
 	UploadFileToS3(request FileConversionRequest) (string, error)
 	TriggerLambdaFunc(request FileConversionRequest) (*LambdaResponse, error)
+	PresignDownload(objectKey, fileName string, ttl time.Duration) (string, error)
 }
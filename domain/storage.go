@@ -0,0 +1,87 @@
+package domain
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/kwa0x2/SmartSRT-Backend/domain/types"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const (
+	CollectionStorageDeletion = "storage_deletions"
+
+	StorageDeletionBatchSize  = 100
+	StorageDeletionMaxBackoff = 1 * time.Hour
+
+	// StorageOrphanGracePeriod keeps the reconciliation away from objects of conversions
+	// that are still running and have not written their history yet.
+	StorageOrphanGracePeriod = 24 * time.Hour
+	StorageReconcileInterval = 24 * time.Hour
+
+	RetentionInterval  = 1 * time.Hour
+	RetentionBatchSize = 500
+	// RetentionWarningPeriod is the least time between the warning email and a retention
+	// deletion. Deletions that come due without a warning are postponed accordingly.
+	RetentionWarningPeriod = 3 * 24 * time.Hour
+)
+
+// StoragePrefixes are the bucket prefixes holding user media and subtitles.
+var StoragePrefixes = []string{"files/", "sandbox/"}
+
+// StorageDeletion is a queued removal of an S3 object. Entries are written together with the
+// change that made the object obsolete and retried until S3 confirms the deletion.
+type StorageDeletion struct {
+	ID            bson.ObjectID               `bson:"_id,omitempty"`
+	ObjectKey     string                      `bson:"object_key" validate:"required"`
+	Reason        types.StorageDeletionReason `bson:"reason" validate:"required"`
+	HistoryID     *bson.ObjectID              `bson:"history_id,omitempty"`
+	Attempts      int                         `bson:"attempts"`
+	LastError     string                      `bson:"last_error,omitempty"`
+	NextAttemptAt time.Time                   `bson:"next_attempt_at" validate:"required"`
+	CompletedAt   *time.Time                  `bson:"completed_at,omitempty"`
+	CreatedAt     time.Time                   `bson:"created_at" validate:"required"`
+	UpdatedAt     time.Time                   `bson:"updated_at" validate:"required"`
+}
+
+func (d *StorageDeletion) Validate() error {
+	validate := validator.New()
+	return validate.Struct(d)
+}
+
+func (d *StorageDeletion) GetCollectionName() string {
+	return CollectionStorageDeletion
+}
+
+func (d *StorageDeletion) SetID(id bson.ObjectID) {
+	d.ID = id
+}
+
+type StorageObject struct {
+	Key          string
+	LastModified time.Time
+}
+
+type StorageRepository interface {
+	// DeleteObjects removes the keys and returns the per-key failures S3 reported.
+	DeleteObjects(keys []string) (map[string]error, error)
+	// ListObjects walks every object under prefix, one page at a time.
+	ListObjects(prefix string, fn func(page []StorageObject) error) error
+}
+
+type RetentionRun struct {
+	MediaDeleted     int
+	HistoriesDeleted int
+	Warned           int
+}
+
+type RetentionUseCase interface {
+	ApplyRetention() (*RetentionRun, error)
+}
+
+type StorageUseCase interface {
+	QueueDeletion(ctx context.Context, keys []string, reason types.StorageDeletionReason, historyID *bson.ObjectID) error
+	ProcessPendingDeletions() (int, error)
+	ReconcileOrphans() (int, error)
+}
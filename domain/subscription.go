@@ -22,7 +22,7 @@ type UnitPrice struct {
 type Subscription struct {
 	ID                   bson.ObjectID `bson:"_id,omitempty"`
 	SubscriptionID       string        `bson:"subscription_id" validate:"required"`
-	UserID               bson.ObjectID `bson:"user_id" validate:"required"`
+	UserID               bson.ObjectID `bson:"user_id" validate:"required"` // Account ID, a user or an organization
 	Status               string        `bson:"status" validate:"required"`
 	PriceID              string        `bson:"price_id" validate:"required"`
 	UnitPrice            UnitPrice     `bson:"unit_price" validate:"required"`
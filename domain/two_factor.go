@@ -0,0 +1,47 @@
+package domain
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const (
+	// TwoFactorIssuer names the account in authenticator apps.
+	TwoFactorIssuer       = "SmartSRT"
+	RecoveryCodeCount     = 10
+	TwoFactorChallengeTTL = 5 * time.Minute
+	// TwoFactorMaxAttempts is how many codes one sign-in challenge accepts before the sign-in has to start over.
+	TwoFactorMaxAttempts = 5
+	// TwoFactorMaxFailures wrong sign-in codes lock the account's two-factor step for
+	// TwoFactorLockoutDuration, however many sign-ins they were spread over.
+	TwoFactorMaxFailures     = 10
+	TwoFactorLockoutDuration = 15 * time.Minute
+)
+
+// TwoFactorCodeBody carries a code of the authenticator app or, where accepted, a recovery code.
+type TwoFactorCodeBody struct {
+	Code string `json:"code" binding:"required,max=32"`
+}
+
+type TwoFactorUseCase interface {
+	// BeginEnrollment stores a new pending secret and returns it with its otpauth:// URI.
+	// ErrTwoFactorEnabled when the user already uses two-factor authentication.
+	BeginEnrollment(user *User) (string, string, error)
+	// ConfirmEnrollment enables two-factor authentication once a code of the pending secret
+	// is given and returns the recovery codes, which are only stored hashed.
+	ConfirmEnrollment(userID bson.ObjectID, code string) ([]string, error)
+	// Verify accepts a code of the authenticator app or an unused recovery code, each only once.
+	// The user may be a deleted account that is restored once its sign-in is verified.
+	Verify(user *User, code string) error
+	// CreateChallenge starts the second step of a sign-in and returns its secret. A new
+	// challenge replaces the previous one of the user.
+	CreateChallenge(userID bson.ObjectID) (string, error)
+	// VerifyChallenge is Verify for a sign-in challenge. Every attempt counts against
+	// TwoFactorMaxAttempts and a verified challenge is used up; ErrTwoFactorChallengeInvalid
+	// when the challenge was replaced, used up or had too many attempts. Wrong codes also
+	// count against TwoFactorMaxFailures of the user; ErrTwoFactorLocked while locked out.
+	VerifyChallenge(user *User, challenge, code string) error
+	Disable(user *User, code string) error
+	RegenerateRecoveryCodes(user *User, code string) ([]string, error)
+}
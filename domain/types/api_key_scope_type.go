@@ -0,0 +1,14 @@
+package types
+
+type APIKeyScope string
+
+const (
+	ScopeSRTWrite     APIKeyScope = "srt:write"
+	ScopeHistoryRead  APIKeyScope = "history:read"
+	ScopeHistoryWrite APIKeyScope = "history:write"
+	ScopeUsageRead    APIKeyScope = "usage:read"
+)
+
+func (s APIKeyScope) IsValid() bool {
+	return s == ScopeSRTWrite || s == ScopeHistoryRead || s == ScopeHistoryWrite || s == ScopeUsageRead
+}
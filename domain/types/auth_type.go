@@ -6,4 +6,5 @@ const (
 	Google      AuthType = "google"
 	Github      AuthType = "github"
 	Credentials AuthType = "credentials"
+	Passkey     AuthType = "passkey" // Left with passkeys only after unlinking the providers
 )
@@ -0,0 +1,11 @@
+package types
+
+type DataExportStatus string
+
+const (
+	DataExportQueued     DataExportStatus = "queued"
+	DataExportProcessing DataExportStatus = "processing"
+	DataExportReady      DataExportStatus = "ready"
+	DataExportFailed     DataExportStatus = "failed"
+	DataExportExpired    DataExportStatus = "expired"
+)
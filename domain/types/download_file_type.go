@@ -0,0 +1,13 @@
+package types
+
+// DownloadFile selects which object of a conversion a download link points at.
+type DownloadFile string
+
+const (
+	DownloadSRT   DownloadFile = "srt"
+	DownloadMedia DownloadFile = "media"
+)
+
+func (f DownloadFile) IsValid() bool {
+	return f == DownloadSRT || f == DownloadMedia
+}
@@ -0,0 +1,9 @@
+package types
+
+type ErasureStatus string
+
+const (
+	ErasureScheduled ErasureStatus = "scheduled"
+	ErasureCompleted ErasureStatus = "completed"
+	ErasureCancelled ErasureStatus = "cancelled"
+)
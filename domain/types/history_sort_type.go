@@ -0,0 +1,42 @@
+package types
+
+type HistorySort string
+
+const (
+	SortNewest   HistorySort = "newest"
+	SortOldest   HistorySort = "oldest"
+	SortLongest  HistorySort = "longest"
+	SortShortest HistorySort = "shortest"
+	SortNameAsc  HistorySort = "name_asc"
+	SortNameDesc HistorySort = "name_desc"
+)
+
+func (s HistorySort) IsValid() bool {
+	switch s {
+	case SortNewest, SortOldest, SortLongest, SortShortest, SortNameAsc, SortNameDesc:
+		return true
+	}
+	return false
+}
+
+// Field returns the srt_history field the sort orders by.
+func (s HistorySort) Field() string {
+	switch s {
+	case SortLongest, SortShortest:
+		return "duration"
+	case SortNameAsc, SortNameDesc:
+		return "file_name"
+	default:
+		return "created_at"
+	}
+}
+
+// Direction returns 1 for ascending and -1 for descending order.
+func (s HistorySort) Direction() int {
+	switch s {
+	case SortOldest, SortShortest, SortNameAsc:
+		return 1
+	default:
+		return -1
+	}
+}
@@ -0,0 +1,17 @@
+package types
+
+type JobStatus string
+
+const (
+	JobQueued       JobStatus = "queued"
+	JobUploading    JobStatus = "uploading"
+	JobTranscribing JobStatus = "transcribing"
+	JobSaving       JobStatus = "saving"
+	JobDone         JobStatus = "done"
+	JobFailed       JobStatus = "failed"
+	JobCancelled    JobStatus = "cancelled"
+)
+
+func (s JobStatus) IsTerminal() bool {
+	return s == JobDone || s == JobFailed || s == JobCancelled
+}
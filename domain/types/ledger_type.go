@@ -0,0 +1,11 @@
+package types
+
+type LedgerEntryType string
+
+const (
+	LedgerCharge     LedgerEntryType = "charge"
+	LedgerRefund     LedgerEntryType = "refund"
+	LedgerAdjustment LedgerEntryType = "adjustment"
+	LedgerReset      LedgerEntryType = "reset"
+	LedgerPurchase   LedgerEntryType = "purchase"
+)
@@ -0,0 +1,18 @@
+package types
+
+type OrgRole string
+
+const (
+	OrgOwner  OrgRole = "owner"
+	OrgAdmin  OrgRole = "admin"
+	OrgMember OrgRole = "member"
+)
+
+func (r OrgRole) IsValid() bool {
+	return r == OrgOwner || r == OrgAdmin || r == OrgMember
+}
+
+// CanManageMembers reports whether the role may change roles and remove other members.
+func (r OrgRole) CanManageMembers() bool {
+	return r == OrgOwner || r == OrgAdmin
+}
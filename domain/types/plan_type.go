@@ -1,19 +1,10 @@
 package types
 
-import "github.com/kwa0x2/SmartSRT-Backend/config"
-
+// PlanType is the name of a plan in the catalogue. Free and Pro are the plans seeded
+// by default; other tiers only exist as documents in the plans collection.
 type PlanType string
 
 const (
 	Free PlanType = "free"
 	Pro  PlanType = "pro"
 )
-
-func GetMonthlyLimit(plan PlanType, env *config.Env) float64 {
-	switch plan {
-	case Pro:
-		return env.ProMonthlyLimit
-	default:
-		return env.FreeMonthlyLimit
-	}
-}
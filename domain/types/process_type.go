@@ -5,4 +5,13 @@ type ProcessType string
 const (
 	UpdatePassword ProcessType = "update_password"
 	DeleteAccount  ProcessType = "delete_account"
+	RestoreAccount ProcessType = "restore_account"
+	ChangeEmail    ProcessType = "change_email"
+	TwoFactorLogin ProcessType = "two_factor_login"
+
+	PasskeyRegistration ProcessType = "passkey_registration"
+	PasskeyLogin        ProcessType = "passkey_login"
+	PasskeySecondFactor ProcessType = "passkey_second_factor"
+
+	AcceptInvitation ProcessType = "accept_invitation"
 )
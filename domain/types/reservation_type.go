@@ -0,0 +1,17 @@
+package types
+
+type ReservationStatus string
+
+const (
+	ReservationReserved  ReservationStatus = "reserved"
+	ReservationCommitted ReservationStatus = "committed"
+	ReservationReleased  ReservationStatus = "released"
+)
+
+type ReleaseReason string
+
+const (
+	ReleaseFailed    ReleaseReason = "failed"
+	ReleaseCancelled ReleaseReason = "cancelled"
+	ReleaseExpired   ReleaseReason = "expired"
+)
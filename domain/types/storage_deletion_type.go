@@ -0,0 +1,12 @@
+package types
+
+type StorageDeletionReason string
+
+const (
+	DeletionHistoryDeleted StorageDeletionReason = "history_deleted"
+	DeletionOrphan         StorageDeletionReason = "orphan"
+	DeletionRetention      StorageDeletionReason = "retention"
+	DeletionAccountErased  StorageDeletionReason = "account_erased"
+	DeletionExportExpired  StorageDeletionReason = "export_expired"
+	DeletionAvatarReplaced StorageDeletionReason = "avatar_replaced"
+)
@@ -5,22 +5,46 @@ import (
 	"time"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/kwa0x2/SmartSRT-Backend/domain/types"
 	"go.mongodb.org/mongo-driver/v2/bson"
 )
 
 const (
-	CollectionUsage = "usage"
+	CollectionUsage            = "usage"
+	CollectionUsageReservation = "usage_reservation"
+	CollectionUsagePeriod      = "usage_period"
+
+	ReservationTTL    = 1 * time.Hour
+	UsagePeriodLength = 30 * 24 * time.Hour
+
+	UsageSweepPageSize = 100 // Usages loaded per page by the periodic sweeps
 )
 
+// ReservationProcessingTTL is how long a reservation is held once its job starts processing.
+// It grows with the file duration, so that a long file cannot expire while it is transcribed.
+func ReservationProcessingTTL(fileDuration float64) time.Duration {
+	return ReservationTTL + time.Duration(fileDuration*float64(time.Second))
+}
+
+// DefaultUsageNotifyThresholds are the percentages of UsageLimit that trigger an email
+// when USAGE_NOTIFY_THRESHOLDS is not set.
+var DefaultUsageNotifyThresholds = []int{80, 100}
+
 type Usage struct {
-	ID           bson.ObjectID `bson:"_id,omitempty"`
-	UserID       bson.ObjectID `bson:"user_id" validate:"required"`
-	StartDate    time.Time     `bson:"start_date" validate:"required"` // Subscription start date, renews every 30 days
-	MonthlyUsage float64       `bson:"monthly_usage"`                  // Usage duration for current period (seconds)
-	TotalUsage   float64       `bson:"total_usage"`                    // Total usage duration since registration (seconds)
-	UsageLimit   float64       `bson:"usage_limit" validate:"required"` // Monthly usage limit in seconds
-	CreatedAt    time.Time     `bson:"created_at" validate:"required"`
-	UpdatedAt    time.Time     `bson:"updated_at" validate:"required"`
+	ID                  bson.ObjectID  `bson:"_id,omitempty"`
+	UserID              bson.ObjectID  `bson:"user_id" validate:"required"`     // Account ID, a user or an organization sharing the pool
+	Plan                types.PlanType `bson:"plan"`                            // Plan the current period was opened with
+	StartDate           time.Time      `bson:"start_date" validate:"required"`  // Current period start, billing period for Pro, rolling 30 days for Free
+	EndDate             time.Time      `bson:"end_date"`                        // Current period end, the period rolls over once it is reached
+	MonthlyUsage        float64        `bson:"monthly_usage"`                   // Usage duration for current period (seconds)
+	ReservedUsage       float64        `bson:"reserved_usage"`                  // Seconds held by queued or running jobs
+	BonusBalance        float64        `bson:"bonus_balance"`                   // Purchased minute pack seconds, used after the monthly allowance and never reset
+	TotalUsage          float64        `bson:"total_usage"`                     // Total usage duration since registration (seconds)
+	UsageLimit          float64        `bson:"usage_limit" validate:"required"` // Monthly usage limit in seconds
+	NotifiedThresholds  []int          `bson:"notified_thresholds"`             // Thresholds already emailed in the current period
+	PeriodStartNotified bool           `bson:"period_start_notified"`           // Whether the new period email went out
+	CreatedAt           time.Time      `bson:"created_at" validate:"required"`
+	UpdatedAt           time.Time      `bson:"updated_at" validate:"required"`
 }
 
 func (u *Usage) Validate() error {
@@ -36,8 +60,73 @@ func (u *Usage) SetID(id bson.ObjectID) {
 	u.UserID = id
 }
 
+type UsageReservation struct {
+	ID            bson.ObjectID           `bson:"_id,omitempty"`
+	UserID        bson.ObjectID           `bson:"user_id" validate:"required"`
+	FileID        string                  `bson:"file_id" validate:"required"`
+	Seconds       float64                 `bson:"seconds" validate:"required"`
+	Status        types.ReservationStatus `bson:"status" validate:"required"`
+	ReleaseReason types.ReleaseReason     `bson:"release_reason,omitempty"`
+	ExpiresAt     time.Time               `bson:"expires_at" validate:"required"`
+	CreatedAt     time.Time               `bson:"created_at" validate:"required"`
+	UpdatedAt     time.Time               `bson:"updated_at" validate:"required"`
+}
+
+func (r *UsageReservation) Validate() error {
+	validate := validator.New()
+	return validate.Struct(r)
+}
+
+func (r *UsageReservation) GetCollectionName() string {
+	return CollectionUsageReservation
+}
+
+func (r *UsageReservation) SetID(id bson.ObjectID) {
+	r.ID = id
+}
+
+// UsagePeriod is the archived total of a closed usage period.
+type UsagePeriod struct {
+	ID         bson.ObjectID  `bson:"_id,omitempty"`
+	UserID     bson.ObjectID  `bson:"user_id" validate:"required"`
+	Plan       types.PlanType `bson:"plan"`
+	StartDate  time.Time      `bson:"start_date" validate:"required"`
+	EndDate    time.Time      `bson:"end_date" validate:"required"`
+	Usage      float64        `bson:"usage"`
+	UsageLimit float64        `bson:"usage_limit"`
+	CreatedAt  time.Time      `bson:"created_at" validate:"required"`
+	UpdatedAt  time.Time      `bson:"updated_at" validate:"required"`
+}
+
+func (p *UsagePeriod) Validate() error {
+	validate := validator.New()
+	return validate.Struct(p)
+}
+
+func (p *UsagePeriod) GetCollectionName() string {
+	return CollectionUsagePeriod
+}
+
+func (p *UsagePeriod) SetID(id bson.ObjectID) {
+	p.ID = id
+}
+
 type UsageUseCase interface {
 	FindOneByUserID(userID bson.ObjectID) (*Usage, error)
-	UpdateUsage(ctx context.Context, userID bson.ObjectID, duration float64) error
-	CheckUsageLimit(userID bson.ObjectID, duration float64) (bool, error)
+	ReserveUsage(userID bson.ObjectID, fileID string, duration float64) error
+	FindActiveReservation(fileID string) (*UsageReservation, error)
+	// ExtendReservation holds the active reservation for ReservationProcessingTTL from now,
+	// ErrReservationNotActive when there is none.
+	ExtendReservation(fileID string, fileDuration float64) error
+	CommitReservation(ctx context.Context, fileID string) error
+	// AdjustUsage applies a manual correction to the current period and records it in the
+	// ledger, as a refund when it gives back seconds charged for fileID.
+	AdjustUsage(userID bson.ObjectID, fileID string, seconds float64, reason string) error
+	ReleaseReservation(fileID string, reason types.ReleaseReason) error
+	ReleaseExpiredReservations() (int, error)
+	StartNewPeriod(ctx context.Context, userID bson.ObjectID, plan types.PlanType, start, end time.Time) error
+	RolloverDuePeriods() (int, error)
+	CreditMinutePack(userID bson.ObjectID, transactionID string, seconds float64) error
+	FindHistory(userID bson.ObjectID, from, to time.Time) (*UsageHistory, error)
+	SendUsageNotifications() (int, error)
 }
@@ -0,0 +1,63 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/kwa0x2/SmartSRT-Backend/domain/types"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const (
+	CollectionUsageLedger = "usage_ledger"
+
+	UsageHistoryMaxRange = 366 * 24 * time.Hour
+	UsageHistoryMaxItems = 1000
+)
+
+// UsageLedgerEntry is an append-only record of a single change to a user's monthly usage.
+// Entries are never updated, so the sum of a period's entries always explains its balance.
+type UsageLedgerEntry struct {
+	ID            bson.ObjectID         `bson:"_id,omitempty" json:"id"`
+	UserID        bson.ObjectID         `bson:"user_id" json:"user_id" validate:"required"`
+	Type          types.LedgerEntryType `bson:"type" json:"type" validate:"required"`
+	FileID        string                `bson:"file_id,omitempty" json:"file_id,omitempty"`               // Conversion job the entry belongs to, empty for resets and manual adjustments
+	Seconds       float64               `bson:"seconds" json:"seconds"`                                   // Signed change to monthly usage, negative for refunds and resets
+	BalanceAfter  float64               `bson:"balance_after" json:"balance_after"`                       // Monthly usage after the entry was applied
+	BonusSeconds  float64               `bson:"bonus_seconds" json:"bonus_seconds"`                       // Signed change to the minute pack balance
+	BonusAfter    float64               `bson:"bonus_after" json:"bonus_after"`                           // Minute pack balance after the entry was applied
+	Released      float64               `bson:"released,omitempty" json:"released,omitempty"`             // Reserved seconds handed back when a job did not complete
+	TransactionID string                `bson:"transaction_id,omitempty" json:"transaction_id,omitempty"` // Paddle transaction of a minute pack purchase
+	Reason        string                `bson:"reason" json:"reason" validate:"required"`
+	CreatedAt     time.Time             `bson:"created_at" json:"created_at" validate:"required"`
+}
+
+func (e *UsageLedgerEntry) Validate() error {
+	validate := validator.New()
+	return validate.Struct(e)
+}
+
+func (e *UsageLedgerEntry) GetCollectionName() string {
+	return CollectionUsageLedger
+}
+
+func (e *UsageLedgerEntry) SetID(id bson.ObjectID) {
+	e.ID = id
+}
+
+type DailyUsage struct {
+	Date      string  `json:"date"` // YYYY-MM-DD in UTC
+	Charged   float64 `json:"charged"`
+	Refunded  float64 `json:"refunded"`
+	Adjusted  float64 `json:"adjusted"`
+	Purchased float64 `json:"purchased"`
+	Jobs      int     `json:"jobs"`
+}
+
+type UsageHistory struct {
+	From      time.Time           `json:"from"`
+	To        time.Time           `json:"to"`
+	Daily     []DailyUsage        `json:"daily"`   // Always covers the whole range
+	Entries   []*UsageLedgerEntry `json:"entries"` // The latest UsageHistoryMaxItems entries of the range, oldest first
+	Truncated bool                `json:"truncated"`
+}
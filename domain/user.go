@@ -10,6 +10,9 @@ import (
 
 const (
 	CollectionUser = "users"
+
+	// CustomerEmailMaxBackoff caps the wait between retries of a failed Paddle customer update.
+	CustomerEmailMaxBackoff = 6 * time.Hour
 )
 
 type User struct {
@@ -26,6 +29,48 @@ type User struct {
 	CreatedAt   time.Time      `bson:"created_at"  validate:"required"`
 	UpdatedAt   time.Time      `bson:"updated_at"  validate:"required"`
 	DeletedAt   *time.Time     `bson:"deleted_at,omitempty"`
+
+	UsageEmailsOptOut bool           `bson:"usage_emails_opt_out"`
+	ActiveOrgID       *bson.ObjectID `bson:"active_org_id,omitempty"` // Organization whose quota and history the user works in, nil for the personal account
+
+	// CustomerEmailPending is set while the Paddle customer still has the previous email
+	CustomerEmailPending  bool       `bson:"customer_email_pending,omitempty" json:"-"`
+	CustomerEmailAttempts int        `bson:"customer_email_attempts,omitempty" json:"-"`
+	CustomerEmailRetryAt  *time.Time `bson:"customer_email_retry_at,omitempty" json:"-"` // Next retry after a transient Paddle failure
+	// CustomerEmailSyncError is why Paddle rejected the update for good, it is not retried
+	CustomerEmailSyncError string `bson:"customer_email_sync_error,omitempty" json:"-"`
+
+	// AvatarObjectKey is the avatar stored in our bucket, AvatarURL then points at GET /user/avatars/:id
+	AvatarObjectKey string `bson:"avatar_object_key,omitempty" json:"-"`
+
+	// TOTP two-factor authentication, TOTPPendingSecret waits for the first code of an enrollment
+	TOTPEnabled                bool     `bson:"totp_enabled"`
+	TOTPSecret                 string   `bson:"totp_secret,omitempty" json:"-"`
+	TOTPPendingSecret          string   `bson:"totp_pending_secret,omitempty" json:"-"`
+	TOTPLastStep               int64    `bson:"totp_last_step,omitempty" json:"-"` // Time step of the last accepted code, codes are not accepted twice
+	RecoveryCodeHashes         []string `bson:"recovery_code_hashes,omitempty" json:"-"`
+	TwoFactorChallengeHash     string   `bson:"two_factor_challenge_hash,omitempty" json:"-"` // Sign-in challenge waiting for a code
+	TwoFactorChallengeAttempts int      `bson:"two_factor_challenge_attempts,omitempty" json:"-"`
+	// TwoFactorFailures counts wrong sign-in codes across challenges, new challenges do not reset it
+	TwoFactorFailures    int        `bson:"two_factor_failures,omitempty" json:"-"`
+	TwoFactorLockedUntil *time.Time `bson:"two_factor_locked_until,omitempty" json:"-"`
+}
+
+// UpdateProfileBody changes the fields that are set. A new phone number needs the OTP that
+// POST /auth/otp/send delivered to it.
+type UpdateProfileBody struct {
+	Name        *string `json:"name" binding:"omitempty,max=100"`
+	PhoneNumber *string `json:"phone_number" binding:"omitempty,e164"`
+	OTP         string  `json:"otp" binding:"omitempty,numeric"`
+}
+
+type ProfileUpdate struct {
+	Name        *string
+	PhoneNumber *string
+}
+
+type UsageNotificationsBody struct {
+	Enabled *bool `json:"enabled" binding:"required"`
 }
 
 func (u *User) Validate() error {
@@ -36,7 +81,6 @@ func (u *User) Validate() error {
 type UserUseCase interface {
 	Create(user *User) error
 	FindOneByEmail(email string) (*User, error)
-	FindOneByEmailAndAuthType(email string, authType types.AuthType) (*User, error)
 	FindOneByID(id bson.ObjectID) (*User, error)
 	IsEmailExists(email string) (bool, error)
 	IsPhoneExists(phone string) (bool, error)
@@ -44,7 +88,18 @@ type UserUseCase interface {
 	UpdatePlanByID(id bson.ObjectID, plan types.PlanType) error
 	UpdatePlanAndUsageLimitByID(id bson.ObjectID, plan types.PlanType) error
 	UpdateCustomerIDByEmail(email string, customerID string) error
-	DeleteUser(id bson.ObjectID) error
+	UpdateUsageEmailsOptOutByID(id bson.ObjectID, optOut bool) error
+	UpdateProfile(id bson.ObjectID, update ProfileUpdate) (*User, error)
+	// ChangeEmail moves the user from oldEmail to newEmail, ErrEmailChangeInvalid when the
+	// address changed in the meantime and ErrEmailTaken when newEmail belongs to another account.
+	ChangeEmail(id bson.ObjectID, oldEmail, newEmail string) (*User, error)
+	// SyncPendingCustomerEmails retries the Paddle customer updates ChangeEmail could not make.
+	SyncPendingCustomerEmails() (int, error)
+	DeleteUser(id bson.ObjectID, cancelledSubscription *Subscription) (*Erasure, error)
+	FindRestorableByEmail(email string) (*User, error)
+	FindRestorableByID(id bson.ObjectID) (*User, error)
+	// RestoreUser undoes the pending erasure of the user, only the one with erasureID when set.
+	RestoreUser(id bson.ObjectID, erasureID *bson.ObjectID) (*Erasure, error)
 }
 
 func (u *User) GetCollectionName() string {
@@ -19,11 +19,28 @@ func Connect(r *domain.RabbitMQ, rabbitMQURI string) error {
 		return err
 	}
 
-	_, err = ch.QueueDeclare(
-		domain.QueueConversions,
+	for _, queue := range []string{domain.QueueConversions, domain.QueueDataExports} {
+		_, err = ch.QueueDeclare(
+			queue,
+			true,  // durable
+			false, // auto-delete
+			false, // exclusive
+			false, // no-wait
+			nil,   // arguments
+		)
+		if err != nil {
+			ch.Close()
+			conn.Close()
+			return err
+		}
+	}
+
+	err = ch.ExchangeDeclare(
+		domain.ExchangeJobEvents,
+		amqp.ExchangeFanout,
 		true,  // durable
 		false, // auto-delete
-		false, // exclusive
+		false, // internal
 		false, // no-wait
 		nil,   // arguments
 	)
@@ -0,0 +1,111 @@
+package rabbitmq
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/kwa0x2/SmartSRT-Backend/domain"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func PublishJobEvent(r *domain.RabbitMQ, event domain.JobEvent) error {
+	ch, err := r.Connection.Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return publishJobEvent(ctx, ch, event)
+}
+
+func publishJobEvent(ctx context.Context, ch *amqp.Channel, event domain.JobEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	return ch.PublishWithContext(
+		ctx,
+		domain.ExchangeJobEvents, // exchange
+		"",                       // routing key
+		false,                    // mandatory
+		false,                    // immediate
+		amqp.Publishing{
+			ContentType:   "application/json",
+			Body:          body,
+			CorrelationId: event.FileID,
+		},
+	)
+}
+
+// StartJobEventRelay binds an exclusive queue to the job events exchange and
+// feeds every event into the hub until the connection is closed for good.
+func StartJobEventRelay(r *domain.RabbitMQ, hub *domain.JobEventHub) {
+	logger := slog.Default()
+
+	for {
+		select {
+		case <-r.Done:
+			return
+		default:
+			if err := relayJobEvents(r, hub); err != nil {
+				logger.Warn("Job event relay interrupted",
+					slog.String("error", err.Error()),
+				)
+			}
+			time.Sleep(domain.ReInitDelay)
+		}
+	}
+}
+
+func relayJobEvents(r *domain.RabbitMQ, hub *domain.JobEventHub) error {
+	ch, err := r.Connection.Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	queue, err := ch.QueueDeclare(
+		"",    // random name
+		false, // not durable
+		true,  // auto-delete
+		true,  // exclusive
+		false, // no-wait
+		nil,   // arguments
+	)
+	if err != nil {
+		return err
+	}
+
+	if err = ch.QueueBind(queue.Name, "", domain.ExchangeJobEvents, false, nil); err != nil {
+		return err
+	}
+
+	msgs, err := ch.Consume(
+		queue.Name,
+		"",    // consumer
+		true,  // auto-ack
+		true,  // exclusive
+		false, // no-local
+		false, // no-wait
+		nil,   // args
+	)
+	if err != nil {
+		return err
+	}
+
+	for msg := range msgs {
+		var event domain.JobEvent
+		if err = json.Unmarshal(msg.Body, &event); err != nil {
+			continue
+		}
+		hub.Publish(event)
+	}
+
+	return nil
+}
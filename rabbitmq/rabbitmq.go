@@ -6,17 +6,39 @@ import (
 	"time"
 
 	"github.com/kwa0x2/SmartSRT-Backend/domain"
+	"github.com/kwa0x2/SmartSRT-Backend/domain/types"
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
-func StartWorkerPool(r *domain.RabbitMQ, numWorkers int, handler func(domain.ConversionMessage) (*domain.LambdaResponse, error)) error {
+func StartWorkerPool(r *domain.RabbitMQ, numWorkers int, handler func(domain.ConversionMessage) error) error {
+	return startWorkers(r, domain.QueueConversions, numWorkers, func(body []byte) error {
+		var msg domain.ConversionMessage
+		if err := json.Unmarshal(body, &msg); err != nil {
+			return err
+		}
+		return handler(msg)
+	})
+}
+
+func StartDataExportWorkerPool(r *domain.RabbitMQ, numWorkers int, handler func(domain.DataExportMessage) error) error {
+	return startWorkers(r, domain.QueueDataExports, numWorkers, func(body []byte) error {
+		var msg domain.DataExportMessage
+		if err := json.Unmarshal(body, &msg); err != nil {
+			return err
+		}
+		return handler(msg)
+	})
+}
+
+// startWorkers consumes queue with numWorkers workers. Messages the handler fails on are rejected.
+func startWorkers(r *domain.RabbitMQ, queue string, numWorkers int, handler func(body []byte) error) error {
 	r.Mu.Lock()
 	defer r.Mu.Unlock()
 
 	for i := 0; i < numWorkers; i++ {
 		worker := &domain.Worker{
-			ID:       i + 1,
-			Queue:    domain.QueueConversions,
+			ID:       len(r.Workers) + 1,
+			Queue:    queue,
 			Handler:  handler,
 			Done:     make(chan bool),
 			RabbitMQ: r,
@@ -30,108 +52,87 @@ func StartWorkerPool(r *domain.RabbitMQ, numWorkers int, handler func(domain.Con
 	return nil
 }
 
-func PublishConversionMessage(r *domain.RabbitMQ, ctx context.Context, msg domain.ConversionMessage) (*domain.LambdaResponse, error) {
+// PublishConversionMessage enqueues the conversion and returns the job's queue position.
+// Progress is reported asynchronously through the job events exchange.
+func PublishConversionMessage(r *domain.RabbitMQ, ctx context.Context, msg domain.ConversionMessage) (int, error) {
 	ch, err := r.Connection.Channel()
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 	defer ch.Close()
 
-	replyQueue, err := ch.QueueDeclare(
-		"",    // random name
-		false, // not durable
-		true,  // auto-delete
-		true,  // exclusive
-		false, // no-wait
-		nil,   // arguments
-	)
-	if err != nil {
-		return nil, err
-	}
-
-	replies, err := ch.Consume(
-		replyQueue.Name,
-		"",    // consumer
-		true,  // auto-ack
+	queue, err := ch.QueueDeclarePassive(
+		domain.QueueConversions,
+		true,  // durable
+		false, // auto-delete
 		false, // exclusive
-		false, // no-local
 		false, // no-wait
-		nil,   // args
+		nil,   // arguments
 	)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
+	position := queue.Messages + 1
 
 	body, err := json.Marshal(msg)
 	if err != nil {
-		ch.QueueDelete(replyQueue.Name, false, false, false)
-		return nil, err
+		return 0, err
 	}
 
-	err = ch.Publish(
+	err = ch.PublishWithContext(
+		ctx,
 		"",                      // exchange
 		domain.QueueConversions, // routing key
 		false,                   // mandatory
 		false,                   // immediate
 		amqp.Publishing{
 			ContentType:   "application/json",
+			DeliveryMode:  amqp.Persistent,
 			Body:          body,
-			ReplyTo:       replyQueue.Name,
 			CorrelationId: msg.FileID,
 		},
 	)
 	if err != nil {
-		ch.QueueDelete(replyQueue.Name, false, false, false)
-		return nil, err
+		return 0, err
 	}
 
-	responseChan := make(chan *domain.LambdaResponse, 1)
-	errorChan := make(chan error, 1)
-	done := make(chan struct{})
-
-	go func() {
-		defer close(done)
-		for reply := range replies {
-			if reply.CorrelationId == msg.FileID {
-				var response domain.LambdaResponse
-				if err = json.Unmarshal(reply.Body, &response); err != nil {
-					errorChan <- err
-					return
-				}
-				responseChan <- &response
-				return
-			}
-		}
-	}()
-
-	timeoutTimer := time.NewTimer(domain.MessageTimeout)
-	defer timeoutTimer.Stop()
-
-	select {
-	case <-ctx.Done():
-		ch.Cancel("", false)
-		<-done
-		ch.QueueDelete(replyQueue.Name, false, false, false)
-		return nil, ctx.Err()
-	case err := <-errorChan:
-		ch.Cancel("", false)
-		<-done
-		ch.QueueDelete(replyQueue.Name, false, false, false)
-		return nil, err
-	case response := <-responseChan:
-		ch.Cancel("", false)
-		<-done
-		ch.QueueDelete(replyQueue.Name, false, false, false)
-		if response.StatusCode != 200 {
-			response.Body.Message = "An error occurred. Please try again later or contact support."
-		}
-		return response, nil
-	case <-timeoutTimer.C:
-		return &domain.LambdaResponse{
-			StatusCode: 202,
-			Body: domain.LambdaBodyResponse{
-				Message: "Your request is being processed. You will be notified by email when it's completed.",
-			},
-		}, nil
+	err = publishJobEvent(ctx, ch, domain.JobEvent{
+		FileID:        msg.FileID,
+		UserID:        msg.UserID,
+		Status:        types.JobQueued,
+		QueuePosition: position,
+		Timestamp:     time.Now().UTC(),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return position, nil
+}
+
+func PublishDataExportMessage(r *domain.RabbitMQ, ctx context.Context, msg domain.DataExportMessage) error {
+	ch, err := r.Connection.Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
 	}
+
+	return ch.PublishWithContext(
+		ctx,
+		"",                      // exchange
+		domain.QueueDataExports, // routing key
+		false,                   // mandatory
+		false,                   // immediate
+		amqp.Publishing{
+			ContentType:   "application/json",
+			DeliveryMode:  amqp.Persistent,
+			Body:          body,
+			CorrelationId: msg.ExportID.Hex(),
+		},
+	)
 }
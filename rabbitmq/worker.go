@@ -1,11 +1,9 @@
 package rabbitmq
 
 import (
-	"encoding/json"
 	"time"
 
 	"github.com/kwa0x2/SmartSRT-Backend/domain"
-	amqp "github.com/rabbitmq/amqp091-go"
 )
 
 func ReinitializeWorkers(r *domain.RabbitMQ) {
@@ -55,43 +53,12 @@ func consume(w *domain.Worker) error {
 	}
 
 	for msg := range msgs {
-		var convMsg domain.ConversionMessage
-		if err = json.Unmarshal(msg.Body, &convMsg); err != nil {
+		if err = w.Handler(msg.Body); err != nil {
 			msg.Reject(false)
 			continue
 		}
 
-		response, resErr := w.Handler(convMsg)
-		if resErr != nil {
-			msg.Reject(false)
-			response = &domain.LambdaResponse{
-				StatusCode: 500,
-				Body: domain.LambdaBodyResponse{
-					Message: resErr.Error(),
-				},
-			}
-		} else {
-			msg.Ack(false)
-		}
-
-		if msg.ReplyTo != "" {
-			body, jsonErr := json.Marshal(response)
-			if jsonErr != nil {
-				continue
-			}
-
-			ch.Publish(
-				"",          // exchange
-				msg.ReplyTo, // routing key
-				false,       // mandatory
-				false,       // immediate
-				amqp.Publishing{
-					ContentType:   "application/json",
-					Body:          body,
-					CorrelationId: msg.CorrelationId,
-				},
-			)
-		}
+		msg.Ack(false)
 	}
 
 	return nil
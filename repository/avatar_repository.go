@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/kwa0x2/SmartSRT-Backend/domain"
+)
+
+type avatarRepository struct {
+	s3Client   *s3.Client
+	httpClient *http.Client
+	bucketName string
+}
+
+func NewAvatarRepository(s3Client *s3.Client, bucketName string) domain.AvatarRepository {
+	return &avatarRepository{
+		s3Client: s3Client,
+		httpClient: &http.Client{
+			Timeout: 10 * time.Second,
+			// provider hosts are checked before the request, a redirect could lead anywhere
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		bucketName: bucketName,
+	}
+}
+
+func (ar *avatarRepository) Upload(objectKey string, image []byte) error {
+	_, err := ar.s3Client.PutObject(context.Background(), &s3.PutObjectInput{
+		Bucket:       aws.String(ar.bucketName),
+		Key:          aws.String(objectKey),
+		Body:         bytes.NewReader(image),
+		ContentType:  aws.String("image/png"),
+		CacheControl: aws.String("public, max-age=31536000, immutable"), // keys are never reused
+	})
+	return err
+}
+
+func (ar *avatarRepository) PresignView(objectKey string, ttl time.Duration) (string, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(ar.bucketName),
+		Key:    aws.String(objectKey),
+	}
+
+	request, err := s3.NewPresignClient(ar.s3Client).PresignGetObject(context.Background(), input, s3.WithPresignExpires(ttl))
+	if err != nil {
+		return "", err
+	}
+
+	return request.URL, nil
+}
+
+func (ar *avatarRepository) FetchProviderAvatar(url string) ([]byte, error) {
+	resp, err := ar.httpClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("avatar request returned status %d", resp.StatusCode)
+	}
+
+	image, err := io.ReadAll(io.LimitReader(resp.Body, domain.AvatarMaxUploadSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(image) > domain.AvatarMaxUploadSize {
+		return nil, fmt.Errorf("avatar is larger than %d bytes", domain.AvatarMaxUploadSize)
+	}
+
+	return image, nil
+}
@@ -116,6 +116,35 @@ func (r *BaseRepository[T]) UpdateOne(ctx context.Context, filter bson.D, update
 	return nil
 }
 
+func (r *BaseRepository[T]) FindOneAndUpdate(ctx context.Context, filter bson.D, update bson.D, opts *options.FindOneAndUpdateOptionsBuilder) (T, error) {
+	var entity T
+
+	if ctx == nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+	}
+
+	update = append(update, bson.E{
+		Key: "$set",
+		Value: bson.D{
+			{Key: "updated_at", Value: time.Now().UTC()},
+		},
+	})
+
+	filter = append(filter, bson.E{Key: "deleted_at", Value: bson.M{"$exists": false}})
+
+	if opts == nil {
+		opts = options.FindOneAndUpdate()
+	}
+
+	if err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&entity); err != nil {
+		return entity, err
+	}
+
+	return entity, nil
+}
+
 func (r *BaseRepository[T]) SoftDelete(ctx context.Context, filter bson.D) error {
 	if ctx == nil {
 		var cancel context.CancelFunc
@@ -140,6 +169,48 @@ func (r *BaseRepository[T]) SoftDelete(ctx context.Context, filter bson.D) error
 	return nil
 }
 
+// FindOneDeleted is the counterpart of FindOne for soft-deleted documents.
+func (r *BaseRepository[T]) FindOneDeleted(ctx context.Context, filter bson.D) (T, error) {
+	var entity T
+
+	if ctx == nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+	}
+
+	filter = append(filter, bson.E{Key: "deleted_at", Value: bson.M{"$exists": true}})
+
+	if err := r.collection.FindOne(ctx, filter).Decode(&entity); err != nil {
+		return entity, err
+	}
+
+	return entity, nil
+}
+
+// Restore clears deleted_at on the soft-deleted documents matching filter.
+func (r *BaseRepository[T]) Restore(ctx context.Context, filter bson.D) error {
+	if ctx == nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+	}
+
+	update := bson.D{
+		{Key: "$unset", Value: bson.D{{Key: "deleted_at", Value: ""}}},
+		{Key: "$set", Value: bson.D{{Key: "updated_at", Value: time.Now().UTC()}}},
+	}
+
+	filter = append(filter, bson.E{Key: "deleted_at", Value: bson.M{"$exists": true}})
+
+	_, err := r.collection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func (r *BaseRepository[T]) GetDatabase() *mongo.Database {
 	return r.collection.Database()
 }
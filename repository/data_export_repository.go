@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/kwa0x2/SmartSRT-Backend/domain"
+)
+
+type dataExportRepository struct {
+	s3Client   *s3.Client
+	bucketName string
+}
+
+func NewDataExportRepository(s3Client *s3.Client, bucketName string) domain.DataExportRepository {
+	return &dataExportRepository{
+		s3Client:   s3Client,
+		bucketName: bucketName,
+	}
+}
+
+func (dr *dataExportRepository) GetObject(objectKey string) (io.ReadCloser, error) {
+	output, err := dr.s3Client.GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String(dr.bucketName),
+		Key:    aws.String(objectKey),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return output.Body, nil
+}
+
+func (dr *dataExportRepository) PutObject(objectKey string, body io.ReadSeeker) error {
+	_, err := dr.s3Client.PutObject(context.Background(), &s3.PutObjectInput{
+		Bucket:      aws.String(dr.bucketName),
+		Key:         aws.String(objectKey),
+		Body:        body,
+		ContentType: aws.String("application/zip"),
+	})
+	return err
+}
+
+func (dr *dataExportRepository) PresignDownload(objectKey, fileName string, ttl time.Duration) (string, error) {
+	return presignDownload(dr.s3Client, dr.bucketName, objectKey, fileName, ttl)
+}
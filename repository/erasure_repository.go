@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/kwa0x2/SmartSRT-Backend/domain"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+type erasureRepository struct {
+	db *mongo.Database
+}
+
+func NewErasureRepository(db *mongo.Database) domain.ErasureRepository {
+	return &erasureRepository{
+		db: db,
+	}
+}
+
+func (er *erasureRepository) Find(ctx context.Context, collection string, filter bson.D, results any) error {
+	cursor, err := er.db.Collection(collection).Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	return cursor.All(ctx, results)
+}
+
+func (er *erasureRepository) DeleteMany(ctx context.Context, collection string, filter bson.D) (int64, error) {
+	result, err := er.db.Collection(collection).DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
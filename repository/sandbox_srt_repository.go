@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/kwa0x2/SmartSRT-Backend/domain"
+)
+
+const (
+	sandboxKeyPrefix   = "sandbox"
+	sandboxCueDuration = 3 * time.Second
+	sandboxMaxCues     = 200
+)
+
+var sandboxWords = []string{
+	"this", "is", "a", "sandbox", "transcript", "generated", "by", "smartsrt",
+	"for", "integration", "testing", "no", "audio", "was", "processed",
+}
+
+type sandboxSRTRepository struct {
+	s3Client   *s3.Client
+	bucketName string
+}
+
+// NewSandboxSRTRepository returns a fake transcription backend for test-mode API keys. It
+// never invokes Lambda and keeps everything it writes under the sandbox/ prefix of the bucket.
+func NewSandboxSRTRepository(s3Client *s3.Client, bucketName string) domain.SRTRepository {
+	return &sandboxSRTRepository{
+		s3Client:   s3Client,
+		bucketName: bucketName,
+	}
+}
+
+// UploadFileToS3 skips the upload, the fake backend does not need the media file.
+func (sr *sandboxSRTRepository) UploadFileToS3(request domain.FileConversionRequest) (string, error) {
+	return fmt.Sprintf("%s_%s", request.FileID, request.FileHeader.Filename), nil
+}
+
+// TriggerLambdaFunc stores a deterministic SRT for the request and answers like the real function.
+func (sr *sandboxSRTRepository) TriggerLambdaFunc(request domain.FileConversionRequest) (*domain.LambdaResponse, error) {
+	fileName := strings.TrimSuffix(request.FileName, filepath.Ext(request.FileName)) + ".srt"
+	objectKey := fmt.Sprintf("%s/srts/%s/%s", sandboxKeyPrefix, request.UserID.Hex(), fileName)
+
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(sr.bucketName),
+		Key:         aws.String(objectKey),
+		Body:        strings.NewReader(buildSandboxSRT(request)),
+		ContentType: aws.String("application/x-subrip"),
+	}
+
+	if _, err := sr.s3Client.PutObject(context.Background(), input); err != nil {
+		return nil, err
+	}
+
+	srtURL := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", sr.bucketName, sr.s3Client.Options().Region, (&url.URL{Path: objectKey}).EscapedPath())
+
+	return &domain.LambdaResponse{
+		StatusCode: http.StatusOK,
+		Body: domain.LambdaBodyResponse{
+			Message: "sandbox conversion completed",
+			SRTURL:  srtURL,
+		},
+	}, nil
+}
+
+func (sr *sandboxSRTRepository) PresignDownload(objectKey, fileName string, ttl time.Duration) (string, error) {
+	return presignDownload(sr.s3Client, sr.bucketName, objectKey, fileName, ttl)
+}
+
+// buildSandboxSRT covers the file duration with fixed-length cues. The output only depends on
+// the duration and the conversion parameters, so the same request always yields the same SRT.
+func buildSandboxSRT(request domain.FileConversionRequest) string {
+	wordsPerLine := max(request.WordsPerLine, 1)
+	duration := time.Duration(request.FileDuration * float64(time.Second))
+	if duration <= 0 {
+		duration = sandboxCueDuration
+	}
+
+	var b strings.Builder
+	word := 0
+	for i := 0; i < sandboxMaxCues; i++ {
+		start := time.Duration(i) * sandboxCueDuration
+		if start >= duration {
+			break
+		}
+		end := min(start+sandboxCueDuration, duration)
+
+		words := make([]string, wordsPerLine)
+		for j := range words {
+			words[j] = sandboxWords[word%len(sandboxWords)]
+			word++
+		}
+		line := strings.Join(words, " ")
+		if request.Punctuation {
+			line = strings.ToUpper(line[:1]) + line[1:] + "."
+		}
+
+		fmt.Fprintf(&b, "%d\n%s --> %s\n%s\n\n", i+1, formatSRTTimestamp(start), formatSRTTimestamp(end), line)
+	}
+
+	return b.String()
+}
+
+func formatSRTTimestamp(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d,%03d", ms/3_600_000, ms/60_000%60, ms/1000%60, ms%1000)
+}
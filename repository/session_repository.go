@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"strconv"
 
@@ -89,24 +90,31 @@ func (sr *sessionRepository) GetSession(ctx context.Context, sessionID string) (
 	return &session, nil
 }
 
-func (sr *sessionRepository) UpdateSessionTTL(ctx context.Context, sessionID string, newTTL int) error {
+func (sr *sessionRepository) UpdateSessionActivity(ctx context.Context, sessionID string, newTTL int, lastSeenAt int64) error {
 	_, err := sr.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
 		TableName: aws.String(sr.tableName),
 		Key: map[string]types.AttributeValue{
 			"session_id": &types.AttributeValueMemberS{Value: sessionID},
 		},
-		UpdateExpression: aws.String("SET #ttl = :ttl"),
+		UpdateExpression: aws.String("SET #ttl = :ttl, last_seen_at = :last_seen_at"),
 		ExpressionAttributeNames: map[string]string{
 			"#ttl": "ttl",
 		},
 		ExpressionAttributeValues: map[string]types.AttributeValue{
-			":ttl": &types.AttributeValueMemberN{Value: strconv.Itoa(newTTL)},
+			":ttl":          &types.AttributeValueMemberN{Value: strconv.Itoa(newTTL)},
+			":last_seen_at": &types.AttributeValueMemberN{Value: strconv.FormatInt(lastSeenAt, 10)},
 		},
-		ReturnValues: types.ReturnValueAllNew,
+		// a session revoked meanwhile must not come back as an item with only these attributes
+		ConditionExpression: aws.String("attribute_exists(session_id)"),
+		ReturnValues:        types.ReturnValueAllNew,
 	})
 
 	if err != nil {
-		sr.logger.Error("Session TTL could not be updated",
+		var conditionErr *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionErr) {
+			return utils.ErrSessionNotFound
+		}
+		sr.logger.Error("Session activity could not be updated",
 			slog.String("session_id", sessionID),
 			slog.Int("new_ttl", newTTL),
 			slog.String("error", err.Error()),
@@ -135,3 +143,59 @@ func (sr *sessionRepository) DeleteSession(ctx context.Context, sessionID string
 
 	return nil
 }
+
+func (sr *sessionRepository) FindSessionsByUserID(ctx context.Context, userID string) ([]*domain.Session, error) {
+	var sessions []*domain.Session
+	var startKey map[string]types.AttributeValue
+
+	for {
+		resp, err := sr.client.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(sr.tableName),
+			IndexName:              aws.String(domain.SessionUserIndex),
+			KeyConditionExpression: aws.String("user_id = :user_id"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":user_id": &types.AttributeValueMemberS{Value: userID},
+			},
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			sr.logger.Error("Sessions could not be queried",
+				slog.String("user_id", userID),
+				slog.String("error", err.Error()),
+			)
+			return nil, err
+		}
+
+		var page []*domain.Session
+		if err = attributevalue.UnmarshalListOfMaps(resp.Items, &page); err != nil {
+			sr.logger.Error("Sessions unmarshal operation failed",
+				slog.String("user_id", userID),
+				slog.String("error", err.Error()),
+			)
+			return nil, err
+		}
+		sessions = append(sessions, page...)
+
+		if len(resp.LastEvaluatedKey) == 0 {
+			return sessions, nil
+		}
+		startKey = resp.LastEvaluatedKey
+	}
+}
+
+func (sr *sessionRepository) DeleteSessionsByUserID(ctx context.Context, userID string) (int, error) {
+	sessions, err := sr.FindSessionsByUserID(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, session := range sessions {
+		if err = sr.DeleteSession(ctx, session.SessionID); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+
+	return deleted, nil
+}
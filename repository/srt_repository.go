@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"mime"
 	"net/http"
 	"time"
 
@@ -35,7 +36,7 @@ func NewSRTRepository(s3Client *s3.Client, lambdaClient *lambda.Client, db *mong
 
 func (sr *srtRepository) UploadFileToS3(request domain.FileConversionRequest) (string, error) {
 	newFileName := fmt.Sprintf("%s_%d_%s", "smartsrt.com", time.Now().UTC().Unix(), request.FileHeader.Filename)
-	objectKey := fmt.Sprintf("files/%s/%s", request.UserID.Hex(), newFileName)
+	objectKey := domain.MediaObjectKey(request.UserID, newFileName)
 
 	input := &s3.PutObjectInput{
 		Bucket: aws.String(sr.bucketName),
@@ -83,3 +84,23 @@ func (sr *srtRepository) TriggerLambdaFunc(request domain.FileConversionRequest)
 
 	return &rawResponse, nil
 }
+
+func (sr *srtRepository) PresignDownload(objectKey, fileName string, ttl time.Duration) (string, error) {
+	return presignDownload(sr.s3Client, sr.bucketName, objectKey, fileName, ttl)
+}
+
+// presignDownload signs a GET for the object that makes browsers save it as fileName.
+func presignDownload(s3Client *s3.Client, bucketName, objectKey, fileName string, ttl time.Duration) (string, error) {
+	input := &s3.GetObjectInput{
+		Bucket:                     aws.String(bucketName),
+		Key:                        aws.String(objectKey),
+		ResponseContentDisposition: aws.String(mime.FormatMediaType("attachment", map[string]string{"filename": fileName})),
+	}
+
+	request, err := s3.NewPresignClient(s3Client).PresignGetObject(context.Background(), input, s3.WithPresignExpires(ttl))
+	if err != nil {
+		return "", err
+	}
+
+	return request.URL, nil
+}
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/kwa0x2/SmartSRT-Backend/domain"
+)
+
+// s3DeleteObjectsLimit is the most keys a single DeleteObjects call accepts.
+const s3DeleteObjectsLimit = 1000
+
+type storageRepository struct {
+	s3Client   *s3.Client
+	bucketName string
+}
+
+func NewStorageRepository(s3Client *s3.Client, bucketName string) domain.StorageRepository {
+	return &storageRepository{
+		s3Client:   s3Client,
+		bucketName: bucketName,
+	}
+}
+
+func (sr *storageRepository) DeleteObjects(keys []string) (map[string]error, error) {
+	failed := make(map[string]error)
+
+	for start := 0; start < len(keys); start += s3DeleteObjectsLimit {
+		chunk := keys[start:min(start+s3DeleteObjectsLimit, len(keys))]
+
+		objects := make([]types.ObjectIdentifier, 0, len(chunk))
+		for _, key := range chunk {
+			objects = append(objects, types.ObjectIdentifier{Key: aws.String(key)})
+		}
+
+		output, err := sr.s3Client.DeleteObjects(context.Background(), &s3.DeleteObjectsInput{
+			Bucket: aws.String(sr.bucketName),
+			Delete: &types.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, e := range output.Errors {
+			failed[aws.ToString(e.Key)] = errors.New(aws.ToString(e.Code) + ": " + aws.ToString(e.Message))
+		}
+	}
+
+	return failed, nil
+}
+
+func (sr *storageRepository) ListObjects(prefix string, fn func(page []domain.StorageObject) error) error {
+	paginator := s3.NewListObjectsV2Paginator(sr.s3Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(sr.bucketName),
+		Prefix: aws.String(prefix),
+	})
+
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(context.Background())
+		if err != nil {
+			return err
+		}
+
+		page := make([]domain.StorageObject, 0, len(output.Contents))
+		for _, object := range output.Contents {
+			page = append(page, domain.StorageObject{
+				Key:          aws.ToString(object.Key),
+				LastModified: aws.ToTime(object.LastModified),
+			})
+		}
+
+		if err = fn(page); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -5,6 +5,11 @@ import (
 	"log/slog"
 	"time"
 
+	"github.com/kwa0x2/SmartSRT-Backend/config"
+	"github.com/kwa0x2/SmartSRT-Backend/domain"
+	"github.com/kwa0x2/SmartSRT-Backend/domain/types"
+	"github.com/kwa0x2/SmartSRT-Backend/utils"
+
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
@@ -12,12 +17,14 @@ import (
 
 type Seeder struct {
 	db     *mongo.Database
+	env    *config.Env
 	logger *slog.Logger
 }
 
-func NewSeeder(db *mongo.Database) *Seeder {
+func NewSeeder(db *mongo.Database, env *config.Env) *Seeder {
 	return &Seeder{
 		db:     db,
+		env:    env,
 		logger: slog.Default(),
 	}
 }
@@ -36,12 +43,24 @@ func (s *Seeder) SeedDatabase() error {
 		return err
 	}
 
+	if err := s.seedPlans(ctx); err != nil {
+		return err
+	}
+
+	if err := s.migratePlanRetention(ctx); err != nil {
+		return err
+	}
+
+	if err := s.migrateSRTHistoryObjectKeys(ctx); err != nil {
+		return err
+	}
+
 	s.logger.Info("✅ Collections and indexes created successfully")
 	return nil
 }
 
 func (s *Seeder) createCollections(ctx context.Context) error {
-	collections := []string{"users", "usage", "subscription"}
+	collections := []string{"users", "usage", "subscription", "usage_reservation", "usage_period", "usage_ledger", "plans", "organizations", "organization_members", "organization_invitations", "api_keys", "srt_history", "storage_deletions", "erasures", "data_exports", "identities", "passkeys", "passkey_ceremonies", "oauth_states"}
 
 	for _, collName := range collections {
 		err := s.db.CreateCollection(ctx, collName)
@@ -67,9 +86,11 @@ func (s *Seeder) createCollections(ctx context.Context) error {
 
 func (s *Seeder) createIndexes(ctx context.Context) error {
 	standardIndexes := map[string][]string{
-		"users":        {"email", "phone_number"},
-		"usage":        {"user_id"},
-		"subscription": {"subscription_id", "user_id"},
+		"users":             {"email", "phone_number"},
+		"usage":             {"user_id"},
+		"subscription":      {"subscription_id", "user_id"},
+		"usage_reservation": {"file_id"},
+		"plans":             {"name"},
 	}
 
 	for collectionName, indexFields := range standardIndexes {
@@ -100,9 +121,398 @@ func (s *Seeder) createIndexes(ctx context.Context) error {
 			}),
 	}
 
-	if err := s.createIndexesForCollection(ctx, "users", []mongo.IndexModel{customerIDIndex}); err != nil {
+	customerEmailPendingIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "customer_email_pending", Value: 1}},
+		Options: options.Index().
+			SetPartialFilterExpression(bson.D{{Key: "customer_email_pending", Value: true}}),
+	}
+
+	if err := s.createIndexesForCollection(ctx, "users", []mongo.IndexModel{customerIDIndex, customerEmailPendingIndex}); err != nil {
+		return err
+	}
+
+	reservationExpiryIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "status", Value: 1}, {Key: "expires_at", Value: 1}},
+	}
+
+	if err := s.createIndexesForCollection(ctx, "usage_reservation", []mongo.IndexModel{reservationExpiryIndex}); err != nil {
+		return err
+	}
+
+	usageEndDateIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "end_date", Value: 1}},
+	}
+
+	if err := s.createIndexesForCollection(ctx, "usage", []mongo.IndexModel{usageEndDateIndex}); err != nil {
+		return err
+	}
+
+	usagePeriodIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "start_date", Value: -1}},
+	}
+
+	if err := s.createIndexesForCollection(ctx, "usage_period", []mongo.IndexModel{usagePeriodIndex}); err != nil {
+		return err
+	}
+
+	usageLedgerIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: 1}},
+	}
+
+	transactionIDIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "transaction_id", Value: 1}},
+		Options: options.Index().
+			SetUnique(true).
+			SetPartialFilterExpression(bson.D{{Key: "transaction_id", Value: bson.D{{Key: "$type", Value: "string"}}}}),
+	}
+
+	if err := s.createIndexesForCollection(ctx, "usage_ledger", []mongo.IndexModel{usageLedgerIndex, transactionIDIndex}); err != nil {
+		return err
+	}
+
+	memberIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "org_id", Value: 1}, {Key: "user_id", Value: 1}},
+		Options: options.Index().
+			SetUnique(true).
+			SetPartialFilterExpression(bson.D{{Key: "deleted_at", Value: nil}}),
+	}
+
+	memberUserIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}},
+	}
+
+	if err := s.createIndexesForCollection(ctx, "organization_members", []mongo.IndexModel{memberIndex, memberUserIndex}); err != nil {
+		return err
+	}
+
+	pendingInvitationIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "org_id", Value: 1}, {Key: "email", Value: 1}},
+		Options: options.Index().
+			SetUnique(true).
+			SetPartialFilterExpression(bson.D{
+				{Key: "accepted_at", Value: nil},
+				{Key: "deleted_at", Value: nil},
+			}),
+	}
+
+	if err := s.createIndexesForCollection(ctx, "organization_invitations", []mongo.IndexModel{pendingInvitationIndex}); err != nil {
+		return err
+	}
+
+	apiKeyHashIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "key_hash", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+
+	apiKeyUserIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}},
+	}
+
+	apiKeyOrgIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "org_id", Value: 1}},
+		Options: options.Index().
+			SetPartialFilterExpression(bson.D{{Key: "org_id", Value: bson.D{{Key: "$exists", Value: true}}}}),
+	}
+
+	if err := s.createIndexesForCollection(ctx, "api_keys", []mongo.IndexModel{apiKeyHashIndex, apiKeyUserIndex, apiKeyOrgIndex}); err != nil {
+		return err
+	}
+
+	pendingDeletionIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "next_attempt_at", Value: 1}},
+		Options: options.Index().
+			SetPartialFilterExpression(bson.D{{Key: "completed_at", Value: nil}}),
+	}
+
+	deletionKeyIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "object_key", Value: 1}},
+	}
+
+	if err := s.createIndexesForCollection(ctx, "storage_deletions", []mongo.IndexModel{pendingDeletionIndex, deletionKeyIndex}); err != nil {
+		return err
+	}
+
+	dueErasureIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "next_attempt_at", Value: 1}},
+		Options: options.Index().
+			SetPartialFilterExpression(bson.D{{Key: "status", Value: "scheduled"}}),
+	}
+
+	erasureUserIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}},
+	}
+
+	if err := s.createIndexesForCollection(ctx, "erasures", []mongo.IndexModel{dueErasureIndex, erasureUserIndex}); err != nil {
+		return err
+	}
+
+	dataExportUserIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "status", Value: 1}},
+	}
+
+	expiringDataExportIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().
+			SetPartialFilterExpression(bson.D{{Key: "status", Value: "ready"}}),
+	}
+
+	if err := s.createIndexesForCollection(ctx, "data_exports", []mongo.IndexModel{dataExportUserIndex, expiringDataExportIndex}); err != nil {
+		return err
+	}
+
+	identitySubjectIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "provider", Value: 1}, {Key: "subject", Value: 1}},
+		Options: options.Index().
+			SetUnique(true).
+			SetPartialFilterExpression(bson.D{{Key: "deleted_at", Value: nil}}),
+	}
+
+	identityUserIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "provider", Value: 1}},
+		Options: options.Index().
+			SetUnique(true).
+			SetPartialFilterExpression(bson.D{{Key: "deleted_at", Value: nil}}),
+	}
+
+	if err := s.createIndexesForCollection(ctx, "identities", []mongo.IndexModel{identitySubjectIndex, identityUserIndex}); err != nil {
+		return err
+	}
+
+	passkeyCredentialIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "credential_id", Value: 1}},
+		Options: options.Index().
+			SetUnique(true).
+			SetPartialFilterExpression(bson.D{{Key: "deleted_at", Value: nil}}),
+	}
+
+	passkeyUserIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}},
+	}
+
+	if err := s.createIndexesForCollection(ctx, "passkeys", []mongo.IndexModel{passkeyCredentialIndex, passkeyUserIndex}); err != nil {
+		return err
+	}
+
+	passkeyCeremonyIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "token_hash", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+
+	expiringPasskeyCeremonyIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	}
+
+	if err := s.createIndexesForCollection(ctx, "passkey_ceremonies", []mongo.IndexModel{passkeyCeremonyIndex, expiringPasskeyCeremonyIndex}); err != nil {
+		return err
+	}
+
+	oauthStateIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "state_hash", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+
+	expiringOAuthStateIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	}
+
+	if err := s.createIndexesForCollection(ctx, "oauth_states", []mongo.IndexModel{oauthStateIndex, expiringOAuthStateIndex}); err != nil {
+		return err
+	}
+
+	srtHistoryObjectKeyIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "object_key", Value: 1}},
+	}
+
+	srtHistoryMediaKeyIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "media_object_key", Value: 1}},
+		Options: options.Index().
+			SetPartialFilterExpression(bson.D{{Key: "media_object_key", Value: bson.D{{Key: "$exists", Value: true}}}}),
+	}
+
+	srtHistoryUserIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}},
+	}
+
+	srtHistoryOrgIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "org_id", Value: 1}, {Key: "created_at", Value: -1}},
+		Options: options.Index().
+			SetPartialFilterExpression(bson.D{{Key: "org_id", Value: bson.D{{Key: "$exists", Value: true}}}}),
+	}
+
+	if err := s.createIndexesForCollection(ctx, "srt_history", []mongo.IndexModel{srtHistoryUserIndex, srtHistoryOrgIndex, srtHistoryObjectKeyIndex, srtHistoryMediaKeyIndex}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// seedPlans inserts the default catalogue only when the plans collection is empty,
+// so plans edited in the database are never overwritten on startup. The configured Pro
+// prices are added on every startup, otherwise subscriptions to a new price would not map.
+func (s *Seeder) seedPlans(ctx context.Context) error {
+	collection := s.db.Collection(domain.CollectionPlan)
+
+	count, err := collection.CountDocuments(ctx, bson.D{})
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		s.logger.Info("Plans already exist, skipping",
+			slog.Int64("count", count))
+		return s.syncProPriceIDs(ctx)
+	}
+
+	plans := domain.DefaultPlans(s.env)
+	documents := make([]interface{}, 0, len(plans))
+	for _, plan := range plans {
+		documents = append(documents, plan)
+	}
+
+	if _, err = collection.InsertMany(ctx, documents); err != nil {
+		return err
+	}
+
+	s.logger.Info("Plans seeded",
+		slog.Int("count", len(plans)))
+
+	return nil
+}
+
+// syncProPriceIDs adds the configured Pro prices that no plan maps yet to the Pro plan.
+// Prices already moved to another plan in the database are left where they are.
+func (s *Seeder) syncProPriceIDs(ctx context.Context) error {
+	collection := s.db.Collection(domain.CollectionPlan)
+
+	added := 0
+	for _, priceID := range s.env.PaddleProPriceIDs {
+		mapped, err := collection.CountDocuments(ctx, bson.D{{Key: "paddle_price_ids", Value: priceID}})
+		if err != nil {
+			return err
+		}
+		if mapped > 0 {
+			continue
+		}
+
+		filter := bson.D{
+			{Key: "name", Value: types.Pro},
+			{Key: "deleted_at", Value: bson.D{{Key: "$exists", Value: false}}},
+		}
+		update := bson.D{
+			{Key: "$addToSet", Value: bson.D{{Key: "paddle_price_ids", Value: priceID}}},
+			{Key: "$set", Value: bson.D{{Key: "updated_at", Value: time.Now().UTC()}}},
+		}
+
+		result, err := collection.UpdateOne(ctx, filter, update)
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			s.logger.Warn("Pro plan not found, price ID not mapped",
+				slog.String("price_id", priceID))
+			continue
+		}
+		added++
+	}
+
+	if added > 0 {
+		s.logger.Info("Pro plan price IDs synced",
+			slog.Int("added", added))
+	}
+
+	return nil
+}
+
+// migratePlanRetention gives plans stored before retention existed the retention of the default
+// plan with the same name. Plans without a default counterpart keep files until one is set.
+func (s *Seeder) migratePlanRetention(ctx context.Context) error {
+	collection := s.db.Collection(domain.CollectionPlan)
+	missing := bson.D{{Key: "retention", Value: bson.D{{Key: "$exists", Value: false}}}}
+
+	migrated := int64(0)
+	for _, plan := range domain.DefaultPlans(s.env) {
+		filter := append(bson.D{{Key: "name", Value: plan.Name}}, missing...)
+		update := bson.D{{Key: "$set", Value: bson.D{
+			{Key: "retention", Value: plan.Retention},
+			{Key: "updated_at", Value: time.Now().UTC()},
+		}}}
+
+		result, err := collection.UpdateMany(ctx, filter, update)
+		if err != nil {
+			return err
+		}
+		migrated += result.ModifiedCount
+	}
+
+	if migrated > 0 {
+		s.logger.Info("Plan retention migrated",
+			slog.Int64("count", migrated))
+	}
+
+	remaining, err := collection.CountDocuments(ctx, missing)
+	if err != nil {
 		return err
 	}
+	if remaining > 0 {
+		s.logger.Warn("Plans without retention keep files forever until it is set",
+			slog.Int64("count", remaining))
+	}
+
+	return nil
+}
+
+// migrateSRTHistoryObjectKeys replaces the object URLs stored by earlier versions with the
+// object keys that download links are now presigned from.
+func (s *Seeder) migrateSRTHistoryObjectKeys(ctx context.Context) error {
+	collection := s.db.Collection(domain.CollectionSRTHistory)
+
+	filter := bson.D{
+		{Key: "s3_url", Value: bson.D{{Key: "$exists", Value: true}}},
+		{Key: "object_key", Value: bson.D{{Key: "$exists", Value: false}}},
+	}
+	cursor, err := collection.Find(ctx, filter, options.Find().SetProjection(bson.D{{Key: "s3_url", Value: 1}}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	migrated := 0
+	for cursor.Next(ctx) {
+		var legacy struct {
+			ID    bson.ObjectID `bson:"_id"`
+			S3URL string        `bson:"s3_url"`
+		}
+		if err = cursor.Decode(&legacy); err != nil {
+			return err
+		}
+
+		objectKey, err := utils.ObjectKeyFromURL(legacy.S3URL)
+		if err != nil {
+			s.logger.Warn("Skipping SRT history with unparsable s3_url",
+				slog.String("history_id", legacy.ID.Hex()),
+				slog.String("error", err.Error()))
+			continue
+		}
+
+		update := bson.D{
+			{Key: "$set", Value: bson.D{{Key: "object_key", Value: objectKey}}},
+			{Key: "$unset", Value: bson.D{{Key: "s3_url", Value: ""}}},
+		}
+		if _, err = collection.UpdateOne(ctx, bson.D{{Key: "_id", Value: legacy.ID}}, update); err != nil {
+			return err
+		}
+		migrated++
+	}
+	if err = cursor.Err(); err != nil {
+		return err
+	}
+
+	if migrated > 0 {
+		s.logger.Info("SRT history object keys migrated",
+			slog.Int("count", migrated))
+	}
 
 	return nil
 }
@@ -0,0 +1,143 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kwa0x2/SmartSRT-Backend/domain"
+	"github.com/kwa0x2/SmartSRT-Backend/domain/types"
+	"github.com/kwa0x2/SmartSRT-Backend/utils"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+type apiKeyUseCase struct {
+	apiKeyBaseRepository domain.BaseRepository[*domain.APIKey]
+}
+
+func NewAPIKeyUseCase(apiKeyBaseRepository domain.BaseRepository[*domain.APIKey]) domain.APIKeyUseCase {
+	return &apiKeyUseCase{
+		apiKeyBaseRepository: apiKeyBaseRepository,
+	}
+}
+
+// Create stores a new key for the user, bound to org when one is given, and returns the
+// plaintext key. It cannot be retrieved again afterwards.
+func (au *apiKeyUseCase) Create(user *domain.User, org *domain.Organization, name string, scopes []types.APIKeyScope, sandbox bool) (*domain.APIKey, string, error) {
+	unique := make([]types.APIKeyScope, 0, len(scopes))
+	for _, scope := range scopes {
+		if !scope.IsValid() {
+			return nil, "", fmt.Errorf("validation failed: unknown scope %q", scope)
+		}
+		if !slices.Contains(unique, scope) {
+			unique = append(unique, scope)
+		}
+	}
+
+	secret, err := utils.GenerateSecret(32)
+	if err != nil {
+		return nil, "", err
+	}
+	prefix := domain.APIKeyPrefix
+	if sandbox {
+		prefix = domain.APIKeySandboxPrefix
+	}
+	rawKey := prefix + secret
+
+	now := time.Now().UTC()
+	apiKey := &domain.APIKey{
+		UserID:    user.ID,
+		Name:      strings.TrimSpace(name),
+		Prefix:    rawKey[:len(prefix)+6],
+		KeyHash:   utils.HashToken(rawKey),
+		Scopes:    unique,
+		Sandbox:   sandbox,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if org != nil {
+		apiKey.OrgID = &org.ID
+	}
+
+	if err = apiKey.Validate(); err != nil {
+		return nil, "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err = au.apiKeyBaseRepository.Create(ctx, apiKey); err != nil {
+		return nil, "", err
+	}
+
+	return apiKey, rawKey, nil
+}
+
+// FindAll lists the organization's keys when org is set, otherwise the user's personal keys.
+func (au *apiKeyUseCase) FindAll(user *domain.User, org *domain.Organization) ([]*domain.APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	return au.apiKeyBaseRepository.Find(ctx, apiKeyOwnerFilter(user, org), opts)
+}
+
+func (au *apiKeyUseCase) Revoke(user *domain.User, org *domain.Organization, id bson.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := append(bson.D{{Key: "_id", Value: id}}, apiKeyOwnerFilter(user, org)...)
+	if _, err := au.apiKeyBaseRepository.FindOne(ctx, filter); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return utils.ErrAPIKeyInvalid
+		}
+		return err
+	}
+
+	return au.apiKeyBaseRepository.SoftDelete(ctx, bson.D{{Key: "_id", Value: id}})
+}
+
+// Authenticate resolves a plaintext key to its record and records when it was last used.
+func (au *apiKeyUseCase) Authenticate(rawKey string) (*domain.APIKey, error) {
+	if !strings.HasPrefix(rawKey, domain.APIKeyPrefix) {
+		return nil, utils.ErrAPIKeyInvalid
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	apiKey, err := au.apiKeyBaseRepository.FindOne(ctx, bson.D{{Key: "key_hash", Value: utils.HashToken(rawKey)}})
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, utils.ErrAPIKeyInvalid
+		}
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) >= domain.APIKeyLastUsedResolution {
+		filter := bson.D{{Key: "_id", Value: apiKey.ID}}
+		update := bson.D{{Key: "$set", Value: bson.D{{Key: "last_used_at", Value: now}}}}
+		if err = au.apiKeyBaseRepository.UpdateOne(ctx, filter, update, nil); err != nil {
+			return nil, err
+		}
+		apiKey.LastUsedAt = &now
+	}
+
+	return apiKey, nil
+}
+
+func apiKeyOwnerFilter(user *domain.User, org *domain.Organization) bson.D {
+	if org != nil {
+		return bson.D{{Key: "org_id", Value: org.ID}}
+	}
+	return bson.D{
+		{Key: "user_id", Value: user.ID},
+		{Key: "org_id", Value: bson.D{{Key: "$exists", Value: false}}},
+	}
+}
@@ -0,0 +1,158 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/kwa0x2/SmartSRT-Backend/config"
+	"github.com/kwa0x2/SmartSRT-Backend/domain"
+	"github.com/kwa0x2/SmartSRT-Backend/domain/types"
+	"github.com/kwa0x2/SmartSRT-Backend/utils"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.mongodb.org/mongo-driver/v2/mongo/writeconcern"
+)
+
+type avatarUseCase struct {
+	env                *config.Env
+	userBaseRepository domain.BaseRepository[*domain.User]
+	avatarRepository   domain.AvatarRepository
+	storageUseCase     domain.StorageUseCase
+}
+
+func NewAvatarUseCase(env *config.Env, userBaseRepository domain.BaseRepository[*domain.User], avatarRepository domain.AvatarRepository, storageUseCase domain.StorageUseCase) domain.AvatarUseCase {
+	return &avatarUseCase{
+		env:                env,
+		userBaseRepository: userBaseRepository,
+		avatarRepository:   avatarRepository,
+		storageUseCase:     storageUseCase,
+	}
+}
+
+func (au *avatarUseCase) Upload(user *domain.User, image []byte) (*domain.User, error) {
+	return au.store(user.ID, image, nil)
+}
+
+// CacheProviderAvatar keeps avatars of OAuth providers in our bucket, so that they survive
+// the provider rotating the link and no third party sees who views them. Users with a stored
+// avatar and links outside AvatarProviderHosts are left alone.
+func (au *avatarUseCase) CacheProviderAvatar(user *domain.User) error {
+	if user.AvatarObjectKey != "" || !isProviderAvatar(user.AvatarURL) {
+		return nil
+	}
+
+	image, err := au.avatarRepository.FetchProviderAvatar(user.AvatarURL)
+	if err != nil {
+		return err
+	}
+
+	// a user who uploaded an avatar in the meantime keeps it
+	cached, err := au.store(user.ID, image, bson.D{{Key: "avatar_object_key", Value: bson.D{{Key: "$exists", Value: false}}}})
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil
+		}
+		return err
+	}
+
+	user.AvatarURL = cached.AvatarURL
+	user.AvatarObjectKey = cached.AvatarObjectKey
+	return nil
+}
+
+func (au *avatarUseCase) CreateViewURL(userID bson.ObjectID) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.D{
+		{Key: "_id", Value: userID},
+		{Key: "avatar_object_key", Value: bson.D{{Key: "$exists", Value: true}}},
+	}
+	user, err := au.userBaseRepository.FindOne(ctx, filter)
+	if err != nil {
+		return "", err
+	}
+
+	return au.avatarRepository.PresignView(user.AvatarObjectKey, domain.AvatarURLTTL)
+}
+
+// store resizes and uploads the image, then points the user at it and queues the previous
+// avatar for deletion in one transaction. condition narrows down the user update.
+func (au *avatarUseCase) store(userID bson.ObjectID, image []byte, condition bson.D) (*domain.User, error) {
+	resized, err := utils.ResizeAvatar(image, domain.AvatarSize)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	objectKey := domain.AvatarObjectKey(userID, now)
+	if err = au.avatarRepository.Upload(objectKey, resized); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	session, err := au.userBaseRepository.GetDatabase().Client().StartSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.EndSession(ctx)
+
+	txnOptions := options.Transaction().SetWriteConcern(writeconcern.Majority())
+
+	result, err := session.WithTransaction(ctx, func(txCtx context.Context) (interface{}, error) {
+		filter := append(bson.D{{Key: "_id", Value: userID}}, condition...)
+		update := bson.D{{Key: "$set", Value: bson.D{
+			{Key: "avatar_url", Value: domain.AvatarURL(au.env, userID, now)},
+			{Key: "avatar_object_key", Value: objectKey},
+		}}}
+
+		previous, err := au.userBaseRepository.FindOneAndUpdate(txCtx, filter, update, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		if previous.AvatarObjectKey != "" {
+			if err = au.storageUseCase.QueueDeletion(txCtx, []string{previous.AvatarObjectKey}, types.DeletionAvatarReplaced, nil); err != nil {
+				return nil, err
+			}
+		}
+
+		previous.AvatarURL = domain.AvatarURL(au.env, userID, now)
+		previous.AvatarObjectKey = objectKey
+		return previous, nil
+	}, txnOptions)
+	if err != nil {
+		// the new object is referenced by nothing, the reconciliation does not look at avatars
+		if queueErr := au.storageUseCase.QueueDeletion(context.Background(), []string{objectKey}, types.DeletionAvatarReplaced, nil); queueErr != nil {
+			slog.Warn("Unused avatar could not be queued for deletion",
+				slog.String("user_id", userID.Hex()),
+				slog.String("object_key", objectKey),
+				slog.String("error", queueErr.Error()))
+		}
+		return nil, err
+	}
+
+	return result.(*domain.User), nil
+}
+
+func isProviderAvatar(avatarURL string) bool {
+	parsed, err := url.Parse(avatarURL)
+	if err != nil || parsed.Scheme != "https" {
+		return false
+	}
+
+	host := parsed.Hostname()
+	for _, provider := range domain.AvatarProviderHosts {
+		if host == provider || strings.HasSuffix(host, "."+provider) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,341 @@
+package usecase
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"time"
+
+	"github.com/kwa0x2/SmartSRT-Backend/domain"
+	"github.com/kwa0x2/SmartSRT-Backend/domain/types"
+	"github.com/kwa0x2/SmartSRT-Backend/utils"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.mongodb.org/mongo-driver/v2/mongo/writeconcern"
+)
+
+type dataExportUseCase struct {
+	dataExportBaseRepository domain.BaseRepository[*domain.DataExport]
+	dataExportRepository     domain.DataExportRepository
+	userBaseRepository       domain.BaseRepository[*domain.User]
+	srtHistoryBaseRepository domain.BaseRepository[*domain.SRTHistory]
+	erasureRepository        domain.ErasureRepository
+	storageUseCase           domain.StorageUseCase
+	resendUseCase            domain.ResendUseCase
+}
+
+func NewDataExportUseCase(
+	dataExportBaseRepository domain.BaseRepository[*domain.DataExport],
+	dataExportRepository domain.DataExportRepository,
+	userBaseRepository domain.BaseRepository[*domain.User],
+	srtHistoryBaseRepository domain.BaseRepository[*domain.SRTHistory],
+	erasureRepository domain.ErasureRepository,
+	storageUseCase domain.StorageUseCase,
+	resendUseCase domain.ResendUseCase,
+) domain.DataExportUseCase {
+	return &dataExportUseCase{
+		dataExportBaseRepository: dataExportBaseRepository,
+		dataExportRepository:     dataExportRepository,
+		userBaseRepository:       userBaseRepository,
+		srtHistoryBaseRepository: srtHistoryBaseRepository,
+		erasureRepository:        erasureRepository,
+		storageUseCase:           storageUseCase,
+		resendUseCase:            resendUseCase,
+	}
+}
+
+func (du *dataExportUseCase) Request(userID bson.ObjectID) (*domain.DataExport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now().UTC()
+
+	// an export stuck for longer than DataExportBuildLimit does not block a new one
+	filter := bson.D{
+		{Key: "user_id", Value: userID},
+		{Key: "status", Value: bson.D{{Key: "$in", Value: bson.A{types.DataExportQueued, types.DataExportProcessing}}}},
+		{Key: "created_at", Value: bson.D{{Key: "$gt", Value: now.Add(-domain.DataExportBuildLimit)}}},
+	}
+	if _, err := du.dataExportBaseRepository.FindOne(ctx, filter); err == nil {
+		return nil, utils.ErrDataExportInProgress
+	} else if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+
+	export := &domain.DataExport{
+		UserID:    userID,
+		Status:    types.DataExportQueued,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := export.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := du.dataExportBaseRepository.Create(ctx, export); err != nil {
+		return nil, err
+	}
+
+	return export, nil
+}
+
+func (du *dataExportUseCase) Fail(id bson.ObjectID, reason string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "status", Value: types.DataExportFailed},
+		{Key: "last_error", Value: reason},
+	}}}
+	return du.dataExportBaseRepository.UpdateOne(ctx, bson.D{{Key: "_id", Value: id}}, update, nil)
+}
+
+// Process builds the archive of a queued export, uploads it and emails the user a link that
+// stays valid for DataExportURLTTL. A redelivered message for a finished export is ignored.
+func (du *dataExportUseCase) Process(id bson.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), domain.DataExportBuildLimit)
+	defer cancel()
+
+	filter := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "status", Value: bson.D{{Key: "$in", Value: bson.A{types.DataExportQueued, types.DataExportProcessing}}}},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "status", Value: types.DataExportProcessing}}}}
+	export, err := du.dataExportBaseRepository.FindOneAndUpdate(ctx, filter, update, nil)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil
+		}
+		return err
+	}
+
+	user, err := du.userBaseRepository.FindOne(ctx, bson.D{{Key: "_id", Value: export.UserID}})
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return du.Fail(export.ID, "account no longer exists")
+		}
+		return err
+	}
+
+	export.ObjectKey = domain.DataExportObjectKey(user.ID, export.ID)
+	size, err := du.buildArchive(ctx, user, export.ObjectKey)
+	if err != nil {
+		if failErr := du.Fail(export.ID, err.Error()); failErr != nil {
+			slog.Warn("Data export failure could not be recorded",
+				slog.String("export_id", export.ID.Hex()),
+				slog.String("error", failErr.Error()))
+		}
+		return err
+	}
+
+	now := time.Now().UTC()
+	expiresAt := now.Add(domain.DataExportURLTTL)
+	update = bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "status", Value: types.DataExportReady},
+			{Key: "object_key", Value: export.ObjectKey},
+			{Key: "size", Value: size},
+			{Key: "expires_at", Value: expiresAt},
+			{Key: "completed_at", Value: now},
+		}},
+		{Key: "$unset", Value: bson.D{{Key: "last_error", Value: ""}}},
+	}
+	if err = du.dataExportBaseRepository.UpdateOne(ctx, bson.D{{Key: "_id", Value: export.ID}}, update, nil); err != nil {
+		return err
+	}
+
+	fileName := fmt.Sprintf("smartsrt-export-%s.zip", now.Format("2006-01-02"))
+	link, err := du.dataExportRepository.PresignDownload(export.ObjectKey, fileName, domain.DataExportURLTTL)
+	if err != nil {
+		return err
+	}
+
+	// the archive is ready either way, a lost email can be recovered by requesting a new export
+	if _, err = du.resendUseCase.SendDataExportEmail(user.Email, expiresAt, link); err != nil {
+		slog.Warn("Data export email could not be sent",
+			slog.String("export_id", export.ID.Hex()),
+			slog.String("user_id", user.ID.Hex()),
+			slog.String("error", err.Error()))
+	}
+
+	return nil
+}
+
+// buildArchive writes the user's data to a temporary ZIP file, uploads it to objectKey and
+// returns its size.
+func (du *dataExportUseCase) buildArchive(ctx context.Context, user *domain.User, objectKey string) (int64, error) {
+	file, err := os.CreateTemp("", "smartsrt-export-*.zip")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	archive := zip.NewWriter(file)
+	if err = du.writeArchive(ctx, archive, user); err != nil {
+		return 0, err
+	}
+	if err = archive.Close(); err != nil {
+		return 0, err
+	}
+
+	size, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	if err = du.dataExportRepository.PutObject(objectKey, file); err != nil {
+		return 0, err
+	}
+
+	return size, nil
+}
+
+// writeArchive adds the profile, the usage ledger, every subscription record, the linked
+// identities and the conversion history of the personal account, together with the stored
+// subtitle files.
+// Conversions made inside an organization belong to the organization and are left out.
+func (du *dataExportUseCase) writeArchive(ctx context.Context, archive *zip.Writer, user *domain.User) error {
+	profile := *user
+	profile.Password = ""
+	if err := writeJSONEntry(archive, "profile.json", profile); err != nil {
+		return err
+	}
+
+	var ledger []*domain.UsageLedgerEntry
+	if err := du.erasureRepository.Find(ctx, domain.CollectionUsageLedger, bson.D{{Key: "user_id", Value: user.ID}}, &ledger); err != nil {
+		return err
+	}
+	if err := writeJSONEntry(archive, "usage_ledger.json", ledger); err != nil {
+		return err
+	}
+
+	// subscriptions are soft-deleted once cancelled, the raw collection keeps the past ones too
+	var subscriptions []*domain.Subscription
+	if err := du.erasureRepository.Find(ctx, domain.CollectionSubscription, bson.D{{Key: "user_id", Value: user.ID}}, &subscriptions); err != nil {
+		return err
+	}
+	if err := writeJSONEntry(archive, "subscriptions.json", subscriptions); err != nil {
+		return err
+	}
+
+	var identities []*domain.Identity
+	if err := du.erasureRepository.Find(ctx, domain.CollectionIdentity, bson.D{{Key: "user_id", Value: user.ID}, {Key: "deleted_at", Value: bson.D{{Key: "$exists", Value: false}}}}, &identities); err != nil {
+		return err
+	}
+	if err := writeJSONEntry(archive, "identities.json", identities); err != nil {
+		return err
+	}
+
+	var passkeys []*domain.Passkey
+	if err := du.erasureRepository.Find(ctx, domain.CollectionPasskey, bson.D{{Key: "user_id", Value: user.ID}, {Key: "deleted_at", Value: bson.D{{Key: "$exists", Value: false}}}}, &passkeys); err != nil {
+		return err
+	}
+	if err := writeJSONEntry(archive, "passkeys.json", passkeys); err != nil {
+		return err
+	}
+
+	historyFilter := bson.D{
+		{Key: "user_id", Value: user.ID},
+		{Key: "org_id", Value: bson.D{{Key: "$exists", Value: false}}},
+	}
+	histories, err := du.srtHistoryBaseRepository.Find(ctx, historyFilter, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return err
+	}
+	if err = writeJSONEntry(archive, "histories.json", histories); err != nil {
+		return err
+	}
+
+	for _, history := range histories {
+		if err = du.writeSRTEntry(archive, history); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeSRTEntry copies the subtitle file of a history into srt/, prefixed with the history ID
+// so that conversions of files with the same name do not collide.
+func (du *dataExportUseCase) writeSRTEntry(archive *zip.Writer, history *domain.SRTHistory) error {
+	body, err := du.dataExportRepository.GetObject(history.ObjectKey)
+	if err != nil {
+		return fmt.Errorf("srt of history %s: %w", history.ID.Hex(), err)
+	}
+	defer body.Close()
+
+	entry, err := archive.CreateHeader(&zip.FileHeader{
+		Name:     "srt/" + history.ID.Hex() + "_" + path.Base(history.FileName),
+		Method:   zip.Deflate,
+		Modified: history.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(entry, body)
+	return err
+}
+
+// ExpireExports queues the archives of exports whose link has expired for deletion.
+func (du *dataExportUseCase) ExpireExports() (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	filter := bson.D{
+		{Key: "status", Value: types.DataExportReady},
+		{Key: "expires_at", Value: bson.D{{Key: "$lte", Value: time.Now().UTC()}}},
+	}
+	expired, err := du.dataExportBaseRepository.Find(ctx, filter, options.Find().SetLimit(domain.DataExportBatchSize))
+	if err != nil {
+		return 0, err
+	}
+
+	session, err := du.dataExportBaseRepository.GetDatabase().Client().StartSession()
+	if err != nil {
+		return 0, err
+	}
+	defer session.EndSession(ctx)
+
+	txnOptions := options.Transaction().SetWriteConcern(writeconcern.Majority())
+
+	count := 0
+	for _, export := range expired {
+		_, err = session.WithTransaction(ctx, func(txCtx context.Context) (interface{}, error) {
+			if err := du.storageUseCase.QueueDeletion(txCtx, []string{export.ObjectKey}, types.DeletionExportExpired, nil); err != nil {
+				return nil, err
+			}
+
+			update := bson.D{{Key: "$set", Value: bson.D{{Key: "status", Value: types.DataExportExpired}}}}
+			return nil, du.dataExportBaseRepository.UpdateOne(txCtx, bson.D{{Key: "_id", Value: export.ID}}, update, nil)
+		}, txnOptions)
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+func writeJSONEntry(archive *zip.Writer, name string, value any) error {
+	entry, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(entry)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
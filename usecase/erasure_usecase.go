@@ -0,0 +1,336 @@
+package usecase
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/kwa0x2/SmartSRT-Backend/domain"
+	"github.com/kwa0x2/SmartSRT-Backend/domain/types"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// accountCollections hold data keyed by the account ID, a user or an organization.
+var accountCollections = []string{
+	domain.CollectionUsage,
+	domain.CollectionUsageReservation,
+	domain.CollectionUsagePeriod,
+	domain.CollectionUsageLedger,
+	domain.CollectionSubscription,
+}
+
+type erasureTarget struct {
+	collection string
+	filter     bson.D
+}
+
+type erasureUseCase struct {
+	erasureBaseRepository domain.BaseRepository[*domain.Erasure]
+	erasureRepository     domain.ErasureRepository
+	sessionRepository     domain.SessionRepository
+	storageUseCase        domain.StorageUseCase
+}
+
+func NewErasureUseCase(erasureBaseRepository domain.BaseRepository[*domain.Erasure], erasureRepository domain.ErasureRepository, sessionRepository domain.SessionRepository, storageUseCase domain.StorageUseCase) domain.ErasureUseCase {
+	return &erasureUseCase{
+		erasureBaseRepository: erasureBaseRepository,
+		erasureRepository:     erasureRepository,
+		sessionRepository:     sessionRepository,
+		storageUseCase:        storageUseCase,
+	}
+}
+
+// ProcessDueErasures permanently removes accounts whose grace period is over. Every step is
+// idempotent, so a failed erasure is simply run again after a backoff.
+func (eu *erasureUseCase) ProcessDueErasures() (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.D{
+		{Key: "status", Value: types.ErasureScheduled},
+		{Key: "next_attempt_at", Value: bson.D{{Key: "$lte", Value: time.Now().UTC()}}},
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).
+		SetLimit(domain.ErasureBatchSize)
+
+	due, err := eu.erasureBaseRepository.Find(ctx, filter, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	completed := 0
+	for _, erasure := range due {
+		done, err := eu.process(erasure)
+		if err != nil {
+			return completed, err
+		}
+		if done {
+			completed++
+		}
+	}
+
+	return completed, nil
+}
+
+// process runs one erasure and records its outcome. Failures of the erasure itself are stored
+// on the record, only failures to update the record are returned.
+func (eu *erasureUseCase) process(erasure *domain.Erasure) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	filter := bson.D{{Key: "_id", Value: erasure.ID}}
+	now := time.Now().UTC()
+
+	steps, restored, err := eu.erase(ctx, erasure)
+	if err != nil {
+		slog.Warn("Account erasure failed",
+			slog.String("erasure_id", erasure.ID.Hex()),
+			slog.String("user_id", erasure.UserID.Hex()),
+			slog.Int("attempts", erasure.Attempts+1),
+			slog.String("error", err.Error()))
+
+		backoff := min(time.Minute<<min(erasure.Attempts, 10), domain.ErasureMaxBackoff)
+		update := bson.D{{Key: "$set", Value: bson.D{
+			{Key: "attempts", Value: erasure.Attempts + 1},
+			{Key: "last_error", Value: err.Error()},
+			{Key: "next_attempt_at", Value: now.Add(backoff)},
+			{Key: "steps", Value: steps},
+		}}}
+		return false, eu.erasureBaseRepository.UpdateOne(ctx, filter, update, nil)
+	}
+
+	set := bson.D{
+		{Key: "status", Value: types.ErasureCompleted},
+		{Key: "completed_at", Value: now},
+		{Key: "steps", Value: steps},
+	}
+	if restored {
+		set = bson.D{
+			{Key: "status", Value: types.ErasureCancelled},
+			{Key: "cancelled_at", Value: now},
+		}
+	}
+	update := bson.D{
+		{Key: "$set", Value: set},
+		{Key: "$unset", Value: bson.D{{Key: "last_error", Value: ""}}},
+	}
+	if err = eu.erasureBaseRepository.UpdateOne(ctx, filter, update, nil); err != nil {
+		return false, err
+	}
+
+	return !restored, nil
+}
+
+// erase removes the user's data across Mongo, S3 and DynamoDB and reports what each step
+// removed. It reports restored instead when the account was brought back in the meantime.
+func (eu *erasureUseCase) erase(ctx context.Context, erasure *domain.Erasure) ([]domain.ErasureStep, bool, error) {
+	var steps []domain.ErasureStep
+	record := func(name string, orgID *bson.ObjectID, count int64) {
+		steps = append(steps, domain.ErasureStep{Name: name, OrgID: orgID, Count: count, At: time.Now().UTC()})
+	}
+
+	userID := erasure.UserID
+	var users []*domain.User
+	if err := eu.erasureRepository.Find(ctx, domain.CollectionUser, bson.D{{Key: "_id", Value: userID}}, &users); err != nil {
+		return steps, false, err
+	}
+
+	// the user document is removed last, a retry after it is gone has no email to work with
+	email, avatarKey := "", ""
+	if len(users) > 0 {
+		if users[0].DeletedAt == nil {
+			return steps, true, nil
+		}
+		email = users[0].Email
+		avatarKey = users[0].AvatarObjectKey
+
+		if erasure.EmailHash == "" {
+			update := bson.D{{Key: "$set", Value: bson.D{{Key: "email_hash", Value: hashEmail(email)}}}}
+			if err := eu.erasureBaseRepository.UpdateOne(ctx, bson.D{{Key: "_id", Value: erasure.ID}}, update, nil); err != nil {
+				return steps, false, err
+			}
+		}
+	}
+
+	personal := bson.D{
+		{Key: "user_id", Value: userID},
+		{Key: "org_id", Value: bson.D{{Key: "$exists", Value: false}}},
+	}
+	if err := eu.eraseAccountData(ctx, userID, personal, nil, record); err != nil {
+		return steps, false, err
+	}
+
+	if err := eu.eraseOwnedOrganizations(ctx, userID, record); err != nil {
+		return steps, false, err
+	}
+
+	if err := eu.eraseDataExports(ctx, userID, record); err != nil {
+		return steps, false, err
+	}
+
+	targets := []erasureTarget{
+		{domain.CollectionAPIKey, bson.D{{Key: "user_id", Value: userID}}},
+		{domain.CollectionOrganizationMember, bson.D{{Key: "user_id", Value: userID}}},
+		{domain.CollectionIdentity, bson.D{{Key: "user_id", Value: userID}}},
+		{domain.CollectionPasskey, bson.D{{Key: "user_id", Value: userID}}},
+	}
+	if email != "" {
+		targets = append(targets,
+			erasureTarget{domain.CollectionOrganizationInvitation, bson.D{{Key: "email", Value: email}}},
+			erasureTarget{domain.CollectionContact, bson.D{{Key: "email", Value: email}}},
+		)
+	}
+	for _, target := range targets {
+		count, err := eu.erasureRepository.DeleteMany(ctx, target.collection, target.filter)
+		if err != nil {
+			return steps, false, err
+		}
+		record(target.collection, nil, count)
+	}
+
+	sessions, err := eu.sessionRepository.DeleteSessionsByUserID(ctx, userID.Hex())
+	if err != nil {
+		return steps, false, err
+	}
+	record(domain.TableName, nil, int64(sessions))
+
+	if avatarKey != "" {
+		if err = eu.storageUseCase.QueueDeletion(ctx, []string{avatarKey}, types.DeletionAccountErased, nil); err != nil {
+			return steps, false, err
+		}
+		record("avatar_objects", nil, 1)
+	}
+
+	// removing the user document frees the email for a new sign-up
+	count, err := eu.erasureRepository.DeleteMany(ctx, domain.CollectionUser, bson.D{{Key: "_id", Value: userID}})
+	if err != nil {
+		return steps, false, err
+	}
+	record(domain.CollectionUser, nil, count)
+
+	return steps, false, nil
+}
+
+// eraseDataExports removes the user's export records and queues the archives that may still
+// be stored.
+func (eu *erasureUseCase) eraseDataExports(ctx context.Context, userID bson.ObjectID, record func(string, *bson.ObjectID, int64)) error {
+	filter := bson.D{{Key: "user_id", Value: userID}}
+
+	var exports []*domain.DataExport
+	if err := eu.erasureRepository.Find(ctx, domain.CollectionDataExport, filter, &exports); err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(exports))
+	for _, export := range exports {
+		if export.ObjectKey != "" && export.Status != types.DataExportExpired {
+			keys = append(keys, export.ObjectKey)
+		}
+	}
+	if err := eu.storageUseCase.QueueDeletion(ctx, keys, types.DeletionAccountErased, nil); err != nil {
+		return err
+	}
+
+	count, err := eu.erasureRepository.DeleteMany(ctx, domain.CollectionDataExport, filter)
+	if err != nil {
+		return err
+	}
+	record(domain.CollectionDataExport, nil, count)
+
+	return nil
+}
+
+// eraseOwnedOrganizations erases organizations the user owned and nobody else is left in.
+// Organizations with remaining members are kept, their data belongs to the team.
+func (eu *erasureUseCase) eraseOwnedOrganizations(ctx context.Context, userID bson.ObjectID, record func(string, *bson.ObjectID, int64)) error {
+	var orgs []*domain.Organization
+	if err := eu.erasureRepository.Find(ctx, domain.CollectionOrganization, bson.D{{Key: "owner_id", Value: userID}}, &orgs); err != nil {
+		return err
+	}
+
+	for _, org := range orgs {
+		var members []*domain.OrganizationMember
+		memberFilter := bson.D{
+			{Key: "org_id", Value: org.ID},
+			{Key: "user_id", Value: bson.D{{Key: "$ne", Value: userID}}},
+			{Key: "deleted_at", Value: bson.D{{Key: "$exists", Value: false}}},
+		}
+		if err := eu.erasureRepository.Find(ctx, domain.CollectionOrganizationMember, memberFilter, &members); err != nil {
+			return err
+		}
+		if len(members) > 0 {
+			record(domain.CollectionOrganization+"_retained", &org.ID, 0)
+			continue
+		}
+
+		orgFilter := bson.D{{Key: "org_id", Value: org.ID}}
+		if err := eu.eraseAccountData(ctx, org.ID, orgFilter, &org.ID, record); err != nil {
+			return err
+		}
+
+		for _, collection := range []string{domain.CollectionAPIKey, domain.CollectionOrganizationMember, domain.CollectionOrganizationInvitation} {
+			count, err := eu.erasureRepository.DeleteMany(ctx, collection, orgFilter)
+			if err != nil {
+				return err
+			}
+			record(collection, &org.ID, count)
+		}
+
+		count, err := eu.erasureRepository.DeleteMany(ctx, domain.CollectionOrganization, bson.D{{Key: "_id", Value: org.ID}})
+		if err != nil {
+			return err
+		}
+		record(domain.CollectionOrganization, &org.ID, count)
+	}
+
+	return nil
+}
+
+// eraseAccountData removes the conversions, their S3 objects and the usage and billing
+// records of a personal or organization account. Objects are queued before their histories
+// are removed, so a retry can always find them again.
+func (eu *erasureUseCase) eraseAccountData(ctx context.Context, accountID bson.ObjectID, historyFilter bson.D, orgID *bson.ObjectID, record func(string, *bson.ObjectID, int64)) error {
+	var histories []*domain.SRTHistory
+	if err := eu.erasureRepository.Find(ctx, domain.CollectionSRTHistory, historyFilter, &histories); err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(histories)*2)
+	for _, history := range histories {
+		for _, key := range []string{history.ObjectKey, history.MediaObjectKey} {
+			if key != "" {
+				keys = append(keys, key)
+			}
+		}
+	}
+	if err := eu.storageUseCase.QueueDeletion(ctx, keys, types.DeletionAccountErased, nil); err != nil {
+		return err
+	}
+	record("storage_objects", orgID, int64(len(keys)))
+
+	count, err := eu.erasureRepository.DeleteMany(ctx, domain.CollectionSRTHistory, historyFilter)
+	if err != nil {
+		return err
+	}
+	record(domain.CollectionSRTHistory, orgID, count)
+
+	for _, collection := range accountCollections {
+		count, err = eu.erasureRepository.DeleteMany(ctx, collection, bson.D{{Key: "user_id", Value: accountID}})
+		if err != nil {
+			return err
+		}
+		record(collection, orgID, count)
+	}
+
+	return nil
+}
+
+func hashEmail(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,218 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/kwa0x2/SmartSRT-Backend/domain"
+	"github.com/kwa0x2/SmartSRT-Backend/domain/types"
+	"github.com/kwa0x2/SmartSRT-Backend/utils"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.mongodb.org/mongo-driver/v2/mongo/writeconcern"
+)
+
+type identityUseCase struct {
+	identityBaseRepository domain.BaseRepository[*domain.Identity]
+	passkeyBaseRepository  domain.BaseRepository[*domain.Passkey]
+	userBaseRepository     domain.BaseRepository[*domain.User]
+}
+
+func NewIdentityUseCase(identityBaseRepository domain.BaseRepository[*domain.Identity], passkeyBaseRepository domain.BaseRepository[*domain.Passkey], userBaseRepository domain.BaseRepository[*domain.User]) domain.IdentityUseCase {
+	return &identityUseCase{
+		identityBaseRepository: identityBaseRepository,
+		passkeyBaseRepository:  passkeyBaseRepository,
+		userBaseRepository:     userBaseRepository,
+	}
+}
+
+func (iu *identityUseCase) FindByProviderSubject(provider types.AuthType, subject string) (*domain.Identity, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.D{
+		{Key: "provider", Value: provider},
+		{Key: "subject", Value: subject},
+	}
+	return iu.identityBaseRepository.FindOne(ctx, filter)
+}
+
+func (iu *identityUseCase) FindByUserID(userID bson.ObjectID) ([]*domain.Identity, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	return iu.identityBaseRepository.Find(ctx, bson.D{{Key: "user_id", Value: userID}}, opts)
+}
+
+func (iu *identityUseCase) Link(userID bson.ObjectID, profile *domain.OAuthProfile) (*domain.Identity, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.D{
+		{Key: "provider", Value: profile.Provider},
+		{Key: "subject", Value: profile.Subject},
+	}
+	existing, err := iu.identityBaseRepository.FindOne(ctx, filter)
+	if err == nil {
+		if existing.UserID != userID {
+			return nil, utils.ErrIdentityLinked
+		}
+		if existing.Email != profile.Email {
+			update := bson.D{{Key: "$set", Value: bson.D{{Key: "email", Value: profile.Email}}}}
+			if err = iu.identityBaseRepository.UpdateOne(ctx, bson.D{{Key: "_id", Value: existing.ID}}, update, nil); err != nil {
+				return nil, err
+			}
+			existing.Email = profile.Email
+		}
+		return existing, nil
+	} else if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+
+	providerFilter := bson.D{
+		{Key: "user_id", Value: userID},
+		{Key: "provider", Value: profile.Provider},
+	}
+	if _, err = iu.identityBaseRepository.FindOne(ctx, providerFilter); err == nil {
+		return nil, utils.ErrProviderLinked
+	} else if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+
+	// a user registered with the provider before identities existed is still found by this
+	// email, linking the account elsewhere would take their login away
+	ownerFilter := bson.D{
+		{Key: "_id", Value: bson.D{{Key: "$ne", Value: userID}}},
+		{Key: "email", Value: profile.Email},
+		{Key: "auth_type", Value: profile.Provider},
+	}
+	if owner, err := iu.userBaseRepository.FindOne(ctx, ownerFilter); err == nil {
+		ownerFilter = bson.D{
+			{Key: "user_id", Value: owner.ID},
+			{Key: "provider", Value: profile.Provider},
+		}
+		if _, err = iu.identityBaseRepository.FindOne(ctx, ownerFilter); errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, utils.ErrIdentityLinked
+		} else if err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	identity := &domain.Identity{
+		UserID:    userID,
+		Provider:  profile.Provider,
+		Subject:   profile.Subject,
+		Email:     profile.Email,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err = identity.Validate(); err != nil {
+		return nil, err
+	}
+
+	// the unique indexes catch a concurrent link of the same account or provider
+	if err = iu.identityBaseRepository.Create(ctx, identity); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, utils.ErrIdentityLinked
+		}
+		return nil, err
+	}
+
+	return identity, nil
+}
+
+// Unlink refuses to remove the last login method, see countLoginMethods. When the user's auth type was the unlinked provider, it moves to a method that is left, which
+// also ends a legacy login of the provider.
+func (iu *identityUseCase) Unlink(userID bson.ObjectID, provider types.AuthType) error {
+	wc := writeconcern.Majority()
+	txnOptions := options.Transaction().SetWriteConcern(wc)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	session, err := iu.identityBaseRepository.GetDatabase().Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(txCtx context.Context) (interface{}, error) {
+		user, err := iu.userBaseRepository.FindOne(txCtx, bson.D{{Key: "_id", Value: userID}})
+		if err != nil {
+			return nil, err
+		}
+
+		identities, err := iu.identityBaseRepository.Find(txCtx, bson.D{{Key: "user_id", Value: userID}}, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var target *domain.Identity
+		var remaining []*domain.Identity
+		for _, identity := range identities {
+			if identity.Provider == provider {
+				target = identity
+			} else {
+				remaining = append(remaining, identity)
+			}
+		}
+
+		// a legacy OAuth login has no identity, unlinking it moves the auth type away from it
+		legacy := domain.IsLegacyOAuthLogin(user, identities)
+		if target == nil && (!legacy || user.AuthType != provider) {
+			return nil, mongo.ErrNoDocuments
+		}
+
+		passkeys, err := iu.passkeyBaseRepository.Find(txCtx, bson.D{{Key: "user_id", Value: userID}}, nil)
+		if err != nil {
+			return nil, err
+		}
+		if countLoginMethods(user, identities, len(passkeys)) <= 1 {
+			return nil, utils.ErrLastLoginMethod
+		}
+
+		if target != nil {
+			if err = iu.identityBaseRepository.SoftDelete(txCtx, bson.D{{Key: "_id", Value: target.ID}}); err != nil {
+				return nil, err
+			}
+		}
+
+		authType := user.AuthType
+		if authType == provider {
+			switch {
+			case user.Password != "":
+				authType = types.Credentials
+			case len(remaining) > 0:
+				authType = remaining[0].Provider
+			default:
+				authType = types.Passkey
+			}
+		}
+
+		// the user is written even when its auth type stays, so that concurrent unlinks of the
+		// same user conflict instead of both removing a method
+		update := bson.D{{Key: "$set", Value: bson.D{{Key: "auth_type", Value: authType}}}}
+		return nil, iu.userBaseRepository.UpdateOne(txCtx, bson.D{{Key: "_id", Value: userID}}, update, nil)
+	}, txnOptions)
+
+	return err
+}
+
+// countLoginMethods counts the linked identities, the password, a legacy OAuth login and the
+// passkeys of the user.
+func countLoginMethods(user *domain.User, identities []*domain.Identity, passkeys int) int {
+	methods := len(identities) + passkeys
+	if user.Password != "" {
+		methods++
+	}
+	if domain.IsLegacyOAuthLogin(user, identities) {
+		methods++
+	}
+	return methods
+}
@@ -0,0 +1,67 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kwa0x2/SmartSRT-Backend/domain"
+	"github.com/kwa0x2/SmartSRT-Backend/domain/types"
+	"github.com/kwa0x2/SmartSRT-Backend/utils"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+type oauthStateUseCase struct {
+	oauthStateBaseRepository domain.BaseRepository[*domain.OAuthState]
+}
+
+func NewOAuthStateUseCase(oauthStateBaseRepository domain.BaseRepository[*domain.OAuthState]) domain.OAuthStateUseCase {
+	return &oauthStateUseCase{
+		oauthStateBaseRepository: oauthStateBaseRepository,
+	}
+}
+
+func (ou *oauthStateUseCase) Create(flow *domain.OAuthState, binding string) (string, error) {
+	state := uuid.New().String()
+
+	now := time.Now().UTC()
+	flow.StateHash = utils.HashToken(state)
+	flow.BindingHash = utils.HashToken(binding)
+	flow.ExpiresAt = now.Add(domain.OAuthStateTTL)
+	flow.CreatedAt = now
+	flow.UpdatedAt = now
+	if err := flow.Validate(); err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := ou.oauthStateBaseRepository.Create(ctx, flow); err != nil {
+		return "", err
+	}
+
+	return state, nil
+}
+
+// Consume deletes from the collection directly, the base repository only soft-deletes. The TTL
+// index removes expired flows with a delay, so the expiry is checked here as well.
+func (ou *oauthStateUseCase) Consume(provider types.AuthType, state, binding string) (*domain.OAuthState, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.D{
+		{Key: "state_hash", Value: utils.HashToken(state)},
+		{Key: "binding_hash", Value: utils.HashToken(binding)},
+		{Key: "provider", Value: provider},
+		{Key: "expires_at", Value: bson.D{{Key: "$gt", Value: time.Now().UTC()}}},
+	}
+
+	var flow domain.OAuthState
+	err := ou.oauthStateBaseRepository.GetDatabase().Collection(domain.CollectionOAuthState).FindOneAndDelete(ctx, filter).Decode(&flow)
+	if err != nil {
+		return nil, err
+	}
+
+	return &flow, nil
+}
@@ -0,0 +1,727 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+
+	"github.com/kwa0x2/SmartSRT-Backend/config"
+	"github.com/kwa0x2/SmartSRT-Backend/domain"
+	"github.com/kwa0x2/SmartSRT-Backend/domain/types"
+	"github.com/kwa0x2/SmartSRT-Backend/utils"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.mongodb.org/mongo-driver/v2/mongo/writeconcern"
+)
+
+type organizationUseCase struct {
+	env                      *config.Env
+	orgBaseRepository        domain.BaseRepository[*domain.Organization]
+	memberBaseRepository     domain.BaseRepository[*domain.OrganizationMember]
+	invitationBaseRepository domain.BaseRepository[*domain.OrganizationInvitation]
+	userBaseRepository       domain.BaseRepository[*domain.User]
+	usageBaseRepository      domain.BaseRepository[*domain.Usage]
+	usageUseCase             domain.UsageUseCase
+	planUseCase              domain.PlanUseCase
+	resendUseCase            domain.ResendUseCase
+}
+
+func NewOrganizationUseCase(
+	env *config.Env,
+	orgBaseRepository domain.BaseRepository[*domain.Organization],
+	memberBaseRepository domain.BaseRepository[*domain.OrganizationMember],
+	invitationBaseRepository domain.BaseRepository[*domain.OrganizationInvitation],
+	userBaseRepository domain.BaseRepository[*domain.User],
+	usageBaseRepository domain.BaseRepository[*domain.Usage],
+	usageUseCase domain.UsageUseCase,
+	planUseCase domain.PlanUseCase,
+	resendUseCase domain.ResendUseCase,
+) domain.OrganizationUseCase {
+	return &organizationUseCase{
+		env:                      env,
+		orgBaseRepository:        orgBaseRepository,
+		memberBaseRepository:     memberBaseRepository,
+		invitationBaseRepository: invitationBaseRepository,
+		userBaseRepository:       userBaseRepository,
+		usageBaseRepository:      usageBaseRepository,
+		usageUseCase:             usageUseCase,
+		planUseCase:              planUseCase,
+		resendUseCase:            resendUseCase,
+	}
+}
+
+// Create opens an organization on the default plan with its own usage pool, makes the
+// user its owner and switches the user into it. Only users on a paid plan can create one,
+// and at most MaxOwnedOrganizations, so new usage pools cannot be opened for free minutes.
+func (ou *organizationUseCase) Create(owner *domain.User, name string) (*domain.Organization, error) {
+	ownerPlan, err := ou.planUseCase.FindByName(owner.Plan)
+	if err != nil {
+		return nil, err
+	}
+	if ownerPlan.IsDefault {
+		return nil, utils.ErrOrgPlanRequired
+	}
+
+	plan, err := ou.planUseCase.FindDefault()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	org := &domain.Organization{
+		Name:      name,
+		OwnerID:   owner.ID,
+		Plan:      plan.Name,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if err = org.Validate(); err != nil {
+		return nil, err
+	}
+
+	// the owner's user document is written in the same transaction, so concurrent creates
+	// conflict and are retried against the new count
+	err = ou.withTransaction(func(txCtx context.Context) error {
+		ownedFilter := bson.D{
+			{Key: "owner_id", Value: owner.ID},
+			{Key: "deleted_at", Value: bson.D{{Key: "$exists", Value: false}}},
+		}
+		owned, err := ou.orgBaseRepository.GetDatabase().Collection(domain.CollectionOrganization).CountDocuments(txCtx, ownedFilter)
+		if err != nil {
+			return err
+		}
+		if owned >= domain.MaxOwnedOrganizations {
+			return utils.ErrOrgLimitReached
+		}
+
+		if err := ou.orgBaseRepository.Create(txCtx, org); err != nil {
+			return err
+		}
+
+		member := &domain.OrganizationMember{
+			OrgID:     org.ID,
+			UserID:    owner.ID,
+			Role:      types.OrgOwner,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		if err := member.Validate(); err != nil {
+			return err
+		}
+		if err := ou.memberBaseRepository.Create(txCtx, member); err != nil {
+			return err
+		}
+
+		usage := &domain.Usage{
+			UserID:              org.ID,
+			Plan:                org.Plan,
+			StartDate:           now,
+			EndDate:             now.Add(domain.UsagePeriodLength),
+			MonthlyUsage:        float64(0),
+			TotalUsage:          float64(0),
+			UsageLimit:          plan.MonthlySeconds,
+			PeriodStartNotified: true, // the first period needs no renewal email
+			CreatedAt:           now,
+			UpdatedAt:           now,
+		}
+		if err := ou.usageBaseRepository.Create(txCtx, usage); err != nil {
+			return err
+		}
+
+		filter := bson.D{{Key: "_id", Value: owner.ID}}
+		update := bson.D{{Key: "$set", Value: bson.D{{Key: "active_org_id", Value: org.ID}}}}
+
+		return ou.userBaseRepository.UpdateOne(txCtx, filter, update, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return org, nil
+}
+
+func (ou *organizationUseCase) FindByID(id bson.ObjectID) (*domain.Organization, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.D{{Key: "_id", Value: id}}
+	return ou.orgBaseRepository.FindOne(ctx, filter)
+}
+
+func (ou *organizationUseCase) FindMember(orgID, userID bson.ObjectID) (*domain.OrganizationMember, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.D{
+		{Key: "org_id", Value: orgID},
+		{Key: "user_id", Value: userID},
+	}
+
+	member, err := ou.memberBaseRepository.FindOne(ctx, filter)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, utils.ErrNotOrgMember
+		}
+		return nil, err
+	}
+
+	return member, nil
+}
+
+func (ou *organizationUseCase) FindMembershipsByUserID(user *domain.User) ([]*domain.OrganizationMembership, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	members, err := ou.memberBaseRepository.Find(ctx, bson.D{{Key: "user_id", Value: user.ID}}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	orgIDs := make([]bson.ObjectID, 0, len(members))
+	for _, member := range members {
+		orgIDs = append(orgIDs, member.OrgID)
+	}
+
+	orgs, err := ou.orgBaseRepository.Find(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: orgIDs}}}}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	orgsByID := make(map[bson.ObjectID]*domain.Organization, len(orgs))
+	for _, org := range orgs {
+		orgsByID[org.ID] = org
+	}
+
+	memberships := make([]*domain.OrganizationMembership, 0, len(members))
+	for _, member := range members {
+		org, ok := orgsByID[member.OrgID]
+		if !ok {
+			continue
+		}
+		memberships = append(memberships, &domain.OrganizationMembership{
+			Organization: org,
+			Role:         member.Role,
+			Active:       user.ActiveOrgID != nil && *user.ActiveOrgID == org.ID,
+		})
+	}
+
+	return memberships, nil
+}
+
+func (ou *organizationUseCase) FindMembers(orgID bson.ObjectID) ([]*domain.OrganizationMemberDetail, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	members, err := ou.memberBaseRepository.Find(ctx, bson.D{{Key: "org_id", Value: orgID}}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	userIDs := make([]bson.ObjectID, 0, len(members))
+	for _, member := range members {
+		userIDs = append(userIDs, member.UserID)
+	}
+
+	users, err := ou.userBaseRepository.Find(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: userIDs}}}}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	usersByID := make(map[bson.ObjectID]*domain.User, len(users))
+	for _, user := range users {
+		usersByID[user.ID] = user
+	}
+
+	details := make([]*domain.OrganizationMemberDetail, 0, len(members))
+	for _, member := range members {
+		user, ok := usersByID[member.UserID]
+		if !ok {
+			continue
+		}
+		details = append(details, &domain.OrganizationMemberDetail{
+			UserID:    member.UserID,
+			Name:      user.Name,
+			Email:     user.Email,
+			AvatarURL: user.AvatarURL,
+			Role:      member.Role,
+			JoinedAt:  member.CreatedAt,
+		})
+	}
+
+	return details, nil
+}
+
+// FindActive returns the organization the user is working in together with their membership.
+// Both are nil when the user works in their personal account or is no longer a member.
+func (ou *organizationUseCase) FindActive(user *domain.User) (*domain.Organization, *domain.OrganizationMember, error) {
+	if user.ActiveOrgID == nil {
+		return nil, nil, nil
+	}
+
+	member, err := ou.FindMember(*user.ActiveOrgID, user.ID)
+	if err != nil {
+		if errors.Is(err, utils.ErrNotOrgMember) {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+
+	org, err := ou.FindByID(member.OrgID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+
+	return org, member, nil
+}
+
+// UpdateMemberRole lets owners manage everyone but themselves and admins manage plain members.
+// Ownership cannot be granted or taken away here.
+func (ou *organizationUseCase) UpdateMemberRole(actor *domain.OrganizationMember, userID bson.ObjectID, role types.OrgRole) error {
+	if err := canAssignRole(actor, role); err != nil {
+		return err
+	}
+
+	target, err := ou.FindMember(actor.OrgID, userID)
+	if err != nil {
+		return err
+	}
+
+	if err = canManageMember(actor, target); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.D{{Key: "_id", Value: target.ID}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "role", Value: role}}}}
+
+	return ou.memberBaseRepository.UpdateOne(ctx, filter, update, nil)
+}
+
+// RemoveMember removes userID from the actor's organization. Members may always remove
+// themselves, except the owner who has to stay.
+func (ou *organizationUseCase) RemoveMember(actor *domain.OrganizationMember, userID bson.ObjectID) error {
+	target := actor
+	if userID != actor.UserID {
+		var err error
+		if target, err = ou.FindMember(actor.OrgID, userID); err != nil {
+			return err
+		}
+		if err = canManageMember(actor, target); err != nil {
+			return err
+		}
+	} else if actor.Role == types.OrgOwner {
+		return utils.ErrOrgOwnerImmutable
+	}
+
+	return ou.withTransaction(func(txCtx context.Context) error {
+		if err := ou.memberBaseRepository.SoftDelete(txCtx, bson.D{{Key: "_id", Value: target.ID}}); err != nil {
+			return err
+		}
+
+		filter := bson.D{
+			{Key: "_id", Value: target.UserID},
+			{Key: "active_org_id", Value: target.OrgID},
+		}
+		update := bson.D{{Key: "$unset", Value: bson.D{{Key: "active_org_id", Value: ""}}}}
+
+		return ou.userBaseRepository.UpdateOne(txCtx, filter, update, nil)
+	})
+}
+
+func (ou *organizationUseCase) EnsureNoSharedOwnership(userID bson.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	orgs, err := ou.orgBaseRepository.Find(ctx, bson.D{{Key: "owner_id", Value: userID}}, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, org := range orgs {
+		filter := bson.D{
+			{Key: "org_id", Value: org.ID},
+			{Key: "user_id", Value: bson.D{{Key: "$ne", Value: userID}}},
+		}
+		members, err := ou.memberBaseRepository.Find(ctx, filter, options.Find().SetLimit(1))
+		if err != nil {
+			return err
+		}
+		if len(members) > 0 {
+			return utils.ErrOrgOwnerHasMembers
+		}
+	}
+
+	return nil
+}
+
+func (ou *organizationUseCase) UpdatePlanAndUsageLimitByID(id bson.ObjectID, plan types.PlanType) error {
+	return ou.withTransaction(func(txCtx context.Context) error {
+		filter := bson.D{{Key: "_id", Value: id}}
+		update := bson.D{{Key: "$set", Value: bson.D{{Key: "plan", Value: plan}}}}
+		if err := ou.orgBaseRepository.UpdateOne(txCtx, filter, update, nil); err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		return ou.usageUseCase.StartNewPeriod(txCtx, id, plan, now, now.Add(domain.UsagePeriodLength))
+	})
+}
+
+// SetActive switches the user into orgID, or back to the personal account when orgID is nil.
+func (ou *organizationUseCase) SetActive(userID bson.ObjectID, orgID *bson.ObjectID) error {
+	var update bson.D
+	if orgID == nil {
+		update = bson.D{{Key: "$unset", Value: bson.D{{Key: "active_org_id", Value: ""}}}}
+	} else {
+		if _, err := ou.FindMember(*orgID, userID); err != nil {
+			return err
+		}
+		update = bson.D{{Key: "$set", Value: bson.D{{Key: "active_org_id", Value: *orgID}}}}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return ou.userBaseRepository.UpdateOne(ctx, bson.D{{Key: "_id", Value: userID}}, update, nil)
+}
+
+// InviteMember records a pending invitation and emails a signed link to it. Admins can only
+// invite plain members, the same limit that applies when they change roles.
+func (ou *organizationUseCase) InviteMember(actor *domain.OrganizationMember, inviter *domain.User, email string, role types.OrgRole, locale string) (*domain.OrganizationInvitation, error) {
+	if err := canAssignRole(actor, role); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	invitee, err := ou.userBaseRepository.FindOne(ctx, bson.D{{Key: "email", Value: email}})
+	if err == nil {
+		if _, err = ou.FindMember(actor.OrgID, invitee.ID); err == nil {
+			return nil, utils.ErrAlreadyOrgMember
+		} else if !errors.Is(err, utils.ErrNotOrgMember) {
+			return nil, err
+		}
+	} else if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+
+	pendingFilter := bson.D{
+		{Key: "org_id", Value: actor.OrgID},
+		{Key: "email", Value: email},
+		{Key: "accepted_at", Value: bson.D{{Key: "$exists", Value: false}}},
+	}
+	if _, err = ou.invitationBaseRepository.FindOne(ctx, pendingFilter); err == nil {
+		return nil, utils.ErrInvitationExists
+	} else if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+
+	org, err := ou.FindByID(actor.OrgID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	invitation := &domain.OrganizationInvitation{
+		ID:        bson.NewObjectID(),
+		OrgID:     actor.OrgID,
+		Email:     email,
+		Role:      role,
+		InvitedBy: inviter.ID,
+		ExpiresAt: now.Add(domain.InvitationTTL),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	token, err := ou.generateInvitationToken(invitation)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = invitation.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err = ou.invitationBaseRepository.Create(ctx, invitation); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, utils.ErrInvitationExists
+		}
+		return nil, err
+	}
+
+	if err = ou.sendInvitation(org, inviter, invitation, token, locale); err != nil {
+		return nil, err
+	}
+
+	return invitation, nil
+}
+
+func (ou *organizationUseCase) FindPendingInvitations(orgID bson.ObjectID) ([]*domain.OrganizationInvitation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.D{
+		{Key: "org_id", Value: orgID},
+		{Key: "accepted_at", Value: bson.D{{Key: "$exists", Value: false}}},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+
+	return ou.invitationBaseRepository.Find(ctx, filter, opts)
+}
+
+// ResendInvitation emails a fresh link and restarts the expiry. Links sent earlier stop working.
+func (ou *organizationUseCase) ResendInvitation(actor *domain.OrganizationMember, inviter *domain.User, invitationID bson.ObjectID, locale string) error {
+	invitation, err := ou.findPendingInvitation(actor.OrgID, invitationID)
+	if err != nil {
+		return err
+	}
+
+	if err = canAssignRole(actor, invitation.Role); err != nil {
+		return err
+	}
+
+	org, err := ou.FindByID(actor.OrgID)
+	if err != nil {
+		return err
+	}
+
+	invitation.ExpiresAt = time.Now().UTC().Add(domain.InvitationTTL)
+	token, err := ou.generateInvitationToken(invitation)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.D{{Key: "_id", Value: invitation.ID}}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "token_hash", Value: invitation.TokenHash},
+		{Key: "expires_at", Value: invitation.ExpiresAt},
+	}}}
+	if err = ou.invitationBaseRepository.UpdateOne(ctx, filter, update, nil); err != nil {
+		return err
+	}
+
+	return ou.sendInvitation(org, inviter, invitation, token, locale)
+}
+
+func (ou *organizationUseCase) RevokeInvitation(actor *domain.OrganizationMember, invitationID bson.ObjectID) error {
+	invitation, err := ou.findPendingInvitation(actor.OrgID, invitationID)
+	if err != nil {
+		return err
+	}
+
+	if err = canAssignRole(actor, invitation.Role); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return ou.invitationBaseRepository.SoftDelete(ctx, bson.D{{Key: "_id", Value: invitation.ID}})
+}
+
+// AcceptInvitation adds the user to the inviting organization and switches them into it. The
+// token must be the latest one sent for the invitation and the account email must match.
+func (ou *organizationUseCase) AcceptInvitation(user *domain.User, token string) (*domain.Organization, error) {
+	claims, err := utils.GetClaims(token, ou.env.JWTSecret)
+	if err != nil {
+		return nil, utils.ErrInvitationInvalid
+	}
+
+	process, _ := claims["process"].(string)
+	invitationIDStr, _ := claims["invitation_id"].(string)
+	invitationID, err := bson.ObjectIDFromHex(invitationIDStr)
+	if process != string(types.AcceptInvitation) || err != nil {
+		return nil, utils.ErrInvitationInvalid
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	invitation, err := ou.invitationBaseRepository.FindOne(ctx, bson.D{
+		{Key: "_id", Value: invitationID},
+		{Key: "accepted_at", Value: bson.D{{Key: "$exists", Value: false}}},
+	})
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, utils.ErrInvitationInvalid
+		}
+		return nil, err
+	}
+
+	if invitation.TokenHash != utils.HashToken(token) || time.Now().UTC().After(invitation.ExpiresAt) {
+		return nil, utils.ErrInvitationInvalid
+	}
+	if !strings.EqualFold(invitation.Email, user.Email) {
+		return nil, utils.ErrInvitationEmailMismatch
+	}
+
+	org, err := ou.FindByID(invitation.OrgID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, utils.ErrInvitationInvalid
+		}
+		return nil, err
+	}
+
+	if _, err = ou.FindMember(org.ID, user.ID); err == nil {
+		return nil, utils.ErrAlreadyOrgMember
+	} else if !errors.Is(err, utils.ErrNotOrgMember) {
+		return nil, err
+	}
+
+	err = ou.withTransaction(func(txCtx context.Context) error {
+		now := time.Now().UTC()
+
+		claimFilter := bson.D{
+			{Key: "_id", Value: invitation.ID},
+			{Key: "token_hash", Value: invitation.TokenHash},
+			{Key: "accepted_at", Value: bson.D{{Key: "$exists", Value: false}}},
+		}
+		claimUpdate := bson.D{{Key: "$set", Value: bson.D{
+			{Key: "accepted_at", Value: now},
+			{Key: "accepted_by", Value: user.ID},
+		}}}
+		if _, err := ou.invitationBaseRepository.FindOneAndUpdate(txCtx, claimFilter, claimUpdate, nil); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return utils.ErrInvitationInvalid
+			}
+			return err
+		}
+
+		member := &domain.OrganizationMember{
+			OrgID:     org.ID,
+			UserID:    user.ID,
+			Role:      invitation.Role,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		if err := member.Validate(); err != nil {
+			return err
+		}
+		if err := ou.memberBaseRepository.Create(txCtx, member); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return utils.ErrAlreadyOrgMember
+			}
+			return err
+		}
+
+		filter := bson.D{{Key: "_id", Value: user.ID}}
+		update := bson.D{{Key: "$set", Value: bson.D{{Key: "active_org_id", Value: org.ID}}}}
+
+		return ou.userBaseRepository.UpdateOne(txCtx, filter, update, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return org, nil
+}
+
+func (ou *organizationUseCase) findPendingInvitation(orgID, invitationID bson.ObjectID) (*domain.OrganizationInvitation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.D{
+		{Key: "_id", Value: invitationID},
+		{Key: "org_id", Value: orgID},
+		{Key: "accepted_at", Value: bson.D{{Key: "$exists", Value: false}}},
+	}
+
+	invitation, err := ou.invitationBaseRepository.FindOne(ctx, filter)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, utils.ErrInvitationInvalid
+		}
+		return nil, err
+	}
+
+	return invitation, nil
+}
+
+// generateInvitationToken signs a token for the invitation and stores its hash on it. The jti
+// makes every token unique, so a resend always replaces the stored hash.
+func (ou *organizationUseCase) generateInvitationToken(invitation *domain.OrganizationInvitation) (string, error) {
+	claims := jwt.MapClaims{
+		"process":       types.AcceptInvitation,
+		"invitation_id": invitation.ID.Hex(),
+		"jti":           utils.GenerateUUID(),
+	}
+
+	token, err := utils.GenerateJWT(claims, ou.env, invitation.ExpiresAt.Unix())
+	if err != nil {
+		return "", err
+	}
+
+	invitation.TokenHash = utils.HashToken(token)
+	return token, nil
+}
+
+func (ou *organizationUseCase) sendInvitation(org *domain.Organization, inviter *domain.User, invitation *domain.OrganizationInvitation, token, locale string) error {
+	inviteLink := fmt.Sprintf("%s/%s/invitations/accept?token=%s", ou.env.FrontEndURL, locale, url.QueryEscape(token))
+
+	_, err := ou.resendUseCase.SendOrganizationInvitationEmail(invitation.Email, org.Name, inviter.Name, string(invitation.Role), invitation.ExpiresAt, inviteLink)
+	return err
+}
+
+func (ou *organizationUseCase) withTransaction(fn func(txCtx context.Context) error) error {
+	wc := writeconcern.Majority()
+	txnOptions := options.Transaction().SetWriteConcern(wc)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	session, err := ou.orgBaseRepository.GetDatabase().Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(txCtx context.Context) (interface{}, error) {
+		return nil, fn(txCtx)
+	}, txnOptions)
+
+	return err
+}
+
+func canAssignRole(actor *domain.OrganizationMember, role types.OrgRole) error {
+	if role == types.OrgOwner {
+		return utils.ErrOrgOwnerImmutable
+	}
+	if !role.IsValid() {
+		return fmt.Errorf("validation failed: unknown role %q", role)
+	}
+	if !actor.Role.CanManageMembers() || (actor.Role != types.OrgOwner && role != types.OrgMember) {
+		return utils.ErrOrgRoleForbidden
+	}
+	return nil
+}
+
+func canManageMember(actor, target *domain.OrganizationMember) error {
+	if target.Role == types.OrgOwner {
+		return utils.ErrOrgOwnerImmutable
+	}
+	if !actor.Role.CanManageMembers() || (actor.Role != types.OrgOwner && target.Role != types.OrgMember) {
+		return utils.ErrOrgRoleForbidden
+	}
+	return nil
+}
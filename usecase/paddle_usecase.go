@@ -6,9 +6,9 @@ import (
 	"fmt"
 	"time"
 	paddle "github.com/PaddleHQ/paddle-go-sdk/v3"
+	"github.com/PaddleHQ/paddle-go-sdk/v3/pkg/paddleerr"
 	"github.com/kwa0x2/SmartSRT-Backend/config"
 	"github.com/kwa0x2/SmartSRT-Backend/domain"
-	"github.com/kwa0x2/SmartSRT-Backend/domain/types"
 	"github.com/kwa0x2/SmartSRT-Backend/utils"
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
@@ -19,14 +19,20 @@ type paddleUseCase struct {
 	sdk                 *paddle.SDK
 	subscriptionUseCase domain.SubscriptionUseCase
 	userUseCase         domain.UserUseCase
+	usageUseCase        domain.UsageUseCase
+	planUseCase         domain.PlanUseCase
+	organizationUseCase domain.OrganizationUseCase
 }
 
-func NewPaddleUseCase(env *config.Env, paddleSDK *paddle.SDK, subscriptionUseCase domain.SubscriptionUseCase, userUseCase domain.UserUseCase) domain.PaddleUseCase {
+func NewPaddleUseCase(env *config.Env, paddleSDK *paddle.SDK, subscriptionUseCase domain.SubscriptionUseCase, userUseCase domain.UserUseCase, usageUseCase domain.UsageUseCase, planUseCase domain.PlanUseCase, organizationUseCase domain.OrganizationUseCase) domain.PaddleUseCase {
 	return &paddleUseCase{
 		env:                 env,
 		sdk:                 paddleSDK,
 		subscriptionUseCase: subscriptionUseCase,
 		userUseCase:         userUseCase,
+		usageUseCase:        usageUseCase,
+		planUseCase:         planUseCase,
+		organizationUseCase: organizationUseCase,
 	}
 }
 
@@ -48,6 +54,9 @@ func (pu *paddleUseCase) HandleWebhook(event *domain.PaddleWebhookEvent) error {
 	
 	case "customer.created":
 		return pu.handleCustomerCreated(event.Data)
+
+	case "transaction.completed":
+		return pu.handleTransactionCompleted(event.Data)
 	}
 
 	return nil
@@ -55,7 +64,7 @@ func (pu *paddleUseCase) HandleWebhook(event *domain.PaddleWebhookEvent) error {
 
 
 func (pu *paddleUseCase) handleSubscriptionCreated(data map[string]interface{}) error {
-	userID, err := utils.ParseUserIDFromCustomData(data)
+	accountID, err := utils.ParseAccountIDFromCustomData(data)
 	if err != nil {
 		return err
 	}
@@ -77,7 +86,7 @@ func (pu *paddleUseCase) handleSubscriptionCreated(data map[string]interface{})
 
 	subscription := domain.Subscription{
 		SubscriptionID:       data["id"].(string),
-		UserID:            userID,
+		UserID:            accountID,
 		Status:               data["status"].(string),
 		PriceID:              priceID,
 		UnitPrice: domain.UnitPrice{
@@ -106,6 +115,40 @@ func (pu *paddleUseCase) handleCustomerCreated(data map[string]interface{}) erro
 	return pu.userUseCase.UpdateCustomerIDByEmail(data["email"].(string), data["id"].(string))
 }
 
+// handleTransactionCompleted credits one-time minute pack purchases. Subscription
+// transactions are ignored here, they are handled by the subscription events.
+func (pu *paddleUseCase) handleTransactionCompleted(data map[string]interface{}) error {
+	if subscriptionID, ok := data["subscription_id"].(string); ok && subscriptionID != "" {
+		return nil
+	}
+
+	packs, err := utils.ParseMinutePacks(pu.env.PaddleMinutePacks)
+	if err != nil {
+		return err
+	}
+
+	quantities, err := utils.ParseTransactionItems(data)
+	if err != nil {
+		return err
+	}
+
+	var seconds float64
+	for priceID, quantity := range quantities {
+		seconds += packs[priceID] * float64(quantity)
+	}
+
+	if seconds == 0 {
+		return nil
+	}
+
+	accountID, err := utils.ParseAccountIDFromCustomData(data)
+	if err != nil {
+		return err
+	}
+
+	return pu.usageUseCase.CreditMinutePack(accountID, data["id"].(string), seconds)
+}
+
 func (pu *paddleUseCase) handleSubscriptionCanceled(data map[string]interface{}) error {
 	subscriptionID := data["id"].(string)
 
@@ -113,12 +156,13 @@ func (pu *paddleUseCase) handleSubscriptionCanceled(data map[string]interface{})
 		return err
 	}
 
-	userID, err := utils.ParseUserIDFromCustomData(data)
+	accountID, err := utils.ParseAccountIDFromCustomData(data)
 	if err != nil {
 		return err
 	}
 
-	return pu.CancelSubscriptionImmediately(userID)
+	_, err = pu.CancelSubscriptionImmediately(accountID)
+	return err
 }
 
 func (pu *paddleUseCase) handleSubscriptionUpdated(data map[string]interface{}) error {
@@ -151,12 +195,13 @@ func (pu *paddleUseCase) handleSubscriptionPastDue(data map[string]interface{})
 		return err
 	}
 
-	userID, err := utils.ParseUserIDFromCustomData(data)
+	accountID, err := utils.ParseAccountIDFromCustomData(data)
 	if err != nil {
 		return err
 	}
 
-	return pu.CancelSubscriptionImmediately(userID)
+	_, err = pu.CancelSubscriptionImmediately(accountID)
+	return err
 }
 
 func (pu *paddleUseCase) CreateCustomerPortalSessionByEmail(email string) (*paddle.CustomerPortalSession, error) {
@@ -177,15 +222,16 @@ func (pu *paddleUseCase) CreateCustomerPortalSessionByEmail(email string) (*padd
 	return session, nil
 }
 
-func (pu *paddleUseCase) CancelSubscriptionImmediately(userID bson.ObjectID) error {
-	subscription, err := pu.subscriptionUseCase.FindByUserID(userID)
+func (pu *paddleUseCase) CancelSubscriptionImmediately(accountID bson.ObjectID) (*domain.Subscription, error) {
+	subscription, err := pu.subscriptionUseCase.FindByUserID(accountID)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
-			return nil
+			return nil, nil
 		}
-		return err
+		return nil, err
 	}
 
+	var cancelled *domain.Subscription
 	if subscription.Status != "canceled" {
 		effectiveFrom := paddle.EffectiveFromImmediately
 		_, err = pu.sdk.CancelSubscription(context.Background(), &paddle.CancelSubscriptionRequest{
@@ -194,15 +240,32 @@ func (pu *paddleUseCase) CancelSubscriptionImmediately(userID bson.ObjectID) err
 		})
 
 		if err != nil {
-			return err
+			return nil, err
 		}
+		cancelled = subscription
 	}
 
-	if err = pu.userUseCase.UpdatePlanAndUsageLimitByID(userID, types.Free); err != nil {
-		return err
+	defaultPlan, err := pu.planUseCase.FindDefault()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = pu.organizationUseCase.FindByID(accountID)
+	switch {
+	case err == nil:
+		err = pu.organizationUseCase.UpdatePlanAndUsageLimitByID(accountID, defaultPlan.Name)
+	case errors.Is(err, mongo.ErrNoDocuments):
+		err = pu.userUseCase.UpdatePlanAndUsageLimitByID(accountID, defaultPlan.Name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = pu.subscriptionUseCase.DeleteBySubsID(subscription.SubscriptionID); err != nil {
+		return nil, err
 	}
 
-	return pu.subscriptionUseCase.DeleteBySubsID(subscription.SubscriptionID)
+	return cancelled, nil
 }
 
 func (pu *paddleUseCase) GetCustomerIDByEmail(email string) (string, error) {
@@ -229,6 +292,30 @@ func (pu *paddleUseCase) GetCustomerIDByEmail(email string) (string, error) {
 	return customerID, nil
 }
 
+func (pu *paddleUseCase) UpdateCustomerEmail(customerID, email string) error {
+	req := &paddle.UpdateCustomerRequest{
+		CustomerID: customerID,
+		Email:      paddle.NewPatchField(email),
+	}
+
+	_, err := pu.sdk.UpdateCustomer(context.Background(), req)
+	return rejectedPaddleRequest(err)
+}
+
+// rejectedPaddleRequest marks request errors with ErrPaddleRequestRejected, sending them again
+// fails the same way. Gateway errors and rate limits are request errors too, but transient.
+func rejectedPaddleRequest(err error) error {
+	var paddleErr *paddleerr.Error
+	if !errors.As(err, &paddleErr) || paddleErr.Type != paddleerr.ErrorTypeRequestError {
+		return err
+	}
+	if paddleErr.Code == "bad_gateway" || paddleErr.Code == "too_many_requests" {
+		return err
+	}
+
+	return fmt.Errorf("%w: %w", utils.ErrPaddleRequestRejected, err)
+}
+
 func (pu *paddleUseCase) GetPriceByID(priceID string) (*paddle.Price, error) {
 	req := &paddle.GetPriceRequest{
 		PriceID:        priceID,
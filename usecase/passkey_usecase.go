@@ -0,0 +1,400 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/kwa0x2/SmartSRT-Backend/domain"
+	"github.com/kwa0x2/SmartSRT-Backend/domain/types"
+	"github.com/kwa0x2/SmartSRT-Backend/utils"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.mongodb.org/mongo-driver/v2/mongo/writeconcern"
+)
+
+type passkeyUseCase struct {
+	webAuthn                      *webauthn.WebAuthn
+	passkeyBaseRepository         domain.BaseRepository[*domain.Passkey]
+	passkeyCeremonyBaseRepository domain.BaseRepository[*domain.PasskeyCeremony]
+	identityBaseRepository        domain.BaseRepository[*domain.Identity]
+	userBaseRepository            domain.BaseRepository[*domain.User]
+}
+
+func NewPasskeyUseCase(webAuthn *webauthn.WebAuthn, passkeyBaseRepository domain.BaseRepository[*domain.Passkey], passkeyCeremonyBaseRepository domain.BaseRepository[*domain.PasskeyCeremony], identityBaseRepository domain.BaseRepository[*domain.Identity], userBaseRepository domain.BaseRepository[*domain.User]) domain.PasskeyUseCase {
+	return &passkeyUseCase{
+		webAuthn:                      webAuthn,
+		passkeyBaseRepository:         passkeyBaseRepository,
+		passkeyCeremonyBaseRepository: passkeyCeremonyBaseRepository,
+		identityBaseRepository:        identityBaseRepository,
+		userBaseRepository:            userBaseRepository,
+	}
+}
+
+// passkeyUser presents a user and their passkeys to the WebAuthn library. The user handle is
+// the user ID, which tells nothing about the user.
+type passkeyUser struct {
+	user     *domain.User
+	passkeys []*domain.Passkey
+}
+
+func (pu *passkeyUser) WebAuthnID() []byte {
+	return pu.user.ID[:]
+}
+
+func (pu *passkeyUser) WebAuthnName() string {
+	return pu.user.Email
+}
+
+func (pu *passkeyUser) WebAuthnDisplayName() string {
+	return pu.user.Name
+}
+
+func (pu *passkeyUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, len(pu.passkeys))
+	for i, passkey := range pu.passkeys {
+		transports := make([]protocol.AuthenticatorTransport, len(passkey.Transports))
+		for j, transport := range passkey.Transports {
+			transports[j] = protocol.AuthenticatorTransport(transport)
+		}
+
+		credentials[i] = webauthn.Credential{
+			ID:              passkey.CredentialID,
+			PublicKey:       passkey.PublicKey,
+			AttestationType: passkey.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				BackupEligible: passkey.BackupEligible,
+				BackupState:    passkey.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    passkey.AAGUID,
+				SignCount: passkey.SignCount,
+			},
+		}
+	}
+	return credentials
+}
+
+func (pu *passkeyUser) find(credentialID []byte) *domain.Passkey {
+	for _, passkey := range pu.passkeys {
+		if string(passkey.CredentialID) == string(credentialID) {
+			return passkey
+		}
+	}
+	return nil
+}
+
+func (pu *passkeyUseCase) BeginRegistration(user *domain.User) (*protocol.CredentialCreation, *webauthn.SessionData, error) {
+	owner, err := pu.loadUser(user)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// discoverable credentials let the browser offer the passkey without asking for the email
+	return pu.webAuthn.BeginRegistration(owner,
+		webauthn.WithExclusions(webauthn.Credentials(owner.WebAuthnCredentials()).CredentialDescriptors()),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+	)
+}
+
+func (pu *passkeyUseCase) FinishRegistration(user *domain.User, session webauthn.SessionData, name string, response []byte) (*domain.Passkey, error) {
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(response)
+	if err != nil {
+		return nil, utils.ErrPasskeyInvalid
+	}
+
+	owner, err := pu.loadUser(user)
+	if err != nil {
+		return nil, err
+	}
+
+	credential, err := pu.webAuthn.CreateCredential(owner, session, parsed)
+	if err != nil {
+		slog.Info("Passkey registration did not verify",
+			slog.String("user_id", user.ID.Hex()),
+			slog.String("error", err.Error()))
+		return nil, utils.ErrPasskeyInvalid
+	}
+
+	transports := make([]string, len(credential.Transport))
+	for i, transport := range credential.Transport {
+		transports[i] = string(transport)
+	}
+
+	now := time.Now().UTC()
+	passkey := &domain.Passkey{
+		UserID:          user.ID,
+		Name:            name,
+		CredentialID:    credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       credential.Authenticator.SignCount,
+		Transports:      transports,
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	if err = passkey.Validate(); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err = pu.passkeyBaseRepository.Create(ctx, passkey); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, utils.ErrPasskeyInvalid
+		}
+		return nil, err
+	}
+
+	return passkey, nil
+}
+
+func (pu *passkeyUseCase) BeginLogin() (*protocol.CredentialAssertion, *webauthn.SessionData, error) {
+	return pu.webAuthn.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+}
+
+func (pu *passkeyUseCase) FinishLogin(session webauthn.SessionData, response []byte) (*domain.User, error) {
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(response)
+	if err != nil {
+		return nil, utils.ErrPasskeyInvalid
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// failures of the lookup other than an unknown user are ours, not the browser's
+	var owner *passkeyUser
+	var lookupErr error
+	handler := func(rawID, userHandle []byte) (webauthn.User, error) {
+		if len(userHandle) != len(bson.ObjectID{}) {
+			return nil, utils.ErrPasskeyInvalid
+		}
+
+		userID := bson.ObjectID(userHandle)
+		user, err := pu.userBaseRepository.FindOne(ctx, bson.D{{Key: "_id", Value: userID}})
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			user, err = pu.userBaseRepository.FindOneDeleted(ctx, bson.D{{Key: "_id", Value: userID}})
+		}
+		if err == nil {
+			owner, err = pu.loadUser(user)
+		}
+		if err != nil {
+			if !errors.Is(err, mongo.ErrNoDocuments) {
+				lookupErr = err
+			}
+			return nil, err
+		}
+		return owner, nil
+	}
+
+	_, credential, err := pu.webAuthn.ValidatePasskeyLogin(handler, session, parsed)
+	if err != nil {
+		if lookupErr != nil {
+			return nil, lookupErr
+		}
+		return nil, utils.ErrPasskeyInvalid
+	}
+
+	if err = pu.recordUse(owner, credential); err != nil {
+		return nil, err
+	}
+
+	return owner.user, nil
+}
+
+func (pu *passkeyUseCase) BeginSecondFactor(user *domain.User) (*protocol.CredentialAssertion, *webauthn.SessionData, error) {
+	owner, err := pu.loadUser(user)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(owner.passkeys) == 0 {
+		return nil, nil, mongo.ErrNoDocuments
+	}
+
+	return pu.webAuthn.BeginLogin(owner)
+}
+
+func (pu *passkeyUseCase) FinishSecondFactor(user *domain.User, session webauthn.SessionData, response []byte) error {
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(response)
+	if err != nil {
+		return utils.ErrPasskeyInvalid
+	}
+
+	owner, err := pu.loadUser(user)
+	if err != nil {
+		return err
+	}
+
+	credential, err := pu.webAuthn.ValidateLogin(owner, session, parsed)
+	if err != nil {
+		return utils.ErrPasskeyInvalid
+	}
+
+	return pu.recordUse(owner, credential)
+}
+
+func (pu *passkeyUseCase) StartCeremony(process types.ProcessType, userID *bson.ObjectID, session *webauthn.SessionData) (string, error) {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return "", err
+	}
+
+	token, err := utils.GenerateSecret(32)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	ceremony := &domain.PasskeyCeremony{
+		TokenHash: utils.HashToken(token),
+		Process:   process,
+		UserID:    userID,
+		Session:   string(data),
+		ExpiresAt: now.Add(domain.PasskeyCeremonyTTL),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err = ceremony.Validate(); err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err = pu.passkeyCeremonyBaseRepository.Create(ctx, ceremony); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// FinishCeremony deletes from the collection directly, the base repository only soft-deletes.
+// The TTL index removes expired ceremonies with a delay, so the expiry is checked here as well.
+func (pu *passkeyUseCase) FinishCeremony(process types.ProcessType, token string) (*webauthn.SessionData, *bson.ObjectID, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.D{
+		{Key: "token_hash", Value: utils.HashToken(token)},
+		{Key: "process", Value: process},
+		{Key: "expires_at", Value: bson.D{{Key: "$gt", Value: time.Now().UTC()}}},
+	}
+
+	var ceremony domain.PasskeyCeremony
+	err := pu.passkeyCeremonyBaseRepository.GetDatabase().Collection(domain.CollectionPasskeyCeremony).FindOneAndDelete(ctx, filter).Decode(&ceremony)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var session webauthn.SessionData
+	if err = json.Unmarshal([]byte(ceremony.Session), &session); err != nil {
+		return nil, nil, err
+	}
+
+	return &session, ceremony.UserID, nil
+}
+
+func (pu *passkeyUseCase) FindByUserID(userID bson.ObjectID) ([]*domain.Passkey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	return pu.passkeyBaseRepository.Find(ctx, bson.D{{Key: "user_id", Value: userID}}, opts)
+}
+
+func (pu *passkeyUseCase) Revoke(userID, id bson.ObjectID) error {
+	wc := writeconcern.Majority()
+	txnOptions := options.Transaction().SetWriteConcern(wc)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	session, err := pu.passkeyBaseRepository.GetDatabase().Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(txCtx context.Context) (interface{}, error) {
+		user, err := pu.userBaseRepository.FindOne(txCtx, bson.D{{Key: "_id", Value: userID}})
+		if err != nil {
+			return nil, err
+		}
+
+		passkeyFilter := bson.D{{Key: "_id", Value: id}, {Key: "user_id", Value: userID}}
+		if _, err = pu.passkeyBaseRepository.FindOne(txCtx, passkeyFilter); err != nil {
+			return nil, err
+		}
+
+		identities, err := pu.identityBaseRepository.Find(txCtx, bson.D{{Key: "user_id", Value: userID}}, nil)
+		if err != nil {
+			return nil, err
+		}
+		passkeys, err := pu.passkeyBaseRepository.Find(txCtx, bson.D{{Key: "user_id", Value: userID}}, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		if countLoginMethods(user, identities, len(passkeys)) <= 1 {
+			return nil, utils.ErrLastLoginMethod
+		}
+
+		if err = pu.passkeyBaseRepository.SoftDelete(txCtx, passkeyFilter); err != nil {
+			return nil, err
+		}
+
+		// see identityUseCase.Unlink, concurrent removals of login methods have to conflict
+		update := bson.D{{Key: "$set", Value: bson.D{{Key: "auth_type", Value: user.AuthType}}}}
+		return nil, pu.userBaseRepository.UpdateOne(txCtx, bson.D{{Key: "_id", Value: userID}}, update, nil)
+	}, txnOptions)
+
+	return err
+}
+
+func (pu *passkeyUseCase) loadUser(user *domain.User) (*passkeyUser, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	passkeys, err := pu.passkeyBaseRepository.Find(ctx, bson.D{{Key: "user_id", Value: user.ID}}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &passkeyUser{user: user, passkeys: passkeys}, nil
+}
+
+// recordUse stores the new signature counter. A counter that went backwards means the
+// credential was likely cloned, the sign-in is refused.
+func (pu *passkeyUseCase) recordUse(owner *passkeyUser, credential *webauthn.Credential) error {
+	passkey := owner.find(credential.ID)
+	if passkey == nil {
+		return utils.ErrPasskeyInvalid
+	}
+
+	if credential.Authenticator.CloneWarning {
+		slog.Warn("Passkey signature counter went backwards",
+			slog.String("user_id", owner.user.ID.Hex()),
+			slog.String("passkey_id", passkey.ID.Hex()))
+		return utils.ErrPasskeyInvalid
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "sign_count", Value: credential.Authenticator.SignCount},
+		{Key: "backup_state", Value: credential.Flags.BackupState},
+		{Key: "last_used_at", Value: time.Now().UTC()},
+	}}}
+	return pu.passkeyBaseRepository.UpdateOne(ctx, bson.D{{Key: "_id", Value: passkey.ID}}, update, nil)
+}
@@ -0,0 +1,111 @@
+package usecase
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/kwa0x2/SmartSRT-Backend/config"
+	"github.com/kwa0x2/SmartSRT-Backend/domain"
+	"github.com/kwa0x2/SmartSRT-Backend/domain/types"
+	"github.com/kwa0x2/SmartSRT-Backend/utils"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+type planUseCase struct {
+	env                *config.Env
+	planBaseRepository domain.BaseRepository[*domain.Plan]
+
+	mu       sync.RWMutex
+	plans    []*domain.Plan
+	loadedAt time.Time
+}
+
+func NewPlanUseCase(env *config.Env, planBaseRepository domain.BaseRepository[*domain.Plan]) domain.PlanUseCase {
+	return &planUseCase{
+		env:                env,
+		planBaseRepository: planBaseRepository,
+	}
+}
+
+func (pu *planUseCase) FindAll() ([]*domain.Plan, error) {
+	return pu.catalogue()
+}
+
+func (pu *planUseCase) FindByName(name types.PlanType) (*domain.Plan, error) {
+	plans, err := pu.catalogue()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, plan := range plans {
+		if plan.Name == name {
+			return plan, nil
+		}
+	}
+
+	return nil, utils.ErrPlanNotFound
+}
+
+func (pu *planUseCase) FindByPriceID(priceID string) (*domain.Plan, error) {
+	plans, err := pu.catalogue()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, plan := range plans {
+		if plan.HasPriceID(priceID) {
+			return plan, nil
+		}
+	}
+
+	return nil, utils.ErrPlanNotFound
+}
+
+func (pu *planUseCase) FindDefault() (*domain.Plan, error) {
+	plans, err := pu.catalogue()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, plan := range plans {
+		if plan.IsDefault {
+			return plan, nil
+		}
+	}
+
+	return nil, utils.ErrPlanNotFound
+}
+
+// catalogue serves the plans from memory and reloads them once PlanCacheTTL has passed.
+// When the collection is empty the built-in defaults are used, so a fresh database works.
+func (pu *planUseCase) catalogue() ([]*domain.Plan, error) {
+	pu.mu.RLock()
+	if pu.plans != nil && time.Since(pu.loadedAt) < domain.PlanCacheTTL {
+		plans := pu.plans
+		pu.mu.RUnlock()
+		return plans, nil
+	}
+	pu.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "monthly_seconds", Value: 1}})
+	plans, err := pu.planBaseRepository.Find(ctx, bson.D{}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(plans) == 0 {
+		plans = domain.DefaultPlans(pu.env)
+	}
+
+	pu.mu.Lock()
+	pu.plans = plans
+	pu.loadedAt = time.Now()
+	pu.mu.Unlock()
+
+	return plans, nil
+}
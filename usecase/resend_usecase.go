@@ -1,6 +1,9 @@
 package usecase
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/kwa0x2/SmartSRT-Backend/config"
 	"github.com/kwa0x2/SmartSRT-Backend/domain"
 	"github.com/kwa0x2/SmartSRT-Backend/utils"
@@ -46,3 +49,63 @@ func (ru *resendUseCase) SendSRTCreatedEmail(email, SRTLink string) (string, err
 		return utils.LoadSRTCreatedEmailTemplate(SRTLink)
 	})
 }
+
+func (ru *resendUseCase) SendUsageThresholdEmail(email string, percent int, usedSeconds, limitSeconds float64, periodEnd time.Time, usageLink string) (string, error) {
+	return ru.sendEmail(email, fmt.Sprintf("📊 SmartSRT - You've Used %d%% of Your Minutes", percent), func() (string, error) {
+		return utils.LoadUsageThresholdEmailTemplate(percent, usedSeconds, limitSeconds, periodEnd, usageLink)
+	})
+}
+
+func (ru *resendUseCase) SendUsagePeriodStartedEmail(email string, limitSeconds float64, periodEnd time.Time, usageLink string) (string, error) {
+	return ru.sendEmail(email, "🔄 SmartSRT - Your Minutes Have Been Renewed", func() (string, error) {
+		return utils.LoadUsagePeriodEmailTemplate(limitSeconds, periodEnd, usageLink)
+	})
+}
+
+func (ru *resendUseCase) SendRetentionWarningEmail(email string, count int, deleteAt time.Time, historyLink string) (string, error) {
+	return ru.sendEmail(email, "🗑️ SmartSRT - Some of Your Files Will Be Deleted Soon", func() (string, error) {
+		return utils.LoadRetentionWarningEmailTemplate(count, deleteAt, historyLink)
+	})
+}
+
+func (ru *resendUseCase) SendAccountDeletedEmail(email string, restoreUntil time.Time, restoreLink string) (string, error) {
+	return ru.sendEmail(email, "👋 SmartSRT - Your Account Has Been Deleted", func() (string, error) {
+		return utils.LoadAccountDeletedEmailTemplate(restoreUntil, restoreLink)
+	})
+}
+
+func (ru *resendUseCase) SendAccountRestoredEmail(email string, cancelled *domain.CancelledSubscription, dashboardLink string) (string, error) {
+	return ru.sendEmail(email, "🎉 SmartSRT - Your Account Has Been Restored", func() (string, error) {
+		return utils.LoadAccountRestoredEmailTemplate(cancelled, dashboardLink)
+	})
+}
+
+func (ru *resendUseCase) SendOrganizationInvitationEmail(email, orgName, inviterName, role string, expiresAt time.Time, inviteLink string) (string, error) {
+	return ru.sendEmail(email, fmt.Sprintf("👥 SmartSRT - You're Invited to Join %s", orgName), func() (string, error) {
+		return utils.LoadOrganizationInvitationEmailTemplate(orgName, inviterName, role, expiresAt, inviteLink)
+	})
+}
+
+func (ru *resendUseCase) SendDataExportEmail(email string, expiresAt time.Time, downloadLink string) (string, error) {
+	return ru.sendEmail(email, "📦 SmartSRT - Your Data Export Is Ready", func() (string, error) {
+		return utils.LoadDataExportEmailTemplate(expiresAt, downloadLink)
+	})
+}
+
+func (ru *resendUseCase) SendEmailChangeConfirmEmail(email, confirmLink string) (string, error) {
+	return ru.sendEmail(email, "✉️ SmartSRT - Confirm Your New Email Address", func() (string, error) {
+		return utils.LoadEmailChangeConfirmEmailTemplate(confirmLink)
+	})
+}
+
+func (ru *resendUseCase) SendEmailChangeNoticeEmail(email, newEmail string) (string, error) {
+	return ru.sendEmail(email, "⚠️ SmartSRT - Email Change Requested", func() (string, error) {
+		return utils.LoadEmailChangeNoticeEmailTemplate(newEmail)
+	})
+}
+
+func (ru *resendUseCase) SendPasskeyAddedEmail(email, passkeyName string) (string, error) {
+	return ru.sendEmail(email, "🔑 SmartSRT - New Passkey Added", func() (string, error) {
+		return utils.LoadPasskeyAddedEmailTemplate(passkeyName)
+	})
+}
@@ -0,0 +1,342 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/kwa0x2/SmartSRT-Backend/config"
+	"github.com/kwa0x2/SmartSRT-Backend/domain"
+	"github.com/kwa0x2/SmartSRT-Backend/domain/types"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.mongodb.org/mongo-driver/v2/mongo/writeconcern"
+)
+
+type retentionUseCase struct {
+	env                      *config.Env
+	srtHistoryBaseRepository domain.BaseRepository[*domain.SRTHistory]
+	userBaseRepository       domain.BaseRepository[*domain.User]
+	orgBaseRepository        domain.BaseRepository[*domain.Organization]
+	planUseCase              domain.PlanUseCase
+	storageUseCase           domain.StorageUseCase
+	resendUseCase            domain.ResendUseCase
+}
+
+// retentionWarning collects the histories of one user that are announced in this run.
+type retentionWarning struct {
+	histories map[bson.ObjectID]time.Time // Due date of each history
+	deleteAt  time.Time
+}
+
+func NewRetentionUseCase(
+	env *config.Env,
+	srtHistoryBaseRepository domain.BaseRepository[*domain.SRTHistory],
+	userBaseRepository domain.BaseRepository[*domain.User],
+	orgBaseRepository domain.BaseRepository[*domain.Organization],
+	planUseCase domain.PlanUseCase,
+	storageUseCase domain.StorageUseCase,
+	resendUseCase domain.ResendUseCase,
+) domain.RetentionUseCase {
+	return &retentionUseCase{
+		env:                      env,
+		srtHistoryBaseRepository: srtHistoryBaseRepository,
+		userBaseRepository:       userBaseRepository,
+		orgBaseRepository:        orgBaseRepository,
+		planUseCase:              planUseCase,
+		storageUseCase:           storageUseCase,
+		resendUseCase:            resendUseCase,
+	}
+}
+
+// ApplyRetention enforces the retention limits of each account's current plan. A history is
+// announced to its uploader first and only removed once RetentionWarningPeriod has passed
+// since the warning, so nothing disappears without notice. Pinned histories are skipped while
+// the plan allows pinning.
+func (ru *retentionUseCase) ApplyRetention() (*domain.RetentionRun, error) {
+	run := &domain.RetentionRun{}
+
+	plans, err := ru.planUseCase.FindAll()
+	if err != nil {
+		return run, err
+	}
+
+	minMediaDays, minSRTDays := 0, 0
+	for _, plan := range plans {
+		minMediaDays = minPositive(minMediaDays, plan.Retention.MediaDays)
+		minSRTDays = minPositive(minSRTDays, plan.Retention.SRTDays)
+	}
+	if minMediaDays == 0 && minSRTDays == 0 {
+		return run, nil
+	}
+
+	now := time.Now().UTC()
+	var candidates bson.A
+	if minMediaDays > 0 {
+		candidates = append(candidates, bson.D{
+			{Key: "media_object_key", Value: bson.D{{Key: "$exists", Value: true}}},
+			{Key: "media_deleted_at", Value: bson.D{{Key: "$exists", Value: false}}},
+			{Key: "created_at", Value: bson.D{{Key: "$lt", Value: retentionCutoff(now, minMediaDays)}}},
+		})
+	}
+	if minSRTDays > 0 {
+		candidates = append(candidates, bson.D{
+			{Key: "created_at", Value: bson.D{{Key: "$lt", Value: retentionCutoff(now, minSRTDays)}}},
+		})
+	}
+
+	plansByAccount := make(map[bson.ObjectID]*domain.Plan)
+	warnings := make(map[bson.ObjectID]*retentionWarning)
+	var lastID bson.ObjectID
+
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		filter := bson.D{
+			{Key: "_id", Value: bson.D{{Key: "$gt", Value: lastID}}},
+			{Key: "$or", Value: candidates},
+		}
+		opts := options.Find().
+			SetSort(bson.D{{Key: "_id", Value: 1}}).
+			SetLimit(domain.RetentionBatchSize)
+
+		histories, err := ru.srtHistoryBaseRepository.Find(ctx, filter, opts)
+		if err != nil {
+			cancel()
+			return run, err
+		}
+
+		for _, history := range histories {
+			lastID = history.ID
+			if err = ru.applyToHistory(ctx, history, now, plansByAccount, warnings, run); err != nil {
+				cancel()
+				return run, err
+			}
+		}
+		cancel()
+
+		if len(histories) < domain.RetentionBatchSize {
+			break
+		}
+	}
+
+	run.Warned = ru.sendWarnings(warnings)
+	return run, nil
+}
+
+func (ru *retentionUseCase) applyToHistory(ctx context.Context, history *domain.SRTHistory, now time.Time, plansByAccount map[bson.ObjectID]*domain.Plan, warnings map[bson.ObjectID]*retentionWarning, run *domain.RetentionRun) error {
+	plan, err := ru.findAccountPlan(ctx, history, plansByAccount)
+	if err != nil || plan == nil {
+		return err
+	}
+	if history.Pinned && plan.HasFeature(domain.FeaturePinHistory) {
+		return nil
+	}
+
+	var srtDue, mediaDue time.Time
+	if plan.Retention.SRTDays > 0 {
+		srtDue = history.CreatedAt.AddDate(0, 0, plan.Retention.SRTDays)
+	}
+	if plan.Retention.MediaDays > 0 && history.MediaObjectKey != "" && history.MediaDeletedAt == nil {
+		mediaDue = history.CreatedAt.AddDate(0, 0, plan.Retention.MediaDays)
+	}
+
+	due := earliest(srtDue, mediaDue)
+	if due.IsZero() || due.After(now.Add(domain.RetentionWarningPeriod)) {
+		return nil
+	}
+
+	// sandbox conversions have no one to notify and are removed as soon as they are due
+	if !history.Sandbox {
+		// a warning announced a due date that has since moved, e.g. after a plan change
+		stale := history.RetentionDueAt != nil && !history.RetentionDueAt.Equal(due)
+		if history.RetentionWarnedAt == nil || stale {
+			// the warning is recorded by sendWarnings once the email went out
+			deleteAt := maxTime(due, now.Add(domain.RetentionWarningPeriod))
+			warning, ok := warnings[history.UserID]
+			if !ok {
+				warning = &retentionWarning{histories: make(map[bson.ObjectID]time.Time), deleteAt: deleteAt}
+				warnings[history.UserID] = warning
+			}
+			warning.histories[history.ID] = due
+			warning.deleteAt = earliest(warning.deleteAt, deleteAt)
+			return nil
+		}
+		if now.Before(history.RetentionWarnedAt.Add(domain.RetentionWarningPeriod)) {
+			return nil
+		}
+	}
+	if now.Before(due) {
+		return nil
+	}
+
+	deleteHistory := !srtDue.IsZero() && !now.Before(srtDue)
+	if err = ru.removeExpired(ctx, history, deleteHistory); err != nil {
+		return err
+	}
+	if deleteHistory {
+		run.HistoriesDeleted++
+	} else {
+		run.MediaDeleted++
+	}
+	return nil
+}
+
+// removeExpired deletes the whole history, or only its source media, and queues the objects
+// in the same transaction.
+func (ru *retentionUseCase) removeExpired(ctx context.Context, history *domain.SRTHistory, deleteHistory bool) error {
+	session, err := ru.srtHistoryBaseRepository.GetDatabase().Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	txnOptions := options.Transaction().SetWriteConcern(writeconcern.Majority())
+
+	_, err = session.WithTransaction(ctx, func(txCtx context.Context) (interface{}, error) {
+		filter := bson.D{{Key: "_id", Value: history.ID}}
+
+		if deleteHistory {
+			if err := ru.storageUseCase.QueueDeletion(txCtx, []string{history.ObjectKey, history.MediaObjectKey}, types.DeletionRetention, &history.ID); err != nil {
+				return nil, err
+			}
+			return nil, ru.srtHistoryBaseRepository.SoftDelete(txCtx, filter)
+		}
+
+		if err := ru.storageUseCase.QueueDeletion(txCtx, []string{history.MediaObjectKey}, types.DeletionRetention, &history.ID); err != nil {
+			return nil, err
+		}
+		// the subtitles get their own warning once they are due
+		update := bson.D{
+			{Key: "$set", Value: bson.D{{Key: "media_deleted_at", Value: time.Now().UTC()}}},
+			{Key: "$unset", Value: bson.D{
+				{Key: "retention_warned_at", Value: ""},
+				{Key: "retention_due_at", Value: ""},
+			}},
+		}
+		return nil, ru.srtHistoryBaseRepository.UpdateOne(txCtx, filter, update, nil)
+	}, txnOptions)
+
+	return err
+}
+
+// findAccountPlan returns the current plan of the account owning the history, or nil when the
+// account no longer exists. Orphaned objects of removed accounts are left to ReconcileOrphans.
+func (ru *retentionUseCase) findAccountPlan(ctx context.Context, history *domain.SRTHistory, plansByAccount map[bson.ObjectID]*domain.Plan) (*domain.Plan, error) {
+	accountID := history.UserID
+	if history.OrgID != nil {
+		accountID = *history.OrgID
+	}
+	if plan, ok := plansByAccount[accountID]; ok {
+		return plan, nil
+	}
+
+	var planType types.PlanType
+	var err error
+	if history.OrgID != nil {
+		var org *domain.Organization
+		if org, err = ru.orgBaseRepository.FindOne(ctx, bson.D{{Key: "_id", Value: accountID}}); err == nil {
+			planType = org.Plan
+		}
+	} else {
+		var user *domain.User
+		if user, err = ru.userBaseRepository.FindOne(ctx, bson.D{{Key: "_id", Value: accountID}}); err == nil {
+			planType = user.Plan
+		}
+	}
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			plansByAccount[accountID] = nil
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	plan, err := ru.planUseCase.FindByName(planType)
+	if err != nil {
+		return nil, err
+	}
+	plansByAccount[accountID] = plan
+	return plan, nil
+}
+
+// sendWarnings emails each user about their announced histories and records the warnings
+// of the emails that went out. A failed email is retried by the next run, so the notice
+// period never starts without a notice. It returns the number of histories warned.
+func (ru *retentionUseCase) sendWarnings(warnings map[bson.ObjectID]*retentionWarning) int {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	historyLink := fmt.Sprintf("%s/en/dashboard", ru.env.FrontEndURL)
+	warned := 0
+	for userID, warning := range warnings {
+		user, err := ru.userBaseRepository.FindOne(ctx, bson.D{{Key: "_id", Value: userID}})
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			slog.Warn("Retention warning recipient lookup failed",
+				slog.String("user_id", userID.Hex()),
+				slog.String("error", err.Error()))
+			continue
+		}
+
+		// organization histories of removed uploaders have no one to notify, they only wait out the notice period
+		if user != nil {
+			if _, err = ru.resendUseCase.SendRetentionWarningEmail(user.Email, len(warning.histories), warning.deleteAt, historyLink); err != nil {
+				slog.Warn("Retention warning email could not be sent",
+					slog.String("user_id", userID.Hex()),
+					slog.Int("count", len(warning.histories)),
+					slog.String("error", err.Error()))
+				continue
+			}
+		}
+
+		now := time.Now().UTC()
+		for historyID, due := range warning.histories {
+			update := bson.D{{Key: "$set", Value: bson.D{
+				{Key: "retention_warned_at", Value: now},
+				{Key: "retention_due_at", Value: due},
+			}}}
+			if err = ru.srtHistoryBaseRepository.UpdateOne(ctx, bson.D{{Key: "_id", Value: historyID}}, update, nil); err != nil {
+				slog.Warn("Retention warning could not be recorded",
+					slog.String("history_id", historyID.Hex()),
+					slog.String("error", err.Error()))
+				continue
+			}
+			warned++
+		}
+	}
+
+	return warned
+}
+
+// retentionCutoff returns the creation time before which a history is within the warning
+// period of a days-long retention limit.
+func retentionCutoff(now time.Time, days int) time.Time {
+	return now.AddDate(0, 0, -days).Add(domain.RetentionWarningPeriod)
+}
+
+func minPositive(current, value int) int {
+	if value <= 0 {
+		return current
+	}
+	if current == 0 {
+		return value
+	}
+	return min(current, value)
+}
+
+// earliest returns the earlier of two times, ignoring zero values.
+func earliest(a, b time.Time) time.Time {
+	if a.IsZero() || (!b.IsZero() && b.Before(a)) {
+		return b
+	}
+	return a
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
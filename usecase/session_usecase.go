@@ -6,6 +6,8 @@ import (
 	"github.com/kwa0x2/SmartSRT-Backend/domain/types"
 	"github.com/kwa0x2/SmartSRT-Backend/utils"
 	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"sort"
 	"time"
 )
 
@@ -21,7 +23,7 @@ func NewSessionUseCase(sessionRepository domain.SessionRepository, userBaseRepos
 	}
 }
 
-func (su *sessionUseCase) CreateSessionAndUpdateLastLogin(userID bson.ObjectID, plan types.PlanType, email string) (string, error) {
+func (su *sessionUseCase) CreateSessionAndUpdateLastLogin(userID bson.ObjectID, plan types.PlanType, email string, client domain.SessionClient) (string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -30,13 +32,19 @@ func (su *sessionUseCase) CreateSessionAndUpdateLastLogin(userID bson.ObjectID,
 		return "", err
 	}
 
-	TTL := time.Now().UTC().Add(3 * 24 * time.Hour).Unix() // 3 day
+	now := time.Now().UTC()
+	TTL := now.Add(3 * 24 * time.Hour).Unix() // 3 day
 
 	session := domain.Session{
-		SessionID: sessionID,
-		UserID:    userID.Hex(),
-		Plan:      plan,
-		TTL:       int(TTL),
+		SessionID:  sessionID,
+		UserID:     userID.Hex(),
+		Plan:       plan,
+		TTL:        int(TTL),
+		Device:     utils.DescribeDevice(client.UserAgent),
+		UserAgent:  client.UserAgent,
+		IPAddress:  client.IPAddress,
+		CreatedAt:  now.Unix(),
+		LastSeenAt: now.Unix(),
 	}
 
 	if err = su.sessionRepository.CreateSession(ctx, session); err != nil {
@@ -69,7 +77,7 @@ func (su *sessionUseCase) ValidateSession(sessionID string) (*domain.Session, er
 
 	newTTL := time.Now().UTC().Add(24 * time.Hour).Unix()
 
-	if err = su.sessionRepository.UpdateSessionTTL(ctx, sessionID, int(newTTL)); err != nil {
+	if err = su.sessionRepository.UpdateSessionActivity(ctx, sessionID, int(newTTL), currentTimeUnix); err != nil {
 		return nil, err
 	}
 
@@ -86,3 +94,84 @@ func (su *sessionUseCase) DeleteSession(sessionID string) error {
 
 	return nil
 }
+
+func (su *sessionUseCase) ListSessions(userID bson.ObjectID, currentSessionID string) ([]*domain.Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	sessions, err := su.activeSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, session := range sessions {
+		session.Current = session.SessionID == currentSessionID
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeenAt > sessions[j].LastSeenAt
+	})
+
+	return sessions, nil
+}
+
+func (su *sessionUseCase) RevokeSession(userID bson.ObjectID, id string) (*domain.Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	sessions, err := su.activeSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, session := range sessions {
+		if session.ID == id {
+			return session, su.sessionRepository.DeleteSession(ctx, session.SessionID)
+		}
+	}
+
+	return nil, mongo.ErrNoDocuments
+}
+
+func (su *sessionUseCase) RevokeOtherSessions(userID bson.ObjectID, currentSessionID string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	sessions, err := su.sessionRepository.FindSessionsByUserID(ctx, userID.Hex())
+	if err != nil {
+		return 0, err
+	}
+
+	revoked := 0
+	for _, session := range sessions {
+		if session.SessionID == currentSessionID {
+			continue
+		}
+		if err = su.sessionRepository.DeleteSession(ctx, session.SessionID); err != nil {
+			return revoked, err
+		}
+		revoked++
+	}
+
+	return revoked, nil
+}
+
+// activeSessions leaves out the sessions that expired but are still waiting for DynamoDB to
+// remove them, and sets their public IDs.
+func (su *sessionUseCase) activeSessions(ctx context.Context, userID bson.ObjectID) ([]*domain.Session, error) {
+	sessions, err := su.sessionRepository.FindSessionsByUserID(ctx, userID.Hex())
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC().Unix()
+	active := make([]*domain.Session, 0, len(sessions))
+	for _, session := range sessions {
+		if int64(session.TTL) < now {
+			continue
+		}
+		session.ID = utils.HashToken(session.SessionID)
+		active = append(active, session)
+	}
+
+	return active, nil
+}
@@ -2,56 +2,63 @@ package usecase
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
 
 	"github.com/kwa0x2/SmartSRT-Backend/domain"
+	"github.com/kwa0x2/SmartSRT-Backend/domain/types"
 	"github.com/kwa0x2/SmartSRT-Backend/utils"
 	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
 	"go.mongodb.org/mongo-driver/v2/mongo/writeconcern"
 )
 
 type srtUseCase struct {
-	srtRepository     domain.SRTRepository
-	usageUseCase      domain.UsageUseCase
-	srtBaseRepository domain.BaseRepository[*domain.SRTHistory]
-	logger            *slog.Logger
+	srtRepository        domain.SRTRepository
+	sandboxSRTRepository domain.SRTRepository
+	usageUseCase         domain.UsageUseCase
+	storageUseCase       domain.StorageUseCase
+	srtBaseRepository    domain.BaseRepository[*domain.SRTHistory]
+	logger               *slog.Logger
 }
 
-func NewSRTUseCase(srtRepository domain.SRTRepository, usageUseCase domain.UsageUseCase, srtBaseRepository domain.BaseRepository[*domain.SRTHistory]) domain.SRTUseCase {
+func NewSRTUseCase(srtRepository, sandboxSRTRepository domain.SRTRepository, usageUseCase domain.UsageUseCase, storageUseCase domain.StorageUseCase, srtBaseRepository domain.BaseRepository[*domain.SRTHistory]) domain.SRTUseCase {
 	return &srtUseCase{
-		srtRepository:     srtRepository,
-		usageUseCase:      usageUseCase,
-		srtBaseRepository: srtBaseRepository,
-		logger:            slog.Default(),
+		srtRepository:        srtRepository,
+		sandboxSRTRepository: sandboxSRTRepository,
+		usageUseCase:         usageUseCase,
+		storageUseCase:       storageUseCase,
+		srtBaseRepository:    srtBaseRepository,
+		logger:               slog.Default(),
 	}
 }
 
-func (su *srtUseCase) UploadFileAndConvertToSRT(request domain.FileConversionRequest) (*domain.LambdaResponse, error) {
-	canUpload, err := su.usageUseCase.CheckUsageLimit(request.UserID, request.FileDuration)
-	if err != nil {
-		su.logger.Error("SRT conversion: usage limit check failed",
-			slog.String("user_id", request.UserID.Hex()),
-			slog.String("file_name", request.FileName),
-			slog.Float64("file_duration", request.FileDuration),
-			slog.String("error", err.Error()),
-		)
+// UploadFileAndConvertToSRT runs a queued conversion. Sandbox requests go through the same
+// steps against the fake backend and hold no usage reservation, so nothing is charged.
+func (su *srtUseCase) UploadFileAndConvertToSRT(request domain.FileConversionRequest) (*domain.SRTHistory, error) {
+	srtRepository := su.srtRepository
+	if request.Sandbox {
+		srtRepository = su.sandboxSRTRepository
+		// the job may have waited in the queue, so the reservation is held for the processing from here on
+	} else if err := su.usageUseCase.ExtendReservation(request.FileID, request.FileDuration); err != nil {
+		if !errors.Is(err, utils.ErrReservationNotActive) {
+			su.logger.Error("SRT conversion: usage reservation extension failed",
+				slog.String("user_id", request.UserID.Hex()),
+				slog.String("file_id", request.FileID),
+				slog.String("error", err.Error()),
+			)
+		}
 		return nil, err
 	}
 
-	if !canUpload {
-		su.logger.Warn("SRT conversion: usage limit exceeded",
-			slog.String("user_id", request.UserID.Hex()),
-			slog.String("file_name", request.FileName),
-			slog.Float64("file_duration", request.FileDuration),
-		)
-		return nil, utils.ErrLimitReached
-	}
+	request.ReportProgress(types.JobUploading)
 
-	objectKey, err := su.srtRepository.UploadFileToS3(request)
+	objectKey, err := srtRepository.UploadFileToS3(request)
 	if err != nil {
 		su.logger.Error("SRT conversion: S3 upload failed",
 			slog.String("user_id", request.UserID.Hex()),
@@ -59,12 +66,15 @@ func (su *srtUseCase) UploadFileAndConvertToSRT(request domain.FileConversionReq
 			slog.Int64("file_size", request.FileHeader.Size),
 			slog.String("error", err.Error()),
 		)
+		su.releaseReservation(request)
 		return nil, err
 	}
 
 	request.FileName = objectKey
 
-	response, err := su.srtRepository.TriggerLambdaFunc(request)
+	request.ReportProgress(types.JobTranscribing)
+
+	response, err := srtRepository.TriggerLambdaFunc(request)
 	if err != nil {
 		su.logger.Error("SRT conversion: Lambda trigger failed",
 			slog.String("user_id", request.UserID.Hex()),
@@ -72,9 +82,29 @@ func (su *srtUseCase) UploadFileAndConvertToSRT(request domain.FileConversionReq
 			slog.String("s3_object_key", objectKey),
 			slog.String("error", err.Error()),
 		)
+		su.releaseReservation(request)
 		return nil, err
 	}
 
+	srtObjectKey, err := utils.ObjectKeyFromURL(response.Body.SRTURL)
+	if err != nil {
+		su.logger.Error("SRT conversion: SRT object key parsing failed",
+			slog.String("user_id", request.UserID.Hex()),
+			slog.String("srt_url", response.Body.SRTURL),
+			slog.String("error", err.Error()),
+		)
+		su.releaseReservation(request)
+		return nil, err
+	}
+
+	// the sandbox backend never uploads the source media
+	var mediaObjectKey string
+	if !request.Sandbox {
+		mediaObjectKey = domain.MediaObjectKey(request.UserID, objectKey)
+	}
+
+	request.ReportProgress(types.JobSaving)
+
 	wc := writeconcern.Majority()
 	txnOptions := options.Transaction().SetWriteConcern(wc)
 
@@ -88,29 +118,38 @@ func (su *srtUseCase) UploadFileAndConvertToSRT(request domain.FileConversionReq
 			slog.String("file_name", request.FileName),
 			slog.String("error", err.Error()),
 		)
+		su.releaseReservation(request)
 		return nil, err
 	}
 	defer session.EndSession(ctx)
 
+	var srtHistory *domain.SRTHistory
 	_, err = session.WithTransaction(ctx, func(txCtx context.Context) (interface{}, error) {
-		if err = su.usageUseCase.UpdateUsage(txCtx, request.UserID, request.FileDuration); err != nil {
-			su.logger.Error("SRT conversion: usage update failed",
-				slog.String("user_id", request.UserID.Hex()),
-				slog.Float64("file_duration", request.FileDuration),
-				slog.String("error", err.Error()),
-			)
-			return nil, err
+		// nothing was reserved for the sandbox, only the history is written
+		if !request.Sandbox {
+			if err = su.usageUseCase.CommitReservation(txCtx, request.FileID); err != nil {
+				su.logger.Error("SRT conversion: usage reservation commit failed",
+					slog.String("user_id", request.UserID.Hex()),
+					slog.Float64("file_duration", request.FileDuration),
+					slog.String("error", err.Error()),
+				)
+				return nil, err
+			}
 		}
 
 		fileType := filepath.Ext(request.FileHeader.Filename)
-		srtHistory := &domain.SRTHistory{
+		srtHistory = &domain.SRTHistory{
 			UserID:              request.UserID,
+			OrgID:               request.OrgID,
 			FileName:            strings.Replace(request.FileHeader.Filename, fileType, ".srt", 1),
-			S3URL:               response.Body.SRTURL,
+			ObjectKey:           srtObjectKey,
+			MediaObjectKey:      mediaObjectKey,
+			MediaFileName:       request.FileHeader.Filename,
 			Duration:            request.FileDuration,
 			WordsPerLine:        request.WordsPerLine,
 			Punctuation:         request.Punctuation,
 			ConsiderPunctuation: request.ConsiderPunctuation,
+			Sandbox:             request.Sandbox,
 			CreatedAt:           time.Now().UTC(),
 			UpdatedAt:           time.Now().UTC(),
 		}
@@ -128,7 +167,7 @@ func (su *srtUseCase) UploadFileAndConvertToSRT(request domain.FileConversionReq
 			su.logger.Error("SRT conversion: SRT history save failed",
 				slog.String("user_id", request.UserID.Hex()),
 				slog.String("file_name", srtHistory.FileName),
-				slog.String("s3_url", response.Body.SRTURL),
+				slog.String("s3_object_key", srtObjectKey),
 				slog.String("error", err.Error()),
 			)
 			return nil, err
@@ -138,6 +177,7 @@ func (su *srtUseCase) UploadFileAndConvertToSRT(request domain.FileConversionReq
 	}, txnOptions)
 
 	if err != nil {
+		su.releaseReservation(request)
 		if abortErr := session.AbortTransaction(ctx); abortErr != nil {
 			su.logger.Error("SRT conversion: transaction abort failed",
 				slog.String("user_id", request.UserID.Hex()),
@@ -155,19 +195,220 @@ func (su *srtUseCase) UploadFileAndConvertToSRT(request domain.FileConversionReq
 		return nil, err
 	}
 
-	return response, nil
+	return srtHistory, nil
 }
 
-func (su *srtUseCase) FindHistoriesByUserID(userID bson.ObjectID) ([]*domain.SRTHistory, error) {
+func (su *srtUseCase) releaseReservation(request domain.FileConversionRequest) {
+	if request.Sandbox {
+		return
+	}
+	if err := su.usageUseCase.ReleaseReservation(request.FileID, types.ReleaseFailed); err != nil && !errors.Is(err, utils.ErrReservationNotActive) {
+		su.logger.Error("SRT conversion: usage reservation release failed",
+			slog.String("user_id", request.UserID.Hex()),
+			slog.String("file_id", request.FileID),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// historyOwnerFilter matches the history visible in the account: the organization's shared
+// history when orgID is set, otherwise the user's personal conversions. Sandbox and live
+// conversions are never mixed.
+func historyOwnerFilter(userID bson.ObjectID, orgID *bson.ObjectID, sandbox bool) bson.D {
+	filter := bson.D{
+		{Key: "user_id", Value: userID},
+		{Key: "org_id", Value: bson.D{{Key: "$exists", Value: false}}},
+	}
+	if orgID != nil {
+		filter = bson.D{{Key: "org_id", Value: *orgID}}
+	}
+	if sandbox {
+		return append(filter, bson.E{Key: "sandbox", Value: true})
+	}
+	return append(filter, bson.E{Key: "sandbox", Value: bson.D{{Key: "$ne", Value: true}}})
+}
+
+func (su *srtUseCase) FindHistory(userID bson.ObjectID, orgID *bson.ObjectID, sandbox bool, id bson.ObjectID) (*domain.SRTHistory, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
-	filter := bson.D{{Key: "user_id", Value: userID}}
+	filter := append(bson.D{{Key: "_id", Value: id}}, historyOwnerFilter(userID, orgID, sandbox)...)
+	return su.srtBaseRepository.FindOne(ctx, filter)
+}
+
+// DeleteHistories soft-deletes the account's entries among ids and queues their subtitles
+// and media for removal from S3 in the same transaction. Unknown ids are ignored.
+func (su *srtUseCase) DeleteHistories(userID bson.ObjectID, orgID *bson.ObjectID, sandbox bool, ids []bson.ObjectID) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	session, err := su.srtBaseRepository.GetDatabase().Client().StartSession()
+	if err != nil {
+		return 0, err
+	}
+	defer session.EndSession(ctx)
+
+	txnOptions := options.Transaction().SetWriteConcern(writeconcern.Majority())
+
+	deleted, err := session.WithTransaction(ctx, func(txCtx context.Context) (interface{}, error) {
+		filter := append(bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}}, historyOwnerFilter(userID, orgID, sandbox)...)
+		histories, err := su.srtBaseRepository.Find(txCtx, filter, nil)
+		if err != nil {
+			return 0, err
+		}
+
+		for _, history := range histories {
+			if err = su.storageUseCase.QueueDeletion(txCtx, []string{history.ObjectKey, history.MediaObjectKey}, types.DeletionHistoryDeleted, &history.ID); err != nil {
+				return 0, err
+			}
+			if err = su.srtBaseRepository.SoftDelete(txCtx, bson.D{{Key: "_id", Value: history.ID}}); err != nil {
+				return 0, err
+			}
+		}
+
+		return len(histories), nil
+	}, txnOptions)
+	if err != nil {
+		return 0, err
+	}
+
+	return deleted.(int), nil
+}
+
+func (su *srtUseCase) SetPinned(userID bson.ObjectID, orgID *bson.ObjectID, sandbox bool, id bson.ObjectID, pinned bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := append(bson.D{{Key: "_id", Value: id}}, historyOwnerFilter(userID, orgID, sandbox)...)
+	if _, err := su.srtBaseRepository.FindOne(ctx, filter); err != nil {
+		return err
+	}
+
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "pinned", Value: pinned}}}}
+	if pinned {
+		// an earlier warning must not shorten the notice once the history is unpinned again
+		update = append(update, bson.E{Key: "$unset", Value: bson.D{
+			{Key: "retention_warned_at", Value: ""},
+			{Key: "retention_due_at", Value: ""},
+		}})
+	}
+	return su.srtBaseRepository.UpdateOne(ctx, bson.D{{Key: "_id", Value: id}}, update, nil)
+}
+
+// CreateDownloadURL presigns a link to the subtitles or the source media of a conversion.
+func (su *srtUseCase) CreateDownloadURL(history *domain.SRTHistory, file types.DownloadFile, ttl time.Duration) (string, error) {
+	if file == types.DownloadMedia {
+		if history.MediaObjectKey == "" || history.MediaDeletedAt != nil {
+			return "", mongo.ErrNoDocuments
+		}
+		return su.srtRepository.PresignDownload(history.MediaObjectKey, history.MediaFileName, ttl)
+	}
+	return su.srtRepository.PresignDownload(history.ObjectKey, history.FileName, ttl)
+}
+
+// FindHistories pages through the account's history, see historyOwnerFilter. Pages are keyed
+// on the sort field and _id, so they stay stable while new conversions are added.
+func (su *srtUseCase) FindHistories(userID bson.ObjectID, orgID *bson.ObjectID, sandbox bool, query domain.SRTHistoryQuery) (*domain.SRTHistoryPage, error) {
+	if !query.Sort.IsValid() {
+		query.Sort = types.SortNewest
+	}
+	if query.Limit <= 0 || query.Limit > domain.SRTHistoryMaxPageSize {
+		query.Limit = domain.SRTHistoryDefaultPageSize
+	}
+
+	filter := historyOwnerFilter(userID, orgID, sandbox)
+
+	createdAt := bson.D{}
+	if query.From != nil {
+		createdAt = append(createdAt, bson.E{Key: "$gte", Value: *query.From})
+	}
+	if query.To != nil {
+		createdAt = append(createdAt, bson.E{Key: "$lt", Value: *query.To})
+	}
+	if len(createdAt) > 0 {
+		filter = append(filter, bson.E{Key: "created_at", Value: createdAt})
+	}
+
+	duration := bson.D{}
+	if query.MinDuration != nil {
+		duration = append(duration, bson.E{Key: "$gte", Value: *query.MinDuration})
+	}
+	if query.MaxDuration != nil {
+		duration = append(duration, bson.E{Key: "$lte", Value: *query.MaxDuration})
+	}
+	if len(duration) > 0 {
+		filter = append(filter, bson.E{Key: "duration", Value: duration})
+	}
+
+	if query.WordsPerLine != nil {
+		filter = append(filter, bson.E{Key: "words_per_line", Value: *query.WordsPerLine})
+	}
+	if query.Punctuation != nil {
+		filter = append(filter, bson.E{Key: "punctuation", Value: *query.Punctuation})
+	}
+	if query.ConsiderPunctuation != nil {
+		filter = append(filter, bson.E{Key: "consider_punctuation", Value: *query.ConsiderPunctuation})
+	}
+	if query.FileName != "" {
+		filter = append(filter, bson.E{Key: "file_name", Value: bson.Regex{Pattern: regexp.QuoteMeta(query.FileName), Options: "i"}})
+	}
+
+	field, direction := query.Sort.Field(), query.Sort.Direction()
+	if query.Cursor != "" {
+		valueType := bson.TypeDateTime
+		switch field {
+		case "duration":
+			valueType = bson.TypeDouble
+		case "file_name":
+			valueType = bson.TypeString
+		}
+
+		value, id, err := utils.DecodeCursor(query.Cursor, string(query.Sort), valueType)
+		if err != nil {
+			return nil, err
+		}
+
+		op := "$lt"
+		if direction > 0 {
+			op = "$gt"
+		}
+		filter = append(filter, bson.E{Key: "$or", Value: bson.A{
+			bson.D{{Key: field, Value: bson.D{{Key: op, Value: value}}}},
+			bson.D{{Key: field, Value: value}, {Key: "_id", Value: bson.D{{Key: op, Value: id}}}},
+		}})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: field, Value: direction}, {Key: "_id", Value: direction}}).
+		SetLimit(int64(query.Limit) + 1)
 	result, err := su.srtBaseRepository.Find(ctx, filter, opts)
 	if err != nil {
 		return nil, err
 	}
 
-	return result, err
+	page := &domain.SRTHistoryPage{Items: result}
+	if len(result) > query.Limit {
+		page.Items = result[:query.Limit]
+		last := page.Items[query.Limit-1]
+
+		var value any = last.CreatedAt
+		switch field {
+		case "duration":
+			value = last.Duration
+		case "file_name":
+			value = last.FileName
+		}
+
+		if page.NextCursor, err = utils.EncodeCursor(string(query.Sort), value, last.ID); err != nil {
+			return nil, err
+		}
+	}
+	if page.Items == nil {
+		page.Items = []*domain.SRTHistory{}
+	}
+
+	return page, nil
 }
@@ -0,0 +1,280 @@
+package usecase
+
+import (
+	"context"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/kwa0x2/SmartSRT-Backend/domain"
+	"github.com/kwa0x2/SmartSRT-Backend/domain/types"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+type storageUseCase struct {
+	storageRepository        domain.StorageRepository
+	deletionBaseRepository   domain.BaseRepository[*domain.StorageDeletion]
+	srtHistoryBaseRepository domain.BaseRepository[*domain.SRTHistory]
+	erasureBaseRepository    domain.BaseRepository[*domain.Erasure]
+}
+
+func NewStorageUseCase(storageRepository domain.StorageRepository, deletionBaseRepository domain.BaseRepository[*domain.StorageDeletion], srtHistoryBaseRepository domain.BaseRepository[*domain.SRTHistory], erasureBaseRepository domain.BaseRepository[*domain.Erasure]) domain.StorageUseCase {
+	return &storageUseCase{
+		storageRepository:        storageRepository,
+		deletionBaseRepository:   deletionBaseRepository,
+		srtHistoryBaseRepository: srtHistoryBaseRepository,
+		erasureBaseRepository:    erasureBaseRepository,
+	}
+}
+
+// QueueDeletion records the keys for removal. Pass the transaction context to queue them
+// atomically with the change that made them obsolete. Keys already queued are skipped.
+func (su *storageUseCase) QueueDeletion(ctx context.Context, keys []string, reason types.StorageDeletionReason, historyID *bson.ObjectID) error {
+	now := time.Now().UTC()
+
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+
+		pending := bson.D{
+			{Key: "object_key", Value: key},
+			{Key: "completed_at", Value: bson.D{{Key: "$exists", Value: false}}},
+		}
+		existing, err := su.deletionBaseRepository.Find(ctx, pending, options.Find().SetLimit(1))
+		if err != nil {
+			return err
+		}
+		if len(existing) > 0 {
+			continue
+		}
+
+		deletion := &domain.StorageDeletion{
+			ObjectKey:     key,
+			Reason:        reason,
+			HistoryID:     historyID,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}
+		if err = deletion.Validate(); err != nil {
+			return err
+		}
+		if err = su.deletionBaseRepository.Create(ctx, deletion); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ProcessPendingDeletions removes a batch of due objects from S3. Failed keys are retried
+// with an exponential backoff capped at StorageDeletionMaxBackoff.
+func (su *storageUseCase) ProcessPendingDeletions() (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	now := time.Now().UTC()
+	filter := bson.D{
+		{Key: "completed_at", Value: bson.D{{Key: "$exists", Value: false}}},
+		{Key: "next_attempt_at", Value: bson.D{{Key: "$lte", Value: now}}},
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).
+		SetLimit(domain.StorageDeletionBatchSize)
+
+	due, err := su.deletionBaseRepository.Find(ctx, filter, opts)
+	if err != nil || len(due) == 0 {
+		return 0, err
+	}
+
+	keys := make([]string, 0, len(due))
+	for _, deletion := range due {
+		keys = append(keys, deletion.ObjectKey)
+	}
+
+	failed, err := su.storageRepository.DeleteObjects(keys)
+	if err != nil {
+		failed = make(map[string]error, len(keys))
+		for _, key := range keys {
+			failed[key] = err
+		}
+	}
+
+	deleted := 0
+	for _, deletion := range due {
+		var set bson.D
+		if deleteErr, ok := failed[deletion.ObjectKey]; ok {
+			backoff := min(time.Minute<<min(deletion.Attempts, 10), domain.StorageDeletionMaxBackoff)
+			set = bson.D{
+				{Key: "attempts", Value: deletion.Attempts + 1},
+				{Key: "last_error", Value: deleteErr.Error()},
+				{Key: "next_attempt_at", Value: now.Add(backoff)},
+			}
+		} else {
+			set = bson.D{{Key: "completed_at", Value: now}}
+			deleted++
+		}
+
+		update := bson.D{{Key: "$set", Value: set}}
+		if err = su.deletionBaseRepository.UpdateOne(ctx, bson.D{{Key: "_id", Value: deletion.ID}}, update, nil); err != nil {
+			return deleted, err
+		}
+	}
+
+	return deleted, nil
+}
+
+// ReconcileOrphans queues objects that no live history references anymore, such as the
+// files of conversions that failed after the upload. Objects of deleted accounts are kept
+// until their erasure, so the account can still be restored with its files.
+func (su *storageUseCase) ReconcileOrphans() (int, error) {
+	cutoff := time.Now().UTC().Add(-domain.StorageOrphanGracePeriod)
+	legacyOwners := make(map[string]bool)
+	pendingOwners := make(map[string]bool)
+	queued := 0
+
+	for _, prefix := range domain.StoragePrefixes {
+		err := su.storageRepository.ListObjects(prefix, func(page []domain.StorageObject) error {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			candidates := make([]string, 0, len(page))
+			for _, object := range page {
+				if object.LastModified.Before(cutoff) {
+					candidates = append(candidates, object.Key)
+				}
+			}
+			if len(candidates) == 0 {
+				return nil
+			}
+
+			referenced, err := su.findReferencedKeys(ctx, candidates)
+			if err != nil {
+				return err
+			}
+
+			for _, key := range candidates {
+				if referenced[key] {
+					continue
+				}
+
+				keep, err := su.mayBeLegacyMedia(ctx, key, legacyOwners)
+				if err == nil && !keep {
+					keep, err = su.isPendingErasure(ctx, key, pendingOwners)
+				}
+				if err != nil {
+					return err
+				}
+				if keep {
+					continue
+				}
+
+				if err = su.QueueDeletion(ctx, []string{key}, types.DeletionOrphan, nil); err != nil {
+					return err
+				}
+				queued++
+			}
+
+			return nil
+		})
+		if err != nil {
+			return queued, err
+		}
+	}
+
+	return queued, nil
+}
+
+func (su *storageUseCase) findReferencedKeys(ctx context.Context, keys []string) (map[string]bool, error) {
+	filter := bson.D{{Key: "$or", Value: bson.A{
+		bson.D{{Key: "object_key", Value: bson.D{{Key: "$in", Value: keys}}}},
+		bson.D{{Key: "media_object_key", Value: bson.D{{Key: "$in", Value: keys}}}},
+	}}}
+	opts := options.Find().SetProjection(bson.D{{Key: "object_key", Value: 1}, {Key: "media_object_key", Value: 1}})
+
+	histories, err := su.srtHistoryBaseRepository.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	referenced := make(map[string]bool, len(histories)*2)
+	for _, history := range histories {
+		referenced[history.ObjectKey] = true
+		referenced[history.MediaObjectKey] = true
+	}
+	return referenced, nil
+}
+
+// mayBeLegacyMedia reports whether key could be the source media of a history written before
+// media keys were recorded. Such media is kept while its owner still has live legacy entries.
+func (su *storageUseCase) mayBeLegacyMedia(ctx context.Context, key string, legacyOwners map[string]bool) (bool, error) {
+	parts := strings.SplitN(key, "/", 3)
+	if len(parts) != 3 || parts[0] != "files" || path.Ext(key) == ".srt" {
+		return false, nil
+	}
+
+	if legacy, ok := legacyOwners[parts[1]]; ok {
+		return legacy, nil
+	}
+
+	userID, err := bson.ObjectIDFromHex(parts[1])
+	if err != nil {
+		return false, nil
+	}
+
+	filter := bson.D{
+		{Key: "user_id", Value: userID},
+		{Key: "media_object_key", Value: bson.D{{Key: "$exists", Value: false}}},
+		{Key: "sandbox", Value: bson.D{{Key: "$ne", Value: true}}},
+	}
+	legacy, err := su.srtHistoryBaseRepository.Find(ctx, filter, options.Find().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+
+	legacyOwners[parts[1]] = len(legacy) > 0
+	return len(legacy) > 0, nil
+}
+
+// isPendingErasure reports whether key belongs to a deleted account that can still be restored.
+func (su *storageUseCase) isPendingErasure(ctx context.Context, key string, pendingOwners map[string]bool) (bool, error) {
+	owner, ok := objectOwner(key)
+	if !ok {
+		return false, nil
+	}
+
+	if pending, ok := pendingOwners[owner]; ok {
+		return pending, nil
+	}
+
+	userID, err := bson.ObjectIDFromHex(owner)
+	if err != nil {
+		return false, nil
+	}
+
+	filter := bson.D{
+		{Key: "user_id", Value: userID},
+		{Key: "status", Value: types.ErasureScheduled},
+	}
+	pending, err := su.erasureBaseRepository.Find(ctx, filter, options.Find().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+
+	pendingOwners[owner] = len(pending) > 0
+	return len(pending) > 0, nil
+}
+
+// objectOwner returns the hex user ID of files/<user>/... and sandbox/srts/<user>/... keys.
+func objectOwner(key string) (string, bool) {
+	parts := strings.Split(key, "/")
+	switch {
+	case len(parts) >= 3 && parts[0] == "files":
+		return parts[1], true
+	case len(parts) >= 4 && parts[0] == "sandbox" && parts[1] == "srts":
+		return parts[2], true
+	}
+	return "", false
+}
@@ -7,7 +7,6 @@ import (
 
 	"github.com/kwa0x2/SmartSRT-Backend/config"
 	"github.com/kwa0x2/SmartSRT-Backend/domain"
-	"github.com/kwa0x2/SmartSRT-Backend/domain/types"
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
 	"go.mongodb.org/mongo-driver/v2/mongo/writeconcern"
@@ -17,19 +16,28 @@ type subscriptionUseCase struct {
 	env                 *config.Env
 	subscriptionBaseRepository domain.BaseRepository[*domain.Subscription]
 	userBaseRepository         domain.BaseRepository[*domain.User]
-	usageBaseRepository        domain.BaseRepository[*domain.Usage]
+	orgBaseRepository          domain.BaseRepository[*domain.Organization]
+	usageUseCase               domain.UsageUseCase
+	planUseCase                domain.PlanUseCase
 }
 
-func NewSubscriptionUseCase(env *config.Env ,subscriptionBaseRepository domain.BaseRepository[*domain.Subscription], userBaseRepository domain.BaseRepository[*domain.User], usageBaseRepository domain.BaseRepository[*domain.Usage]) domain.SubscriptionUseCase {
+func NewSubscriptionUseCase(env *config.Env ,subscriptionBaseRepository domain.BaseRepository[*domain.Subscription], userBaseRepository domain.BaseRepository[*domain.User], orgBaseRepository domain.BaseRepository[*domain.Organization], usageUseCase domain.UsageUseCase, planUseCase domain.PlanUseCase) domain.SubscriptionUseCase {
 	return &subscriptionUseCase{
 		env: env,
 		subscriptionBaseRepository: subscriptionBaseRepository,
 		userBaseRepository:         userBaseRepository,
-		usageBaseRepository:        usageBaseRepository,
+		orgBaseRepository:          orgBaseRepository,
+		usageUseCase:               usageUseCase,
+		planUseCase:                planUseCase,
 	}
 }
 
 func (sc *subscriptionUseCase) Create(subscription domain.Subscription) error {
+	plan, err := sc.planUseCase.FindByPriceID(subscription.PriceID)
+	if err != nil {
+		return err
+	}
+
 	wc := writeconcern.Majority()
 	txnOptions := options.Transaction().SetWriteConcern(wc)
 
@@ -51,22 +59,22 @@ func (sc *subscriptionUseCase) Create(subscription domain.Subscription) error {
 			return nil, err
 		}
 
-		filter := bson.D{{Key: "user_id", Value: subscription.UserID}}
+		billingPeriod := subscription.CurrentBillingPeriod
+		if err = sc.usageUseCase.StartNewPeriod(txCtx, subscription.UserID, plan.Name, billingPeriod.StartsAt, billingPeriod.EndsAt); err != nil {
+			return nil, err
+		}
+
+		// the subscription belongs to either a user or an organization, only one of them matches
+		filter := bson.D{{Key: "_id", Value: subscription.UserID}}
 		update := bson.D{{Key: "$set", Value: bson.D{
-			{Key: "usage_limit", Value: types.GetMonthlyLimit(types.Pro, sc.env)},
-			{Key: "monthly_usage", Value: 0},
+			{Key: "plan", Value: plan.Name},
 		}}}
 
-		if err = sc.usageBaseRepository.UpdateOne(txCtx, filter, update, nil); err != nil {
+		if err = sc.userBaseRepository.UpdateOne(txCtx, filter, update, nil); err != nil {
 			return nil, err
 		}
 
-		filter = bson.D{{Key: "_id", Value: subscription.UserID}}
-		update = bson.D{{Key: "$set", Value: bson.D{
-			{Key: "plan", Value: types.Pro},
-		}}}
-
-		return nil, sc.userBaseRepository.UpdateOne(txCtx, filter, update, nil)
+		return nil, sc.orgBaseRepository.UpdateOne(txCtx, filter, update, nil)
 	}, txnOptions)
 
 	return err
@@ -94,15 +102,39 @@ func (sc *subscriptionUseCase) UpdateStatusBySubsID(subscriptionID, status strin
 }
 
 func (sc *subscriptionUseCase) UpdateCurrentBillingPeriodBySubsID(subscriptionID string, billingPeriod domain.BillingPeriod) error {
+	wc := writeconcern.Majority()
+	txnOptions := options.Transaction().SetWriteConcern(wc)
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	filter := bson.D{{Key: "subscription_id", Value: subscriptionID}}
-	update := bson.D{{Key: "$set", Value: bson.D{
-		{Key: "current_billing_period", Value: billingPeriod},
-	}}}
+	session, err := sc.subscriptionBaseRepository.GetDatabase().Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
 
-	return sc.subscriptionBaseRepository.UpdateOne(ctx, filter, update, nil)
+	_, err = session.WithTransaction(ctx, func(txCtx context.Context) (interface{}, error) {
+		filter := bson.D{{Key: "subscription_id", Value: subscriptionID}}
+		update := bson.D{{Key: "$set", Value: bson.D{
+			{Key: "current_billing_period", Value: billingPeriod},
+		}}}
+
+		subscription, err := sc.subscriptionBaseRepository.FindOneAndUpdate(txCtx, filter, update, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		plan, err := sc.planUseCase.FindByPriceID(subscription.PriceID)
+		if err != nil {
+			return nil, err
+		}
+
+		// a renewal opens a new usage period; StartNewPeriod ignores periods that are not newer
+		return nil, sc.usageUseCase.StartNewPeriod(txCtx, subscription.UserID, plan.Name, billingPeriod.StartsAt, billingPeriod.EndsAt)
+	}, txnOptions)
+
+	return err
 }
 
 func (sc *subscriptionUseCase) FindByUserID(userID bson.ObjectID) (*domain.Subscription, error) {
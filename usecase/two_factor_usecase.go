@@ -0,0 +1,304 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/kwa0x2/SmartSRT-Backend/domain"
+	"github.com/kwa0x2/SmartSRT-Backend/utils"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+type twoFactorUseCase struct {
+	userBaseRepository domain.BaseRepository[*domain.User]
+}
+
+func NewTwoFactorUseCase(userBaseRepository domain.BaseRepository[*domain.User]) domain.TwoFactorUseCase {
+	return &twoFactorUseCase{
+		userBaseRepository: userBaseRepository,
+	}
+}
+
+func (tu *twoFactorUseCase) BeginEnrollment(user *domain.User) (string, string, error) {
+	if user.TOTPEnabled {
+		return "", "", utils.ErrTwoFactorEnabled
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.D{{Key: "_id", Value: user.ID}, {Key: "totp_enabled", Value: bson.D{{Key: "$ne", Value: true}}}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "totp_pending_secret", Value: secret}}}}
+	if _, err = tu.userBaseRepository.FindOneAndUpdate(ctx, filter, update, nil); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return "", "", utils.ErrTwoFactorEnabled
+		}
+		return "", "", err
+	}
+
+	return secret, utils.TOTPURI(domain.TwoFactorIssuer, user.Email, secret), nil
+}
+
+func (tu *twoFactorUseCase) ConfirmEnrollment(userID bson.ObjectID, code string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := tu.userBaseRepository.FindOne(ctx, bson.D{{Key: "_id", Value: userID}})
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return nil, utils.ErrTwoFactorEnabled
+	}
+	if user.TOTPPendingSecret == "" {
+		return nil, utils.ErrTwoFactorNotSetUp
+	}
+
+	step, ok := utils.ValidateTOTP(user.TOTPPendingSecret, code, time.Now())
+	if !ok {
+		return nil, utils.ErrTwoFactorCodeInvalid
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	// the pending secret in the filter keeps a concurrent enrollment from being confirmed with this code
+	filter := bson.D{
+		{Key: "_id", Value: userID},
+		{Key: "totp_enabled", Value: bson.D{{Key: "$ne", Value: true}}},
+		{Key: "totp_pending_secret", Value: user.TOTPPendingSecret},
+	}
+	update := bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "totp_enabled", Value: true},
+			{Key: "totp_secret", Value: user.TOTPPendingSecret},
+			{Key: "totp_last_step", Value: step},
+			{Key: "recovery_code_hashes", Value: hashes},
+		}},
+		{Key: "$unset", Value: bson.D{{Key: "totp_pending_secret", Value: ""}}},
+	}
+	if _, err = tu.userBaseRepository.FindOneAndUpdate(ctx, filter, update, nil); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, utils.ErrTwoFactorNotSetUp
+		}
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// Verify writes to the users collection directly, the base repository leaves deleted users alone.
+func (tu *twoFactorUseCase) Verify(user *domain.User, code string) error {
+	if !user.TOTPEnabled {
+		return utils.ErrTwoFactorNotSetUp
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	users := tu.userBaseRepository.GetDatabase().Collection(domain.CollectionUser)
+
+	var filter, update bson.D
+	if step, ok := utils.ValidateTOTP(user.TOTPSecret, code, time.Now()); ok {
+		filter = bson.D{
+			{Key: "_id", Value: user.ID},
+			{Key: "totp_enabled", Value: true},
+			{Key: "totp_secret", Value: user.TOTPSecret},
+			{Key: "$or", Value: bson.A{
+				bson.D{{Key: "totp_last_step", Value: bson.D{{Key: "$lt", Value: step}}}},
+				bson.D{{Key: "totp_last_step", Value: bson.D{{Key: "$exists", Value: false}}}},
+			}},
+		}
+		update = bson.D{{Key: "$set", Value: bson.D{{Key: "totp_last_step", Value: step}}}}
+	} else {
+		hash := utils.HashToken(utils.NormalizeRecoveryCode(code))
+		filter = bson.D{
+			{Key: "_id", Value: user.ID},
+			{Key: "totp_enabled", Value: true},
+			{Key: "recovery_code_hashes", Value: hash},
+		}
+		update = bson.D{{Key: "$pull", Value: bson.D{{Key: "recovery_code_hashes", Value: hash}}}}
+	}
+
+	result, err := users.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return utils.ErrTwoFactorCodeInvalid
+	}
+
+	return nil
+}
+
+// CreateChallenge writes to the users collection directly, a deleted user signing in may be restored.
+func (tu *twoFactorUseCase) CreateChallenge(userID bson.ObjectID) (string, error) {
+	challenge, err := utils.GenerateSecret(32)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "two_factor_challenge_hash", Value: utils.HashToken(challenge)},
+		{Key: "two_factor_challenge_attempts", Value: 0},
+	}}}
+	users := tu.userBaseRepository.GetDatabase().Collection(domain.CollectionUser)
+	if _, err = users.UpdateOne(ctx, bson.D{{Key: "_id", Value: userID}}, update); err != nil {
+		return "", err
+	}
+
+	return challenge, nil
+}
+
+func (tu *twoFactorUseCase) VerifyChallenge(user *domain.User, challenge, code string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	users := tu.userBaseRepository.GetDatabase().Collection(domain.CollectionUser)
+	hash := utils.HashToken(challenge)
+	now := time.Now().UTC()
+
+	// the attempt is counted before the code is checked, so parallel guesses cannot exceed the limit
+	filter := bson.D{
+		{Key: "_id", Value: user.ID},
+		{Key: "two_factor_challenge_hash", Value: hash},
+		{Key: "two_factor_challenge_attempts", Value: bson.D{{Key: "$lt", Value: domain.TwoFactorMaxAttempts}}},
+		{Key: "$or", Value: bson.A{
+			bson.D{{Key: "two_factor_locked_until", Value: bson.D{{Key: "$exists", Value: false}}}},
+			bson.D{{Key: "two_factor_locked_until", Value: bson.D{{Key: "$lte", Value: now}}}},
+		}},
+	}
+	update := bson.D{{Key: "$inc", Value: bson.D{{Key: "two_factor_challenge_attempts", Value: 1}}}}
+	result, err := users.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		locked, err := users.CountDocuments(ctx, bson.D{
+			{Key: "_id", Value: user.ID},
+			{Key: "two_factor_locked_until", Value: bson.D{{Key: "$gt", Value: now}}},
+		})
+		if err != nil {
+			return err
+		}
+		if locked > 0 {
+			return utils.ErrTwoFactorLocked
+		}
+		return utils.ErrTwoFactorChallengeInvalid
+	}
+
+	if err = tu.Verify(user, code); err != nil {
+		if errors.Is(err, utils.ErrTwoFactorCodeInvalid) {
+			return tu.recordFailure(ctx, user.ID, now)
+		}
+		return err
+	}
+
+	usedUp := bson.D{{Key: "$unset", Value: bson.D{
+		{Key: "two_factor_challenge_hash", Value: ""},
+		{Key: "two_factor_challenge_attempts", Value: ""},
+		{Key: "two_factor_failures", Value: ""},
+		{Key: "two_factor_locked_until", Value: ""},
+	}}}
+	_, err = users.UpdateOne(ctx, bson.D{{Key: "_id", Value: user.ID}, {Key: "two_factor_challenge_hash", Value: hash}}, usedUp)
+	return err
+}
+
+// recordFailure counts a wrong sign-in code and starts the lockout once TwoFactorMaxFailures
+// is reached. It returns the error VerifyChallenge reports for the code.
+func (tu *twoFactorUseCase) recordFailure(ctx context.Context, userID bson.ObjectID, now time.Time) error {
+	users := tu.userBaseRepository.GetDatabase().Collection(domain.CollectionUser)
+
+	update := bson.D{{Key: "$inc", Value: bson.D{{Key: "two_factor_failures", Value: 1}}}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var user domain.User
+	if err := users.FindOneAndUpdate(ctx, bson.D{{Key: "_id", Value: userID}}, update, opts).Decode(&user); err != nil {
+		return err
+	}
+	if user.TwoFactorFailures < domain.TwoFactorMaxFailures {
+		return utils.ErrTwoFactorCodeInvalid
+	}
+
+	filter := bson.D{
+		{Key: "_id", Value: userID},
+		{Key: "two_factor_failures", Value: bson.D{{Key: "$gte", Value: domain.TwoFactorMaxFailures}}},
+	}
+	lock := bson.D{
+		{Key: "$set", Value: bson.D{{Key: "two_factor_locked_until", Value: now.Add(domain.TwoFactorLockoutDuration)}}},
+		{Key: "$unset", Value: bson.D{{Key: "two_factor_failures", Value: ""}}},
+	}
+	if _, err := users.UpdateOne(ctx, filter, lock); err != nil {
+		return err
+	}
+
+	return utils.ErrTwoFactorLocked
+}
+
+func (tu *twoFactorUseCase) Disable(user *domain.User, code string) error {
+	if err := tu.Verify(user, code); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.D{
+		{Key: "$set", Value: bson.D{{Key: "totp_enabled", Value: false}}},
+		{Key: "$unset", Value: bson.D{
+			{Key: "totp_secret", Value: ""},
+			{Key: "totp_pending_secret", Value: ""},
+			{Key: "totp_last_step", Value: ""},
+			{Key: "recovery_code_hashes", Value: ""},
+		}},
+	}
+	return tu.userBaseRepository.UpdateOne(ctx, bson.D{{Key: "_id", Value: user.ID}}, update, nil)
+}
+
+func (tu *twoFactorUseCase) RegenerateRecoveryCodes(user *domain.User, code string) ([]string, error) {
+	if err := tu.Verify(user, code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.D{{Key: "_id", Value: user.ID}, {Key: "totp_enabled", Value: true}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "recovery_code_hashes", Value: hashes}}}}
+	if err = tu.userBaseRepository.UpdateOne(ctx, filter, update, nil); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+func newRecoveryCodes() ([]string, []string, error) {
+	codes, err := utils.GenerateRecoveryCodes(domain.RecoveryCodeCount)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = utils.HashToken(code)
+	}
+	return codes, hashes, nil
+}
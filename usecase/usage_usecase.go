@@ -2,24 +2,58 @@ package usecase
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
 	"time"
 
 	"github.com/kwa0x2/SmartSRT-Backend/config"
 	"github.com/kwa0x2/SmartSRT-Backend/domain"
+	"github.com/kwa0x2/SmartSRT-Backend/domain/types"
+	"github.com/kwa0x2/SmartSRT-Backend/utils"
 	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.mongodb.org/mongo-driver/v2/mongo/writeconcern"
 )
 
 type usageUseCase struct {
-	env                 *config.Env
-	usageBaseRepository domain.BaseRepository[*domain.Usage]
-	userBaseRepository  domain.BaseRepository[*domain.User]
+	env                        *config.Env
+	usageBaseRepository        domain.BaseRepository[*domain.Usage]
+	userBaseRepository         domain.BaseRepository[*domain.User]
+	reservationBaseRepository  domain.BaseRepository[*domain.UsageReservation]
+	periodBaseRepository       domain.BaseRepository[*domain.UsagePeriod]
+	subscriptionBaseRepository domain.BaseRepository[*domain.Subscription]
+	ledgerBaseRepository       domain.BaseRepository[*domain.UsageLedgerEntry]
+	orgBaseRepository          domain.BaseRepository[*domain.Organization]
+	resendUseCase              domain.ResendUseCase
+	planUseCase                domain.PlanUseCase
 }
 
-func NewUsageUseCase(env *config.Env, usageBaseRepository domain.BaseRepository[*domain.Usage], userBaseRepository domain.BaseRepository[*domain.User]) domain.UsageUseCase {
+func NewUsageUseCase(
+	env *config.Env,
+	usageBaseRepository domain.BaseRepository[*domain.Usage],
+	userBaseRepository domain.BaseRepository[*domain.User],
+	reservationBaseRepository domain.BaseRepository[*domain.UsageReservation],
+	periodBaseRepository domain.BaseRepository[*domain.UsagePeriod],
+	subscriptionBaseRepository domain.BaseRepository[*domain.Subscription],
+	ledgerBaseRepository domain.BaseRepository[*domain.UsageLedgerEntry],
+	orgBaseRepository domain.BaseRepository[*domain.Organization],
+	resendUseCase domain.ResendUseCase,
+	planUseCase domain.PlanUseCase,
+) domain.UsageUseCase {
 	return &usageUseCase{
-		env:                 env,
-		usageBaseRepository: usageBaseRepository,
-		userBaseRepository:  userBaseRepository,
+		env:                        env,
+		usageBaseRepository:        usageBaseRepository,
+		userBaseRepository:         userBaseRepository,
+		reservationBaseRepository:  reservationBaseRepository,
+		periodBaseRepository:       periodBaseRepository,
+		subscriptionBaseRepository: subscriptionBaseRepository,
+		ledgerBaseRepository:       ledgerBaseRepository,
+		orgBaseRepository:          orgBaseRepository,
+		resendUseCase:              resendUseCase,
+		planUseCase:                planUseCase,
 	}
 }
 
@@ -34,23 +68,831 @@ func (uu *usageUseCase) FindOneByUserID(userID bson.ObjectID) (*domain.Usage, er
 	return uu.usageBaseRepository.FindOne(ctx, filter)
 }
 
-func (uu *usageUseCase) UpdateUsage(ctx context.Context, userID bson.ObjectID, duration float64) error {
+// ReserveUsage holds the file's seconds against the monthly limit plus the minute pack balance.
+// The limit check and the increment happen in a single conditional update, so concurrent
+// uploads cannot overshoot.
+func (uu *usageUseCase) ReserveUsage(userID bson.ObjectID, fileID string, duration float64) error {
+	wc := writeconcern.Majority()
+	txnOptions := options.Transaction().SetWriteConcern(wc)
 
-	filter := bson.D{{Key: "user_id", Value: userID}}
-	update := bson.D{
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	session, err := uu.usageBaseRepository.GetDatabase().Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(txCtx context.Context) (interface{}, error) {
+		filter := bson.D{
+			{Key: "user_id", Value: userID},
+			{Key: "$expr", Value: bson.D{{Key: "$lte", Value: bson.A{
+				bson.D{{Key: "$add", Value: bson.A{"$monthly_usage", bson.D{{Key: "$ifNull", Value: bson.A{"$reserved_usage", 0}}}, duration}}},
+				bson.D{{Key: "$add", Value: bson.A{"$usage_limit", bson.D{{Key: "$ifNull", Value: bson.A{"$bonus_balance", 0}}}}}},
+			}}}},
+		}
+		update := bson.D{{Key: "$inc", Value: bson.D{{Key: "reserved_usage", Value: duration}}}}
+
+		if _, err := uu.usageBaseRepository.FindOneAndUpdate(txCtx, filter, update, nil); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return nil, utils.ErrLimitReached
+			}
+			return nil, err
+		}
+
+		now := time.Now().UTC()
+		reservation := &domain.UsageReservation{
+			UserID:    userID,
+			FileID:    fileID,
+			Seconds:   duration,
+			Status:    types.ReservationReserved,
+			ExpiresAt: now.Add(domain.ReservationTTL),
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+
+		if err := reservation.Validate(); err != nil {
+			return nil, err
+		}
+
+		return nil, uu.reservationBaseRepository.Create(txCtx, reservation)
+	}, txnOptions)
+
+	return err
+}
+
+func (uu *usageUseCase) FindActiveReservation(fileID string) (*domain.UsageReservation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.D{
+		{Key: "file_id", Value: fileID},
+		{Key: "status", Value: types.ReservationReserved},
+	}
+
+	reservation, err := uu.reservationBaseRepository.FindOne(ctx, filter)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, utils.ErrReservationNotActive
+		}
+		return nil, err
+	}
+
+	return reservation, nil
+}
+
+func (uu *usageUseCase) ExtendReservation(fileID string, fileDuration float64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.D{
+		{Key: "file_id", Value: fileID},
+		{Key: "status", Value: types.ReservationReserved},
+	}
+	expiresAt := time.Now().UTC().Add(domain.ReservationProcessingTTL(fileDuration))
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "expires_at", Value: expiresAt}}}}
+
+	if _, err := uu.reservationBaseRepository.FindOneAndUpdate(ctx, filter, update, nil); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return utils.ErrReservationNotActive
+		}
+		return err
+	}
+
+	return nil
+}
+
+// CommitReservation turns the reserved seconds into real usage. It must run inside
+// the caller's transaction so the charge lands together with the SRT history record.
+func (uu *usageUseCase) CommitReservation(ctx context.Context, fileID string) error {
+	filter := bson.D{
+		{Key: "file_id", Value: fileID},
+		{Key: "status", Value: types.ReservationReserved},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "status", Value: types.ReservationCommitted}}}}
+
+	reservation, err := uu.reservationBaseRepository.FindOneAndUpdate(ctx, filter, update, nil)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return utils.ErrReservationNotActive
+		}
+		return err
+	}
+
+	usageFilter := bson.D{{Key: "user_id", Value: reservation.UserID}}
+
+	current, err := uu.usageBaseRepository.FindOne(ctx, usageFilter)
+	if err != nil {
+		return err
+	}
+
+	// the monthly allowance is consumed first, whatever does not fit comes out of the pack balance.
+	// If the balance shrank since the reservation, the rest is charged to the month as overage,
+	// so every committed second is counted and recorded in the ledger.
+	fromBonus := min(max(reservation.Seconds-max(current.UsageLimit-current.MonthlyUsage, 0), 0), max(current.BonusBalance, 0))
+	fromMonthly := reservation.Seconds - fromBonus
+
+	usageUpdate := bson.D{
 		{Key: "$inc", Value: bson.D{
-			{Key: "monthly_usage", Value: duration},
-			{Key: "total_usage", Value: duration},
+			{Key: "reserved_usage", Value: -reservation.Seconds},
+			{Key: "monthly_usage", Value: fromMonthly},
+			{Key: "bonus_balance", Value: -fromBonus},
+			{Key: "total_usage", Value: reservation.Seconds},
+		}},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	usage, err := uu.usageBaseRepository.FindOneAndUpdate(ctx, usageFilter, usageUpdate, opts)
+	if err != nil {
+		return err
+	}
+
+	return uu.recordLedgerEntry(ctx, &domain.UsageLedgerEntry{
+		UserID:       reservation.UserID,
+		Type:         types.LedgerCharge,
+		FileID:       fileID,
+		Seconds:      fromMonthly,
+		BalanceAfter: usage.MonthlyUsage,
+		BonusSeconds: -fromBonus,
+		BonusAfter:   usage.BonusBalance,
+		Reason:       "conversion",
+	})
+}
+
+// AdjustUsage never takes monthly usage below zero.
+func (uu *usageUseCase) AdjustUsage(userID bson.ObjectID, fileID string, seconds float64, reason string) error {
+	return uu.withTransaction(func(txCtx context.Context) error {
+		usage, err := uu.usageBaseRepository.FindOne(txCtx, bson.D{{Key: "user_id", Value: userID}})
+		if err != nil {
+			return err
+		}
+
+		if seconds < -usage.MonthlyUsage {
+			seconds = -usage.MonthlyUsage
+		}
+
+		filter := bson.D{{Key: "user_id", Value: userID}}
+		update := bson.D{{Key: "$inc", Value: bson.D{
+			{Key: "monthly_usage", Value: seconds},
+			{Key: "total_usage", Value: seconds},
+		}}}
+		opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+		usage, err = uu.usageBaseRepository.FindOneAndUpdate(txCtx, filter, update, opts)
+		if err != nil {
+			return err
+		}
+
+		entryType := types.LedgerAdjustment
+		if seconds < 0 && fileID != "" {
+			entryType = types.LedgerRefund
+		}
+
+		return uu.recordLedgerEntry(txCtx, &domain.UsageLedgerEntry{
+			UserID:       userID,
+			Type:         entryType,
+			FileID:       fileID,
+			Seconds:      seconds,
+			BalanceAfter: usage.MonthlyUsage,
+			BonusAfter:   usage.BonusBalance,
+			Reason:       reason,
+		})
+	})
+}
+
+// ReleaseReservation hands the reserved seconds of a job that did not complete back and
+// records the refund in the ledger. Nothing was charged yet, so monthly usage is unchanged.
+func (uu *usageUseCase) ReleaseReservation(fileID string, reason types.ReleaseReason) error {
+	wc := writeconcern.Majority()
+	txnOptions := options.Transaction().SetWriteConcern(wc)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	session, err := uu.reservationBaseRepository.GetDatabase().Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(txCtx context.Context) (interface{}, error) {
+		filter := bson.D{
+			{Key: "file_id", Value: fileID},
+			{Key: "status", Value: types.ReservationReserved},
+		}
+		update := bson.D{{Key: "$set", Value: bson.D{
+			{Key: "status", Value: types.ReservationReleased},
+			{Key: "release_reason", Value: reason},
+		}}}
+
+		reservation, err := uu.reservationBaseRepository.FindOneAndUpdate(txCtx, filter, update, nil)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return nil, utils.ErrReservationNotActive
+			}
+			return nil, err
+		}
+
+		usageFilter := bson.D{{Key: "user_id", Value: reservation.UserID}}
+		usageUpdate := bson.D{{Key: "$inc", Value: bson.D{{Key: "reserved_usage", Value: -reservation.Seconds}}}}
+		opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+		usage, err := uu.usageBaseRepository.FindOneAndUpdate(txCtx, usageFilter, usageUpdate, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, uu.recordLedgerEntry(txCtx, &domain.UsageLedgerEntry{
+			UserID:       reservation.UserID,
+			Type:         types.LedgerRefund,
+			FileID:       fileID,
+			BalanceAfter: usage.MonthlyUsage,
+			BonusAfter:   usage.BonusBalance,
+			Released:     reservation.Seconds,
+			Reason:       "reservation_" + string(reason),
+		})
+	}, txnOptions)
+
+	return err
+}
+
+func (uu *usageUseCase) ReleaseExpiredReservations() (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.D{
+		{Key: "status", Value: types.ReservationReserved},
+		{Key: "expires_at", Value: bson.D{{Key: "$lt", Value: time.Now().UTC()}}},
+	}
+
+	expired, err := uu.reservationBaseRepository.Find(ctx, filter, options.Find().SetLimit(100))
+	if err != nil {
+		return 0, err
+	}
+
+	released := 0
+	for _, reservation := range expired {
+		if err = uu.ReleaseReservation(reservation.FileID, types.ReleaseExpired); err != nil {
+			if errors.Is(err, utils.ErrReservationNotActive) {
+				continue
+			}
+			return released, err
+		}
+		released++
+	}
+
+	return released, nil
+}
+
+// StartNewPeriod archives the user's current period and opens [start, end) with the plan's limit.
+// The counter is only reset when the current period started before start, so replayed
+// webhooks and concurrent sweeps cannot reset it twice; the plan and its limit are applied
+// either way, so a plan change within the current period still takes effect.
+func (uu *usageUseCase) StartNewPeriod(ctx context.Context, userID bson.ObjectID, plan types.PlanType, start, end time.Time) error {
+	planData, err := uu.planUseCase.FindByName(plan)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.D{
+		{Key: "user_id", Value: userID},
+		{Key: "start_date", Value: bson.D{{Key: "$lt", Value: start}}},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "plan", Value: plan},
+		{Key: "start_date", Value: start},
+		{Key: "end_date", Value: end},
+		{Key: "usage_limit", Value: planData.MonthlySeconds},
+		{Key: "monthly_usage", Value: 0},
+		{Key: "notified_thresholds", Value: bson.A{}},
+		{Key: "period_start_notified", Value: false},
+	}}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.Before)
+
+	previous, err := uu.usageBaseRepository.FindOneAndUpdate(ctx, filter, update, opts)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			planFilter := bson.D{{Key: "user_id", Value: userID}}
+			planUpdate := bson.D{{Key: "$set", Value: bson.D{
+				{Key: "plan", Value: plan},
+				{Key: "usage_limit", Value: planData.MonthlySeconds},
+			}}}
+			return uu.usageBaseRepository.UpdateOne(ctx, planFilter, planUpdate, nil)
+		}
+		return err
+	}
+
+	reason := "period_rollover"
+	if previous.Plan != plan {
+		reason = "plan_change"
+	}
+	if err = uu.recordLedgerEntry(ctx, &domain.UsageLedgerEntry{
+		UserID:     userID,
+		Type:       types.LedgerReset,
+		Seconds:    -previous.MonthlyUsage,
+		BonusAfter: previous.BonusBalance,
+		Reason:     reason,
+	}); err != nil {
+		return err
+	}
+
+	closedAt := previous.EndDate
+	if closedAt.IsZero() || closedAt.After(start) {
+		closedAt = start
+	}
+
+	now := time.Now().UTC()
+	period := &domain.UsagePeriod{
+		UserID:     userID,
+		Plan:       previous.Plan,
+		StartDate:  previous.StartDate,
+		EndDate:    closedAt,
+		Usage:      previous.MonthlyUsage,
+		UsageLimit: previous.UsageLimit,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	if err = period.Validate(); err != nil {
+		return err
+	}
+
+	return uu.periodBaseRepository.Create(ctx, period)
+}
+
+// RolloverDuePeriods opens the next period for every usage whose period has ended.
+// Subscribed accounts follow the Paddle billing period and wait for it to advance; the rest
+// move to the rolling 30-day window that contains now. Due usages are paged by _id, so the
+// subscribed accounts that keep waiting cannot starve the ones behind them.
+func (uu *usageUseCase) RolloverDuePeriods() (int, error) {
+	now := time.Now().UTC()
+	after := bson.NilObjectID
+
+	rolled := 0
+	for {
+		pageRolled, last, more, err := uu.rolloverDuePage(now, after)
+		rolled += pageRolled
+		if err != nil || !more {
+			return rolled, err
+		}
+		after = last
+	}
+}
+
+// rolloverDuePage rolls over one page of due usages with _id greater than after and reports
+// the last _id it saw and whether another page may follow.
+func (uu *usageUseCase) rolloverDuePage(now time.Time, after bson.ObjectID) (int, bson.ObjectID, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.D{
+		{Key: "_id", Value: bson.D{{Key: "$gt", Value: after}}},
+		{Key: "$or", Value: bson.A{
+			bson.D{{Key: "end_date", Value: bson.D{{Key: "$lte", Value: now}}}},
+			bson.D{
+				{Key: "end_date", Value: bson.D{{Key: "$exists", Value: false}}},
+				{Key: "start_date", Value: bson.D{{Key: "$lte", Value: now.Add(-domain.UsagePeriodLength)}}},
+			},
+		}},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(domain.UsageSweepPageSize)
+
+	due, err := uu.usageBaseRepository.Find(ctx, filter, opts)
+	if err != nil {
+		return 0, after, false, err
+	}
+
+	rolled := 0
+	for _, usage := range due {
+		after = usage.ID
+
+		plan, found, err := uu.findAccountPlan(ctx, usage.UserID)
+		if err != nil {
+			return rolled, after, false, err
+		}
+		if !found {
+			continue
+		}
+
+		start, end, ok, err := uu.nextPeriod(ctx, usage, now)
+		if err != nil {
+			return rolled, after, false, err
+		}
+		if !ok {
+			continue
+		}
+
+		if err = uu.withTransaction(func(txCtx context.Context) error {
+			return uu.StartNewPeriod(txCtx, usage.UserID, plan, start, end)
+		}); err != nil {
+			return rolled, after, false, err
+		}
+		rolled++
+	}
+
+	return rolled, after, len(due) == domain.UsageSweepPageSize, nil
+}
+
+// findAccountPlan resolves the plan of the user or organization a usage pool belongs to.
+func (uu *usageUseCase) findAccountPlan(ctx context.Context, accountID bson.ObjectID) (types.PlanType, bool, error) {
+	user, err := uu.userBaseRepository.FindOne(ctx, bson.D{{Key: "_id", Value: accountID}})
+	if err == nil {
+		return user.Plan, true, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return "", false, err
+	}
+
+	org, err := uu.orgBaseRepository.FindOne(ctx, bson.D{{Key: "_id", Value: accountID}})
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+
+	return org.Plan, true, nil
+}
+
+func (uu *usageUseCase) nextPeriod(ctx context.Context, usage *domain.Usage, now time.Time) (time.Time, time.Time, bool, error) {
+	// paid plans follow their subscription, everything else uses rolling 30-day windows
+	subscription, err := uu.subscriptionBaseRepository.FindOne(ctx, bson.D{{Key: "user_id", Value: usage.UserID}})
+	if err == nil {
+		billingPeriod := subscription.CurrentBillingPeriod
+		if !billingPeriod.StartsAt.After(usage.StartDate) || billingPeriod.StartsAt.After(now) {
+			// Paddle has not renewed the subscription yet, subscription.updated will roll it over
+			return time.Time{}, time.Time{}, false, nil
+		}
+		return billingPeriod.StartsAt, billingPeriod.EndsAt, true, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return time.Time{}, time.Time{}, false, err
+	}
+
+	start := usage.EndDate
+	if start.IsZero() {
+		start = usage.StartDate.Add(domain.UsagePeriodLength)
+	}
+	for !start.Add(domain.UsagePeriodLength).After(now) {
+		start = start.Add(domain.UsagePeriodLength)
+	}
+
+	return start, start.Add(domain.UsagePeriodLength), true, nil
+}
+
+func (uu *usageUseCase) withTransaction(fn func(txCtx context.Context) error) error {
+	wc := writeconcern.Majority()
+	txnOptions := options.Transaction().SetWriteConcern(wc)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	session, err := uu.usageBaseRepository.GetDatabase().Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(txCtx context.Context) (interface{}, error) {
+		return nil, fn(txCtx)
+	}, txnOptions)
+
+	return err
+}
+
+// CreditMinutePack adds a purchased minute pack to the user's bonus balance. The Paddle
+// transaction ID is unique in the ledger, so a redelivered webhook is credited only once.
+func (uu *usageUseCase) CreditMinutePack(userID bson.ObjectID, transactionID string, seconds float64) error {
+	err := uu.withTransaction(func(txCtx context.Context) error {
+		filter := bson.D{{Key: "user_id", Value: userID}}
+		update := bson.D{{Key: "$inc", Value: bson.D{{Key: "bonus_balance", Value: seconds}}}}
+		opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+		usage, err := uu.usageBaseRepository.FindOneAndUpdate(txCtx, filter, update, opts)
+		if err != nil {
+			return err
+		}
+
+		return uu.recordLedgerEntry(txCtx, &domain.UsageLedgerEntry{
+			UserID:        userID,
+			Type:          types.LedgerPurchase,
+			BalanceAfter:  usage.MonthlyUsage,
+			BonusSeconds:  seconds,
+			BonusAfter:    usage.BonusBalance,
+			TransactionID: transactionID,
+			Reason:        "minute_pack",
+		})
+	})
+
+	if mongo.IsDuplicateKeyError(err) {
+		return nil
+	}
+
+	return err
+}
+
+// dailyLedgerTotal is one (day, entry type) group of the usage history aggregation.
+type dailyLedgerTotal struct {
+	ID struct {
+		Date string                `bson:"date"`
+		Type types.LedgerEntryType `bson:"type"`
+	} `bson:"_id"`
+	Seconds      float64 `bson:"seconds"`
+	BonusSeconds float64 `bson:"bonus_seconds"`
+	Count        int     `bson:"count"`
+}
+
+// FindHistory returns the ledger entries in [from, to) together with per-day totals.
+// Daily totals are aggregated by the database and always cover the whole range; only the
+// latest UsageHistoryMaxItems entries are loaded.
+func (uu *usageUseCase) FindHistory(userID bson.ObjectID, from, to time.Time) (*domain.UsageHistory, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.D{
+		{Key: "user_id", Value: userID},
+		{Key: "created_at", Value: bson.D{
+			{Key: "$gte", Value: from},
+			{Key: "$lt", Value: to},
 		}},
 	}
 
-	return uu.usageBaseRepository.UpdateOne(ctx, filter, update, nil)
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: bson.D{
+				{Key: "date", Value: bson.D{{Key: "$dateToString", Value: bson.D{
+					{Key: "format", Value: "%Y-%m-%d"},
+					{Key: "date", Value: "$created_at"},
+				}}}},
+				{Key: "type", Value: "$type"},
+			}},
+			{Key: "seconds", Value: bson.D{{Key: "$sum", Value: "$seconds"}}},
+			{Key: "bonus_seconds", Value: bson.D{{Key: "$sum", Value: "$bonus_seconds"}}},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "_id.date", Value: 1}}}},
+	}
+
+	cursor, err := uu.ledgerBaseRepository.GetDatabase().Collection(domain.CollectionUsageLedger).Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	var totals []dailyLedgerTotal
+	if err = cursor.All(ctx, &totals); err != nil {
+		return nil, err
+	}
+
+	history := &domain.UsageHistory{
+		From:  from,
+		To:    to,
+		Daily: []domain.DailyUsage{},
+	}
+
+	for _, total := range totals {
+		if len(history.Daily) == 0 || history.Daily[len(history.Daily)-1].Date != total.ID.Date {
+			history.Daily = append(history.Daily, domain.DailyUsage{Date: total.ID.Date})
+		}
+
+		day := &history.Daily[len(history.Daily)-1]
+		switch total.ID.Type {
+		case types.LedgerCharge:
+			day.Charged += total.Seconds - total.BonusSeconds
+			day.Jobs += total.Count
+		case types.LedgerRefund:
+			day.Refunded -= total.Seconds
+		case types.LedgerAdjustment:
+			day.Adjusted += total.Seconds
+		case types.LedgerPurchase:
+			day.Purchased += total.BonusSeconds
+		}
+	}
+
+	// one extra entry tells whether the list was cut
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetLimit(domain.UsageHistoryMaxItems + 1)
+
+	entries, err := uu.ledgerBaseRepository.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(entries) > domain.UsageHistoryMaxItems {
+		entries = entries[:domain.UsageHistoryMaxItems]
+		history.Truncated = true
+	}
+	slices.Reverse(entries)
+	history.Entries = entries
+
+	return history, nil
+}
+
+func (uu *usageUseCase) recordLedgerEntry(ctx context.Context, entry *domain.UsageLedgerEntry) error {
+	entry.CreatedAt = time.Now().UTC()
+
+	if err := entry.Validate(); err != nil {
+		return err
+	}
+
+	return uu.ledgerBaseRepository.Create(ctx, entry)
+}
+
+// SendUsageNotifications emails users whose period just started or who crossed a usage
+// threshold. Each notification is claimed before it is sent, so it fires at most once per
+// period even with several consumers running.
+func (uu *usageUseCase) SendUsageNotifications() (int, error) {
+	sent, err := uu.sendPeriodStartedNotifications()
+	if err != nil {
+		return sent, err
+	}
+
+	thresholdSent, err := uu.sendThresholdNotifications()
+	return sent + thresholdSent, err
+}
+
+func (uu *usageUseCase) sendPeriodStartedNotifications() (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.D{{Key: "period_start_notified", Value: false}}
+	pending, err := uu.usageBaseRepository.Find(ctx, filter, options.Find().SetLimit(100))
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, usage := range pending {
+		claimFilter := bson.D{
+			{Key: "user_id", Value: usage.UserID},
+			{Key: "period_start_notified", Value: false},
+		}
+		claimUpdate := bson.D{{Key: "$set", Value: bson.D{{Key: "period_start_notified", Value: true}}}}
+
+		if _, err = uu.usageBaseRepository.FindOneAndUpdate(ctx, claimFilter, claimUpdate, nil); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				continue
+			}
+			return sent, err
+		}
+
+		user, ok, err := uu.findNotifiableUser(ctx, usage.UserID)
+		if err != nil {
+			return sent, err
+		}
+		if !ok {
+			continue
+		}
+
+		if _, err = uu.resendUseCase.SendUsagePeriodStartedEmail(user.Email, usage.UsageLimit, usage.EndDate, uu.usageLink()); err != nil {
+			slog.Warn("Usage period email could not be sent",
+				slog.String("user_id", usage.UserID.Hex()),
+				slog.String("error", err.Error()))
+			continue
+		}
+		sent++
+	}
+
+	return sent, nil
+}
+
+func (uu *usageUseCase) sendThresholdNotifications() (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	thresholds := uu.notifyThresholds()
+	if len(thresholds) == 0 {
+		return 0, nil
+	}
+
+	// only accounts whose highest crossed threshold is not notified yet match, so the ones
+	// already emailed for their current threshold cannot fill the page
+	branches := bson.A{}
+	for i, threshold := range thresholds {
+		highest := bson.A{usageCrossesThreshold(threshold)}
+		if i+1 < len(thresholds) {
+			highest = append(highest, bson.D{{Key: "$not", Value: bson.A{usageCrossesThreshold(thresholds[i+1])}}})
+		}
+
+		branches = append(branches, bson.D{
+			{Key: "$expr", Value: bson.D{{Key: "$and", Value: highest}}},
+			{Key: "notified_thresholds", Value: bson.D{{Key: "$ne", Value: threshold}}},
+		})
+	}
+
+	filter := bson.D{{Key: "$or", Value: branches}}
+	pending, err := uu.usageBaseRepository.Find(ctx, filter, options.Find().SetLimit(100))
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, usage := range pending {
+		var crossed []int
+		for _, threshold := range thresholds {
+			if usage.MonthlyUsage*100 >= usage.UsageLimit*float64(threshold) {
+				crossed = append(crossed, threshold)
+			}
+		}
+		if len(crossed) == 0 {
+			continue
+		}
+
+		// only the highest crossed threshold is emailed, lower ones are marked as sent with it
+		highest := crossed[len(crossed)-1]
+		if slices.Contains(usage.NotifiedThresholds, highest) {
+			continue
+		}
+
+		claimFilter := bson.D{
+			{Key: "user_id", Value: usage.UserID},
+			{Key: "start_date", Value: usage.StartDate},
+			{Key: "notified_thresholds", Value: bson.D{{Key: "$ne", Value: highest}}},
+		}
+		claimUpdate := bson.D{{Key: "$addToSet", Value: bson.D{
+			{Key: "notified_thresholds", Value: bson.D{{Key: "$each", Value: crossed}}},
+		}}}
+
+		if _, err = uu.usageBaseRepository.FindOneAndUpdate(ctx, claimFilter, claimUpdate, nil); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				continue
+			}
+			return sent, err
+		}
+
+		user, ok, err := uu.findNotifiableUser(ctx, usage.UserID)
+		if err != nil {
+			return sent, err
+		}
+		if !ok {
+			continue
+		}
+
+		if _, err = uu.resendUseCase.SendUsageThresholdEmail(user.Email, highest, usage.MonthlyUsage, usage.UsageLimit, usage.EndDate, uu.usageLink()); err != nil {
+			slog.Warn("Usage threshold email could not be sent",
+				slog.String("user_id", usage.UserID.Hex()),
+				slog.Int("threshold", highest),
+				slog.String("error", err.Error()))
+			continue
+		}
+		sent++
+	}
+
+	return sent, nil
 }
 
-func (uu *usageUseCase) CheckUsageLimit(userID bson.ObjectID, duration float64) (bool, error) {
-	usage, err := uu.FindOneByUserID(userID)
+// findNotifiableUser resolves who hears about an account's usage: the user itself, or the
+// owner for an organization. It reports false for deleted accounts and users who opted out.
+func (uu *usageUseCase) findNotifiableUser(ctx context.Context, accountID bson.ObjectID) (*domain.User, bool, error) {
+	user, err := uu.userBaseRepository.FindOne(ctx, bson.D{{Key: "_id", Value: accountID}})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		org, orgErr := uu.orgBaseRepository.FindOne(ctx, bson.D{{Key: "_id", Value: accountID}})
+		if orgErr != nil {
+			if errors.Is(orgErr, mongo.ErrNoDocuments) {
+				return nil, false, nil
+			}
+			return nil, false, orgErr
+		}
+		user, err = uu.userBaseRepository.FindOne(ctx, bson.D{{Key: "_id", Value: org.OwnerID}})
+	}
 	if err != nil {
-		return false, err
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, false, nil
+		}
+		return nil, false, err
 	}
-	return (usage.MonthlyUsage + duration) <= usage.UsageLimit, nil
+
+	return user, !user.UsageEmailsOptOut, nil
+}
+
+// usageCrossesThreshold is an aggregation expression matching usages at or above threshold percent of their limit.
+func usageCrossesThreshold(threshold int) bson.D {
+	return bson.D{{Key: "$gte", Value: bson.A{
+		bson.D{{Key: "$multiply", Value: bson.A{"$monthly_usage", 100}}},
+		bson.D{{Key: "$multiply", Value: bson.A{"$usage_limit", threshold}}},
+	}}}
+}
+
+// notifyThresholds returns the configured thresholds sorted ascending, ignoring values outside 1-100.
+func (uu *usageUseCase) notifyThresholds() []int {
+	configured := uu.env.UsageNotifyThresholds
+	if len(configured) == 0 {
+		configured = domain.DefaultUsageNotifyThresholds
+	}
+
+	thresholds := make([]int, 0, len(configured))
+	for _, threshold := range configured {
+		if threshold > 0 && threshold <= 100 && !slices.Contains(thresholds, threshold) {
+			thresholds = append(thresholds, threshold)
+		}
+	}
+	slices.Sort(thresholds)
+
+	return thresholds
+}
+
+func (uu *usageUseCase) usageLink() string {
+	return fmt.Sprintf("%s/en/dashboard", uu.env.FrontEndURL)
 }
@@ -3,6 +3,7 @@ package usecase
 import (
 	"context"
 	"errors"
+	"log/slog"
 	"time"
 
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
@@ -11,16 +12,20 @@ import (
 	"github.com/kwa0x2/SmartSRT-Backend/config"
 	"github.com/kwa0x2/SmartSRT-Backend/domain"
 	"github.com/kwa0x2/SmartSRT-Backend/domain/types"
+	"github.com/kwa0x2/SmartSRT-Backend/utils"
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 )
 
 type userUseCase struct {
-	env                 *config.Env
-	userBaseRepository  domain.BaseRepository[*domain.User]
-	usageBaseRepository domain.BaseRepository[*domain.Usage]
-	srtBaseRepository   domain.BaseRepository[*domain.SRTHistory]
-	paddleUseCase       domain.PaddleUseCase
+	env                   *config.Env
+	userBaseRepository    domain.BaseRepository[*domain.User]
+	usageBaseRepository   domain.BaseRepository[*domain.Usage]
+	srtBaseRepository     domain.BaseRepository[*domain.SRTHistory]
+	erasureBaseRepository domain.BaseRepository[*domain.Erasure]
+	paddleUseCase         domain.PaddleUseCase
+	usageUseCase          domain.UsageUseCase
+	planUseCase           domain.PlanUseCase
 }
 
 func NewUserUseCase(
@@ -28,14 +33,20 @@ func NewUserUseCase(
 	userBaseRepository domain.BaseRepository[*domain.User],
 	usageBaseRepository domain.BaseRepository[*domain.Usage],
 	srtBaseRepository domain.BaseRepository[*domain.SRTHistory],
+	erasureBaseRepository domain.BaseRepository[*domain.Erasure],
 	paddleUseCase domain.PaddleUseCase,
+	usageUseCase domain.UsageUseCase,
+	planUseCase domain.PlanUseCase,
 ) domain.UserUseCase {
 	return &userUseCase{
-		env:                 env,
-		userBaseRepository:  userBaseRepository,
-		usageBaseRepository: usageBaseRepository,
-		srtBaseRepository:   srtBaseRepository,
-		paddleUseCase:       paddleUseCase,
+		env:                   env,
+		userBaseRepository:    userBaseRepository,
+		usageBaseRepository:   usageBaseRepository,
+		srtBaseRepository:     srtBaseRepository,
+		erasureBaseRepository: erasureBaseRepository,
+		paddleUseCase:         paddleUseCase,
+		usageUseCase:          usageUseCase,
+		planUseCase:           planUseCase,
 	}
 }
 
@@ -52,12 +63,17 @@ func (uu *userUseCase) Create(user *domain.User) error {
 	}
 	defer session.EndSession(ctx)
 
+	plan, err := uu.planUseCase.FindDefault()
+	if err != nil {
+		return err
+	}
+
 	_, err = session.WithTransaction(ctx, func(txCtx context.Context) (interface{}, error) {
 		now := time.Now().UTC()
 
 		user.CreatedAt = now
 		user.UpdatedAt = now
-		user.Plan = types.Free
+		user.Plan = plan.Name
 
 		if err = user.Validate(); err != nil {
 			return nil, err
@@ -76,13 +92,16 @@ func (uu *userUseCase) Create(user *domain.User) error {
 		}
 
 		usage := &domain.Usage{
-			UserID:       user.ID,
-			StartDate:    now,
-			MonthlyUsage: float64(0),
-			TotalUsage:   float64(0),
-			UsageLimit:   types.GetMonthlyLimit(user.Plan, uu.env),
-			CreatedAt:    now,
-			UpdatedAt:    now,
+			UserID:              user.ID,
+			Plan:                user.Plan,
+			StartDate:           now,
+			EndDate:             now.Add(domain.UsagePeriodLength),
+			MonthlyUsage:        float64(0),
+			TotalUsage:          float64(0),
+			UsageLimit:          plan.MonthlySeconds,
+			PeriodStartNotified: true, // the first period needs no renewal email
+			CreatedAt:           now,
+			UpdatedAt:           now,
 		}
 
 		if err = uu.usageBaseRepository.Create(txCtx, usage); err != nil {
@@ -111,18 +130,6 @@ func (uu *userUseCase) FindOneByID(id bson.ObjectID) (*domain.User, error) {
 	return uu.userBaseRepository.FindOne(ctx, filter)
 }
 
-func (uu *userUseCase) FindOneByEmailAndAuthType(email string, authType types.AuthType) (*domain.User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	filter := bson.D{
-		{Key: "email", Value: email},
-		{Key: "auth_type", Value: authType},
-	}
-
-	return uu.userBaseRepository.FindOne(ctx, filter)
-}
-
 func (uu *userUseCase) IsEmailExists(email string) (bool, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -157,14 +164,13 @@ func (uu *userUseCase) IsPhoneExists(phone string) (bool, error) {
 	return true, nil
 }
 
+// UpdateCredentialsPasswordByID sets the password of credentials login. Users of any auth
+// type can set one, it becomes another login method next to their linked identities.
 func (uu *userUseCase) UpdateCredentialsPasswordByID(id bson.ObjectID, newPassword string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	filter := bson.D{
-		{Key: "_id", Value: id},
-		{Key: "auth_type", Value: types.Credentials},
-	}
+	filter := bson.D{{Key: "_id", Value: id}}
 	update := bson.D{{Key: "$set", Value: bson.D{{Key: "password", Value: newPassword}}}}
 
 	return uu.userBaseRepository.UpdateOne(ctx, filter, update, nil)
@@ -200,12 +206,8 @@ func (uu *userUseCase) UpdatePlanAndUsageLimitByID(id bson.ObjectID, plan types.
 			return nil, err
 		}
 
-		userIDFilter := bson.D{{Key: "user_id", Value: id}}
-		usageUpdate := bson.D{{Key: "$set", Value: bson.D{
-			{Key: "usage_limit", Value: types.GetMonthlyLimit(plan, uu.env)},
-			{Key: "monthly_usage", Value: 0},
-		}}}
-		if err := uu.usageBaseRepository.UpdateOne(txCtx, userIDFilter, usageUpdate, nil); err != nil {
+		now := time.Now().UTC()
+		if err := uu.usageUseCase.StartNewPeriod(txCtx, id, plan, now, now.Add(domain.UsagePeriodLength)); err != nil {
 			return nil, err
 		}
 
@@ -215,6 +217,190 @@ func (uu *userUseCase) UpdatePlanAndUsageLimitByID(id bson.ObjectID, plan types.
 	return err
 }
 
+func (uu *userUseCase) UpdateUsageEmailsOptOutByID(id bson.ObjectID, optOut bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.D{{Key: "_id", Value: id}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "usage_emails_opt_out", Value: optOut}}}}
+
+	return uu.userBaseRepository.UpdateOne(ctx, filter, update, nil)
+}
+
+func (uu *userUseCase) UpdateProfile(id bson.ObjectID, update domain.ProfileUpdate) (*domain.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	set := bson.D{}
+	if update.Name != nil {
+		set = append(set, bson.E{Key: "name", Value: *update.Name})
+	}
+	if update.PhoneNumber != nil {
+		set = append(set, bson.E{Key: "phone_number", Value: *update.PhoneNumber})
+	}
+
+	filter := bson.D{{Key: "_id", Value: id}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	return uu.userBaseRepository.FindOneAndUpdate(ctx, filter, bson.D{{Key: "$set", Value: set}}, opts)
+}
+
+// ChangeEmail applies the change only while the user still has oldEmail, so a confirmation
+// link cannot be replayed after a later change. The Paddle customer is updated once the change
+// is committed; until that succeeds the user is marked for SyncPendingCustomerEmails.
+func (uu *userUseCase) ChangeEmail(id bson.ObjectID, oldEmail, newEmail string) (*domain.User, error) {
+	wc := writeconcern.Majority()
+	txnOptions := options.Transaction().SetWriteConcern(wc)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	session, err := uu.userBaseRepository.GetDatabase().Client().StartSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.EndSession(ctx)
+
+	result, err := session.WithTransaction(ctx, func(txCtx context.Context) (interface{}, error) {
+		// a deleted account that can still be restored keeps its address
+		if _, err := uu.userBaseRepository.FindOneDeleted(txCtx, bson.D{{Key: "email", Value: newEmail}}); err == nil {
+			return nil, utils.ErrEmailTaken
+		} else if !errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, err
+		}
+
+		filter := bson.D{{Key: "_id", Value: id}, {Key: "email", Value: oldEmail}}
+		update := bson.D{{Key: "$set", Value: bson.D{{Key: "email", Value: newEmail}}}}
+		opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+		user, err := uu.userBaseRepository.FindOneAndUpdate(txCtx, filter, update, opts)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return nil, utils.ErrEmailChangeInvalid
+			}
+			if mongo.IsDuplicateKeyError(err) {
+				return nil, utils.ErrEmailTaken
+			}
+			return nil, err
+		}
+
+		if user.CustomerID != "" {
+			pending := bson.D{
+				{Key: "$set", Value: bson.D{{Key: "customer_email_pending", Value: true}}},
+				{Key: "$unset", Value: bson.D{
+					{Key: "customer_email_attempts", Value: ""},
+					{Key: "customer_email_retry_at", Value: ""},
+					{Key: "customer_email_sync_error", Value: ""},
+				}},
+			}
+			if err = uu.userBaseRepository.UpdateOne(txCtx, bson.D{{Key: "_id", Value: id}}, pending, nil); err != nil {
+				return nil, err
+			}
+			user.CustomerEmailPending = true
+		}
+
+		return user, nil
+	}, txnOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	user := result.(*domain.User)
+	if user.CustomerEmailPending {
+		if err = uu.syncCustomerEmail(ctx, user); err != nil {
+			uu.recordCustomerEmailFailure(ctx, user, err)
+		}
+	}
+
+	return user, nil
+}
+
+func (uu *userUseCase) SyncPendingCustomerEmails() (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	filter := bson.D{
+		{Key: "customer_email_pending", Value: true},
+		{Key: "$or", Value: bson.A{
+			bson.D{{Key: "customer_email_retry_at", Value: bson.D{{Key: "$exists", Value: false}}}},
+			bson.D{{Key: "customer_email_retry_at", Value: bson.D{{Key: "$lte", Value: time.Now().UTC()}}}},
+		}},
+	}
+	users, err := uu.userBaseRepository.Find(ctx, filter, options.Find().SetLimit(100))
+	if err != nil {
+		return 0, err
+	}
+
+	synced := 0
+	for _, user := range users {
+		if err = uu.syncCustomerEmail(ctx, user); err != nil {
+			uu.recordCustomerEmailFailure(ctx, user, err)
+			continue
+		}
+		synced++
+	}
+
+	return synced, nil
+}
+
+// syncCustomerEmail copies the user's email to the Paddle customer. The pending mark is only
+// cleared while the email is unchanged, a newer change keeps it for its own sync.
+func (uu *userUseCase) syncCustomerEmail(ctx context.Context, user *domain.User) error {
+	if err := uu.paddleUseCase.UpdateCustomerEmail(user.CustomerID, user.Email); err != nil {
+		return err
+	}
+
+	filter := bson.D{{Key: "_id", Value: user.ID}, {Key: "email", Value: user.Email}}
+	update := bson.D{{Key: "$unset", Value: bson.D{
+		{Key: "customer_email_pending", Value: ""},
+		{Key: "customer_email_attempts", Value: ""},
+		{Key: "customer_email_retry_at", Value: ""},
+	}}}
+
+	return uu.userBaseRepository.UpdateOne(ctx, filter, update, nil)
+}
+
+// recordCustomerEmailFailure stops retrying an update Paddle rejected and reports it, since
+// sending it again fails the same way. Other failures are retried with an exponential
+// backoff capped at CustomerEmailMaxBackoff.
+func (uu *userUseCase) recordCustomerEmailFailure(ctx context.Context, user *domain.User, syncErr error) {
+	filter := bson.D{{Key: "_id", Value: user.ID}, {Key: "email", Value: user.Email}}
+
+	var update bson.D
+	if errors.Is(syncErr, utils.ErrPaddleRequestRejected) {
+		slog.Error("Paddle rejected the customer email update, it needs to be resolved manually",
+			slog.String("user_id", user.ID.Hex()),
+			slog.String("customer_id", user.CustomerID),
+			slog.String("error", syncErr.Error()))
+
+		update = bson.D{
+			{Key: "$set", Value: bson.D{{Key: "customer_email_sync_error", Value: syncErr.Error()}}},
+			{Key: "$unset", Value: bson.D{
+				{Key: "customer_email_pending", Value: ""},
+				{Key: "customer_email_attempts", Value: ""},
+				{Key: "customer_email_retry_at", Value: ""},
+			}},
+		}
+	} else {
+		slog.Warn("Paddle customer email could not be updated, the consumer retries it",
+			slog.String("user_id", user.ID.Hex()),
+			slog.Int("attempts", user.CustomerEmailAttempts+1),
+			slog.String("error", syncErr.Error()))
+
+		backoff := min(time.Minute<<min(user.CustomerEmailAttempts, 10), domain.CustomerEmailMaxBackoff)
+		update = bson.D{{Key: "$set", Value: bson.D{
+			{Key: "customer_email_attempts", Value: user.CustomerEmailAttempts + 1},
+			{Key: "customer_email_retry_at", Value: time.Now().UTC().Add(backoff)},
+		}}}
+	}
+
+	if err := uu.userBaseRepository.UpdateOne(ctx, filter, update, nil); err != nil {
+		slog.Error("Failed to record Paddle customer email failure",
+			slog.String("user_id", user.ID.Hex()),
+			slog.String("error", err.Error()))
+	}
+}
+
 func (uu *userUseCase) UpdateCustomerIDByEmail(email string, customerID string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -225,7 +411,9 @@ func (uu *userUseCase) UpdateCustomerIDByEmail(email string, customerID string)
 	return uu.userBaseRepository.UpdateOne(ctx, filter, update, nil)
 }
 
-func (uu *userUseCase) DeleteUser(userID bson.ObjectID) error {
+// DeleteUser soft-deletes the account and schedules its erasure. The account can be restored
+// until the erasure is due.
+func (uu *userUseCase) DeleteUser(userID bson.ObjectID, cancelledSubscription *domain.Subscription) (*domain.Erasure, error) {
 	wc := writeconcern.Majority()
 	txnOptions := options.Transaction().SetWriteConcern(wc)
 
@@ -234,11 +422,14 @@ func (uu *userUseCase) DeleteUser(userID bson.ObjectID) error {
 
 	session, err := uu.userBaseRepository.GetDatabase().Client().StartSession()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer session.EndSession(ctx)
 
-	_, err = session.WithTransaction(ctx, func(txCtx context.Context) (interface{}, error) {
+	result, err := session.WithTransaction(ctx, func(txCtx context.Context) (interface{}, error) {
+		// taken before the soft deletions, a restore brings back everything deleted since
+		now := time.Now().UTC()
+
 		userFilter := bson.D{{Key: "_id", Value: userID}}
 		if err = uu.userBaseRepository.SoftDelete(txCtx, userFilter); err != nil {
 			return nil, err
@@ -249,20 +440,157 @@ func (uu *userUseCase) DeleteUser(userID bson.ObjectID) error {
 			return nil, err
 		}
 
-		srtFilter := bson.D{{Key: "user_id", Value: userID}}
+		// conversions made inside organizations belong to the team and stay visible to it
+		srtFilter := bson.D{
+			{Key: "user_id", Value: userID},
+			{Key: "org_id", Value: bson.D{{Key: "$exists", Value: false}}},
+		}
 		if err = uu.srtBaseRepository.SoftDelete(txCtx, srtFilter); err != nil {
 			return nil, err
 		}
 
-		return nil, nil
+		// the account is erased for good once the grace period is over
+		scheduledAt := now.Add(domain.ErasureGracePeriod(uu.env))
+		erasure := &domain.Erasure{
+			UserID:        userID,
+			Status:        types.ErasureScheduled,
+			RequestedAt:   now,
+			ScheduledAt:   scheduledAt,
+			NextAttemptAt: scheduledAt,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}
+		if cancelledSubscription != nil {
+			erasure.CancelledSubscription = &domain.CancelledSubscription{
+				SubscriptionID: cancelledSubscription.SubscriptionID,
+				ProductName:    cancelledSubscription.ProductName,
+				PaidUntil:      cancelledSubscription.CurrentBillingPeriod.EndsAt,
+			}
+		}
+		if err = erasure.Validate(); err != nil {
+			return nil, err
+		}
+		if err = uu.erasureBaseRepository.Create(txCtx, erasure); err != nil {
+			return nil, err
+		}
+
+		return erasure, nil
 	}, txnOptions)
 
 	if err != nil {
 		if abortErr := session.AbortTransaction(ctx); abortErr != nil {
-			return abortErr
+			return nil, abortErr
 		}
-		return err
+		return nil, err
+	}
+
+	return result.(*domain.Erasure), nil
+}
+
+// FindRestorableByEmail returns a deleted user whose account can still be restored.
+func (uu *userUseCase) FindRestorableByEmail(email string) (*domain.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := uu.userBaseRepository.FindOneDeleted(ctx, bson.D{{Key: "email", Value: email}})
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = uu.erasureBaseRepository.FindOne(ctx, restorableErasureFilter(user.ID)); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// FindRestorableByID is FindRestorableByEmail for users found through a linked identity.
+func (uu *userUseCase) FindRestorableByID(id bson.ObjectID) (*domain.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := uu.userBaseRepository.FindOneDeleted(ctx, bson.D{{Key: "_id", Value: id}})
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	if _, err = uu.erasureBaseRepository.FindOne(ctx, restorableErasureFilter(user.ID)); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// RestoreUser undoes DeleteUser while the erasure is not due yet. The returned erasure tells
+// which subscription was cancelled with the account, it is not restarted.
+func (uu *userUseCase) RestoreUser(userID bson.ObjectID, erasureID *bson.ObjectID) (*domain.Erasure, error) {
+	wc := writeconcern.Majority()
+	txnOptions := options.Transaction().SetWriteConcern(wc)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	session, err := uu.userBaseRepository.GetDatabase().Client().StartSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.EndSession(ctx)
+
+	result, err := session.WithTransaction(ctx, func(txCtx context.Context) (interface{}, error) {
+		now := time.Now().UTC()
+		update := bson.D{{Key: "$set", Value: bson.D{
+			{Key: "status", Value: types.ErasureCancelled},
+			{Key: "cancelled_at", Value: now},
+		}}}
+		erasureFilter := restorableErasureFilter(userID)
+		if erasureID != nil {
+			erasureFilter = append(erasureFilter, bson.E{Key: "_id", Value: *erasureID})
+		}
+		erasure, err := uu.erasureBaseRepository.FindOneAndUpdate(txCtx, erasureFilter, update, nil)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return nil, utils.ErrAccountNotRestorable
+			}
+			return nil, err
+		}
+
+		if err = uu.userBaseRepository.Restore(txCtx, bson.D{{Key: "_id", Value: userID}}); err != nil {
+			return nil, err
+		}
+
+		if err = uu.usageBaseRepository.Restore(txCtx, bson.D{{Key: "user_id", Value: userID}}); err != nil {
+			return nil, err
+		}
+
+		// conversions the user had deleted before deleting the account stay deleted
+		srtFilter := bson.D{
+			{Key: "user_id", Value: userID},
+			{Key: "org_id", Value: bson.D{{Key: "$exists", Value: false}}},
+			{Key: "$and", Value: bson.A{
+				bson.D{{Key: "deleted_at", Value: bson.D{{Key: "$gte", Value: erasure.RequestedAt}}}},
+			}},
+		}
+		if err = uu.srtBaseRepository.Restore(txCtx, srtFilter); err != nil {
+			return nil, err
+		}
+
+		return erasure, nil
+	}, txnOptions)
+
+	if err != nil {
+		if abortErr := session.AbortTransaction(ctx); abortErr != nil {
+			return nil, abortErr
+		}
+		return nil, err
+	}
+
+	return result.(*domain.Erasure), nil
+}
+
+func restorableErasureFilter(userID bson.ObjectID) bson.D {
+	return bson.D{
+		{Key: "user_id", Value: userID},
+		{Key: "status", Value: types.ErasureScheduled},
+		{Key: "scheduled_at", Value: bson.D{{Key: "$gt", Value: time.Now().UTC()}}},
+	}
 }
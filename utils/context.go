@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/kwa0x2/SmartSRT-Backend/domain"
+)
+
+// GetActiveOrganization returns the organization SessionMiddleware resolved for the request,
+// or nil when the user works in their personal account.
+func GetActiveOrganization(ctx *gin.Context) *domain.Organization {
+	org, exists := ctx.Get("organization")
+	if !exists {
+		return nil
+	}
+	return org.(*domain.Organization)
+}
+
+// GetMembership returns the user's membership in the active organization, nil without one.
+func GetMembership(ctx *gin.Context) *domain.OrganizationMember {
+	membership, exists := ctx.Get("membership")
+	if !exists {
+		return nil
+	}
+	return membership.(*domain.OrganizationMember)
+}
+
+// IsSandbox reports whether the request was authenticated with a test-mode API key.
+func IsSandbox(ctx *gin.Context) bool {
+	apiKey, exists := ctx.Get("api_key")
+	if !exists {
+		return false
+	}
+	return apiKey.(*domain.APIKey).Sandbox
+}
@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"encoding/base64"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+type cursor struct {
+	Sort  string        `bson:"s"`
+	Value any           `bson:"v"`
+	ID    bson.ObjectID `bson:"id"`
+}
+
+type rawCursor struct {
+	Sort  string        `bson:"s"`
+	Value bson.RawValue `bson:"v"`
+	ID    bson.ObjectID `bson:"id"`
+}
+
+// EncodeCursor packs the sort value and _id of the last returned document into an opaque
+// token. BSON keeps the value's type, so dates and numbers compare correctly on the way back.
+func EncodeCursor(sort string, value any, id bson.ObjectID) (string, error) {
+	data, err := bson.Marshal(cursor{Sort: sort, Value: value, ID: id})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// DecodeCursor reverses EncodeCursor. A token issued for a different sort, or whose value is
+// not of valueType, is rejected, so a crafted value such as a document cannot act as a query operator.
+func DecodeCursor(token, sort string, valueType bson.Type) (bson.RawValue, bson.ObjectID, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return bson.RawValue{}, bson.NilObjectID, ErrCursorInvalid
+	}
+
+	var c rawCursor
+	if err = bson.Unmarshal(data, &c); err != nil || c.Sort != sort || c.Value.Type != valueType || c.ID.IsZero() {
+		return bson.RawValue{}, bson.NilObjectID, ErrCursorInvalid
+	}
+	return c.Value, c.ID, nil
+}
@@ -1,9 +1,13 @@
 package utils
 
 import (
+	"fmt"
+	"html"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/kwa0x2/SmartSRT-Backend/domain"
 )
@@ -54,3 +58,93 @@ func LoadSRTCreatedEmailTemplate(SRTLink string) (string, error) {
 		"[SRTLink]": SRTLink,
 	})
 }
+
+func LoadUsageThresholdEmailTemplate(percent int, usedSeconds, limitSeconds float64, periodEnd time.Time, usageLink string) (string, error) {
+	return loadTemplate("usage_threshold.html", map[string]string{
+		"[percent]":      strconv.Itoa(percent),
+		"[usedMinutes]":  formatMinutes(usedSeconds),
+		"[limitMinutes]": formatMinutes(limitSeconds),
+		"[periodEnd]":    periodEnd.Format("January 2, 2006"),
+		"[usageURL]":     usageLink,
+	})
+}
+
+func LoadUsagePeriodEmailTemplate(limitSeconds float64, periodEnd time.Time, usageLink string) (string, error) {
+	return loadTemplate("usage_period.html", map[string]string{
+		"[limitMinutes]": formatMinutes(limitSeconds),
+		"[periodEnd]":    periodEnd.Format("January 2, 2006"),
+		"[usageURL]":     usageLink,
+	})
+}
+
+// LoadOrganizationInvitationEmailTemplate escapes the names since both are chosen by users.
+func LoadOrganizationInvitationEmailTemplate(orgName, inviterName, role string, expiresAt time.Time, inviteLink string) (string, error) {
+	return loadTemplate("organization_invitation.html", map[string]string{
+		"[orgName]":     html.EscapeString(orgName),
+		"[inviterName]": html.EscapeString(inviterName),
+		"[role]":        role,
+		"[expiresAt]":   expiresAt.Format("January 2, 2006"),
+		"[inviteURL]":   inviteLink,
+	})
+}
+
+func LoadRetentionWarningEmailTemplate(count int, deleteAt time.Time, historyLink string) (string, error) {
+	return loadTemplate("retention_warning.html", map[string]string{
+		"[count]":      strconv.Itoa(count),
+		"[deleteDate]": deleteAt.Format("January 2, 2006"),
+		"[historyURL]": historyLink,
+	})
+}
+
+func LoadAccountDeletedEmailTemplate(restoreUntil time.Time, restoreLink string) (string, error) {
+	return loadTemplate("account_deleted.html", map[string]string{
+		"[restoreDate]": restoreUntil.Format("January 2, 2006"),
+		"[restoreURL]":  restoreLink,
+	})
+}
+
+// LoadAccountRestoredEmailTemplate reports a subscription that was cancelled with the account,
+// restoring the account does not restart it.
+func LoadAccountRestoredEmailTemplate(cancelled *domain.CancelledSubscription, dashboardLink string) (string, error) {
+	notice := ""
+	if cancelled != nil {
+		notice = fmt.Sprintf("Your %s subscription was cancelled when the account was deleted and has not been restarted. You can subscribe again from your dashboard.",
+			html.EscapeString(cancelled.ProductName))
+	}
+
+	return loadTemplate("account_restored.html", map[string]string{
+		"[subscriptionNotice]": notice,
+		"[dashboardURL]":       dashboardLink,
+	})
+}
+
+func formatMinutes(seconds float64) string {
+	return fmt.Sprintf("%.0f", seconds/60)
+}
+
+func LoadDataExportEmailTemplate(expiresAt time.Time, downloadLink string) (string, error) {
+	return loadTemplate("data_export.html", map[string]string{
+		"[expireDate]":  expiresAt.Format("January 2, 2006"),
+		"[downloadURL]": downloadLink,
+	})
+}
+
+func LoadEmailChangeConfirmEmailTemplate(confirmLink string) (string, error) {
+	return loadTemplate("email_change_confirm.html", map[string]string{
+		"[confirmURL]": confirmLink,
+	})
+}
+
+// LoadEmailChangeNoticeEmailTemplate names the new address only partly, the old inbox may no
+// longer be in the user's hands.
+func LoadEmailChangeNoticeEmailTemplate(newEmail string) (string, error) {
+	return loadTemplate("email_change_notice.html", map[string]string{
+		"[newEmail]": html.EscapeString(MaskEmail(newEmail)),
+	})
+}
+
+func LoadPasskeyAddedEmailTemplate(passkeyName string) (string, error) {
+	return loadTemplate("passkey_added.html", map[string]string{
+		"[passkeyName]": html.EscapeString(passkeyName),
+	})
+}
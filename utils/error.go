@@ -5,3 +5,32 @@ import "errors"
 var ErrSessionExpired = errors.New("session is expired")
 var ErrSessionNotFound = errors.New("session not found in dynamodb")
 var ErrLimitReached = errors.New("monthly usage limit reached")
+var ErrReservationNotActive = errors.New("usage reservation not found or no longer active")
+var ErrPlanNotFound = errors.New("plan not found in catalogue")
+var ErrNotOrgMember = errors.New("user is not a member of the organization")
+var ErrOrgRoleForbidden = errors.New("organization role does not allow this action")
+var ErrInvitationInvalid = errors.New("invitation is invalid, revoked or expired")
+var ErrInvitationEmailMismatch = errors.New("invitation was sent to a different email address")
+var ErrInvitationExists = errors.New("a pending invitation already exists for this email")
+var ErrAlreadyOrgMember = errors.New("user is already a member of the organization")
+var ErrOrgOwnerImmutable = errors.New("organization owner cannot be changed or removed")
+var ErrOrgOwnerHasMembers = errors.New("user owns an organization that other members are still in")
+var ErrOrgPlanRequired = errors.New("creating an organization requires a paid plan")
+var ErrOrgLimitReached = errors.New("user already owns the maximum number of organizations")
+var ErrAPIKeyInvalid = errors.New("api key is invalid or revoked")
+var ErrCursorInvalid = errors.New("pagination cursor is invalid")
+var ErrAccountNotRestorable = errors.New("account is not deleted or its restore window has passed")
+var ErrDataExportInProgress = errors.New("a data export is already being prepared")
+var ErrAvatarInvalid = errors.New("avatar must be a JPEG, PNG or GIF image of supported size")
+var ErrEmailTaken = errors.New("email address is already used by another account")
+var ErrEmailChangeInvalid = errors.New("email change link is no longer valid")
+var ErrPaddleRequestRejected = errors.New("paddle rejected the request")
+var ErrIdentityLinked = errors.New("provider account is linked to another user")
+var ErrProviderLinked = errors.New("a different account of this provider is already linked")
+var ErrLastLoginMethod = errors.New("the last login method cannot be unlinked")
+var ErrTwoFactorEnabled = errors.New("two-factor authentication is already enabled")
+var ErrTwoFactorNotSetUp = errors.New("two-factor authentication is not set up")
+var ErrTwoFactorCodeInvalid = errors.New("two-factor code is invalid or already used")
+var ErrTwoFactorChallengeInvalid = errors.New("two-factor challenge is used up or had too many attempts")
+var ErrTwoFactorLocked = errors.New("two-factor sign-in is locked after too many wrong codes")
+var ErrPasskeyInvalid = errors.New("passkey response could not be verified")
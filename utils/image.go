@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+
+	"github.com/kwa0x2/SmartSRT-Backend/domain"
+)
+
+// ResizeAvatar decodes a JPEG, PNG or GIF image, crops it to a centred square and scales it
+// to size x size pixels. The result is PNG encoded so that transparency is kept.
+func ResizeAvatar(data []byte, size int) ([]byte, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || config.Width == 0 || config.Height == 0 || config.Width*config.Height > domain.AvatarMaxPixels {
+		return nil, ErrAvatarInvalid
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrAvatarInvalid
+	}
+
+	bounds := src.Bounds()
+	side := min(bounds.Dx(), bounds.Dy())
+	offset := image.Pt((bounds.Dx()-side)/2, (bounds.Dy()-side)/2)
+
+	square := image.NewRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(square, square.Bounds(), src, bounds.Min.Add(offset), draw.Src)
+
+	var out bytes.Buffer
+	if err = png.Encode(&out, scaleSquare(square, size)); err != nil {
+		return nil, err
+	}
+
+	return out.Bytes(), nil
+}
+
+// scaleSquare averages the source pixels covered by each target pixel. Smaller sources are
+// scaled up by repeating pixels. Averaging premultiplied values keeps transparent edges clean.
+func scaleSquare(src *image.RGBA, size int) *image.RGBA {
+	side := src.Bounds().Dx()
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+
+	for y := 0; y < size; y++ {
+		y0 := y * side / size
+		y1 := max((y+1)*side/size, y0+1)
+
+		for x := 0; x < size; x++ {
+			x0 := x * side / size
+			x1 := max((x+1)*side/size, x0+1)
+
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride+x0*4 : sy*src.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					sum[0] += int(row[i])
+					sum[1] += int(row[i+1])
+					sum[2] += int(row[i+2])
+					sum[3] += int(row[i+3])
+				}
+			}
+
+			count := (y1 - y0) * (x1 - x0)
+			i := dst.PixOffset(x, y)
+			for c := 0; c < 4; c++ {
+				dst.Pix[i+c] = uint8(sum[c] / count)
+			}
+		}
+	}
+
+	return dst
+}
@@ -6,15 +6,11 @@ import (
 	"github.com/kwa0x2/SmartSRT-Backend/config"
 )
 
-var secretKey []byte
-
 func GenerateJWT(jwtClaims jwt.MapClaims, env *config.Env, expUnixTime int64) (string, error) {
-	secretKey = []byte(env.JWTSecret)
-
 	jwtClaims["exp"] = expUnixTime
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwtClaims)
-	tokenString, err := token.SignedString(secretKey)
+	tokenString, err := token.SignedString([]byte(env.JWTSecret))
 	if err != nil {
 		return "", err
 	}
@@ -22,35 +18,26 @@ func GenerateJWT(jwtClaims jwt.MapClaims, env *config.Env, expUnixTime int64) (s
 	return tokenString, nil
 }
 
-func VerifyJWT(tokenString string) error {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return secretKey, nil
-	})
-
-	if err != nil {
-		return err
-	}
-
-	if !token.Valid {
-		return errors.New("invalid token")
+// GetClaims verifies a token signed by GenerateJWT with the given secret. Only HS256 is
+// accepted, and an empty secret never verifies anything.
+func GetClaims(tokenString string, secret string) (jwt.MapClaims, error) {
+	if secret == "" {
+		return nil, errors.New("jwt secret is not configured")
 	}
 
-	return nil
-}
-
-func GetClaims(tokenString string) (jwt.MapClaims, error) {
-	err := VerifyJWT(tokenString)
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, errors.New("unexpected signing method")
+		}
+		return []byte(secret), nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	claims := jwt.MapClaims{}
-	_, parseErr := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return secretKey, nil
-	})
-
-	if parseErr != nil {
-		return nil, parseErr
+	if !token.Valid {
+		return nil, errors.New("invalid token")
 	}
 
 	return claims, nil
@@ -44,6 +44,26 @@ func ParseUserIDFromCustomData(data map[string]interface{}) (bson.ObjectID, erro
 	return userID, nil
 }
 
+// ParseAccountIDFromCustomData extracts the account a checkout was made for: the organization
+// when custom data carries an org_id, the user otherwise
+func ParseAccountIDFromCustomData(data map[string]interface{}) (bson.ObjectID, error) {
+	customData, ok := data["custom_data"].(map[string]interface{})
+	if !ok {
+		return bson.ObjectID{}, fmt.Errorf("custom_data is not a valid map")
+	}
+
+	orgIDStr, ok := customData["org_id"].(string)
+	if !ok || orgIDStr == "" {
+		return ParseUserIDFromCustomData(data)
+	}
+
+	orgID, err := bson.ObjectIDFromHex(orgIDStr)
+	if err != nil {
+		return bson.ObjectID{}, fmt.Errorf("invalid org id format: %v", err)
+	}
+
+	return orgID, nil
+}
 
 // ParseProductAndPrice extracts product and price information from items array
 func ParseProductAndPrice(data map[string]interface{}) (string, string, string, string, string, error) {
@@ -110,3 +130,72 @@ func ParseBillingPeriod(data map[string]interface{}) (time.Time, time.Time, erro
 
 	return startsAt, endsAt, nil
 }
+
+// ParseMinutePacks parses "price_id:minutes" pairs into a map of price ID to bonus seconds
+func ParseMinutePacks(value string) (map[string]float64, error) {
+	packs := make(map[string]float64)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		priceID, minutes, found := strings.Cut(pair, ":")
+		if !found {
+			return nil, fmt.Errorf("invalid minute pack %q, expected price_id:minutes", pair)
+		}
+
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(minutes), 64)
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("invalid minutes for minute pack %q", pair)
+		}
+
+		packs[strings.TrimSpace(priceID)] = parsed * 60
+	}
+
+	return packs, nil
+}
+
+// ParseTransactionItems extracts price IDs and quantities from a transaction's items array
+func ParseTransactionItems(data map[string]interface{}) (map[string]int, error) {
+	items, ok := data["items"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid items format")
+	}
+
+	quantities := make(map[string]int)
+	for _, raw := range items {
+		item, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid item format")
+		}
+
+		price, ok := item["price"].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid price format")
+		}
+
+		priceID, ok := price["id"].(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid price id format")
+		}
+
+		quantity := 1
+		if value, ok := item["quantity"].(float64); ok && value > 0 {
+			quantity = int(value)
+		}
+
+		quantities[priceID] += quantity
+	}
+
+	return quantities, nil
+}
+
+// MaskEmail keeps the first character of the local part and the domain, e.g. j***@example.com.
+func MaskEmail(email string) string {
+	local, domain, found := strings.Cut(email, "@")
+	if !found || local == "" {
+		return "***"
+	}
+	return string([]rune(local)[:1]) + "***@" + domain
+}
@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"net/url"
+	"strings"
+)
+
+const maxRedirectPathLength = 512
+
+// SafeRedirectPath returns target when it is a path on the frontend, otherwise an empty string.
+// Absolute and protocol-relative URLs are refused, so that a sign-in link cannot send the user
+// to another site once they are signed in.
+func SafeRedirectPath(target string) string {
+	if target == "" || len(target) > maxRedirectPathLength {
+		return ""
+	}
+	// browsers read a backslash like a slash, "/\evil.com" would be protocol-relative
+	if !strings.HasPrefix(target, "/") || strings.HasPrefix(target, "//") || strings.ContainsAny(target, "\\") {
+		return ""
+	}
+	for _, r := range target {
+		if r < 0x20 || r == 0x7f {
+			return ""
+		}
+	}
+
+	parsed, err := url.Parse(target)
+	if err != nil || parsed.Scheme != "" || parsed.Host != "" || parsed.User != nil {
+		return ""
+	}
+
+	return target
+}
@@ -0,0 +1,26 @@
+package utils
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ObjectKeyFromURL extracts the object key from a virtual-hosted or path-style S3 object URL.
+func ObjectKeyFromURL(rawURL string) (string, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	key := strings.TrimPrefix(parsed.Path, "/")
+	if strings.HasPrefix(parsed.Host, "s3.") || strings.HasPrefix(parsed.Host, "s3-") {
+		// path-style URLs carry the bucket as the first path segment
+		_, key, _ = strings.Cut(key, "/")
+	}
+
+	if key == "" {
+		return "", fmt.Errorf("no object key in url %q", rawURL)
+	}
+	return key, nil
+}
@@ -25,6 +25,67 @@ func IsNormalBusinessError(err error) bool {
 		return true
 	}
 
+	// Usage related normal errors
+	if errors.Is(err, ErrLimitReached) || errors.Is(err, ErrReservationNotActive) {
+		return true
+	}
+
+	// Organization related normal errors
+	if errors.Is(err, ErrNotOrgMember) || errors.Is(err, ErrOrgRoleForbidden) || errors.Is(err, ErrOrgOwnerImmutable) || errors.Is(err, ErrOrgOwnerHasMembers) {
+		return true
+	}
+	if errors.Is(err, ErrOrgPlanRequired) || errors.Is(err, ErrOrgLimitReached) {
+		return true
+	}
+	if errors.Is(err, ErrInvitationInvalid) || errors.Is(err, ErrInvitationEmailMismatch) || errors.Is(err, ErrInvitationExists) || errors.Is(err, ErrAlreadyOrgMember) {
+		return true
+	}
+
+	// API key related normal errors
+	if errors.Is(err, ErrAPIKeyInvalid) {
+		return true
+	}
+
+	// Pagination related normal errors
+	if errors.Is(err, ErrCursorInvalid) {
+		return true
+	}
+
+	// Account restore related normal errors
+	if errors.Is(err, ErrAccountNotRestorable) {
+		return true
+	}
+
+	// Data export related normal errors
+	if errors.Is(err, ErrDataExportInProgress) {
+		return true
+	}
+
+	// Profile related normal errors
+	if errors.Is(err, ErrAvatarInvalid) {
+		return true
+	}
+
+	// Email change related normal errors
+	if errors.Is(err, ErrEmailTaken) || errors.Is(err, ErrEmailChangeInvalid) {
+		return true
+	}
+
+	// Linked identity related normal errors
+	if errors.Is(err, ErrIdentityLinked) || errors.Is(err, ErrProviderLinked) || errors.Is(err, ErrLastLoginMethod) {
+		return true
+	}
+
+	// Two-factor authentication related normal errors
+	if errors.Is(err, ErrTwoFactorEnabled) || errors.Is(err, ErrTwoFactorNotSetUp) || errors.Is(err, ErrTwoFactorCodeInvalid) || errors.Is(err, ErrTwoFactorChallengeInvalid) || errors.Is(err, ErrTwoFactorLocked) {
+		return true
+	}
+
+	// Passkey related normal errors
+	if errors.Is(err, ErrPasskeyInvalid) {
+		return true
+	}
+
 	// Common normal error patterns
 	normalErrorPatterns := []string{
 		"session not found",
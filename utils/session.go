@@ -83,3 +83,19 @@ func SetErrorCookie(ctx *gin.Context, value string, env *config.Env) {
 		SameSite: http.SameSiteLaxMode,
 	})
 }
+
+// SetOAuthBindingCookie ties started OAuth flows to the browser, callbacks only finish flows
+// whose binding matches the cookie.
+func SetOAuthBindingCookie(ctx *gin.Context, binding string, maxAge int, env *config.Env) {
+	isSecure := env.AppEnv == "production"
+	http.SetCookie(ctx.Writer, &http.Cookie{
+		Name:     "oauth_binding",
+		Value:    binding,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   isSecure,
+		Path:     "/",
+		Domain:   env.CookieDomain,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
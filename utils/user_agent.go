@@ -0,0 +1,55 @@
+package utils
+
+import "strings"
+
+// userAgentBrowsers and userAgentSystems are checked in order, since user agents name the
+// engines they are compatible with too. Edge also says Chrome and Safari, iOS says Mac OS X.
+var userAgentBrowsers = []struct{ token, name string }{
+	{"Edg", "Edge"},
+	{"OPR/", "Opera"},
+	{"SamsungBrowser/", "Samsung Internet"},
+	{"Firefox/", "Firefox"},
+	{"FxiOS/", "Firefox"},
+	{"CriOS/", "Chrome"},
+	{"Chrome/", "Chrome"},
+	{"Safari/", "Safari"},
+}
+
+var userAgentSystems = []struct{ token, name string }{
+	{"iPhone", "iOS"},
+	{"iPad", "iPadOS"},
+	{"Android", "Android"},
+	{"Windows", "Windows"},
+	{"CrOS", "ChromeOS"},
+	{"Macintosh", "macOS"},
+	{"Linux", "Linux"},
+}
+
+// DescribeDevice names the browser and operating system of a user agent, like "Chrome on macOS",
+// so that users recognise their sessions. Parts it does not know are left out.
+func DescribeDevice(userAgent string) string {
+	browser, system := "", ""
+	for _, candidate := range userAgentBrowsers {
+		if strings.Contains(userAgent, candidate.token) {
+			browser = candidate.name
+			break
+		}
+	}
+	for _, candidate := range userAgentSystems {
+		if strings.Contains(userAgent, candidate.token) {
+			system = candidate.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	default:
+		return "Unknown device"
+	}
+}
@@ -1,9 +1,21 @@
 package utils
 
 import (
+	"crypto/rand"
+	"encoding/base64"
+
 	"github.com/google/uuid"
 )
 
 func GenerateUUID() string {
 	return uuid.New().String()
 }
+
+// GenerateSecret returns n random bytes as URL-safe base64, for keys that must not be guessable.
+func GenerateSecret(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -3,8 +3,12 @@ package validator
 import (
 	"fmt"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kwa0x2/SmartSRT-Backend/domain"
+	"github.com/kwa0x2/SmartSRT-Backend/domain/types"
 )
 
 type ConversionParams struct {
@@ -43,3 +47,90 @@ func ValidateConversionParams(ctx *gin.Context) (*ConversionParams, error) {
 
 	return params, nil
 }
+
+// ValidateHistoryQuery parses the history listing query string. Dates use the YYYY-MM-DD
+// format and the 'to' date is inclusive; durations are in seconds.
+func ValidateHistoryQuery(ctx *gin.Context) (*domain.SRTHistoryQuery, error) {
+	query := &domain.SRTHistoryQuery{
+		FileName: strings.TrimSpace(ctx.Query("file_name")),
+		Sort:     types.SortNewest,
+		Cursor:   ctx.Query("cursor"),
+		Limit:    domain.SRTHistoryDefaultPageSize,
+	}
+
+	if val := ctx.Query("sort"); val != "" {
+		query.Sort = types.HistorySort(val)
+		if !query.Sort.IsValid() {
+			return nil, fmt.Errorf("sort must be one of newest, oldest, longest, shortest, name_asc or name_desc")
+		}
+	}
+
+	if val := ctx.Query("limit"); val != "" {
+		limit, err := strconv.Atoi(val)
+		if err != nil || limit < 1 || limit > domain.SRTHistoryMaxPageSize {
+			return nil, fmt.Errorf("limit must be between 1 and %d", domain.SRTHistoryMaxPageSize)
+		}
+		query.Limit = limit
+	}
+
+	if val := ctx.Query("from"); val != "" {
+		from, err := time.Parse(time.DateOnly, val)
+		if err != nil {
+			return nil, fmt.Errorf("invalid 'from' date, use the YYYY-MM-DD format")
+		}
+		query.From = &from
+	}
+
+	if val := ctx.Query("to"); val != "" {
+		to, err := time.Parse(time.DateOnly, val)
+		if err != nil {
+			return nil, fmt.Errorf("invalid 'to' date, use the YYYY-MM-DD format")
+		}
+		to = to.AddDate(0, 0, 1)
+		query.To = &to
+	}
+
+	if query.From != nil && query.To != nil && !query.From.Before(*query.To) {
+		return nil, fmt.Errorf("the 'from' date must not be after the 'to' date")
+	}
+
+	for field, ptr := range map[string]**float64{
+		"min_duration": &query.MinDuration,
+		"max_duration": &query.MaxDuration,
+	} {
+		if val := ctx.Query(field); val != "" {
+			seconds, err := strconv.ParseFloat(val, 64)
+			if err != nil || seconds < 0 {
+				return nil, fmt.Errorf("%s must be a non-negative number of seconds", field)
+			}
+			*ptr = &seconds
+		}
+	}
+
+	if query.MinDuration != nil && query.MaxDuration != nil && *query.MinDuration > *query.MaxDuration {
+		return nil, fmt.Errorf("min_duration must not be greater than max_duration")
+	}
+
+	if val := ctx.Query("words_per_line"); val != "" {
+		wpl, err := strconv.Atoi(val)
+		if err != nil || wpl < 1 || wpl > 5 {
+			return nil, fmt.Errorf("words per line must be between 1 and 5")
+		}
+		query.WordsPerLine = &wpl
+	}
+
+	for field, ptr := range map[string]**bool{
+		"punctuation":          &query.Punctuation,
+		"consider_punctuation": &query.ConsiderPunctuation,
+	} {
+		if val := ctx.Query(field); val != "" {
+			boolVal, err := strconv.ParseBool(val)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s value", field)
+			}
+			*ptr = &boolVal
+		}
+	}
+
+	return query, nil
+}